@@ -14,6 +14,8 @@ require (
 	github.com/lib/pq v1.1.1
 	github.com/pkg/errors v0.9.1
 	github.com/segmentio/ksuid v1.0.4
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/image v0.29.0
 	google.golang.org/api v0.246.0
 	gorm.io/gorm v1.25.11
 )
@@ -47,6 +47,47 @@ func init() {
 		TWILIO_SERVICES_ID: os.Getenv("TWILIO_SERVICES_ID"),
 		OPEN_AI_API_KEY:    os.Getenv("OPEN_AI_API_KEY"),
 		JWT_SECRET:         os.Getenv("JWT_SECRET"),
+		QR_SECRET:          os.Getenv("QR_SECRET"),
+		QR_BASE_URL:        os.Getenv("QR_BASE_URL"),
+		API_BASE_URL:       os.Getenv("API_BASE_URL"),
+
+		SESSION_IDLE_MINUTES:        os.Getenv("SESSION_IDLE_MINUTES"),
+		SESSION_PAID_GRACE_MINUTES:  os.Getenv("SESSION_PAID_GRACE_MINUTES"),
+		TABLE_CODE_ROTATION_MINUTES: os.Getenv("TABLE_CODE_ROTATION_MINUTES"),
+		TABLE_CODE_MAX_ATTEMPTS:     os.Getenv("TABLE_CODE_MAX_ATTEMPTS"),
+		TABLE_CODE_LOCK_MINUTES:     os.Getenv("TABLE_CODE_LOCK_MINUTES"),
+
+		TTS_PROVIDER: os.Getenv("TTS_PROVIDER"),
+		TTS_VOICE:    os.Getenv("TTS_VOICE"),
+
+		REVIEW_CLASSIFIER: os.Getenv("REVIEW_CLASSIFIER"),
+		FEEDBACK_ANALYSER: os.Getenv("FEEDBACK_ANALYSER"),
+
+		STORAGE_DRIVER:       os.Getenv("STORAGE_DRIVER"),
+		LOCAL_STORAGE_DIR:    os.Getenv("LOCAL_STORAGE_DIR"),
+		LOCAL_STORAGE_URL:    os.Getenv("LOCAL_STORAGE_URL"),
+		S3_ENDPOINT:          os.Getenv("S3_ENDPOINT"),
+		S3_REGION:            os.Getenv("S3_REGION"),
+		S3_BUCKET:            os.Getenv("S3_BUCKET"),
+		S3_ACCESS_KEY_ID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		S3_SECRET_ACCESS_KEY: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3_PUBLIC_URL:        os.Getenv("S3_PUBLIC_URL"),
+
+		FEEDBACK_LINK_URL:             os.Getenv("FEEDBACK_LINK_URL"),
+		FEEDBACK_PROMPT_DELAY_MINUTES: os.Getenv("FEEDBACK_PROMPT_DELAY_MINUTES"),
+		QUIET_HOURS_START:             os.Getenv("QUIET_HOURS_START"),
+		QUIET_HOURS_END:               os.Getenv("QUIET_HOURS_END"),
+
+		FIREBASE_AUTH_KEY: os.Getenv("FIREBASE_AUTH_KEY"),
+		SMTP_HOST:         os.Getenv("SMTP_HOST"),
+		SMTP_PORT:         os.Getenv("SMTP_PORT"),
+		SMTP_USERNAME:     os.Getenv("SMTP_USERNAME"),
+		SMTP_PASSWORD:     os.Getenv("SMTP_PASSWORD"),
+		SMTP_FROM:         os.Getenv("SMTP_FROM"),
+		WEBHOOK_SECRET:    os.Getenv("WEBHOOK_SECRET"),
+
+		SMS_PROVIDER: os.Getenv("SMS_PROVIDER"),
+		TWILIO_FROM:  os.Getenv("TWILIO_FROM"),
 	}
 
 	// Check if required variables are loaded
@@ -55,27 +96,36 @@ func init() {
 	} else {
 		fmt.Println("Successfully loaded environment variables from Lambda!")
 	}
+
+	// QR codes and upload tokens must not be signed with the JWT key
+	if config.QR_SECRET == "" || config.QR_SECRET == config.JWT_SECRET {
+		log.Fatalf("QR_SECRET must be set and differ from JWT_SECRET")
+	}
 }
 
 var fiberLambda *fiberadapter.FiberLambda
 
-// Middleware to extract and validate JWT
-func ExtractJWT(c *fiber.Ctx) error {
+// parseJWTClaims validates the bearer token in the Authorization header and
+// returns its claims. On failure the error response has already been written
+// and ok is false.
+func parseJWTClaims(c *fiber.Ctx) (jwt.MapClaims, bool) {
 	// Get Authorization header
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Missing Authorization header",
 		})
+		return nil, false
 	}
 
 	// Check if it's a Bearer token
 	if !strings.HasPrefix(authHeader, "Bearer ") {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Invalid Authorization header format",
 		})
+		return nil, false
 	}
 
 	// Extract token by removing "Bearer " prefix
@@ -92,19 +142,31 @@ func ExtractJWT(c *fiber.Ctx) error {
 
 	// Check for parsing or validation errors
 	if err != nil || !token.Valid {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Invalid or expired token",
 		})
+		return nil, false
 	}
 
 	// Extract claims (payload) from the token
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Failed to extract token claims",
 		})
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// Middleware to extract and validate JWT
+func ExtractJWT(c *fiber.Ctx) error {
+	claims, ok := parseJWTClaims(c)
+	if !ok {
+		return nil
 	}
 
 	// Example: Extract user phone number from claims
@@ -122,15 +184,40 @@ func ExtractJWT(c *fiber.Ctx) error {
 	return c.Next()
 }
 
+// Middleware to extract and validate admin JWT issued to cafe staff
+func ExtractAdminJWT(c *fiber.Ctx) error {
+	claims, ok := parseJWTClaims(c)
+	if !ok {
+		return nil
+	}
+
+	adminId, okAdmin := claims["admin_id"].(float64)
+	cafeId, okCafe := claims["cafe_id"].(float64)
+	if !okAdmin || !okCafe {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Token is not an admin token",
+		})
+	}
+
+	c.Locals("adminId", adminId)
+	c.Locals("cafeId", cafeId)
+
+	return c.Next()
+}
+
 func main() {
 	fmt.Println("Starting the server !!")
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		BodyLimit: 10 << 20, // Media uploads
+	})
 
 	// Use the CORS middleware
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: config.ORIGIN,
-		AllowMethods: "GET,POST,PUT,DELETE",
-		AllowHeaders: "Origin, Content-Type, Accept",
+		AllowOrigins:  config.ORIGIN,
+		AllowMethods:  "GET,POST,PUT,DELETE",
+		AllowHeaders:  "Origin, Content-Type, Accept, If-None-Match, X-Image-Size, X-Image-Accept",
+		ExposeHeaders: "ETag",
 	}))
 
 	DB_USERNAME := config.DB_USERNAME
@@ -160,7 +247,12 @@ func main() {
 	}
 
 	db = db.Debug()
-	db.AutoMigrate(&structures.User{}, &structures.Preference{}, &structures.MenuItem{}, &structures.ItemCustomization{}, &structures.CrossSell{}, &structures.CuratedCart{}, &structures.CuratedCartItem{}, &structures.Session{}, &structures.UserSession{}, &structures.Cart{}, &structures.CartItem{}, &structures.Order{}, &structures.Order{}, &structures.UpdateCartResult{}, &structures.MenuAIRecords{}, &structures.Discount{}, &structures.Cafe{}, &structures.ItemFeedback{}, &structures.CafeFeedback{}, &structures.CustomerRequest{}, &structures.TermsAndConditions{}, &structures.CafeAdvertisementClick{}, &structures.RewardTransaction{}, &structures.UpsellData{}, &structures.ItemFavorite{}, &structures.Category{})
+	db.AutoMigrate(&structures.User{}, &structures.Preference{}, &structures.MenuItem{}, &structures.ItemCustomization{}, &structures.CrossSell{}, &structures.CuratedCart{}, &structures.CuratedCartItem{}, &structures.Session{}, &structures.TableCodeAttempt{}, &structures.UserSession{}, &structures.Cart{}, &structures.CartItem{}, &structures.Order{}, &structures.Order{}, &structures.UpdateCartResult{}, &structures.MenuAIRecords{}, &structures.Discount{}, &structures.Cafe{}, &structures.CafeFeedback{}, &structures.CustomerRequest{}, &structures.TermsAndConditions{}, &structures.CafeAdvertisementClick{}, &structures.RewardTransaction{}, &structures.UpsellData{}, &structures.ItemFavorite{}, &structures.Category{}, &structures.SeatingArea{}, &structures.Table{}, &structures.CafeOperatingHours{}, &structures.CafeHoliday{}, &structures.Ingredient{}, &structures.RecipeItem{}, &structures.InventoryTransaction{}, &structures.MenuVersion{}, &structures.MenuItemPrice{}, &structures.CustomizationGroup{}, &structures.Label{}, &structures.MenuItemLabel{}, &structures.MenuItemTranslation{}, &structures.MediaAsset{}, &structures.CategoryPopularity{}, &structures.CafePopularitySettings{}, &structures.FeedbackTopic{}, &structures.FeedbackPrompt{}, &structures.NotificationChannel{}, &structures.NotificationTemplate{}, &structures.NotificationDelivery{}, &structures.QueuedJob{})
+	if err := server.RunMigrations(db); err != nil {
+		log.Fatalln("Migrations failed:", err)
+	}
+	// Their unique indexes need the duplicates removed by the migrations first
+	db.AutoMigrate(&structures.ItemFeedback{}, &structures.FcmToken{})
 	fmt.Println("Auto migration done!!")
 
 	defer db.Close()
@@ -177,46 +269,173 @@ func main() {
 	case "curatedCartCronJob":
 		svr.RunCuratedCartsJob(nil)
 		return
+	case "sessionExpiryJob":
+		svr.RunSessionExpiryJob(nil)
+		return
+	case "menuPublishJob":
+		svr.RunMenuPublishJob(nil)
+		return
+	case "labelMigrationJob":
+		svr.RunLabelMigrationJob(nil)
+		return
+	case "itemAudioJob":
+		svr.RunItemAudioJob(nil)
+		return
+	case "popularityJob":
+		svr.RunPopularityJob(nil)
+		return
+	case "ratingRebuildJob":
+		svr.RunRatingRebuildJob(nil)
+		return
+	case "feedbackAnalysisJob":
+		svr.RunFeedbackAnalysisJob(nil)
+		return
+	case "feedbackPromptJob":
+		svr.RunFeedbackPromptJob(nil)
+		return
+	case "jobWorker":
+		// Lambda runs the worker on a schedule, elsewhere it runs until stopped
+		for {
+			svr.RunJobWorker(nil)
+			if helper.IsLambda() {
+				return
+			}
+		}
 	default:
 		fmt.Println("Proceeding with normal server setup")
 	}
 
 	app.Get("/ping", svr.HealthCheck)
-	// Apply JWT middleware to protected routes
-	app.Post("/getCafeDetails", ExtractJWT, svr.GetCafeDetails)
-	app.Post("/upsellItem", ExtractJWT, svr.UpsellItem)
-	app.Post("/getUpsellAndCrossSell", ExtractJWT, svr.GetUpsellAndCrossSell)
-	app.Post("/askMenuAI", ExtractJWT, svr.AskMenuAI)
-	app.Post("/getMenu", ExtractJWT, svr.GetMenu)
-	app.Post("/getFilteredList", ExtractJWT, svr.GetFilteredList)
-	app.Post("/getCrossSellData", ExtractJWT, svr.GetCrossSellData)
-	app.Post("/checkSessionStatus", ExtractJWT, svr.CheckSessionStatus)
-	app.Post("/recordUserSession", ExtractJWT, svr.RecordUserSession)
+	if config.STORAGE_DRIVER == "local" {
+		app.Static("/media", config.LOCAL_STORAGE_DIR)
+	}
+	// Apply JWT and authorization middleware to protected routes
+	app.Post("/getCafeDetails", ExtractJWT, svr.AuthorizeSession, svr.GetCafeDetails)
+	app.Post("/upsellItem", ExtractJWT, svr.AuthorizeSession, svr.UpsellItem)
+	app.Post("/getUpsellAndCrossSell", ExtractJWT, svr.AuthorizeSession, svr.GetUpsellAndCrossSell)
+	app.Post("/askMenuAI", ExtractJWT, svr.AuthorizeSession, svr.AskMenuAI)
+	app.Post("/getMenu", ExtractJWT, svr.AuthorizeSession, svr.GetMenu)
+	app.Post("/getFilteredList", ExtractJWT, svr.AuthorizeSession, svr.GetFilteredList)
+	app.Post("/browseMenu", ExtractJWT, svr.AuthorizeSession, svr.BrowseMenu)
+	app.Post("/getCrossSellData", ExtractJWT, svr.AuthorizeSession, svr.GetCrossSellData)
+	app.Post("/checkSessionStatus", ExtractJWT, svr.AuthorizeTable, svr.CheckSessionStatus)
+	app.Post("/recordUserSession", ExtractJWT, svr.AuthorizeTable, svr.RecordUserSession)
 	app.Get("/curatedCartCronJob", svr.RunCuratedCartsJob)
-	app.Post("/getCuratedCart", ExtractJWT, svr.GetCuratedCart)
-	app.Post("/addToCart", ExtractJWT, svr.AddToCart)
-	app.Post("/getCart", ExtractJWT, svr.GetCart)
-	app.Post("/updateCustomizations", ExtractJWT, svr.UpdateCustomizations)
-	app.Post("/updateCrossSellItems", ExtractJWT, svr.UpdateCrossSellItems)
-	app.Post("/updateQuantity", ExtractJWT, svr.UpdateQuantity)
-	app.Post("/crossSellCheckout", ExtractJWT, svr.GetCheckoutCrossSells)
-	app.Post("/upgradeCart", ExtractJWT, svr.UpgradeCart)
-	app.Post("/getItemAudio", ExtractJWT, svr.GetItemAudio)
-	app.Post("/placeOrder", ExtractJWT, svr.PlaceOrder)
-	app.Post("/getUpsellData", ExtractJWT, svr.GetUpsellData)
-	app.Post("/fetchOrderDetails", ExtractJWT, svr.FetchOrderDetails)
-	app.Post("/invalidateSession", ExtractJWT, svr.InvalidateSession)
-	app.Post("/getFeedbackForm", ExtractJWT, svr.GetFeedbackForm)
-	app.Post("/submitFeedback", ExtractJWT, svr.SubmitFeedback)
-	app.Post("/callWaiter", ExtractJWT, svr.CallWaiter)
-	app.Post("/addSpecialRequest", ExtractJWT, svr.AddSpecialRequest)
-	app.Get("/acceptTermsAndConditions", ExtractJWT, svr.AcceptTermsAndConditions)
-	app.Post("/recordUserAdClick", ExtractJWT, svr.RecordUserAdClick)
-	app.Get("/getProfile", ExtractJWT, svr.GetProfile)
-	app.Post("/addFavouriteItem", ExtractJWT, svr.AddFavouriteItem)
-	// app.Get("/getFavouriteItems", ExtractJWT, svr.GetFavouriteItems)
-	app.Get("/getPersonalisedData", ExtractJWT, svr.GetPersonalisedData)
-	app.Post("/verifyTableCode", ExtractJWT, svr.VerifyTableCode)
+	app.Get("/sessionExpiryJob", svr.RunSessionExpiryJob)
+	app.Get("/menuPublishJob", svr.RunMenuPublishJob)
+	app.Get("/labelMigrationJob", svr.RunLabelMigrationJob)
+	app.Get("/itemAudioJob", svr.RunItemAudioJob)
+	app.Get("/popularityJob", svr.RunPopularityJob)
+	app.Get("/ratingRebuildJob", svr.RunRatingRebuildJob)
+	app.Get("/feedbackAnalysisJob", svr.RunFeedbackAnalysisJob)
+	app.Get("/feedbackPromptJob", svr.RunFeedbackPromptJob)
+	app.Get("/jobWorker", svr.RunJobWorker)
+	app.Post("/getCuratedCart", ExtractJWT, svr.AuthorizeSession, svr.GetCuratedCart)
+	app.Post("/addToCart", ExtractJWT, svr.AuthorizeSession, svr.AddToCart)
+	app.Post("/getCart", ExtractJWT, svr.AuthorizeSession, svr.GetCart)
+	app.Post("/updateCustomizations", ExtractJWT, svr.AuthorizeSession, svr.UpdateCustomizations)
+	app.Post("/updateCrossSellItems", ExtractJWT, svr.AuthorizeSession, svr.UpdateCrossSellItems)
+	app.Post("/updateQuantity", ExtractJWT, svr.AuthorizeSession, svr.UpdateQuantity)
+	app.Post("/crossSellCheckout", ExtractJWT, svr.AuthorizeSession, svr.GetCheckoutCrossSells)
+	app.Post("/upgradeCart", ExtractJWT, svr.AuthorizeSession, svr.UpgradeCart)
+	app.Get("/getDietaryProfile", ExtractJWT, svr.AuthorizeSession, svr.GetDietaryProfile)
+	app.Post("/saveDietaryProfile", ExtractJWT, svr.AuthorizeSession, svr.SaveDietaryProfile)
+	app.Post("/getItemAudio", ExtractJWT, svr.AuthorizeSession, svr.GetItemAudio)
+	app.Post("/createPaymentImageUpload", ExtractJWT, svr.AuthorizeSession, svr.CreatePaymentImageUpload)
+	app.Put("/uploadMedia", svr.UploadMedia)
+	app.Post("/placeOrder", ExtractJWT, svr.AuthorizeSession, svr.PlaceOrder)
+	app.Post("/getUpsellData", ExtractJWT, svr.AuthorizeSession, svr.GetUpsellData)
+	app.Post("/fetchOrderDetails", ExtractJWT, svr.AuthorizeSession, svr.FetchOrderDetails)
+	app.Post("/invalidateSession", ExtractJWT, svr.AuthorizeSession, svr.InvalidateSession)
+	app.Post("/getFeedbackForm", ExtractJWT, svr.AuthorizeSession, svr.GetFeedbackForm)
+	app.Post("/submitFeedback", ExtractJWT, svr.AuthorizeSession, svr.SubmitFeedback)
+	app.Get("/cafeReviews", svr.GetCafeReviews)
+	app.Get("/feedbackPrompt", svr.OpenFeedbackPrompt)
+	app.Get("/feedbackPromptOptOut", svr.FeedbackPromptOptOutPage)
+	app.Post("/feedbackPromptOptOut", svr.OptOutOfFeedbackPrompts)
+	app.Post("/setNotificationPreferences", ExtractJWT, svr.AuthorizeSession, svr.SetNotificationPreferences)
+	app.Post("/callWaiter", ExtractJWT, svr.AuthorizeSession, svr.CallWaiter)
+	app.Post("/addSpecialRequest", ExtractJWT, svr.AuthorizeSession, svr.AddSpecialRequest)
+	app.Get("/acceptTermsAndConditions", ExtractJWT, svr.AuthorizeSession, svr.AcceptTermsAndConditions)
+	app.Post("/recordUserAdClick", ExtractJWT, svr.AuthorizeSession, svr.RecordUserAdClick)
+	app.Get("/getProfile", ExtractJWT, svr.AuthorizeSession, svr.GetProfile)
+	app.Post("/addFavouriteItem", ExtractJWT, svr.AuthorizeSession, svr.AddFavouriteItem)
+	// app.Get("/getFavouriteItems", ExtractJWT, svr.AuthorizeSession, svr.GetFavouriteItems)
+	app.Get("/getPersonalisedData", ExtractJWT, svr.AuthorizeSession, svr.GetPersonalisedData)
+	app.Post("/verifyTableCode", ExtractJWT, svr.AuthorizeTable, svr.VerifyTableCode)
+	app.Post("/resolveTableQR", svr.ResolveTableQR)
+
+	// Admin routes for cafe staff
+	app.Post("/admin/createSeatingArea", ExtractAdminJWT, svr.AuthorizeAdmin, svr.CreateSeatingArea)
+	app.Get("/admin/getSeatingAreas", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetSeatingAreas)
+	app.Post("/admin/updateSeatingArea", ExtractAdminJWT, svr.AuthorizeAdmin, svr.UpdateSeatingArea)
+	app.Post("/admin/deleteSeatingArea", ExtractAdminJWT, svr.AuthorizeAdmin, svr.DeleteSeatingArea)
+	app.Post("/admin/createTable", ExtractAdminJWT, svr.AuthorizeAdmin, svr.CreateTable)
+	app.Get("/admin/getTables", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetTables)
+	app.Post("/admin/updateTable", ExtractAdminJWT, svr.AuthorizeAdmin, svr.UpdateTable)
+	app.Post("/admin/deleteTable", ExtractAdminJWT, svr.AuthorizeAdmin, svr.DeleteTable)
+	app.Post("/admin/getTableQR", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetTableQR)
+	app.Post("/admin/rotateTableQR", ExtractAdminJWT, svr.AuthorizeAdmin, svr.RotateTableQR)
+	app.Post("/admin/setOperatingHours", ExtractAdminJWT, svr.AuthorizeAdmin, svr.SetOperatingHours)
+	app.Get("/admin/getOperatingHours", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetOperatingHours)
+	app.Post("/admin/addHoliday", ExtractAdminJWT, svr.AuthorizeAdmin, svr.AddHoliday)
+	app.Post("/admin/deleteHoliday", ExtractAdminJWT, svr.AuthorizeAdmin, svr.DeleteHoliday)
+	app.Post("/admin/updateCafeSettings", ExtractAdminJWT, svr.AuthorizeAdmin, svr.UpdateCafeSettings)
+	app.Post("/admin/createIngredient", ExtractAdminJWT, svr.AuthorizeAdmin, svr.CreateIngredient)
+	app.Get("/admin/getIngredients", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetIngredients)
+	app.Post("/admin/updateIngredient", ExtractAdminJWT, svr.AuthorizeAdmin, svr.UpdateIngredient)
+	app.Post("/admin/deleteIngredient", ExtractAdminJWT, svr.AuthorizeAdmin, svr.DeleteIngredient)
+	app.Post("/admin/setRecipe", ExtractAdminJWT, svr.AuthorizeAdmin, svr.SetRecipe)
+	app.Post("/admin/getRecipe", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetRecipe)
+	app.Post("/admin/setItemStock", ExtractAdminJWT, svr.AuthorizeAdmin, svr.SetItemStock)
+	app.Post("/admin/restock", ExtractAdminJWT, svr.AuthorizeAdmin, svr.Restock)
+	app.Post("/admin/createCategory", ExtractAdminJWT, svr.AuthorizeAdmin, svr.CreateCategory)
+	app.Post("/admin/updateCategory", ExtractAdminJWT, svr.AuthorizeAdmin, svr.UpdateCategory)
+	app.Post("/admin/archiveCategory", ExtractAdminJWT, svr.AuthorizeAdmin, svr.ArchiveCategory)
+	app.Post("/admin/setCategoryPins", ExtractAdminJWT, svr.AuthorizeAdmin, svr.SetCategoryPins)
+	app.Get("/admin/getCategoryRanking", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetCategoryRanking)
+	app.Get("/admin/getPopularitySettings", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetPopularitySettings)
+	app.Post("/admin/setPopularitySettings", ExtractAdminJWT, svr.AuthorizeAdmin, svr.SetPopularitySettings)
+	app.Get("/admin/getReviewQueue", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetReviewQueue)
+	app.Post("/admin/moderateReview", ExtractAdminJWT, svr.AuthorizeAdmin, svr.ModerateReview)
+	app.Post("/admin/replyToReview", ExtractAdminJWT, svr.AuthorizeAdmin, svr.ReplyToReview)
+	app.Get("/admin/getFeedbackTrends", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetFeedbackTrends)
+	app.Get("/admin/getFeedbackPromptStats", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetFeedbackPromptStats)
+	app.Get("/admin/getNotificationChannels", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetNotificationChannels)
+	app.Post("/admin/setNotificationChannels", ExtractAdminJWT, svr.AuthorizeAdmin, svr.SetNotificationChannels)
+	app.Get("/admin/getNotificationTemplates", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetNotificationTemplates)
+	app.Post("/admin/setNotificationTemplate", ExtractAdminJWT, svr.AuthorizeAdmin, svr.SetNotificationTemplate)
+	app.Get("/admin/getNotificationLog", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetNotificationLog)
+	app.Post("/admin/registerDeviceToken", ExtractAdminJWT, svr.AuthorizeAdmin, svr.RegisterDeviceToken)
+	app.Post("/admin/refreshDeviceToken", ExtractAdminJWT, svr.AuthorizeAdmin, svr.RefreshDeviceToken)
+	app.Post("/admin/unregisterDeviceToken", ExtractAdminJWT, svr.AuthorizeAdmin, svr.UnregisterDeviceToken)
+	app.Post("/admin/createMenuItem", ExtractAdminJWT, svr.AuthorizeAdmin, svr.CreateMenuItem)
+	app.Post("/admin/updateMenuItem", ExtractAdminJWT, svr.AuthorizeAdmin, svr.UpdateMenuItem)
+	app.Post("/admin/archiveMenuItem", ExtractAdminJWT, svr.AuthorizeAdmin, svr.ArchiveMenuItem)
+	app.Post("/admin/createCustomization", ExtractAdminJWT, svr.AuthorizeAdmin, svr.CreateCustomization)
+	app.Post("/admin/updateCustomization", ExtractAdminJWT, svr.AuthorizeAdmin, svr.UpdateCustomization)
+	app.Post("/admin/archiveCustomization", ExtractAdminJWT, svr.AuthorizeAdmin, svr.ArchiveCustomization)
+	app.Post("/admin/createCrossSell", ExtractAdminJWT, svr.AuthorizeAdmin, svr.CreateCrossSell)
+	app.Post("/admin/updateCrossSell", ExtractAdminJWT, svr.AuthorizeAdmin, svr.UpdateCrossSell)
+	app.Post("/admin/archiveCrossSell", ExtractAdminJWT, svr.AuthorizeAdmin, svr.ArchiveCrossSell)
+	app.Get("/admin/exportMenu", ExtractAdminJWT, svr.AuthorizeAdmin, svr.ExportMenu)
+	app.Post("/admin/importMenu", ExtractAdminJWT, svr.AuthorizeAdmin, svr.ImportMenu)
+	app.Post("/admin/createMenuDraft", ExtractAdminJWT, svr.AuthorizeAdmin, svr.CreateMenuDraft)
+	app.Post("/admin/updateMenuDraft", ExtractAdminJWT, svr.AuthorizeAdmin, svr.UpdateMenuDraft)
+	app.Get("/admin/getMenuVersions", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetMenuVersions)
+	app.Post("/admin/getMenuVersion", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetMenuVersion)
+	app.Post("/admin/scheduleMenuVersion", ExtractAdminJWT, svr.AuthorizeAdmin, svr.ScheduleMenuVersion)
+	app.Post("/admin/publishMenuVersion", ExtractAdminJWT, svr.AuthorizeAdmin, svr.PublishMenuVersion)
+	app.Post("/admin/rollbackMenuVersion", ExtractAdminJWT, svr.AuthorizeAdmin, svr.RollbackMenuVersion)
+	app.Post("/admin/getItemPriceHistory", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetItemPriceHistory)
+	app.Post("/admin/createCustomizationGroup", ExtractAdminJWT, svr.AuthorizeAdmin, svr.CreateCustomizationGroup)
+	app.Post("/admin/updateCustomizationGroup", ExtractAdminJWT, svr.AuthorizeAdmin, svr.UpdateCustomizationGroup)
+	app.Post("/admin/archiveCustomizationGroup", ExtractAdminJWT, svr.AuthorizeAdmin, svr.ArchiveCustomizationGroup)
+	app.Post("/admin/getCustomizationGroups", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetCustomizationGroups)
+	app.Post("/admin/setItemTranslation", ExtractAdminJWT, svr.AuthorizeAdmin, svr.SetItemTranslation)
+	app.Post("/admin/getItemTranslations", ExtractAdminJWT, svr.AuthorizeAdmin, svr.GetItemTranslations)
+	app.Post("/admin/deleteItemTranslation", ExtractAdminJWT, svr.AuthorizeAdmin, svr.DeleteItemTranslation)
+	app.Post("/admin/createMediaUpload", ExtractAdminJWT, svr.AuthorizeAdmin, svr.CreateMediaUpload)
 
 	fmt.Println("Routing established!!")
 
@@ -237,12 +456,16 @@ func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (events
 	// Proxy the request to the Fiber app and get the response
 	response, err := fiberLambda.ProxyWithContext(ctx, request)
 
-	response.Headers = make(map[string]string)
+	// Keep the headers of the app, e.g. the ETag of the menu
+	if response.Headers == nil {
+		response.Headers = make(map[string]string)
+	}
 
 	// Add CORS headers to the response
 	response.Headers["Access-Control-Allow-Origin"] = "*"
 	response.Headers["Access-Control-Allow-Methods"] = "GET,POST,PUT,DELETE"
-	response.Headers["Access-Control-Allow-Headers"] = "Origin, Content-Type, Accept"
+	response.Headers["Access-Control-Allow-Headers"] = "Origin, Content-Type, Accept, If-None-Match, X-Image-Size, X-Image-Accept"
+	response.Headers["Access-Control-Expose-Headers"] = "ETag"
 
 	return response, err
 }
@@ -0,0 +1,232 @@
+package helper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OperatingWindow is a daily opening window expressed as offsets from local
+// midnight. A window whose Close is not after Open runs past midnight.
+type OperatingWindow struct {
+	Open  time.Duration
+	Close time.Duration
+}
+
+// Holiday overrides the weekly schedule for a single date. A holiday that is
+// not closed and has no windows keeps the regular hours.
+type Holiday struct {
+	Closed  bool
+	Windows []OperatingWindow
+	Reason  string
+}
+
+// CafeSchedule describes when a cafe is open in its own timezone
+type CafeSchedule struct {
+	Location *time.Location
+	Weekly   map[time.Weekday][]OperatingWindow // Empty means the Default hours apply every day
+	Default  []OperatingWindow                  // Empty means the cafe is always open
+	Holidays map[string]Holiday                 // Keyed by local date, 2006-01-02
+}
+
+// Availability is the outcome of an availability check with a reason that
+// can be shown to the user when Available is false.
+type Availability struct {
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ItemWindow is the time of day during which a menu item can be ordered
+type ItemWindow struct {
+	Restricted bool
+	Window     OperatingWindow
+}
+
+const dayLength = 24 * time.Hour
+
+var timeOfDayLayouts = []string{"15:04", "15:04:05", "3:04 PM", "3:04PM", "3 PM", "3PM"}
+
+// ParseTimeOfDay parses values such as "07:30", "19:00:00" or "7:30 PM"
+// into an offset from midnight.
+func ParseTimeOfDay(value string) (time.Duration, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	for _, layout := range timeOfDayLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time of day %q", value)
+}
+
+// FormatTimeOfDay renders an offset from midnight as HH:MM
+func FormatTimeOfDay(offset time.Duration) string {
+	offset = offset % dayLength
+	return fmt.Sprintf("%02d:%02d", int(offset/time.Hour), int(offset%time.Hour/time.Minute))
+}
+
+// ParseItemWindow interprets the available_from, available_till and
+// available_all_day columns of a menu item.
+func ParseItemWindow(from, till, allDay string) (ItemWindow, error) {
+	switch strings.ToLower(strings.TrimSpace(allDay)) {
+	case "true", "t", "1", "yes":
+		return ItemWindow{}, nil
+	}
+
+	if strings.TrimSpace(from) == "" && strings.TrimSpace(till) == "" {
+		return ItemWindow{}, nil
+	}
+
+	open, close := time.Duration(0), dayLength
+	var err error
+	if strings.TrimSpace(from) != "" {
+		if open, err = ParseTimeOfDay(from); err != nil {
+			return ItemWindow{}, err
+		}
+	}
+	if strings.TrimSpace(till) != "" {
+		if close, err = ParseTimeOfDay(till); err != nil {
+			return ItemWindow{}, err
+		}
+	}
+
+	return ItemWindow{Restricted: true, Window: OperatingWindow{Open: open, Close: close}}, nil
+}
+
+// IsOpen reports whether the cafe is open at the given instant
+func (s CafeSchedule) IsOpen(now time.Time) Availability {
+	local := now.In(s.location())
+
+	if s.openAt(local) {
+		return Availability{Available: true}
+	}
+
+	reason := "Cafe is closed right now"
+	if holiday, ok := s.Holidays[local.Format("2006-01-02")]; ok && holiday.Closed && holiday.Reason != "" {
+		reason = fmt.Sprintf("Cafe is closed today (%s)", holiday.Reason)
+	}
+	if next, ok := s.NextOpening(local); ok {
+		if sameDay(next, local) {
+			reason += ". Opens at " + next.Format("15:04")
+		} else {
+			reason += ". Opens " + next.Format("Mon 15:04")
+		}
+	}
+
+	return Availability{Available: false, Reason: reason}
+}
+
+// NextOpening returns the next time the cafe opens within the coming week
+func (s CafeSchedule) NextOpening(now time.Time) (time.Time, bool) {
+	local := now.In(s.location())
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+
+	for day := 0; day <= 7; day++ {
+		date := midnight.AddDate(0, 0, day)
+		windows, _ := s.windowsOn(date)
+		var earliest time.Time
+		for _, window := range windows {
+			opening := date.Add(window.Open)
+			if opening.After(local) && (earliest.IsZero() || opening.Before(earliest)) {
+				earliest = opening
+			}
+		}
+		if !earliest.IsZero() {
+			return earliest, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// ItemAvailable reports whether an item with the given window can be ordered
+func (s CafeSchedule) ItemAvailable(window ItemWindow, now time.Time) Availability {
+	if !window.Restricted {
+		return Availability{Available: true}
+	}
+
+	local := now.In(s.location())
+	if window.Window.contains(offsetOf(local)) || window.Window.overnightContains(offsetOf(local)) {
+		return Availability{Available: true}
+	}
+
+	return Availability{
+		Available: false,
+		Reason:    fmt.Sprintf("Available only between %s and %s", FormatTimeOfDay(window.Window.Open), FormatTimeOfDay(window.Window.Close)),
+	}
+}
+
+func (s CafeSchedule) location() *time.Location {
+	if s.Location == nil {
+		return time.UTC
+	}
+	return s.Location
+}
+
+// windowsOn returns the windows for a local date and whether any hours are
+// configured at all.
+func (s CafeSchedule) windowsOn(date time.Time) ([]OperatingWindow, bool) {
+	if holiday, ok := s.Holidays[date.Format("2006-01-02")]; ok {
+		if holiday.Closed {
+			return nil, true
+		}
+		if len(holiday.Windows) > 0 {
+			return holiday.Windows, true
+		}
+	}
+
+	if len(s.Weekly) > 0 {
+		return s.Weekly[date.Weekday()], true
+	}
+
+	if len(s.Default) > 0 {
+		return s.Default, true
+	}
+
+	return nil, false
+}
+
+func (s CafeSchedule) openAt(local time.Time) bool {
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	offset := offsetOf(local)
+
+	windows, configured := s.windowsOn(midnight)
+	if !configured {
+		return true
+	}
+	for _, window := range windows {
+		if window.contains(offset) {
+			return true
+		}
+	}
+
+	// Windows from the previous day that run past midnight
+	previous, _ := s.windowsOn(midnight.AddDate(0, 0, -1))
+	for _, window := range previous {
+		if window.overnightContains(offset) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contains checks the part of the window that falls on its own day
+func (w OperatingWindow) contains(offset time.Duration) bool {
+	if w.Close > w.Open {
+		return offset >= w.Open && offset < w.Close
+	}
+	return offset >= w.Open
+}
+
+// overnightContains checks the part of the window that spills into the next day
+func (w OperatingWindow) overnightContains(offset time.Duration) bool {
+	return w.Close <= w.Open && offset < w.Close
+}
+
+func offsetOf(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
@@ -0,0 +1,150 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testIST = time.FixedZone("IST", 5*60*60+30*60)
+
+func hm(hour, minute int) time.Duration {
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+}
+
+// at is a local time in the week of Monday 2026-10-19
+func at(day, hour, minute int) time.Time {
+	return time.Date(2026, 10, 19+day, hour, minute, 0, 0, testIST)
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"07:30", hm(7, 30), false},
+		{"19:00:00", hm(19, 0), false},
+		{"7:30 PM", hm(19, 30), false},
+		{"7:30pm", hm(19, 30), false},
+		{" 12 AM ", 0, false},
+		{"9PM", hm(21, 0), false},
+		{"25:00", 0, true},
+		{"noon", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTimeOfDay(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTimeOfDay(%q) err = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTimeOfDay(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCafeScheduleIsOpen(t *testing.T) {
+	weekly := CafeSchedule{
+		Location: testIST,
+		Weekly: map[time.Weekday][]OperatingWindow{
+			time.Monday:    {{Open: hm(8, 0), Close: hm(22, 0)}},
+			time.Tuesday:   {{Open: hm(8, 0), Close: hm(12, 0)}, {Open: hm(17, 0), Close: hm(22, 0)}},
+			time.Wednesday: {{Open: hm(8, 0), Close: hm(22, 0)}},
+			time.Friday:    {{Open: hm(18, 0), Close: hm(2, 0)}}, // Runs past midnight
+			time.Saturday:  {{Open: hm(10, 0), Close: hm(23, 0)}},
+		},
+		Holidays: map[string]Holiday{
+			"2026-10-21": {Closed: true, Reason: "Diwali"},
+			"2026-10-22": {Windows: []OperatingWindow{{Open: hm(12, 0), Close: hm(16, 0)}}}, // Special hours on a Thursday
+		},
+	}
+
+	tests := []struct {
+		name     string
+		schedule CafeSchedule
+		now      time.Time
+		want     bool
+		reason   string
+	}{
+		{"before opening", weekly, at(0, 7, 59), false, "Opens at 08:00"},
+		{"at opening", weekly, at(0, 8, 0), true, ""},
+		{"at closing", weekly, at(0, 22, 0), false, "Opens Tue 08:00"},
+		{"between split windows", weekly, at(1, 14, 0), false, "Opens at 17:00"},
+		{"second split window", weekly, at(1, 17, 30), true, ""},
+		{"closed holiday", weekly, at(2, 12, 0), false, "closed today (Diwali)"},
+		{"special hours open", weekly, at(3, 13, 0), true, ""},
+		{"special hours closed", weekly, at(3, 17, 0), false, "Opens Fri 18:00"},
+		{"overnight before midnight", weekly, at(4, 23, 30), true, ""},
+		{"overnight after midnight", weekly, at(5, 1, 30), true, ""},
+		{"overnight ended", weekly, at(5, 2, 0), false, "Opens at 10:00"},
+		{"day without hours", weekly, at(6, 12, 0), false, "Opens Mon 08:00"},
+		{"other timezone", weekly, time.Date(2026, 10, 19, 2, 45, 0, 0, time.UTC), true, ""}, // 08:15 IST
+		{"default hours", CafeSchedule{Location: testIST, Default: []OperatingWindow{{Open: hm(9, 0), Close: hm(17, 0)}}}, at(6, 10, 0), true, ""},
+		{"no hours configured", CafeSchedule{Location: testIST}, at(6, 3, 0), true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.schedule.IsOpen(tt.now)
+			if got.Available != tt.want {
+				t.Fatalf("Available = %v, want %v (reason %q)", got.Available, tt.want, got.Reason)
+			}
+			if !strings.Contains(got.Reason, tt.reason) {
+				t.Errorf("Reason = %q, want it to contain %q", got.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestCafeScheduleItemAvailable(t *testing.T) {
+	schedule := CafeSchedule{Location: testIST}
+	breakfast := ItemWindow{Restricted: true, Window: OperatingWindow{Open: hm(7, 0), Close: hm(11, 0)}}
+	lateNight := ItemWindow{Restricted: true, Window: OperatingWindow{Open: hm(22, 0), Close: hm(3, 0)}}
+
+	tests := []struct {
+		name   string
+		window ItemWindow
+		now    time.Time
+		want   bool
+	}{
+		{"unrestricted", ItemWindow{}, at(0, 4, 0), true},
+		{"inside", breakfast, at(0, 9, 0), true},
+		{"at close", breakfast, at(0, 11, 0), false},
+		{"overnight late", lateNight, at(0, 23, 0), true},
+		{"overnight early", lateNight, at(1, 2, 59), true},
+		{"overnight outside", lateNight, at(1, 12, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.ItemAvailable(tt.window, tt.now); got.Available != tt.want {
+				t.Errorf("Available = %v, want %v (reason %q)", got.Available, tt.want, got.Reason)
+			}
+		})
+	}
+}
+
+func TestParseItemWindow(t *testing.T) {
+	tests := []struct {
+		from, till, allDay string
+		want               ItemWindow
+	}{
+		{"07:00", "11:00", "true", ItemWindow{}},
+		{"", "", "false", ItemWindow{}},
+		{"07:00", "11:00", "", ItemWindow{Restricted: true, Window: OperatingWindow{Open: hm(7, 0), Close: hm(11, 0)}}},
+		{"18:00", "", "no", ItemWindow{Restricted: true, Window: OperatingWindow{Open: hm(18, 0), Close: dayLength}}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseItemWindow(tt.from, tt.till, tt.allDay)
+		if err != nil {
+			t.Errorf("ParseItemWindow(%q, %q, %q): %v", tt.from, tt.till, tt.allDay, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseItemWindow(%q, %q, %q) = %+v, want %+v", tt.from, tt.till, tt.allDay, got, tt.want)
+		}
+	}
+}
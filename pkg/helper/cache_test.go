@@ -0,0 +1,122 @@
+package helper
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	type step struct {
+		op    string // set, get, delete or sleep
+		key   string
+		value string
+		ttl   time.Duration
+		found bool // For get
+	}
+
+	tests := []struct {
+		name     string
+		capacity int
+		steps    []step
+	}{
+		{"get what was set", 2, []step{
+			{op: "set", key: "a", value: "1"},
+			{op: "get", key: "a", value: "1", found: true},
+			{op: "get", key: "b"},
+		}},
+		{"evicts least recently set", 2, []step{
+			{op: "set", key: "a", value: "1"},
+			{op: "set", key: "b", value: "2"},
+			{op: "set", key: "c", value: "3"},
+			{op: "get", key: "a"},
+			{op: "get", key: "b", value: "2", found: true},
+			{op: "get", key: "c", value: "3", found: true},
+		}},
+		{"get refreshes recency", 2, []step{
+			{op: "set", key: "a", value: "1"},
+			{op: "set", key: "b", value: "2"},
+			{op: "get", key: "a", value: "1", found: true},
+			{op: "set", key: "c", value: "3"},
+			{op: "get", key: "a", value: "1", found: true},
+			{op: "get", key: "b"},
+		}},
+		{"set replaces and refreshes", 2, []step{
+			{op: "set", key: "a", value: "1"},
+			{op: "set", key: "b", value: "2"},
+			{op: "set", key: "a", value: "10"},
+			{op: "set", key: "c", value: "3"},
+			{op: "get", key: "a", value: "10", found: true},
+			{op: "get", key: "b"},
+		}},
+		{"delete", 2, []step{
+			{op: "set", key: "a", value: "1"},
+			{op: "delete", key: "a"},
+			{op: "delete", key: "missing"},
+			{op: "get", key: "a"},
+		}},
+		{"expires after ttl", 2, []step{
+			{op: "set", key: "a", value: "1", ttl: 20 * time.Millisecond},
+			{op: "set", key: "b", value: "2"},
+			{op: "get", key: "a", value: "1", found: true},
+			{op: "sleep", ttl: 30 * time.Millisecond},
+			{op: "get", key: "a"},
+			{op: "get", key: "b", value: "2", found: true},
+		}},
+		{"no capacity keeps everything", 0, []step{
+			{op: "set", key: "a", value: "1"},
+			{op: "set", key: "b", value: "2"},
+			{op: "set", key: "c", value: "3"},
+			{op: "get", key: "a", value: "1", found: true},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewLRUCache(tt.capacity)
+			for i, s := range tt.steps {
+				switch s.op {
+				case "set":
+					cache.Set(s.key, []byte(s.value), s.ttl)
+				case "delete":
+					cache.Delete(s.key)
+				case "sleep":
+					time.Sleep(s.ttl)
+				case "get":
+					value, found := cache.Get(s.key)
+					if found != s.found || string(value) != s.value {
+						t.Fatalf("step %d: Get(%q) = %q, %v, want %q, %v", i, s.key, value, found, s.value, s.found)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLRUCacheConcurrentUse(t *testing.T) {
+	cache := NewLRUCache(16)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("k%d", (worker+i)%32)
+				cache.Set(key, []byte(key), time.Minute)
+				if value, ok := cache.Get(key); ok && string(value) != key {
+					t.Errorf("Get(%q) = %q", key, value)
+				}
+				if i%10 == 0 {
+					cache.Delete(key)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	if n := cache.order.Len(); n > 16 || n != len(cache.entries) {
+		t.Errorf("cache holds %d entries and %d keys, want at most 16 of each", n, len(cache.entries))
+	}
+}
@@ -0,0 +1,181 @@
+package helper
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTimezone = "Asia/Kolkata"
+	DefaultCurrency = "INR"
+	DefaultLocale   = "en-IN"
+)
+
+// CafeClock gives the current time and formats money the way a cafe's
+// customers expect, based on the timezone, currency and locale of the cafe.
+type CafeClock struct {
+	Location *time.Location
+	Currency string
+	Locale   string
+}
+
+type currencyFormat struct {
+	Symbol   string
+	Decimals int
+}
+
+var currencyFormats = map[string]currencyFormat{
+	"INR": {Symbol: "₹", Decimals: 2},
+	"USD": {Symbol: "$", Decimals: 2},
+	"EUR": {Symbol: "€", Decimals: 2},
+	"GBP": {Symbol: "£", Decimals: 2},
+	"AED": {Symbol: "AED ", Decimals: 2},
+	"SGD": {Symbol: "S$", Decimals: 2},
+	"AUD": {Symbol: "A$", Decimals: 2},
+	"CAD": {Symbol: "C$", Decimals: 2},
+	"JPY": {Symbol: "¥", Decimals: 0},
+	"LKR": {Symbol: "Rs ", Decimals: 2},
+	"NPR": {Symbol: "Rs ", Decimals: 2},
+}
+
+// NewCafeClock builds a clock for the given settings. Empty or unknown values
+// fall back to the defaults so a misconfigured cafe keeps working.
+func NewCafeClock(timezone, currency, locale string) CafeClock {
+	if timezone == "" {
+		timezone = DefaultTimezone
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		fmt.Printf("Invalid timezone %q, using %s\n", timezone, DefaultTimezone)
+		location, err = time.LoadLocation(DefaultTimezone)
+		if err != nil {
+			location = time.UTC
+		}
+	}
+
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	if locale == "" {
+		locale = DefaultLocale
+	}
+
+	return CafeClock{Location: location, Currency: currency, Locale: locale}
+}
+
+// Now returns the current time in the cafe's timezone
+func (c CafeClock) Now() time.Time {
+	return time.Now().In(c.location())
+}
+
+// In converts t to the cafe's timezone
+func (c CafeClock) In(t time.Time) time.Time {
+	return t.In(c.location())
+}
+
+// StartOfDay returns local midnight of the current day in the cafe
+func (c CafeClock) StartOfDay() time.Time {
+	now := c.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+// Today returns the cafe's current calendar date at UTC midnight, suitable
+// for date columns regardless of the database session timezone.
+func (c CafeClock) Today() time.Time {
+	now := c.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// FormatTime renders a time of day using the 12 or 24 hour convention of the locale
+func (c CafeClock) FormatTime(t time.Time) string {
+	if c.uses24Hour() {
+		return c.In(t).Format("15:04")
+	}
+	return c.In(t).Format("03:04 PM")
+}
+
+// FormatMoney renders an amount with the currency symbol and the digit
+// grouping of the locale, e.g. ₹1,23,456.50 for en-IN or $123,456.50 for en-US.
+func (c CafeClock) FormatMoney(amount float64) string {
+	format, ok := currencyFormats[c.Currency]
+	if !ok {
+		format = currencyFormat{Symbol: c.Currency + " ", Decimals: 2}
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	scale := math.Pow(10, float64(format.Decimals))
+	rounded := math.Round(amount*scale) / scale
+	whole := int64(rounded)
+	decimal, group := c.separators()
+	text := groupDigits(fmt.Sprintf("%d", whole), c.usesIndianGrouping(), group)
+
+	if format.Decimals > 0 {
+		fraction := int64(math.Round((rounded - float64(whole)) * scale))
+		text += fmt.Sprintf("%s%0*d", decimal, format.Decimals, fraction)
+	}
+
+	return sign + format.Symbol + text
+}
+
+func (c CafeClock) location() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+	return c.Location
+}
+
+func (c CafeClock) language() string {
+	return LocaleLanguage(c.Locale)
+}
+
+func (c CafeClock) usesIndianGrouping() bool {
+	return strings.HasSuffix(strings.ToUpper(c.Locale), "-IN") || strings.HasSuffix(strings.ToUpper(c.Locale), "_IN")
+}
+
+func (c CafeClock) uses24Hour() bool {
+	switch c.language() {
+	case "en", "hi", "ar":
+		return false
+	}
+	return true
+}
+
+// separators returns the decimal and digit group separators of the locale
+func (c CafeClock) separators() (string, string) {
+	switch c.language() {
+	case "de", "fr", "es", "it", "nl", "pt", "id":
+		return ",", "."
+	}
+	return ".", ","
+}
+
+// groupDigits inserts thousands separators, using the lakh/crore pattern for
+// Indian locales.
+func groupDigits(digits string, indian bool, separator string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+
+	head, tail := digits[:len(digits)-3], digits[len(digits)-3:]
+	step := 3
+	if indian {
+		step = 2
+	}
+
+	var groups []string
+	for len(head) > step {
+		groups = append([]string{head[len(head)-step:]}, groups...)
+		head = head[:len(head)-step]
+	}
+	groups = append([]string{head}, groups...)
+
+	return strings.Join(groups, separator) + separator + tail
+}
@@ -0,0 +1,58 @@
+package helper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatMoney(t *testing.T) {
+	tests := []struct {
+		currency, locale string
+		amount           float64
+		want             string
+	}{
+		{"INR", "en-IN", 0, "₹0.00"},
+		{"INR", "en-IN", 999.5, "₹999.50"},
+		{"INR", "en-IN", 1000, "₹1,000.00"},
+		{"INR", "en-IN", 123456.5, "₹1,23,456.50"},
+		{"INR", "en-IN", 12345678.9, "₹1,23,45,678.90"},
+		{"INR", "hi_IN", 1234567, "₹12,34,567.00"},
+		{"INR", "en-IN", -250000, "-₹2,50,000.00"},
+		{"INR", "en-IN", 99.999, "₹100.00"},
+		{"USD", "en-US", 123456.5, "$123,456.50"},
+		{"USD", "en-US", 1234567.891, "$1,234,567.89"},
+		{"EUR", "de-DE", 1234567.5, "€1.234.567,50"},
+		{"JPY", "ja-JP", 1234567.6, "¥1,234,568"},
+		{"XYZ", "en-US", 12.3, "XYZ 12.30"},
+	}
+
+	for _, tt := range tests {
+		clock := CafeClock{Location: time.UTC, Currency: tt.currency, Locale: tt.locale}
+		if got := clock.FormatMoney(tt.amount); got != tt.want {
+			t.Errorf("FormatMoney(%v) in %s/%s = %q, want %q", tt.amount, tt.currency, tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestGroupDigits(t *testing.T) {
+	tests := []struct {
+		digits string
+		indian bool
+		want   string
+	}{
+		{"1", true, "1"},
+		{"123", true, "123"},
+		{"1234", true, "1,234"},
+		{"12345", true, "12,345"},
+		{"123456", true, "1,23,456"},
+		{"1234567890", true, "1,23,45,67,890"},
+		{"1234", false, "1,234"},
+		{"1234567890", false, "1,234,567,890"},
+	}
+
+	for _, tt := range tests {
+		if got := groupDigits(tt.digits, tt.indian, ","); got != tt.want {
+			t.Errorf("groupDigits(%q, %v) = %q, want %q", tt.digits, tt.indian, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// CSVCellError is a value in a CSV file that could not be converted
+type CSVCellError struct {
+	Row     int // Line number in the file, the header is line 1
+	Column  string
+	Message string
+}
+
+// MarshalCSV writes a slice of structs as CSV using their csv tags as the header
+func MarshalCSV(rows interface{}) ([]byte, error) {
+	value := reflect.ValueOf(rows)
+	if value.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("MarshalCSV expects a slice, got %s", value.Kind())
+	}
+
+	rowType := value.Type().Elem()
+	columns := csvColumns(rowType)
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < value.Len(); i++ {
+		row := value.Index(i)
+		record := make([]string, len(columns))
+		for j, column := range columns {
+			record[j] = formatCSVValue(row.Field(column.index))
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+// UnmarshalCSV appends one struct per CSV record to dst, a pointer to a slice
+// of structs with csv tags. Columns are matched by header name; unknown
+// columns are an error while missing columns keep their zero value. Cells that
+// cannot be converted are reported per row and left at their zero value.
+func UnmarshalCSV(content []byte, dst interface{}) ([]CSVCellError, error) {
+	slice := reflect.ValueOf(dst)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("UnmarshalCSV expects a pointer to a slice")
+	}
+	slice = slice.Elem()
+	rowType := slice.Type().Elem()
+
+	fields := make(map[string]int)
+	for _, column := range csvColumns(rowType) {
+		fields[column.name] = column.index
+	}
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV file is empty")
+	}
+
+	header := records[0]
+	indexes := make([]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		index, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		indexes[i] = index
+	}
+
+	var cellErrors []CSVCellError
+	for line, record := range records[1:] {
+		row := reflect.New(rowType).Elem()
+		for i, cell := range record {
+			if i >= len(indexes) {
+				break
+			}
+			if err := parseCSVValue(row.Field(indexes[i]), strings.TrimSpace(cell)); err != nil {
+				cellErrors = append(cellErrors, CSVCellError{Row: line + 2, Column: header[i], Message: err.Error()})
+			}
+		}
+		slice.Set(reflect.Append(slice, row))
+	}
+
+	return cellErrors, nil
+}
+
+type csvColumn struct {
+	name  string
+	index int
+}
+
+func csvColumns(rowType reflect.Type) []csvColumn {
+	var columns []csvColumn
+	for i := 0; i < rowType.NumField(); i++ {
+		tag := rowType.Field(i).Tag.Get("csv")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		columns = append(columns, csvColumn{name: tag, index: i})
+	}
+	return columns
+}
+
+func formatCSVValue(value reflect.Value) string {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value.Uint() == 0 {
+			return ""
+		}
+		return strconv.FormatUint(value.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64)
+	default:
+		return fmt.Sprint(value.Interface())
+	}
+}
+
+func parseCSVValue(field reflect.Value, cell string) error {
+	if cell == "" {
+		return nil
+	}
+
+	if field.Kind() == reflect.Ptr {
+		target := reflect.New(field.Type().Elem())
+		if err := parseCSVValue(target.Elem(), cell); err != nil {
+			return err
+		}
+		field.Set(target)
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(cell)
+	case reflect.Bool:
+		switch strings.ToLower(cell) {
+		case "true", "t", "1", "yes", "y":
+			field.SetBool(true)
+		case "false", "f", "0", "no", "n":
+			field.SetBool(false)
+		default:
+			return fmt.Errorf("%q is not a boolean", cell)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, err := strconv.ParseInt(cell, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", cell)
+		}
+		field.SetInt(number)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number, err := strconv.ParseUint(cell, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a positive whole number", cell)
+		}
+		field.SetUint(number)
+	case reflect.Float32, reflect.Float64:
+		number, err := strconv.ParseFloat(cell, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", cell)
+		}
+		field.SetFloat(number)
+	default:
+		return fmt.Errorf("unsupported column type %s", field.Kind())
+	}
+	return nil
+}
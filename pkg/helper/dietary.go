@@ -0,0 +1,92 @@
+package helper
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DietaryProfile is what a user cannot or will not eat. Allergens are
+// excluded outright, every dietary need has to be met by the item's labels.
+type DietaryProfile struct {
+	Allergens     []string `json:"allergens"`
+	Dietary       []string `json:"dietary"`
+	HideConflicts bool     `json:"hide_conflicts"` // Hide conflicting items instead of flagging them
+}
+
+// Labels that are implied by a stricter label
+var impliedLabels = map[string][]string{
+	"vegan": {"vegetarian", "lactose-free"},
+	"keto":  {"low-carb"},
+}
+
+func (p DietaryProfile) IsEmpty() bool {
+	return len(p.Allergens) == 0 && len(p.Dietary) == 0
+}
+
+// NormalizeLabel lower cases and trims a label or allergen name
+func NormalizeLabel(label string) string {
+	return strings.ToLower(strings.TrimSpace(label))
+}
+
+// SplitLabels reads labels stored as a comma separated list
+func SplitLabels(value string) []string {
+	var labels []string
+	for _, label := range strings.Split(value, ",") {
+		if label = NormalizeLabel(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// Conflicts returns why an item with the given allergens and dietary labels
+// does not suit the profile. It is empty when the item is fine.
+func (p DietaryProfile) Conflicts(allergens []string, labels []string) []string {
+	if p.IsEmpty() {
+		return nil
+	}
+
+	contains := make(map[string]bool, len(allergens))
+	for _, allergen := range allergens {
+		contains[NormalizeLabel(allergen)] = true
+	}
+	has := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		label = NormalizeLabel(label)
+		has[label] = true
+		for _, implied := range impliedLabels[label] {
+			has[implied] = true
+		}
+	}
+
+	var conflicts []string
+	for _, allergen := range p.Allergens {
+		if contains[NormalizeLabel(allergen)] {
+			conflicts = append(conflicts, fmt.Sprintf("Contains %s", NormalizeLabel(allergen)))
+		}
+	}
+	for _, need := range p.Dietary {
+		if !has[NormalizeLabel(need)] {
+			conflicts = append(conflicts, fmt.Sprintf("Not %s", NormalizeLabel(need)))
+		}
+	}
+	sort.Strings(conflicts)
+
+	return conflicts
+}
+
+// LabelsSatisfying returns the label and every stricter label that implies it
+func LabelsSatisfying(label string) []string {
+	label = NormalizeLabel(label)
+	labels := []string{label}
+	for stricter, implied := range impliedLabels {
+		for _, name := range implied {
+			if name == label {
+				labels = append(labels, stricter)
+			}
+		}
+	}
+	sort.Strings(labels[1:])
+	return labels
+}
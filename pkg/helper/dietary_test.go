@@ -0,0 +1,62 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDietaryProfileConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		profile   DietaryProfile
+		allergens []string
+		labels    []string
+		want      []string
+	}{
+		{"empty profile", DietaryProfile{}, []string{"nuts"}, nil, nil},
+		{"no conflict", DietaryProfile{Allergens: []string{"nuts"}, Dietary: []string{"vegetarian"}},
+			[]string{"milk"}, []string{"vegetarian"}, nil},
+		{"allergen", DietaryProfile{Allergens: []string{"Nuts"}},
+			[]string{" nuts "}, nil, []string{"Contains nuts"}},
+		{"need not met", DietaryProfile{Dietary: []string{"gluten-free"}},
+			nil, []string{"vegetarian"}, []string{"Not gluten-free"}},
+		{"implied by stricter label", DietaryProfile{Dietary: []string{"vegetarian", "lactose-free"}},
+			nil, []string{"Vegan"}, nil},
+		{"not implied the other way", DietaryProfile{Dietary: []string{"vegan"}},
+			nil, []string{"vegetarian"}, []string{"Not vegan"}},
+		{"keto is low carb", DietaryProfile{Dietary: []string{"low-carb"}},
+			nil, []string{"keto"}, nil},
+		{"several, sorted", DietaryProfile{Allergens: []string{"soy", "milk"}, Dietary: []string{"vegan"}},
+			[]string{"milk", "soy"}, []string{"vegetarian"}, []string{"Contains milk", "Contains soy", "Not vegan"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.profile.Conflicts(tt.allergens, tt.labels)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Conflicts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelsSatisfying(t *testing.T) {
+	tests := []struct {
+		label string
+		want  []string
+	}{
+		{"vegetarian", []string{"vegetarian", "vegan"}},
+		{" Lactose-Free ", []string{"lactose-free", "vegan"}},
+		{"low-carb", []string{"low-carb", "keto"}},
+		{"vegan", []string{"vegan"}},
+	}
+
+	for _, tt := range tests {
+		if got := LabelsSatisfying(tt.label); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LabelsSatisfying(%q) = %q, want %q", tt.label, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sentiments of a review or of a topic in it
+const (
+	SentimentPositive = "positive"
+	SentimentNeutral  = "neutral"
+	SentimentNegative = "negative"
+)
+
+// FeedbackTopics are the aspects of a visit reviews are sorted into
+var FeedbackTopics = []string{"service", "wait_time", "taste", "price", "ambience"}
+
+// TopicSentiment is how a review speaks of one topic
+type TopicSentiment struct {
+	Topic     string `json:"topic"`
+	Sentiment string `json:"sentiment"`
+}
+
+// FeedbackAnalysis is the sentiment of a review and the topics it mentions
+type FeedbackAnalysis struct {
+	Sentiment string
+	Score     float64 // From -1 (negative) to 1 (positive)
+	Topics    []TopicSentiment
+}
+
+// FeedbackAnalyser classifies the text of a review. Name identifies the
+// implementation and is stored with the analysis.
+type FeedbackAnalyser interface {
+	Name() string
+	Analyse(text string) (FeedbackAnalysis, error)
+}
+
+// sentimentLabel turns a score into a sentiment, weak scores are neutral
+func sentimentLabel(score float64) string {
+	switch {
+	case score > 0.2:
+		return SentimentPositive
+	case score < -0.2:
+		return SentimentNegative
+	default:
+		return SentimentNeutral
+	}
+}
+
+var topicKeywords = map[string][]string{
+	"service": {"service", "staff", "waiter", "waiters", "waitress", "server", "manager", "served",
+		"rude", "friendly", "polite", "attentive", "helpful", "ignored", "behaviour", "behavior"},
+	"wait_time": {"wait", "waited", "waiting", "slow", "late", "delay", "delayed", "quick", "quickly",
+		"fast", "minutes", "hour", "hours", "forever", "prompt", "took"},
+	"taste": {"taste", "tasted", "tasty", "delicious", "flavour", "flavor", "flavours", "flavors",
+		"bland", "salty", "sweet", "spicy", "fresh", "stale", "burnt", "food", "coffee", "yummy", "swaad"},
+	"price": {"price", "prices", "priced", "expensive", "cheap", "costly", "overpriced", "value",
+		"worth", "affordable", "money", "bill", "pricey", "mehenga", "sasta"},
+	"ambience": {"ambience", "ambiance", "atmosphere", "music", "decor", "vibe", "vibes", "noisy",
+		"loud", "cozy", "cosy", "seating", "clean", "dirty", "crowded", "interior", "place", "lighting"},
+}
+
+var positiveWords = map[string]bool{
+	"good": true, "great": true, "excellent": true, "amazing": true, "awesome": true, "love": true,
+	"loved": true, "lovely": true, "delicious": true, "tasty": true, "friendly": true, "polite": true,
+	"quick": true, "quickly": true, "fast": true, "fresh": true, "cozy": true, "cosy": true,
+	"clean": true, "nice": true, "perfect": true, "best": true, "worth": true, "affordable": true,
+	"attentive": true, "helpful": true, "pleasant": true, "recommend": true, "wonderful": true,
+	"fantastic": true, "enjoyed": true, "prompt": true, "yummy": true, "accha": true, "badhiya": true,
+}
+
+var negativeWords = map[string]bool{
+	"bad": true, "terrible": true, "awful": true, "horrible": true, "worst": true, "rude": true,
+	"slow": true, "late": true, "cold": true, "bland": true, "stale": true, "salty": true,
+	"burnt": true, "dirty": true, "noisy": true, "loud": true, "expensive": true, "overpriced": true,
+	"costly": true, "pricey": true, "disappointing": true, "disappointed": true, "poor": true,
+	"forever": true, "crowded": true, "ignored": true, "delayed": true, "mediocre": true,
+	"unhygienic": true, "bekar": true, "mehenga": true,
+}
+
+var negators = map[string]bool{
+	"not": true, "no": true, "never": true, "isn't": true, "wasn't": true, "weren't": true,
+	"didn't": true, "don't": true, "doesn't": true, "hardly": true, "nahi": true,
+}
+
+// LexiconAnalyser scores reviews with word lists and finds topics by
+// keyword. It works offline and is the default. Every clause counts for the
+// topics it mentions, so "great coffee but slow service" is positive on taste
+// and negative on wait time.
+type LexiconAnalyser struct{}
+
+func (LexiconAnalyser) Name() string {
+	return "lexicon"
+}
+
+func (LexiconAnalyser) Analyse(text string) (FeedbackAnalysis, error) {
+	topicScores := make(map[string]float64)
+	positive, negative := 0, 0
+
+	clauses := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return strings.ContainsRune(".,!?;\n", r)
+	})
+	for _, clause := range clauses {
+		// "but" turns a sentence around, each side is its own clause
+		for _, part := range strings.Split(clause, " but ") {
+			words := strings.FieldsFunc(part, func(r rune) bool {
+				return !(r >= 'a' && r <= 'z' || r == '\'')
+			})
+
+			score, negatedFor := 0, 0
+			for _, word := range words {
+				polarity := 0
+				if positiveWords[word] {
+					polarity = 1
+				} else if negativeWords[word] {
+					polarity = -1
+				}
+				if negatedFor > 0 {
+					polarity = -polarity
+					negatedFor--
+				}
+				if negators[word] {
+					negatedFor = 3
+				}
+				score += polarity
+				if polarity > 0 {
+					positive++
+				} else if polarity < 0 {
+					negative++
+				}
+			}
+
+			for topic, keywords := range topicKeywords {
+				for _, keyword := range keywords {
+					if containsWord(words, keyword) {
+						topicScores[topic] += float64(score)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	var analysis FeedbackAnalysis
+	if positive+negative > 0 {
+		analysis.Score = float64(positive-negative) / float64(positive+negative)
+	}
+	analysis.Sentiment = sentimentLabel(analysis.Score)
+	for _, topic := range FeedbackTopics {
+		if score, ok := topicScores[topic]; ok {
+			analysis.Topics = append(analysis.Topics, TopicSentiment{Topic: topic, Sentiment: sentimentLabel(score)})
+		}
+	}
+	return analysis, nil
+}
+
+func containsWord(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenAIAnalyser asks a chat model for the analysis. It understands sarcasm,
+// mixed languages and topics worded in ways the lexicon does not know.
+type OpenAIAnalyser struct {
+	APIKey string
+	Model  string // Defaults to gpt-4o-mini
+}
+
+func (o OpenAIAnalyser) model() string {
+	if o.Model == "" {
+		return "gpt-4o-mini"
+	}
+	return o.Model
+}
+
+func (o OpenAIAnalyser) Name() string {
+	return "openai:" + o.model()
+}
+
+func (o OpenAIAnalyser) Analyse(text string) (FeedbackAnalysis, error) {
+	prompt := fmt.Sprintf(`Analyse this cafe review. Reply with JSON only, in the form
+{"score": 0.6, "topics": [{"topic": "taste", "sentiment": "positive"}]}
+where score is the overall sentiment from -1 (very negative) to 1 (very positive), and topics lists
+only the topics the review talks about, out of: %s. The sentiment of a topic is positive, neutral or negative.
+
+Review: %s`, strings.Join(FeedbackTopics, ", "), text)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model":           o.model(),
+		"messages":        []map[string]string{{"role": "user", "content": prompt}},
+		"response_format": map[string]string{"type": "json_object"},
+		"temperature":     0,
+	})
+	if err != nil {
+		return FeedbackAnalysis{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return FeedbackAnalysis{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return FeedbackAnalysis{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return FeedbackAnalysis{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return FeedbackAnalysis{}, fmt.Errorf("analysis request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(data, &completion); err != nil {
+		return FeedbackAnalysis{}, err
+	}
+	if len(completion.Choices) == 0 {
+		return FeedbackAnalysis{}, fmt.Errorf("analysis response has no choices")
+	}
+
+	var result struct {
+		Score  float64          `json:"score"`
+		Topics []TopicSentiment `json:"topics"`
+	}
+	if err := json.Unmarshal([]byte(completion.Choices[0].Message.Content), &result); err != nil {
+		return FeedbackAnalysis{}, fmt.Errorf("invalid analysis %q: %w", completion.Choices[0].Message.Content, err)
+	}
+
+	analysis := FeedbackAnalysis{Score: result.Score}
+	if analysis.Score > 1 {
+		analysis.Score = 1
+	} else if analysis.Score < -1 {
+		analysis.Score = -1
+	}
+	analysis.Sentiment = sentimentLabel(analysis.Score)
+
+	// Keep the known topics once each, in the usual order
+	mentioned := make(map[string]string)
+	for _, topic := range result.Topics {
+		switch topic.Sentiment {
+		case SentimentPositive, SentimentNeutral, SentimentNegative:
+			mentioned[topic.Topic] = topic.Sentiment
+		}
+	}
+	for _, topic := range FeedbackTopics {
+		if sentiment, ok := mentioned[topic]; ok {
+			analysis.Topics = append(analysis.Topics, TopicSentiment{Topic: topic, Sentiment: sentiment})
+		}
+	}
+	return analysis, nil
+}
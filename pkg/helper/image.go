@@ -0,0 +1,327 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"regexp"
+)
+
+// MaxImagePixels bounds decoded uploads, a 6000x4000 photo still fits
+const MaxImagePixels = 25_000_000
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image, upload a JPEG, PNG or GIF")
+	ErrImageTooLarge    = fmt.Errorf("image cannot have more than %d megapixels", MaxImagePixels/1_000_000)
+)
+
+// ImageVariant is a size images are resized to, fitting in MaxSize pixels on
+// the longer side. Smaller images are not enlarged.
+type ImageVariant struct {
+	Name    string
+	MaxSize int
+}
+
+var ImageVariants = []ImageVariant{
+	{Name: "thumbnail", MaxSize: 160},
+	{Name: "medium", MaxSize: 480},
+	{Name: "large", MaxSize: 1200},
+}
+
+// DecodedImage is a validated upload with the EXIF orientation of JPEGs
+type DecodedImage struct {
+	Image       image.Image
+	Format      string // jpeg, png or gif
+	Orientation int    // EXIF orientation, 1 when upright
+}
+
+// Width and Height are the dimensions once the orientation is applied
+func (d DecodedImage) Width() int {
+	if d.Orientation >= 5 {
+		return d.Image.Bounds().Dy()
+	}
+	return d.Image.Bounds().Dx()
+}
+
+func (d DecodedImage) Height() int {
+	if d.Orientation >= 5 {
+		return d.Image.Bounds().Dx()
+	}
+	return d.Image.Bounds().Dy()
+}
+
+// DecodeImage checks the dimensions of an upload before decoding it, so a
+// small file cannot expand into a huge bitmap.
+func DecodeImage(data []byte) (DecodedImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return DecodedImage{}, ErrUnsupportedImage
+	}
+	if config.Width < 1 || config.Height < 1 {
+		return DecodedImage{}, ErrUnsupportedImage
+	}
+	if config.Width*config.Height > MaxImagePixels {
+		return DecodedImage{}, ErrImageTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return DecodedImage{}, ErrUnsupportedImage
+	}
+
+	decoded := DecodedImage{Image: img, Format: format, Orientation: 1}
+	if format == "jpeg" {
+		decoded.Orientation = jpegOrientation(data)
+	}
+	return decoded, nil
+}
+
+// Opaque reports whether the upload has no transparent pixels
+func (d DecodedImage) Opaque() bool {
+	if opaque, ok := d.Image.(interface{ Opaque() bool }); ok {
+		return opaque.Opaque()
+	}
+	return false
+}
+
+// ResizeImage scales the image down to fit the variant and turns it upright.
+// Pixels are averaged over the area they cover, which keeps photos sharp
+// without aliasing.
+func ResizeImage(decoded DecodedImage, variant ImageVariant) *image.NRGBA {
+	src := image.NewRGBA(image.Rect(0, 0, decoded.Image.Bounds().Dx(), decoded.Image.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), decoded.Image, decoded.Image.Bounds().Min, draw.Src)
+
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	width, height := srcWidth, srcHeight
+	if longest := max(width, height); longest > variant.MaxSize {
+		width = max(1, (width*variant.MaxSize+longest/2)/longest)
+		height = max(1, (height*variant.MaxSize+longest/2)/longest)
+	}
+
+	// Horizontal then vertical pass on premultiplied colors
+	columns := areaWeights(srcWidth, width)
+	rows := areaWeights(srcHeight, height)
+
+	horizontal := make([]float32, width*srcHeight*4)
+	for y := 0; y < srcHeight; y++ {
+		line := src.Pix[y*src.Stride:]
+		for x, weights := range columns {
+			var acc [4]float32
+			for _, w := range weights {
+				p := line[w.index*4 : w.index*4+4]
+				for c := range acc {
+					acc[c] += float32(p[c]) * w.weight
+				}
+			}
+			copy(horizontal[(y*width+x)*4:], acc[:])
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y, weights := range rows {
+		for x := 0; x < width; x++ {
+			var acc [4]float32
+			for _, w := range weights {
+				p := horizontal[(w.index*width+x)*4:]
+				for c := range acc {
+					acc[c] += p[c] * w.weight
+				}
+			}
+
+			out := dst.Pix[y*dst.Stride+x*4:]
+			alpha := acc[3]
+			if alpha < 0.5 {
+				out[0], out[1], out[2], out[3] = 0, 0, 0, 0
+				continue
+			}
+			for c := 0; c < 3; c++ {
+				out[c] = clampByte(acc[c] * 255 / alpha)
+			}
+			out[3] = clampByte(alpha)
+		}
+	}
+
+	return orientImage(dst, decoded.Orientation)
+}
+
+type areaWeight struct {
+	index  int
+	weight float32
+}
+
+// areaWeights lists for every destination pixel the source pixels it covers
+// and by how much.
+func areaWeights(srcSize, dstSize int) [][]areaWeight {
+	scale := float64(srcSize) / float64(dstSize)
+	weights := make([][]areaWeight, dstSize)
+	for i := range weights {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < srcSize && float64(j) < end; j++ {
+			coverage := min(end, float64(j+1)) - max(start, float64(j))
+			if coverage > 0 {
+				weights[i] = append(weights[i], areaWeight{index: j, weight: float32(coverage / scale)})
+			}
+		}
+	}
+	return weights
+}
+
+func clampByte(v float32) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
+
+// orientImage applies an EXIF orientation so the image is shown upright
+func orientImage(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored
+				sx, sy = width-1-x, y
+			case 3: // Upside down
+				sx, sy = width-1-x, height-1-y
+			case 4: // Mirrored upside down
+				sx, sy = x, height-1-y
+			case 5: // Transposed
+				sx, sy = y, x
+			case 6: // Turned left, rotate clockwise
+				sx, sy = y, height-1-x
+			case 7: // Transversed
+				sx, sy = width-1-y, height-1-x
+			case 8: // Turned right, rotate counter clockwise
+				sx, sy = width-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], img.Pix[sy*img.Stride+sx*4:])
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the orientation tag from the EXIF segment of a JPEG
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xda || marker == 0xd9 { // Image data starts, no EXIF
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		if marker == 0xe1 {
+			if orientation := exifOrientation(data[i+4 : i+2+size]); orientation != 0 {
+				return orientation
+			}
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func exifOrientation(segment []byte) int {
+	if len(segment) < 14 || string(segment[:6]) != "Exif\x00\x00" {
+		return 0
+	}
+	tiff := segment[6:]
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for e := 0; e < entries; e++ {
+		entry := offset + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// EncodeImage encodes a variant as JPEG, or PNG when the upload has
+// transparency, and returns the data with its content type and extension.
+// All variants of an upload share the format so their URLs only differ by
+// the variant name.
+func EncodeImage(img *image.NRGBA, opaque bool) ([]byte, string, string, error) {
+	var buf bytes.Buffer
+	if opaque {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 82}); err != nil {
+			return nil, "", "", err
+		}
+		return buf.Bytes(), "image/jpeg", ".jpg", nil
+	}
+
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return nil, "", "", err
+	}
+	return buf.Bytes(), "image/png", ".png", nil
+}
+
+var imageVariantPath = regexp.MustCompile(`(/images/\d+/\d+/)(thumbnail|medium|large)\.(jpg|png)$`)
+
+// ImageVariantURL points an image URL produced by the media pipeline at
+// another of its variants. Every image has all sizes both in its original
+// format and as WebP. Other URLs are returned unchanged.
+func ImageVariantURL(url, size string, webp bool) string {
+	match := imageVariantPath.FindStringSubmatchIndex(url)
+	if match == nil {
+		return url
+	}
+
+	if size == "" {
+		size = url[match[4]:match[5]]
+	}
+	extension := url[match[6]:match[7]]
+	if webp {
+		extension = "webp"
+	}
+	return url[:match[3]] + size + "." + extension
+}
@@ -0,0 +1,80 @@
+package helper
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NormalizeLanguage lower cases a language tag and uses '-' between subtags,
+// so "en_IN" and "EN-in" are both "en-in".
+func NormalizeLanguage(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+}
+
+// LocaleLanguage returns the primary language of a locale, "en" for "en-IN"
+func LocaleLanguage(locale string) string {
+	return strings.SplitN(NormalizeLanguage(locale), "-", 2)[0]
+}
+
+// ParseAcceptLanguage returns the tags of an Accept-Language header, most
+// preferred first. Tags with q=0 and the "*" wildcard are dropped.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := NormalizeLanguage(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		languages = append(languages, weighted{tag: tag, quality: quality})
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+
+	tags := make([]string, 0, len(languages))
+	for _, language := range languages {
+		tags = append(tags, language.tag)
+	}
+	return tags
+}
+
+// MatchLanguage returns the first preferred language that is available. A
+// preference matches an available tag exactly or by its primary language, so
+// "hi-in" is served "hi". It is empty when nothing matches.
+func MatchLanguage(preferred, available []string) string {
+	for _, tag := range preferred {
+		for _, candidate := range available {
+			if NormalizeLanguage(candidate) == tag {
+				return NormalizeLanguage(candidate)
+			}
+		}
+		primary := LocaleLanguage(tag)
+		for _, candidate := range available {
+			if NormalizeLanguage(candidate) == primary {
+				return primary
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package helper
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidMediaUpload = errors.New("invalid or expired upload token")
+
+// SignMediaUpload encodes an upload token the same way as table QR payloads.
+// The signature is domain separated so a QR payload cannot be replayed as an
+// upload token when both use the same secret.
+func SignMediaUpload(payload structures.MediaUploadPayload, secret string) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + tableQRSignature("media-upload."+encoded, secret), nil
+}
+
+// VerifyMediaUpload checks the signature and expiry of a token produced by
+// SignMediaUpload and returns its decoded content.
+func VerifyMediaUpload(token, secret string, now time.Time) (structures.MediaUploadPayload, error) {
+	var payload structures.MediaUploadPayload
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return payload, ErrInvalidMediaUpload
+	}
+
+	expected := tableQRSignature("media-upload."+parts[0], secret)
+	if !hmac.Equal([]byte(expected), []byte(parts[1])) {
+		return payload, ErrInvalidMediaUpload
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return payload, ErrInvalidMediaUpload
+	}
+
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return payload, ErrInvalidMediaUpload
+	}
+
+	if now.Unix() > payload.ExpiresAt {
+		return payload, ErrInvalidMediaUpload
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,67 @@
+package helper
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMediaUploadToken(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	payload := structures.MediaUploadPayload{AssetID: 42, CafeID: 3, ExpiresAt: now.Add(10 * time.Minute).Unix()}
+
+	token, err := SignMediaUpload(payload, "upload-secret")
+	if err != nil {
+		t.Fatalf("SignMediaUpload: %v", err)
+	}
+	encoded, _, _ := strings.Cut(token, ".")
+
+	// A table QR signed with the same secret over the same bytes
+	qrToken := encoded + "." + tableQRSignature(encoded, "upload-secret")
+
+	tests := []struct {
+		name    string
+		token   string
+		secret  string
+		now     time.Time
+		wantErr bool
+	}{
+		{"valid", token, "upload-secret", now, false},
+		{"valid until expiry", token, "upload-secret", now.Add(10 * time.Minute), false},
+		{"expired", token, "upload-secret", now.Add(10*time.Minute + time.Second), true},
+		{"wrong secret", token, "other-secret", now, true},
+		{"table QR signature", qrToken, "upload-secret", now, true},
+		{"tampered payload", "x" + token, "upload-secret", now, true},
+		{"missing signature", encoded, "upload-secret", now, true},
+		{"empty", "", "upload-secret", now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyMediaUpload(tt.token, tt.secret, tt.now)
+			if tt.wantErr {
+				if err != ErrInvalidMediaUpload {
+					t.Errorf("err = %v, want ErrInvalidMediaUpload", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyMediaUpload: %v", err)
+			}
+			if got != payload {
+				t.Errorf("payload = %+v, want %+v", got, payload)
+			}
+		})
+	}
+}
+
+func TestMediaUploadTokenIsNotATableQR(t *testing.T) {
+	token, err := SignMediaUpload(structures.MediaUploadPayload{AssetID: 1, CafeID: 3, ExpiresAt: 1}, "shared-secret")
+	if err != nil {
+		t.Fatalf("SignMediaUpload: %v", err)
+	}
+	if _, err := VerifyTableQR(token, "shared-secret"); err != ErrInvalidTableQR {
+		t.Errorf("VerifyTableQR accepted an upload token, err = %v", err)
+	}
+}
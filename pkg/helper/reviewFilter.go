@@ -0,0 +1,152 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReviewVerdict is what a classifier found in a review. Flagged reviews wait
+// for the cafe owner instead of being published.
+type ReviewVerdict struct {
+	Flagged bool
+	Reasons []string // e.g. "profanity", "harassment"
+}
+
+// ReviewClassifier checks the text of a review before it is published
+type ReviewClassifier interface {
+	Classify(text string) (ReviewVerdict, error)
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	linkPattern  = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+	phonePattern = regexp.MustCompile(`\+?\d[\d\s().-]{7,}\d`)
+)
+
+// MaskPII removes email addresses, links and phone numbers from a review so
+// they are never published. It reports whether anything was removed.
+func MaskPII(text string) (string, bool) {
+	masked := emailPattern.ReplaceAllString(text, "[removed]")
+	masked = linkPattern.ReplaceAllString(masked, "[removed]")
+	masked = phonePattern.ReplaceAllStringFunc(masked, func(match string) string {
+		digits := 0
+		for _, r := range match {
+			if r >= '0' && r <= '9' {
+				digits++
+			}
+		}
+		// Shorter runs are prices, times or table numbers
+		if digits < 10 {
+			return match
+		}
+		return "[removed]"
+	})
+	return masked, masked != text
+}
+
+// defaultBlockedWords are flagged by a WordListClassifier without a list
+var defaultBlockedWords = []string{
+	"asshole", "bastard", "bitch", "bullshit", "cunt", "dick", "fuck", "fucked",
+	"fucking", "motherfucker", "prick", "shit", "shitty", "slut", "whore",
+	"chutiya", "madarchod", "behenchod", "bhenchod", "gandu", "harami", "randi",
+}
+
+// leetReplacer undoes common letter substitutions used to dodge word lists
+var leetReplacer = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s")
+
+// WordListClassifier flags reviews containing a blocked word. It works
+// offline and is the default.
+type WordListClassifier struct {
+	Words []string // Defaults to a built in list of English and Hindi profanity
+}
+
+func (w WordListClassifier) Classify(text string) (ReviewVerdict, error) {
+	words := w.Words
+	if len(words) == 0 {
+		words = defaultBlockedWords
+	}
+	blocked := make(map[string]bool, len(words))
+	for _, word := range words {
+		blocked[strings.ToLower(word)] = true
+	}
+
+	normalized := leetReplacer.Replace(strings.ToLower(text))
+	for _, token := range strings.FieldsFunc(normalized, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z')
+	}) {
+		if blocked[token] {
+			return ReviewVerdict{Flagged: true, Reasons: []string{"profanity"}}, nil
+		}
+	}
+	return ReviewVerdict{}, nil
+}
+
+// OpenAIModerationClassifier uses the OpenAI moderation API, which also
+// catches harassment, hate and threats in any language.
+type OpenAIModerationClassifier struct {
+	APIKey string
+	Model  string // Defaults to omni-moderation-latest
+}
+
+func (o OpenAIModerationClassifier) Classify(text string) (ReviewVerdict, error) {
+	model := o.Model
+	if model == "" {
+		model = "omni-moderation-latest"
+	}
+
+	body, err := json.Marshal(map[string]string{"model": model, "input": text})
+	if err != nil {
+		return ReviewVerdict{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/moderations", bytes.NewReader(body))
+	if err != nil {
+		return ReviewVerdict{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ReviewVerdict{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ReviewVerdict{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ReviewVerdict{}, fmt.Errorf("moderation request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var result struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return ReviewVerdict{}, err
+	}
+
+	var verdict ReviewVerdict
+	for _, r := range result.Results {
+		verdict.Flagged = verdict.Flagged || r.Flagged
+		for category, flagged := range r.Categories {
+			if flagged {
+				verdict.Reasons = append(verdict.Reasons, category)
+			}
+		}
+	}
+	sort.Strings(verdict.Reasons)
+	return verdict, nil
+}
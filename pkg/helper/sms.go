@@ -0,0 +1,57 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SMSSender delivers a text message to a phone number
+type SMSSender interface {
+	SendSMS(phone, message string) error
+}
+
+// LogSMSSender only logs messages. It lets flows that send SMS run locally
+// without a provider account.
+type LogSMSSender struct{}
+
+func (LogSMSSender) SendSMS(phone, message string) error {
+	log.Printf("SMS to %s: %s\n", phone, message)
+	return nil
+}
+
+// TwilioSMSSender sends messages through the Twilio API
+type TwilioSMSSender struct {
+	AccountSID string
+	AuthToken  string
+	From       string
+}
+
+func (t TwilioSMSSender) SendSMS(phone, message string) error {
+	form := url.Values{"To": {phone}, "From": {t.From}, "Body": {message}}
+	endpoint := fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", t.AccountSID)
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.AccountSID, t.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("sms request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SpeechAudio is a synthesized narration
+type SpeechAudio struct {
+	Data        []byte
+	ContentType string
+	Extension   string // Including the dot, e.g. ".mp3"
+}
+
+// SpeechSynthesizer turns text into speech. Name identifies the provider and
+// voice, audio is generated again when it changes.
+type SpeechSynthesizer interface {
+	Name() string
+	Synthesize(text, language string) (SpeechAudio, error)
+}
+
+// StubSynthesizer produces silent audio as long as the text would take to
+// read. It lets the audio pipeline run locally without a TTS account.
+type StubSynthesizer struct{}
+
+func (StubSynthesizer) Name() string {
+	return "stub"
+}
+
+func (StubSynthesizer) Synthesize(text, language string) (SpeechAudio, error) {
+	const sampleRate = 8000
+
+	// About three words a second, at most a minute
+	seconds := float64(len(strings.Fields(text)))/3 + 0.5
+	if seconds > 60 {
+		seconds = 60
+	}
+	samples := int(seconds * sampleRate)
+
+	var wav bytes.Buffer
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(36+samples))
+	wav.WriteString("WAVEfmt ")
+	binary.Write(&wav, binary.LittleEndian, uint32(16))         // Format chunk size
+	binary.Write(&wav, binary.LittleEndian, uint16(1))          // PCM
+	binary.Write(&wav, binary.LittleEndian, uint16(1))          // Mono
+	binary.Write(&wav, binary.LittleEndian, uint32(sampleRate)) // Sample rate
+	binary.Write(&wav, binary.LittleEndian, uint32(sampleRate)) // Byte rate
+	binary.Write(&wav, binary.LittleEndian, uint16(1))          // Block align
+	binary.Write(&wav, binary.LittleEndian, uint16(8))          // Bits per sample
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(samples))
+	wav.Write(bytes.Repeat([]byte{128}, samples)) // 8 bit silence
+
+	return SpeechAudio{Data: wav.Bytes(), ContentType: "audio/wav", Extension: ".wav"}, nil
+}
+
+// OpenAISynthesizer uses the OpenAI speech API. The voices speak the
+// language of the text, so the language is not sent.
+type OpenAISynthesizer struct {
+	APIKey string
+	Model  string // Defaults to tts-1
+	Voice  string // Defaults to alloy
+}
+
+func (s OpenAISynthesizer) model() string {
+	if s.Model == "" {
+		return "tts-1"
+	}
+	return s.Model
+}
+
+func (s OpenAISynthesizer) voice() string {
+	if s.Voice == "" {
+		return "alloy"
+	}
+	return s.Voice
+}
+
+func (s OpenAISynthesizer) Name() string {
+	return fmt.Sprintf("openai:%s:%s", s.model(), s.voice())
+}
+
+func (s OpenAISynthesizer) Synthesize(text, language string) (SpeechAudio, error) {
+	// The API takes at most 4096 characters
+	if runes := []rune(text); len(runes) > 4096 {
+		text = string(runes[:4096])
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"model":           s.model(),
+		"voice":           s.voice(),
+		"input":           text,
+		"response_format": "mp3",
+	})
+	if err != nil {
+		return SpeechAudio{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return SpeechAudio{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return SpeechAudio{}, err
+	}
+	defer resp.Body.Close()
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return SpeechAudio{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return SpeechAudio{}, fmt.Errorf("speech request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(audio)))
+	}
+
+	return SpeechAudio{Data: audio, ContentType: "audio/mpeg", Extension: ".mp3"}, nil
+}
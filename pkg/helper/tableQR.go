@@ -0,0 +1,107 @@
+package helper
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+var ErrInvalidTableQR = errors.New("invalid table QR payload")
+
+// SignTableQR encodes the payload as base64url JSON followed by an HMAC-SHA256
+// signature, separated by a dot.
+func SignTableQR(payload structures.TableQRPayload, secret string) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + tableQRSignature(encoded, secret), nil
+}
+
+// VerifyTableQR checks the signature of a payload produced by SignTableQR
+// and returns its decoded content.
+func VerifyTableQR(token, secret string) (structures.TableQRPayload, error) {
+	var payload structures.TableQRPayload
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return payload, ErrInvalidTableQR
+	}
+
+	expected := tableQRSignature(parts[0], secret)
+	if !hmac.Equal([]byte(expected), []byte(parts[1])) {
+		return payload, ErrInvalidTableQR
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return payload, ErrInvalidTableQR
+	}
+
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return payload, ErrInvalidTableQR
+	}
+
+	return payload, nil
+}
+
+// TableQRContent builds the string encoded in the QR image. When a base URL
+// is configured the signed payload is appended as a query parameter so the
+// code opens the app directly.
+func TableQRContent(token, baseURL string) string {
+	if baseURL == "" {
+		return token
+	}
+
+	separator := "?"
+	if strings.Contains(baseURL, "?") {
+		separator = "&"
+	}
+	return baseURL + separator + "qr=" + token
+}
+
+// QRCodePNG renders content as a PNG image of the given size in pixels
+func QRCodePNG(content string, size int) ([]byte, error) {
+	return qrcode.Encode(content, qrcode.Medium, size)
+}
+
+// QRCodeSVG renders content as an SVG image with one square per module
+func QRCodeSVG(content string) (string, error) {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return "", err
+	}
+
+	bitmap := code.Bitmap()
+	size := len(bitmap)
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="#ffffff"/>`, size, size)
+	svg.WriteString(`<path fill="#000000" d="`)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&svg, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	svg.WriteString(`"/></svg>`)
+
+	return svg.String(), nil
+}
+
+func tableQRSignature(encoded, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,75 @@
+package helper
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"strings"
+	"testing"
+)
+
+func TestSignTableQRRoundTrip(t *testing.T) {
+	payload := structures.TableQRPayload{CafeID: 3, TableID: 12, TableName: "Patio 4", Version: 2}
+
+	token, err := SignTableQR(payload, "qr-secret")
+	if err != nil {
+		t.Fatalf("SignTableQR: %v", err)
+	}
+	got, err := VerifyTableQR(token, "qr-secret")
+	if err != nil {
+		t.Fatalf("VerifyTableQR: %v", err)
+	}
+	if got != payload {
+		t.Errorf("payload = %+v, want %+v", got, payload)
+	}
+}
+
+func TestVerifyTableQRRejects(t *testing.T) {
+	token, err := SignTableQR(structures.TableQRPayload{CafeID: 3, TableID: 12, Version: 1}, "qr-secret")
+	if err != nil {
+		t.Fatalf("SignTableQR: %v", err)
+	}
+	encoded, signature, _ := strings.Cut(token, ".")
+	other, err := SignTableQR(structures.TableQRPayload{CafeID: 3, TableID: 13, Version: 1}, "qr-secret")
+	if err != nil {
+		t.Fatalf("SignTableQR: %v", err)
+	}
+	otherEncoded, _, _ := strings.Cut(other, ".")
+
+	tests := []struct {
+		name   string
+		token  string
+		secret string
+	}{
+		{"wrong secret", token, "other-secret"},
+		{"payload of another table", otherEncoded + "." + signature, "qr-secret"},
+		{"missing signature", encoded, "qr-secret"},
+		{"empty signature", encoded + ".", "qr-secret"},
+		{"extra part", token + ".x", "qr-secret"},
+		{"empty", "", "qr-secret"},
+		{"signed garbage", "bm90IGpzb24." + tableQRSignature("bm90IGpzb24", "qr-secret"), "qr-secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyTableQR(tt.token, tt.secret); err != ErrInvalidTableQR {
+				t.Errorf("err = %v, want ErrInvalidTableQR", err)
+			}
+		})
+	}
+}
+
+func TestTableQRContent(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{"", "tok"},
+		{"https://app.example/scan", "https://app.example/scan?qr=tok"},
+		{"https://app.example/scan?src=table", "https://app.example/scan?src=table&qr=tok"},
+	}
+
+	for _, tt := range tests {
+		if got := TableQRContent("tok", tt.baseURL); got != tt.want {
+			t.Errorf("TableQRContent(%q) = %q, want %q", tt.baseURL, got, tt.want)
+		}
+	}
+}
@@ -2,7 +2,13 @@ package helper
 
 import (
 	"coffeeMustacheBackend/pkg/structures"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
 	"os"
+	"strconv"
+	"time"
 )
 
 func IsLambda() bool {
@@ -20,3 +26,37 @@ func IsValid(addedvia structures.CartInsertType) bool {
 		return false
 	}
 }
+
+// GenerateTableCode returns a random 4-digit numeric code from a CSPRNG
+func GenerateTableCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(10000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%04d", n.Int64()), nil
+}
+
+// GenerateToken returns a random hex token of n bytes from a CSPRNG
+func GenerateToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// MinutesOrDefault parses a number of minutes from configuration, falling
+// back to the default when the value is missing or invalid.
+func MinutesOrDefault(value string, fallback int) time.Duration {
+	return time.Duration(IntOrDefault(value, fallback)) * time.Minute
+}
+
+// IntOrDefault parses a positive integer from configuration, falling back to
+// the default when the value is missing or invalid.
+func IntOrDefault(value string, fallback int) int {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return fallback
+	}
+	return n
+}
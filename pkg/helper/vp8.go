@@ -0,0 +1,539 @@
+package helper
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+// Lossy WebP (VP8 key frame) encoder. Every macroblock is predicted from
+// the average of its neighbours, tokens use the default probabilities and
+// the loop filter is off. That is enough to be well below the size of
+// lossless WebP for photos.
+
+var vp8Zigzag = [16]int{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+
+// Band of each coefficient position, the extra entry is read after the last one
+var vp8Bands = [17]int{0, 1, 2, 3, 6, 4, 5, 6, 6, 6, 6, 6, 6, 6, 6, 7, 0}
+
+var (
+	vp8Cat3 = []uint8{173, 148, 140}
+	vp8Cat4 = []uint8{176, 155, 140, 135}
+	vp8Cat5 = []uint8{180, 157, 141, 134, 130}
+	vp8Cat6 = []uint8{254, 254, 243, 230, 196, 177, 153, 140, 133, 130, 129}
+)
+
+// Block types indexing the token probabilities
+const (
+	vp8TypeYAC = 0 // Luma without DC, which goes to the Y2 block
+	vp8TypeY2  = 1
+	vp8TypeUV  = 2
+)
+
+// vp8BoolWriter is the boolean entropy encoder of RFC 6386 section 7
+type vp8BoolWriter struct {
+	buf      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func newVP8BoolWriter() *vp8BoolWriter {
+	return &vp8BoolWriter{rng: 255, bitCount: 24}
+}
+
+func (w *vp8BoolWriter) putBit(bit bool, prob uint8) bool {
+	split := 1 + ((w.rng-1)*uint32(prob))>>8
+	if bit {
+		w.bottom += split
+		w.rng -= split
+	} else {
+		w.rng = split
+	}
+
+	for w.rng < 128 {
+		w.rng <<= 1
+		if w.bottom&(1<<31) != 0 {
+			// Carry into the bytes already written
+			i := len(w.buf) - 1
+			for i >= 0 && w.buf[i] == 0xff {
+				w.buf[i] = 0
+				i--
+			}
+			if i >= 0 {
+				w.buf[i]++
+			}
+		}
+		w.bottom <<= 1
+		w.bitCount--
+		if w.bitCount == 0 {
+			w.buf = append(w.buf, byte(w.bottom>>24))
+			w.bottom &= 1<<24 - 1
+			w.bitCount = 8
+		}
+	}
+	return bit
+}
+
+func (w *vp8BoolWriter) putLiteral(value, bits int) {
+	for bit := bits - 1; bit >= 0; bit-- {
+		w.putBit(value>>bit&1 == 1, 128)
+	}
+}
+
+func (w *vp8BoolWriter) bytes() []byte {
+	// Pad with zeros so the decoder can read past the last value
+	for i := 0; i < 32; i++ {
+		w.putBit(false, 128)
+	}
+	return w.buf
+}
+
+type vp8Quant struct {
+	y1, y2, uv [2]int // DC and AC step sizes
+}
+
+func newVP8Quant(index int) vp8Quant {
+	y2AC := int(vp8AcTable[index]) * 155 / 100
+	if y2AC < 8 {
+		y2AC = 8
+	}
+	return vp8Quant{
+		y1: [2]int{int(vp8DcTable[index]), int(vp8AcTable[index])},
+		y2: [2]int{int(vp8DcTable[index]) * 2, y2AC},
+		uv: [2]int{int(vp8DcTable[min(index, 117)]), int(vp8AcTable[index])},
+	}
+}
+
+// vp8Plane is one color plane padded to whole macroblocks
+type vp8Plane struct {
+	pix    []uint8
+	stride int
+}
+
+func (p vp8Plane) at(x, y int) int {
+	return int(p.pix[y*p.stride+x])
+}
+
+// encodeVP8 returns the VP8 frame of an opaque image. Quality runs from 0 to 100.
+func encodeVP8(img *image.NRGBA, quality int) []byte {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	mbWidth, mbHeight := (width+15)/16, (height+15)/16
+
+	srcY, srcU, srcV := vp8YUV(img, mbWidth, mbHeight)
+	recY := vp8Plane{pix: make([]uint8, len(srcY.pix)), stride: srcY.stride}
+	recU := vp8Plane{pix: make([]uint8, len(srcU.pix)), stride: srcU.stride}
+	recV := vp8Plane{pix: make([]uint8, len(srcV.pix)), stride: srcV.stride}
+
+	quality = max(0, min(100, quality))
+	index := (100 - quality) * 127 / 100
+	quant := newVP8Quant(index)
+
+	header := newVP8BoolWriter()
+	header.putLiteral(0, 1) // Color space
+	header.putLiteral(0, 1) // Clamping required
+	header.putLiteral(0, 1) // No segmentation
+	header.putLiteral(0, 1) // Normal filter
+	header.putLiteral(0, 6) // Filter level, off
+	header.putLiteral(0, 3) // Sharpness
+	header.putLiteral(0, 1) // No filter adjustments
+	header.putLiteral(0, 2) // One token partition
+	header.putLiteral(index, 7)
+	for i := 0; i < 5; i++ {
+		header.putLiteral(0, 1) // No quantizer deltas
+	}
+	header.putLiteral(0, 1) // Refresh entropy probabilities
+	for t := range vp8CoeffUpdateProbs {
+		for b := range vp8CoeffUpdateProbs[t] {
+			for c := range vp8CoeffUpdateProbs[t][b] {
+				for _, prob := range vp8CoeffUpdateProbs[t][b][c] {
+					header.putBit(false, prob)
+				}
+			}
+		}
+	}
+	header.putLiteral(0, 1) // Every macroblock codes its tokens
+
+	tokens := newVP8BoolWriter()
+
+	// Whether the neighbouring blocks had coefficients: 4 luma, 2 U, 2 V and Y2
+	topNz := make([][9]bool, mbWidth)
+	for mbY := 0; mbY < mbHeight; mbY++ {
+		var leftNz [9]bool
+		for mbX := 0; mbX < mbWidth; mbX++ {
+			// DC prediction for luma and chroma
+			header.putBit(true, 145)
+			header.putBit(false, 156)
+			header.putBit(false, 163)
+			header.putBit(false, 142)
+
+			var yLevels [16][16]int
+			y2Levels := vp8EncodeLuma(srcY, recY, mbX, mbY, quant, &yLevels)
+			var uLevels, vLevels [4][16]int
+			vp8EncodeChroma(srcU, recU, mbX, mbY, quant, &uLevels)
+			vp8EncodeChroma(srcV, recV, mbX, mbY, quant, &vLevels)
+
+			top := &topNz[mbX]
+			nz := vp8PutCoeffs(tokens, vp8TypeY2, vp8NzContext(top[8], leftNz[8]), 0, y2Levels)
+			top[8], leftNz[8] = nz, nz
+
+			for by := 0; by < 4; by++ {
+				for bx := 0; bx < 4; bx++ {
+					nz := vp8PutCoeffs(tokens, vp8TypeYAC, vp8NzContext(top[bx], leftNz[by]), 1, yLevels[by*4+bx])
+					top[bx], leftNz[by] = nz, nz
+				}
+			}
+			for plane, levels := range [2]*[4][16]int{&uLevels, &vLevels} {
+				offset := 4 + plane*2
+				for by := 0; by < 2; by++ {
+					for bx := 0; bx < 2; bx++ {
+						nz := vp8PutCoeffs(tokens, vp8TypeUV, vp8NzContext(top[offset+bx], leftNz[offset+by]), 0, levels[by*2+bx])
+						top[offset+bx], leftNz[offset+by] = nz, nz
+					}
+				}
+			}
+		}
+	}
+
+	first := header.bytes()
+	second := tokens.bytes()
+
+	frame := make([]byte, 0, 10+len(first)+len(second))
+	tag := uint32(len(first))<<5 | 1<<4 // Key frame, version 0, shown
+	frame = append(frame, byte(tag), byte(tag>>8), byte(tag>>16))
+	frame = append(frame, 0x9d, 0x01, 0x2a)
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(width))
+	frame = binary.LittleEndian.AppendUint16(frame, uint16(height))
+	frame = append(frame, first...)
+	return append(frame, second...)
+}
+
+func vp8NzContext(top, left bool) int {
+	ctx := 0
+	if top {
+		ctx++
+	}
+	if left {
+		ctx++
+	}
+	return ctx
+}
+
+// vp8YUV converts the image to BT.601 planes, repeating the edge pixels to
+// fill the last macroblocks. Chroma is averaged over 2x2 pixels.
+func vp8YUV(img *image.NRGBA, mbWidth, mbHeight int) (vp8Plane, vp8Plane, vp8Plane) {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	y := vp8Plane{pix: make([]uint8, mbWidth*16*mbHeight*16), stride: mbWidth * 16}
+	u := vp8Plane{pix: make([]uint8, mbWidth*8*mbHeight*8), stride: mbWidth * 8}
+	v := vp8Plane{pix: make([]uint8, mbWidth*8*mbHeight*8), stride: mbWidth * 8}
+
+	rgb := func(px, py int) (float64, float64, float64) {
+		p := img.Pix[min(py, height-1)*img.Stride+min(px, width-1)*4:]
+		return float64(p[0]), float64(p[1]), float64(p[2])
+	}
+
+	for py := 0; py < mbHeight*16; py++ {
+		for px := 0; px < mbWidth*16; px++ {
+			r, g, b := rgb(px, py)
+			y.pix[py*y.stride+px] = clampByte(float32(16 + 0.257*r + 0.504*g + 0.098*b))
+		}
+	}
+	for py := 0; py < mbHeight*8; py++ {
+		for px := 0; px < mbWidth*8; px++ {
+			var r, g, b float64
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb := rgb(px*2+d[0], py*2+d[1])
+				r, g, b = r+pr/4, g+pg/4, b+pb/4
+			}
+			u.pix[py*u.stride+px] = clampByte(float32(128 - 0.148*r - 0.291*g + 0.439*b))
+			v.pix[py*v.stride+px] = clampByte(float32(128 + 0.439*r - 0.368*g - 0.071*b))
+		}
+	}
+	return y, u, v
+}
+
+// vp8PredictDC averages the reconstructed row above and column left of a
+// size x size block, as the decoder does.
+func vp8PredictDC(rec vp8Plane, x, y, size int) int {
+	sum, count := 0, 0
+	if y > 0 {
+		for i := 0; i < size; i++ {
+			sum += rec.at(x+i, y-1)
+		}
+		count += size
+	}
+	if x > 0 {
+		for i := 0; i < size; i++ {
+			sum += rec.at(x-1, y+i)
+		}
+		count += size
+	}
+	if count == 0 {
+		return 128
+	}
+	return (sum + count/2) / count
+}
+
+// vp8EncodeLuma transforms and quantizes the luma of a macroblock, writes
+// its reconstruction and returns the Y2 levels.
+func vp8EncodeLuma(src, rec vp8Plane, mbX, mbY int, quant vp8Quant, levels *[16][16]int) [16]int {
+	x0, y0 := mbX*16, mbY*16
+	prediction := vp8PredictDC(rec, x0, y0, 16)
+
+	var coeffs [16][16]int
+	var dc [16]int
+	for b := 0; b < 16; b++ {
+		bx, by := x0+b%4*4, y0+b/4*4
+		var residual [16]int
+		for i := range residual {
+			residual[i] = src.at(bx+i%4, by+i/4) - prediction
+		}
+		coeffs[b] = vp8FDCT(residual)
+		dc[b] = coeffs[b][0]
+	}
+
+	y2 := vp8FWHT(dc)
+	var y2Levels [16]int
+	var y2Dequant [16]int
+	for n := 0; n < 16; n++ {
+		pos := vp8Zigzag[n]
+		step := quant.y2[min(n, 1)]
+		y2Levels[n] = vp8Quantize(y2[pos], step, n == 0)
+		y2Dequant[pos] = y2Levels[n] * step
+	}
+	dcRecon := vp8IWHT(y2Dequant)
+
+	for b := 0; b < 16; b++ {
+		var dequant [16]int
+		dequant[0] = dcRecon[b]
+		for n := 1; n < 16; n++ {
+			pos := vp8Zigzag[n]
+			levels[b][n] = vp8Quantize(coeffs[b][pos], quant.y1[1], false)
+			dequant[pos] = levels[b][n] * quant.y1[1]
+		}
+		vp8IDCTAdd(rec, x0+b%4*4, y0+b/4*4, prediction, dequant)
+	}
+	return y2Levels
+}
+
+// vp8EncodeChroma transforms and quantizes one chroma plane of a macroblock
+func vp8EncodeChroma(src, rec vp8Plane, mbX, mbY int, quant vp8Quant, levels *[4][16]int) {
+	x0, y0 := mbX*8, mbY*8
+	prediction := vp8PredictDC(rec, x0, y0, 8)
+
+	for b := 0; b < 4; b++ {
+		bx, by := x0+b%2*4, y0+b/2*4
+		var residual [16]int
+		for i := range residual {
+			residual[i] = src.at(bx+i%4, by+i/4) - prediction
+		}
+		coeffs := vp8FDCT(residual)
+
+		var dequant [16]int
+		for n := 0; n < 16; n++ {
+			pos := vp8Zigzag[n]
+			step := quant.uv[min(n, 1)]
+			levels[b][n] = vp8Quantize(coeffs[pos], step, n == 0)
+			dequant[pos] = levels[b][n] * step
+		}
+		vp8IDCTAdd(rec, bx, by, prediction, dequant)
+	}
+}
+
+// vp8Quantize rounds DC to the nearest step and biases AC towards zero,
+// which saves more bits than it costs in quality.
+func vp8Quantize(coeff, step int, dc bool) int {
+	sign := 1
+	if coeff < 0 {
+		sign, coeff = -1, -coeff
+	}
+	bias := step / 3
+	if dc {
+		bias = step / 2
+	}
+	return sign * min((coeff+bias)/step, 2047)
+}
+
+// vp8FDCT is the forward transform matching the decoder's inverse transform
+func vp8FDCT(in [16]int) [16]int {
+	var tmp, out [16]int
+	for i := 0; i < 4; i++ {
+		d := in[i*4 : i*4+4]
+		a0, a1 := d[0]+d[3], d[1]+d[2]
+		a2, a3 := d[1]-d[2], d[0]-d[3]
+		tmp[i*4+0] = (a0 + a1) * 8
+		tmp[i*4+1] = (a2*2217 + a3*5352 + 1812) >> 9
+		tmp[i*4+2] = (a0 - a1) * 8
+		tmp[i*4+3] = (a3*2217 - a2*5352 + 937) >> 9
+	}
+	for i := 0; i < 4; i++ {
+		a0, a1 := tmp[i]+tmp[12+i], tmp[4+i]+tmp[8+i]
+		a2, a3 := tmp[4+i]-tmp[8+i], tmp[i]-tmp[12+i]
+		out[i] = (a0 + a1 + 7) >> 4
+		out[4+i] = (a2*2217 + a3*5352 + 12000) >> 16
+		if a3 != 0 {
+			out[4+i]++
+		}
+		out[8+i] = (a0 - a1 + 7) >> 4
+		out[12+i] = (a3*2217 - a2*5352 + 51000) >> 16
+	}
+	return out
+}
+
+func vp8FWHT(in [16]int) [16]int {
+	var tmp, out [16]int
+	for i := 0; i < 4; i++ {
+		d := in[i*4 : i*4+4]
+		a0, a1 := d[0]+d[3], d[1]+d[2]
+		a2, a3 := d[1]-d[2], d[0]-d[3]
+		tmp[i*4+0] = a0 + a1
+		tmp[i*4+1] = a3 + a2
+		tmp[i*4+2] = a0 - a1
+		tmp[i*4+3] = a3 - a2
+	}
+	for i := 0; i < 4; i++ {
+		a0, a1 := tmp[i]+tmp[12+i], tmp[4+i]+tmp[8+i]
+		a2, a3 := tmp[4+i]-tmp[8+i], tmp[i]-tmp[12+i]
+		out[i] = (a0 + a1) >> 1
+		out[4+i] = (a3 + a2) >> 1
+		out[8+i] = (a0 - a1) >> 1
+		out[12+i] = (a3 - a2) >> 1
+	}
+	return out
+}
+
+// vp8IWHT is the decoder's inverse Walsh-Hadamard transform, bit exact so
+// the encoder predicts from the same pixels the decoder shows.
+func vp8IWHT(in [16]int) [16]int {
+	var tmp, out [16]int
+	for i := 0; i < 4; i++ {
+		a0, a1 := in[i]+in[12+i], in[4+i]+in[8+i]
+		a2, a3 := in[4+i]-in[8+i], in[i]-in[12+i]
+		tmp[i] = a0 + a1
+		tmp[8+i] = a0 - a1
+		tmp[4+i] = a3 + a2
+		tmp[12+i] = a3 - a2
+	}
+	for i := 0; i < 4; i++ {
+		dc := tmp[i*4] + 3
+		a0, a1 := dc+tmp[i*4+3], tmp[i*4+1]+tmp[i*4+2]
+		a2, a3 := tmp[i*4+1]-tmp[i*4+2], dc-tmp[i*4+3]
+		out[i*4+0] = (a0 + a1) >> 3
+		out[i*4+1] = (a3 + a2) >> 3
+		out[i*4+2] = (a0 - a1) >> 3
+		out[i*4+3] = (a3 - a2) >> 3
+	}
+	return out
+}
+
+func vp8Mul1(a int) int {
+	return (a*20091)>>16 + a
+}
+
+func vp8Mul2(a int) int {
+	return (a * 35468) >> 16
+}
+
+// vp8IDCTAdd is the decoder's inverse transform, adding the residual to the
+// prediction of a 4x4 block of the reconstruction.
+func vp8IDCTAdd(rec vp8Plane, x, y, prediction int, in [16]int) {
+	var tmp [16]int
+	for i := 0; i < 4; i++ {
+		a, b := in[i]+in[8+i], in[i]-in[8+i]
+		c := vp8Mul2(in[4+i]) - vp8Mul1(in[12+i])
+		d := vp8Mul1(in[4+i]) + vp8Mul2(in[12+i])
+		tmp[i*4+0] = a + d
+		tmp[i*4+1] = b + c
+		tmp[i*4+2] = b - c
+		tmp[i*4+3] = a - d
+	}
+	for i := 0; i < 4; i++ {
+		dc := tmp[i] + 4
+		a, b := dc+tmp[8+i], dc-tmp[8+i]
+		c := vp8Mul2(tmp[4+i]) - vp8Mul1(tmp[12+i])
+		d := vp8Mul1(tmp[4+i]) + vp8Mul2(tmp[12+i])
+		row := rec.pix[(y+i)*rec.stride+x:]
+		for col, v := range [4]int{a + d, b + c, b - c, a - d} {
+			row[col] = clampByte(float32(prediction + v>>3))
+		}
+	}
+}
+
+// vp8PutCoeffs writes the tokens of a block from its levels in zigzag order
+// and reports whether it had any.
+func vp8PutCoeffs(w *vp8BoolWriter, blockType, ctx, first int, levels [16]int) bool {
+	last := -1
+	for n := 15; n >= first; n-- {
+		if levels[n] != 0 {
+			last = n
+			break
+		}
+	}
+
+	probs := &vp8CoeffProbs[blockType]
+	p := probs[vp8Bands[first]][ctx][:]
+	if !w.putBit(last >= 0, p[0]) {
+		return false
+	}
+
+	for n := first; n < 16; {
+		v := levels[n]
+		n++
+		sign := v < 0
+		if sign {
+			v = -v
+		}
+
+		if !w.putBit(v != 0, p[1]) {
+			p = probs[vp8Bands[n]][0][:]
+			continue
+		}
+
+		if !w.putBit(v > 1, p[2]) {
+			p = probs[vp8Bands[n]][1][:]
+		} else {
+			switch {
+			case !w.putBit(v > 4, p[3]):
+				if w.putBit(v != 2, p[4]) {
+					w.putBit(v == 4, p[5])
+				}
+			case !w.putBit(v > 10, p[6]):
+				if !w.putBit(v > 6, p[7]) {
+					w.putBit(v == 6, 159)
+				} else {
+					w.putBit(v >= 9, 165)
+					w.putBit(v&1 == 0, 145)
+				}
+			default:
+				var extra []uint8
+				switch {
+				case v < 19:
+					w.putBit(false, p[8])
+					w.putBit(false, p[9])
+					v, extra = v-11, vp8Cat3
+				case v < 35:
+					w.putBit(false, p[8])
+					w.putBit(true, p[9])
+					v, extra = v-19, vp8Cat4
+				case v < 67:
+					w.putBit(true, p[8])
+					w.putBit(false, p[10])
+					v, extra = v-35, vp8Cat5
+				default:
+					w.putBit(true, p[8])
+					w.putBit(true, p[10])
+					v, extra = v-67, vp8Cat6
+				}
+				for i, prob := range extra {
+					w.putBit(v>>(len(extra)-1-i)&1 == 1, prob)
+				}
+			}
+			p = probs[vp8Bands[n]][2][:]
+		}
+
+		w.putBit(sign, 128)
+		if n == 16 || !w.putBit(n <= last, p[0]) {
+			return true
+		}
+	}
+	return true
+}
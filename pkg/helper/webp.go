@@ -0,0 +1,464 @@
+package helper
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"sort"
+)
+
+// Lossless WebP (VP8L) encoder, used for images with transparency. It
+// applies the subtract green and predictor transforms and codes every pixel
+// as a literal with one group of prefix codes.
+
+const (
+	webpMaxSize   = 1 << 14
+	webpTileBits  = 5 // Predictor tiles of 32x32 pixels
+	webpMaxLength = 15
+)
+
+var webpCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// Predictor modes tried for each tile
+var webpPredictors = []int{1, 2, 7, 11, 12}
+
+type webpBitWriter struct {
+	buf  []byte
+	acc  uint64
+	bits uint
+}
+
+func (w *webpBitWriter) write(value uint32, bits uint) {
+	w.acc |= uint64(value) << w.bits
+	w.bits += bits
+	for w.bits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.bits -= 8
+	}
+}
+
+func (w *webpBitWriter) bytes() []byte {
+	if w.bits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.bits = 0, 0
+	}
+	return w.buf
+}
+
+// webpPrefixCode holds the length and bit reversed code of every symbol. A
+// code with a single symbol has no lengths and costs no bits.
+type webpPrefixCode struct {
+	lengths []uint8
+	codes   []uint16
+}
+
+func (p webpPrefixCode) write(w *webpBitWriter, symbol int) {
+	w.write(uint32(p.codes[symbol]), uint(p.lengths[symbol]))
+}
+
+// EncodeWebP encodes opaque images as lossy WebP of the quality, from 0 to
+// 100, and images with transparency as lossless WebP.
+func EncodeWebP(img image.Image, quality int) ([]byte, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width >= webpMaxSize || height >= webpMaxSize {
+		return nil, errors.New("webp: image size out of range")
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	if nrgba.Opaque() {
+		return webpContainer("VP8 ", encodeVP8(nrgba, quality)), nil
+	}
+	return webpContainer("VP8L", encodeVP8L(nrgba)), nil
+}
+
+// webpContainer wraps a VP8 or VP8L bitstream in a RIFF file
+func webpContainer(fourCC string, data []byte) []byte {
+	padded := len(data) + len(data)%2
+
+	out := make([]byte, 0, 20+padded)
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(12+padded))
+	out = append(out, "WEBP"...)
+	out = append(out, fourCC...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(data)))
+	out = append(out, data...)
+	if len(data)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+func encodeVP8L(img *image.NRGBA) []byte {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	argb, hasAlpha := webpPixels(img)
+
+	w := &webpBitWriter{}
+	w.write(0x2f, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	if hasAlpha {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+	w.write(0, 3) // Version
+
+	// The decoder undoes the transforms in reverse order
+	w.write(1, 1)
+	w.write(2, 2) // Subtract green
+	webpSubtractGreen(argb)
+
+	w.write(1, 1)
+	w.write(0, 2) // Predictor
+	w.write(webpTileBits-2, 3)
+	modes, tilesX := webpChooseModes(argb, width, height)
+	webpWriteImage(w, modes, false)
+	argb = webpResiduals(argb, width, height, modes, tilesX)
+
+	w.write(0, 1) // No more transforms
+	webpWriteImage(w, argb, true)
+
+	return w.bytes()
+}
+
+func webpPixels(img *image.NRGBA) ([]uint32, bool) {
+	argb := make([]uint32, 0, img.Bounds().Dx()*img.Bounds().Dy())
+	hasAlpha := false
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			p := row[x*4 : x*4+4]
+			argb = append(argb, uint32(p[3])<<24|uint32(p[0])<<16|uint32(p[1])<<8|uint32(p[2]))
+			hasAlpha = hasAlpha || p[3] != 0xff
+		}
+	}
+	return argb, hasAlpha
+}
+
+func webpSubtractGreen(argb []uint32) {
+	for i, p := range argb {
+		green := (p >> 8) & 0xff
+		red := ((p >> 16) - green) & 0xff
+		blue := (p - green) & 0xff
+		argb[i] = p&0xff00ff00 | red<<16 | blue
+	}
+}
+
+func webpAverage2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func webpChannel(p uint32, shift uint) int {
+	return int((p >> shift) & 0xff)
+}
+
+func webpAbs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func webpSelect(left, top, topLeft uint32) uint32 {
+	distLeft, distTop := 0, 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		estimate := webpChannel(left, shift) + webpChannel(top, shift) - webpChannel(topLeft, shift)
+		distLeft += webpAbs(estimate - webpChannel(left, shift))
+		distTop += webpAbs(estimate - webpChannel(top, shift))
+	}
+	if distLeft < distTop {
+		return left
+	}
+	return top
+}
+
+func webpClampAddSubtractFull(a, b, c uint32) uint32 {
+	var out uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		v := webpChannel(a, shift) + webpChannel(b, shift) - webpChannel(c, shift)
+		if v < 0 {
+			v = 0
+		} else if v > 255 {
+			v = 255
+		}
+		out |= uint32(v) << shift
+	}
+	return out
+}
+
+// webpPredict returns the prediction of the pixel at x, y. The first row and
+// column use fixed predictors regardless of the mode.
+func webpPredict(argb []uint32, width, x, y, mode int) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[i-1]
+	case x == 0:
+		return argb[i-width]
+	}
+
+	left, top, topLeft := argb[i-1], argb[i-width], argb[i-width-1]
+	switch mode {
+	case 1:
+		return left
+	case 2:
+		return top
+	case 7:
+		return webpAverage2(left, top)
+	case 11:
+		return webpSelect(left, top, topLeft)
+	default:
+		return webpClampAddSubtractFull(left, top, topLeft)
+	}
+}
+
+func webpResidual(pixel, prediction uint32) uint32 {
+	alphaGreen := ((pixel | 0x00ff00ff) - (prediction & 0xff00ff00)) & 0xff00ff00
+	redBlue := ((pixel | 0xff00ff00) - (prediction & 0x00ff00ff)) & 0x00ff00ff
+	return alphaGreen | redBlue
+}
+
+// webpChooseModes picks the predictor of each tile with the smallest residuals
+func webpChooseModes(argb []uint32, width, height int) ([]uint32, int) {
+	tileSize := 1 << webpTileBits
+	tilesX := (width + tileSize - 1) / tileSize
+	tilesY := (height + tileSize - 1) / tileSize
+	modes := make([]uint32, tilesX*tilesY)
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			bestMode, bestCost := webpPredictors[0], -1
+			for _, mode := range webpPredictors {
+				cost := 0
+				for y := ty * tileSize; y < height && y < (ty+1)*tileSize; y++ {
+					for x := tx * tileSize; x < width && x < (tx+1)*tileSize; x++ {
+						residual := webpResidual(argb[y*width+x], webpPredict(argb, width, x, y, mode))
+						for shift := uint(0); shift < 32; shift += 8 {
+							cost += webpAbs(int(int8(residual >> shift)))
+						}
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					bestMode, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = 0xff000000 | uint32(bestMode)<<8
+		}
+	}
+	return modes, tilesX
+}
+
+func webpResiduals(argb []uint32, width, height int, modes []uint32, tilesX int) []uint32 {
+	residuals := make([]uint32, len(argb))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			mode := int((modes[(y>>webpTileBits)*tilesX+(x>>webpTileBits)] >> 8) & 0xff)
+			residuals[y*width+x] = webpResidual(argb[y*width+x], webpPredict(argb, width, x, y, mode))
+		}
+	}
+	return residuals
+}
+
+// webpWriteImage writes the prefix codes and pixels of an image without a
+// color cache. Every pixel is coded as a literal. Only the main image has
+// the meta prefix code flag.
+func webpWriteImage(w *webpBitWriter, argb []uint32, main bool) {
+	w.write(0, 1) // No color cache
+	if main {
+		w.write(0, 1) // One prefix code group for the whole image
+	}
+
+	counts := [5][]int{make([]int, 256+24), make([]int, 256), make([]int, 256), make([]int, 256), make([]int, 40)}
+	for _, p := range argb {
+		counts[0][(p>>8)&0xff]++
+		counts[1][(p>>16)&0xff]++
+		counts[2][p&0xff]++
+		counts[3][p>>24]++
+	}
+
+	var codes [5]webpPrefixCode
+	for i := range codes {
+		codes[i] = webpWritePrefixCode(w, counts[i])
+	}
+
+	for _, p := range argb {
+		codes[0].write(w, int((p>>8)&0xff))
+		codes[1].write(w, int((p>>16)&0xff))
+		codes[2].write(w, int(p&0xff))
+		codes[3].write(w, int(p>>24))
+	}
+}
+
+// webpWritePrefixCode writes the prefix code for the symbol counts and
+// returns it. Codes of one or two small symbols use the simple form.
+func webpWritePrefixCode(w *webpBitWriter, counts []int) webpPrefixCode {
+	var used []int
+	for symbol, count := range counts {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+	if len(used) == 0 {
+		used = []int{0} // The code is never read, any symbol does
+	}
+
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		w.write(1, 1)
+		w.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(used[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(used[0]), 8)
+		}
+
+		lengths := make([]uint8, len(counts))
+		if len(used) == 2 {
+			w.write(uint32(used[1]), 8)
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		}
+		return webpPrefixCode{lengths: lengths, codes: webpCanonicalCodes(lengths)}
+	}
+
+	lengths := webpCodeLengths(counts, webpMaxLength)
+	w.write(0, 1)
+
+	// Code lengths are sent as literals 0 to 15, without repeat codes
+	lengthCounts := make([]int, 19)
+	for _, length := range lengths {
+		lengthCounts[length]++
+	}
+	nonZero := 0
+	for _, count := range lengthCounts {
+		if count > 0 {
+			nonZero++
+		}
+	}
+	if nonZero == 1 {
+		// A complete code needs two symbols, the extra one is never written
+		if lengthCounts[0] == 0 {
+			lengthCounts[0] = 1
+		} else {
+			lengthCounts[1] = 1
+		}
+	}
+	lengthLengths := webpCodeLengths(lengthCounts, 7)
+	lengthCodes := webpCanonicalCodes(lengthLengths)
+
+	n := len(webpCodeLengthOrder)
+	for n > 4 && lengthLengths[webpCodeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	w.write(uint32(n-4), 4)
+	for _, symbol := range webpCodeLengthOrder[:n] {
+		w.write(uint32(lengthLengths[symbol]), 3)
+	}
+
+	w.write(0, 1) // Lengths follow for the whole alphabet
+	for _, length := range lengths {
+		w.write(uint32(lengthCodes[length]), uint(lengthLengths[length]))
+	}
+
+	return webpPrefixCode{lengths: lengths, codes: webpCanonicalCodes(lengths)}
+}
+
+// webpCodeLengths builds Huffman code lengths of at most limit bits. When the
+// tree is too deep the counts are halved, flattening it, until it fits.
+func webpCodeLengths(counts []int, limit int) []uint8 {
+	type node struct {
+		weight int
+		parent int
+	}
+
+	weights := append([]int(nil), counts...)
+	lengths := make([]uint8, len(counts))
+	for {
+		var nodes []node
+		leaves := make(map[int]int)
+		var active []int
+		for symbol, weight := range weights {
+			if weight > 0 {
+				leaves[symbol] = len(nodes)
+				active = append(active, len(nodes))
+				nodes = append(nodes, node{weight: weight, parent: -1})
+			}
+		}
+
+		for len(active) > 1 {
+			sort.SliceStable(active, func(i, j int) bool {
+				return nodes[active[i]].weight < nodes[active[j]].weight
+			})
+			a, b := active[0], active[1]
+			nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, parent: -1})
+			nodes[a].parent = len(nodes) - 1
+			nodes[b].parent = len(nodes) - 1
+			active = append(active[2:], len(nodes)-1)
+		}
+
+		deepest := 0
+		for symbol, leaf := range leaves {
+			depth := 0
+			for i := leaf; nodes[i].parent >= 0; i = nodes[i].parent {
+				depth++
+			}
+			lengths[symbol] = uint8(depth)
+			if depth > deepest {
+				deepest = depth
+			}
+		}
+		if deepest <= limit {
+			return lengths
+		}
+
+		for symbol, weight := range weights {
+			if weight > 0 {
+				weights[symbol] = (weight + 1) / 2
+			}
+		}
+	}
+}
+
+// webpCanonicalCodes assigns canonical codes to the lengths, bit reversed as
+// the stream is written least significant bit first.
+func webpCanonicalCodes(lengths []uint8) []uint16 {
+	var lengthCount [webpMaxLength + 1]int
+	for _, length := range lengths {
+		if length > 0 {
+			lengthCount[length]++
+		}
+	}
+
+	var next [webpMaxLength + 1]int
+	code := 0
+	for length := 1; length <= webpMaxLength; length++ {
+		code = (code + lengthCount[length-1]) << 1
+		next[length] = code
+	}
+
+	codes := make([]uint16, len(lengths))
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		code := next[length]
+		next[length]++
+
+		reversed := 0
+		for i := 0; i < int(length); i++ {
+			reversed = reversed<<1 | (code>>i)&1
+		}
+		codes[symbol] = uint16(reversed)
+	}
+	return codes
+}
@@ -0,0 +1,116 @@
+package helper
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// webpTestImage draws a gradient with a few hard edges. Transparent images
+// get a varying alpha and a fully transparent corner.
+func webpTestImage(width, height int, transparent bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{
+				R: uint8(x * 255 / width),
+				G: uint8(y * 255 / height),
+				B: uint8((x + y) * 4),
+				A: 255,
+			}
+			if (x/8+y/8)%2 == 0 {
+				c.B = 255 - c.B
+			}
+			if transparent {
+				c.A = uint8(255 - (x+1)*200/width)
+				if x < width/4 && y < height/4 {
+					c = color.NRGBA{}
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestEncodeWebPRoundTrip(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		transparent   bool
+	}{
+		{"opaque 1x1", 1, 1, false},
+		{"opaque odd", 37, 23, false},
+		{"opaque wide", 101, 3, false},
+		{"opaque tall", 5, 67, false},
+		{"transparent 1x1", 1, 1, true},
+		{"transparent odd", 37, 23, true},
+		{"transparent wide", 101, 3, true},
+		{"transparent tall", 5, 67, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := webpTestImage(tt.width, tt.height, tt.transparent)
+			encoded, err := EncodeWebP(src, 90)
+			if err != nil {
+				t.Fatalf("EncodeWebP: %v", err)
+			}
+
+			decoded, err := webp.Decode(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got := decoded.Bounds().Size(); got != src.Bounds().Size() {
+				t.Fatalf("size = %v, want %v", got, src.Bounds().Size())
+			}
+
+			if tt.transparent {
+				// Lossless, so every visible pixel comes back as it was
+				for y := 0; y < tt.height; y++ {
+					for x := 0; x < tt.width; x++ {
+						want := src.NRGBAAt(x, y)
+						got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+						if want.A == 0 && got.A == 0 {
+							continue
+						}
+						if got != want {
+							t.Fatalf("pixel %d,%d = %v, want %v", x, y, got, want)
+						}
+					}
+				}
+				return
+			}
+
+			// Lossy, so the planes only need to be close to the ones encoded.
+			// Comparing in YCbCr leaves out the loss of chroma subsampling.
+			ycbcr, ok := decoded.(*image.YCbCr)
+			if !ok {
+				t.Fatalf("decoded %T, want a lossy *image.YCbCr", decoded)
+			}
+			srcY, srcU, srcV := vp8YUV(src, (tt.width+15)/16, (tt.height+15)/16)
+			var diff, samples int
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					got := ycbcr.YCbCrAt(x, y)
+					diff += webpAbs(int(got.Y) - srcY.at(x, y))
+					diff += webpAbs(int(got.Cb) - srcU.at(x/2, y/2))
+					diff += webpAbs(int(got.Cr) - srcV.at(x/2, y/2))
+					samples += 3
+				}
+			}
+			if mean := float64(diff) / float64(samples); mean > 3 {
+				t.Errorf("mean sample error = %.1f, want at most 3", mean)
+			}
+		})
+	}
+}
+
+func TestEncodeWebPRejectsEmptyImage(t *testing.T) {
+	if _, err := EncodeWebP(image.NewNRGBA(image.Rect(0, 0, 0, 5)), 80); err == nil {
+		t.Error("EncodeWebP accepted an empty image")
+	}
+}
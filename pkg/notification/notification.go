@@ -0,0 +1,111 @@
+// Package notification delivers messages to staff and guests over push, SMS,
+// email and webhooks, retrying failed deliveries with backoff.
+package notification
+
+import (
+	"errors"
+	"time"
+)
+
+// Channel is a way of delivering a message
+type Channel string
+
+const (
+	ChannelFCM     Channel = "fcm"
+	ChannelExpo    Channel = "expo"
+	ChannelSMS     Channel = "sms"
+	ChannelEmail   Channel = "email"
+	ChannelWebhook Channel = "webhook"
+)
+
+// Channels lists every channel a cafe can configure
+var Channels = []Channel{ChannelFCM, ChannelExpo, ChannelSMS, ChannelEmail, ChannelWebhook}
+
+// IsPush reports whether the channel delivers to device tokens
+func (c Channel) IsPush() bool {
+	return c == ChannelFCM || c == ChannelExpo
+}
+
+// ErrInvalidRecipient is returned, wrapped, when the provider reports that the
+// recipient no longer exists, e.g. an uninstalled app. Such deliveries are not
+// retried and push tokens should be removed.
+var ErrInvalidRecipient = errors.New("recipient is no longer valid")
+
+// Message is what is delivered. URL is opened when a push notification is
+// tapped and linked in the other channels.
+type Message struct {
+	Event string            `json:"event"`
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	URL   string            `json:"url,omitempty"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// Provider delivers messages over one channel. The recipient is a device
+// token, phone number, email address or URL depending on the channel.
+type Provider interface {
+	Channel() Channel
+	Send(recipient string, msg Message) error
+}
+
+// Result is the outcome of delivering a message to one recipient
+type Result struct {
+	Channel   Channel
+	Recipient string
+	Attempts  int
+	Err       error
+}
+
+// Invalid reports whether the recipient should be forgotten
+func (r Result) Invalid() bool {
+	return errors.Is(r.Err, ErrInvalidRecipient)
+}
+
+// Dispatcher sends messages through its providers, retrying each delivery
+// up to MaxAttempts times and doubling the wait after every failure.
+type Dispatcher struct {
+	Providers   map[Channel]Provider
+	MaxAttempts int           // Defaults to 3
+	Backoff     time.Duration // Wait after the first failure, defaults to 200ms
+}
+
+// Register adds a provider, replacing the one of the same channel
+func (d *Dispatcher) Register(provider Provider) {
+	if d.Providers == nil {
+		d.Providers = make(map[Channel]Provider)
+	}
+	d.Providers[provider.Channel()] = provider
+}
+
+// Send delivers the message to one recipient
+func (d *Dispatcher) Send(channel Channel, recipient string, msg Message) Result {
+	result := Result{Channel: channel, Recipient: recipient}
+
+	provider, ok := d.Providers[channel]
+	if !ok {
+		result.Err = errors.New("no provider for channel " + string(channel))
+		return result
+	}
+
+	attempts := d.MaxAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	backoff := d.Backoff
+	if backoff <= 0 {
+		backoff = 200 * time.Millisecond
+	}
+
+	for result.Attempts < attempts {
+		if result.Attempts > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		result.Attempts++
+		result.Err = provider.Send(recipient, msg)
+		if result.Err == nil || result.Invalid() {
+			break
+		}
+	}
+	return result
+}
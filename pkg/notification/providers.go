@@ -0,0 +1,118 @@
+package notification
+
+import (
+	"bytes"
+	"coffeeMustacheBackend/pkg/helper"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMSProvider sends the body of messages, followed by the link, as SMS. An
+// unsubscribe_url in the data is added at the end.
+type SMSProvider struct {
+	Sender helper.SMSSender
+}
+
+func (p SMSProvider) Channel() Channel {
+	return ChannelSMS
+}
+
+func (p SMSProvider) Send(phone string, msg Message) error {
+	text := msg.Body
+	if msg.URL != "" {
+		text += " " + msg.URL
+	}
+	if unsubscribe := msg.Data["unsubscribe_url"]; unsubscribe != "" {
+		text += " Stop these messages: " + unsubscribe
+	}
+	return p.Sender.SendSMS(phone, text)
+}
+
+// EmailProvider sends plain text emails through an SMTP server
+type EmailProvider struct {
+	Host     string
+	Port     string // Defaults to 587
+	Username string
+	Password string
+	From     string
+}
+
+func (p EmailProvider) Channel() Channel {
+	return ChannelEmail
+}
+
+func (p EmailProvider) Send(address string, msg Message) error {
+	port := p.Port
+	if port == "" {
+		port = "587"
+	}
+
+	body := msg.Body
+	if msg.URL != "" {
+		body += "\r\n\r\n" + msg.URL
+	}
+	if unsubscribe := msg.Data["unsubscribe_url"]; unsubscribe != "" {
+		body += "\r\n\r\nStop these emails: " + unsubscribe
+	}
+	// Header values must not contain line breaks
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(msg.Title)
+	mail := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		p.From, address, subject, body)
+
+	var auth smtp.Auth
+	if p.Username != "" {
+		auth = smtp.PlainAuth("", p.Username, p.Password, p.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(p.Host, port), auth, p.From, []string{address}, []byte(mail))
+}
+
+// WebhookProvider posts messages as JSON. With a secret the body is signed
+// with HMAC-SHA256 in the X-Signature header, so receivers can verify it.
+type WebhookProvider struct {
+	Secret string
+}
+
+func (p WebhookProvider) Channel() Channel {
+	return ChannelWebhook
+}
+
+func (p WebhookProvider) Send(url string, msg Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(p.Secret))
+		mac.Write(payload)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		return fmt.Errorf("%w: webhook answered %d", ErrInvalidRecipient, resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("webhook failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/messaging"
+	"google.golang.org/api/option"
+)
+
+// FCMProvider sends push notifications through Firebase Cloud Messaging. The
+// Firebase client is created on first use and reused afterwards.
+type FCMProvider struct {
+	CredentialsJSON []byte
+
+	once   sync.Once
+	client *messaging.Client
+	err    error
+}
+
+func (p *FCMProvider) Channel() Channel {
+	return ChannelFCM
+}
+
+func (p *FCMProvider) messaging() (*messaging.Client, error) {
+	p.once.Do(func() {
+		app, err := firebase.NewApp(context.Background(), nil, option.WithCredentialsJSON(p.CredentialsJSON))
+		if err != nil {
+			p.err = fmt.Errorf("initializing firebase: %w", err)
+			return
+		}
+		p.client, p.err = app.Messaging(context.Background())
+	})
+	return p.client, p.err
+}
+
+func (p *FCMProvider) Send(token string, msg Message) error {
+	client, err := p.messaging()
+	if err != nil {
+		return err
+	}
+
+	data := map[string]string{"event": msg.Event}
+	for key, value := range msg.Data {
+		data[key] = value
+	}
+	if msg.URL != "" {
+		data["url"] = msg.URL
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = client.Send(ctx, &messaging.Message{
+		Notification: &messaging.Notification{Title: msg.Title, Body: msg.Body},
+		Data:         data,
+		Token:        token,
+	})
+	if messaging.IsUnregistered(err) || messaging.IsRegistrationTokenNotRegistered(err) {
+		return fmt.Errorf("%w: %v", ErrInvalidRecipient, err)
+	}
+	return err
+}
+
+// ExpoProvider sends push notifications through the Expo push service
+type ExpoProvider struct {
+	Sound     string // Defaults to notification_sound.wav
+	ChannelID string // Android notification channel, defaults to custom_channel
+}
+
+func (p ExpoProvider) Channel() Channel {
+	return ChannelExpo
+}
+
+func (p ExpoProvider) Send(token string, msg Message) error {
+	sound, channelID := p.Sound, p.ChannelID
+	if sound == "" {
+		sound = "notification_sound.wav"
+	}
+	if channelID == "" {
+		channelID = "custom_channel"
+	}
+
+	data := map[string]interface{}{"event": msg.Event}
+	for key, value := range msg.Data {
+		data[key] = value
+	}
+	if msg.URL != "" {
+		data["url"] = msg.URL
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"to":               token,
+		"vibrate":          "true",
+		"vibrationPattern": []int{0, 250, 250, 250},
+		"sound":            sound,
+		"title":            msg.Title,
+		"body":             msg.Body,
+		"priority":         "high",
+		"data":             data,
+		"channelId":        channelID,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "https://exp.host/--/api/v2/push/send", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expo push failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	// Expo answers 200 with a ticket that may still report an error
+	var ticket struct {
+		Data struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details struct {
+				Error string `json:"error"`
+			} `json:"details"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &ticket); err != nil {
+		return err
+	}
+	if ticket.Data.Status == "error" {
+		if ticket.Data.Details.Error == "DeviceNotRegistered" {
+			return fmt.Errorf("%w: %s", ErrInvalidRecipient, ticket.Data.Message)
+		}
+		return errors.New("expo push failed: " + ticket.Data.Message)
+	}
+	return nil
+}
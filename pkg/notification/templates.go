@@ -0,0 +1,86 @@
+package notification
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// Events that send notifications
+const (
+	EventOrderPlaced     = "order_placed"
+	EventCustomerRequest = "customer_request"
+	EventLowStock        = "low_stock"
+	EventFeedbackPrompt  = "feedback_prompt"
+)
+
+// Template renders the message of an event. Its fields are text/template
+// strings executed with the data of the event, e.g. {{.TableName}}.
+type Template struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url"`
+}
+
+// DefaultTemplates are used for events a cafe has not customised
+var DefaultTemplates = map[string]Template{
+	EventOrderPlaced: {
+		Title: "Order Update",
+		Body:  "New order received for Table No: {{.TableName}}",
+		URL:   "https://admin.coffeemustache.in/alerts/waiter-view?tab=new-orders",
+	},
+	EventCustomerRequest: {
+		Title: "Customer Request",
+		Body:  "{{.RequestType}} request from Table No: {{.TableNumber}}",
+		URL:   "https://admin.coffeemustache.in/alerts/waiter-view?tab=customer-requests",
+	},
+	EventLowStock: {
+		Title: "Low Stock",
+		Body:  "{{.Items}}",
+		URL:   "https://admin.coffeemustache.in/inventory",
+	},
+	EventFeedbackPrompt: {
+		Title: "How was {{.CafeName}}?",
+		Body:  "Thanks for visiting {{.CafeName}}! Tell us how it went:",
+		URL:   "{{.Link}}",
+	},
+}
+
+// Validate checks that every field of the template parses
+func (t Template) Validate() error {
+	for name, text := range map[string]string{"title": t.Title, "body": t.Body, "url": t.URL} {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Render builds the message of an event. Keys missing from the data render
+// empty. The data is also sent along with the message.
+func (t Template) Render(event string, data map[string]string) (Message, error) {
+	render := func(name, text string) (string, error) {
+		tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return "", err
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return "", err
+		}
+		return out.String(), nil
+	}
+
+	msg := Message{Event: event, Data: data}
+	var err error
+	if msg.Title, err = render("title", t.Title); err != nil {
+		return msg, err
+	}
+	if msg.Body, err = render("body", t.Body); err != nil {
+		return msg, err
+	}
+	if msg.URL, err = render("url", t.URL); err != nil {
+		return msg, err
+	}
+	return msg, nil
+}
@@ -32,23 +32,34 @@ func (s *Server) AskMenuAI(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Query is required"})
 	}
 
+	schedule, open, err := s.checkCafeOpen(c, aiRequest.CafeID)
+	if !open {
+		return err
+	}
+
 	// Fetch categories dynamically based on the provided cafe_id
 	var categories []string
-	err := s.Db.Raw(`
-		SELECT DISTINCT category FROM menu_items WHERE cafe_id = ?
+	err = s.Db.Raw(`
+		SELECT DISTINCT category FROM menu_items WHERE cafe_id = ? AND archived_at IS NULL
 	`, aiRequest.CafeID).Pluck("category", &categories).Error
 
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch categories"})
 	}
 
+	clock, cafe, err := s.cafeClock(aiRequest.CafeID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch cafe details"})
+	}
+	language := s.requestLanguage(c, cafe)
+
 	// Convert categories to a comma-separated string
 	categoryList := strings.Join(categories, ", ")
 
 	// Dynamically include user query in the AI prompt
 	var items []structures.MenuItem
 	err = s.Db.Raw(`
-		SELECT name FROM menu_items WHERE cafe_id = ?
+		SELECT name FROM menu_items WHERE cafe_id = ? AND archived_at IS NULL
 	`, aiRequest.CafeID).Scan(&items).Error
 
 	if err != nil {
@@ -64,6 +75,12 @@ func (s *Server) AskMenuAI(c *fiber.Ctx) error {
 	### **Available Categories in this Cafe:**
 	%s
 
+	### **Currency:**
+	All prices are in %s. Treat amounts in the query as %s.
+
+	### **Language:**
+	Write the "response" text in the language with the BCP 47 tag "%s". The user may ask in any language, the SQL always uses the values stored in the menu.
+
 
 	### **📌 Available Categories:**
 	1. Beverages
@@ -117,10 +134,10 @@ func (s *Server) AskMenuAI(c *fiber.Ctx) error {
 		is_customizable BOOLEAN DEFAULT FALSE,
 		food_type VARCHAR(10) NOT NULL,
 		cuisine VARCHAR(50) NOT NULL,
-		dietary_labels VARCHAR(50),
+		dietary_labels VARCHAR(255),
 		spice_level VARCHAR(20),
 		ingredients TEXT,
-		allergens VARCHAR(255),
+		allergens JSONB,
 		serving_size VARCHAR(50),
 		calories INT,
 		preparation_time INT,
@@ -131,18 +148,30 @@ func (s *Server) AskMenuAI(c *fiber.Ctx) error {
 		available_till VARCHAR(255),
 		available_all_day BOOLEAN DEFAULT TRUE,
 		is_available BOOLEAN DEFAULT TRUE,
-		tag VARCHAR(255),
+		tag JSONB,
 		cm_category varchar(50),
 		rating FLOAT DEFAULT 0.0 NOT NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP	
 	);
 
+	-- Dietary labels, tags and allergens of every item. kind is 'dietary', 'tag' or 'allergen', name is lower case.
+	CREATE TABLE labels (
+		id SERIAL PRIMARY KEY,
+		kind VARCHAR(20) NOT NULL,
+		name VARCHAR(100) NOT NULL
+	);
+	CREATE TABLE menu_item_labels (
+		menu_item_id INT NOT NULL,
+		label_id INT NOT NULL
+	);
+
 	### **Instructions:**
 	- Understand the **intent** behind the user's query.
 	- If the query matches one of the **supported scenarios**, generate an **SQL query**.
 	- Provide a **human-readable response** explaining the generated query.
 	- Use proper SQL syntax, ensuring that wildcard searches use **LIKE '%%value%%'** instead of incorrect placeholders.
 	- When filtering by **categories**, also consider **cm_category** in addition to category, since different cafes may have unique category names and use the categories provided in 'Available Categories in this Cafe'.
+	- Filter dietary labels, tags and allergens with **EXISTS** on menu_item_labels joined to labels, never with LIKE on the dietary_labels, tag or allergens columns.
 	- Remember that cm_category is a column in the menu_items table that stores the standardized category names and is fixed. Only category change from cafe to cafe.
 	- Also remember to match the intents. For example user can say 'find me' or 'suggest me' or 'show me'
 
@@ -193,19 +222,19 @@ func (s *Server) AskMenuAI(c *fiber.Ctx) error {
 
 	#### ** Tag-Based Queries (Best Selling, Popular, New Items)**
 	- _"Show me only bestseller items."_
-	SELECT * FROM menu_items WHERE tag = 'bestseller';
+	SELECT * FROM menu_items WHERE EXISTS (SELECT 1 FROM menu_item_labels mil JOIN labels l ON l.id = mil.label_id WHERE mil.menu_item_id = menu_items.id AND l.kind = 'tag' AND l.name = 'bestseller');
 	- _"Show me highly rated items (above 4.5 stars)."_
 	SELECT * FROM menu_items WHERE rating > 4.5;
 	- _"Find best-rated and most popular dishes."_
-	SELECT * FROM menu_items WHERE tag = 'bestrated' OR popularity_score > 4.0;
+	SELECT * FROM menu_items WHERE EXISTS (SELECT 1 FROM menu_item_labels mil JOIN labels l ON l.id = mil.label_id WHERE mil.menu_item_id = menu_items.id AND l.kind = 'tag' AND l.name = 'bestrated') OR popularity_score > 4.0;
 
 	#### **Dietary Preferences & Restrictions**
 	- _"Show me all vegan options."_
-	SELECT * FROM menu_items WHERE dietary_labels LIKE '%%vegan%%';
+	SELECT * FROM menu_items WHERE EXISTS (SELECT 1 FROM menu_item_labels mil JOIN labels l ON l.id = mil.label_id WHERE mil.menu_item_id = menu_items.id AND l.kind = 'dietary' AND l.name = 'vegan');
 	- _"I need gluten-free and low-carb dishes."_
-	SELECT * FROM menu_items WHERE dietary_labels LIKE '%%gluten-free%%' AND dietary_labels LIKE '%%low-carb%%';
+	SELECT * FROM menu_items WHERE EXISTS (SELECT 1 FROM menu_item_labels mil JOIN labels l ON l.id = mil.label_id WHERE mil.menu_item_id = menu_items.id AND l.kind = 'dietary' AND l.name = 'gluten-free') AND EXISTS (SELECT 1 FROM menu_item_labels mil JOIN labels l ON l.id = mil.label_id WHERE mil.menu_item_id = menu_items.id AND l.kind = 'dietary' AND l.name = 'low-carb');
 	- _"Find me halal or kosher options."_
-	SELECT * FROM menu_items WHERE dietary_labels LIKE '%%halal%%' OR dietary_labels LIKE '%%kosher%%';
+	SELECT * FROM menu_items WHERE EXISTS (SELECT 1 FROM menu_item_labels mil JOIN labels l ON l.id = mil.label_id WHERE mil.menu_item_id = menu_items.id AND l.kind = 'dietary' AND l.name IN ('halal', 'kosher'));
 
 	#### ** Spice Level Queries**
 	- _"Show me only extra spicy items."_
@@ -222,7 +251,7 @@ func (s *Server) AskMenuAI(c *fiber.Ctx) error {
 
 	#### ** Ingredients-Based Queries**
 	- _"Exclude items with nuts."_
-	SELECT * FROM menu_items WHERE allergens NOT LIKE '%%nuts%%';
+	SELECT * FROM menu_items WHERE NOT EXISTS (SELECT 1 FROM menu_item_labels mil JOIN labels l ON l.id = mil.label_id WHERE mil.menu_item_id = menu_items.id AND l.kind = 'allergen' AND l.name = 'nuts');
 	- _"Find me items with truffle or mushroom."_
 	SELECT * FROM menu_items WHERE ingredients LIKE '%%truffle%%' OR ingredients LIKE '%%mushroom%%';
 
@@ -234,15 +263,15 @@ func (s *Server) AskMenuAI(c *fiber.Ctx) error {
 
 	#### ** Complex Queries (Combining Multiple Conditions, while filtering categories strictly use categories provided in the input above)**
 	- _"Show me best-selling Italian dishes under 500."_
-	SELECT * FROM menu_items WHERE cuisine = 'italian' AND price < 500 AND tag = 'bestseller';
+	SELECT * FROM menu_items WHERE cuisine = 'italian' AND price < 500 AND EXISTS (SELECT 1 FROM menu_item_labels mil JOIN labels l ON l.id = mil.label_id WHERE mil.menu_item_id = menu_items.id AND l.kind = 'tag' AND l.name = 'bestseller');
 	- _"Find high-rated spicy vegan dishes."_
-	SELECT * FROM menu_items WHERE rating > 4.5 AND spice_level = 'spicy' AND dietary_labels LIKE '%%vegan%%';
+	SELECT * FROM menu_items WHERE rating > 4.5 AND spice_level = 'spicy' AND EXISTS (SELECT 1 FROM menu_item_labels mil JOIN labels l ON l.id = mil.label_id WHERE mil.menu_item_id = menu_items.id AND l.kind = 'dietary' AND l.name = 'vegan');
 	- _"Give me gluten-free pastas under 400."_
-	SELECT * FROM menu_items WHERE category LIKE '%%pasta%%' AND dietary_labels LIKE '%%gluten-free%%' AND price < 400;
+	SELECT * FROM menu_items WHERE category LIKE '%%pasta%%' AND EXISTS (SELECT 1 FROM menu_item_labels mil JOIN labels l ON l.id = mil.label_id WHERE mil.menu_item_id = menu_items.id AND l.kind = 'dietary' AND l.name = 'gluten-free') AND price < 400;
 	-_Suggest me some best selling cold coffees in this cafe_
 	SELECT * FROM menu_items WHERE category LIKE '%%cold coffee%%' AND category LIKE '%%cold coffee%% ORDER BY DESC popularity_score '
 
-	`, userQuery, categoryList)
+	`, userQuery, categoryList, clock.Currency, clock.Currency, language)
 
 	// fmt.Println("Prompt : ", prompt)
 
@@ -326,13 +355,24 @@ func (s *Server) AskMenuAI(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database query execution failed"})
 	}
 
+	// Keep only this cafe's items that can be ordered right now
+	now := time.Now()
+	available := make([]structures.MenuItem, 0, len(menu))
+	for _, item := range menu {
+		if item.CafeID == aiRequest.CafeID && itemAvailability(schedule, item, now).Available {
+			available = append(available, item)
+		}
+	}
+	menu, conflicts := s.applyDietaryProfile(s.requestDietaryProfile(c), available)
+	s.translateMenuItems(language, menu)
+
 	// Format response text
 	responseText := aiResponse["response"]
 	if len(menu) == 0 {
 		responseText = "This cafe does not have any matching items."
 	}
 
-	// Update in MenuAIRecords table
+	// Saved by the job worker so the answer is not held up by the write
 	menuAIRecord := structures.MenuAIRecords{
 		PromptId:     ksuid.New().String(),
 		CafeId:       aiRequest.CafeID, // Assuming CafeID is used as UserId here
@@ -343,12 +383,13 @@ func (s *Server) AskMenuAI(c *fiber.Ctx) error {
 		Prompt:       userQuery,
 	}
 
-	if err := s.Db.Create(&menuAIRecord).Error; err != nil {
+	if err := enqueueJob(s.Db, jobLogAIRecord, menuAIRecord); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save AI record"})
 	}
 
 	return c.JSON(fiber.Map{
-		"text":  responseText,
-		"items": menu,
+		"text":              responseText,
+		"items":             menu,
+		"dietary_conflicts": conflicts,
 	})
 }
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+	"github.com/segmentio/ksuid"
+)
+
+// scopedRequest holds the identifiers a request body may carry that tie it
+// to a cafe, table, session, cart or cart item.
+type scopedRequest struct {
+	CafeID     string
+	TableName  string
+	SessionID  string
+	CartID     string
+	CartItemID string
+}
+
+// AuthorizeTable checks that any cafe or table referenced in the request
+// matches the JWT. It is used on routes that create or join a session, where
+// the user is not yet a member.
+func (s *Server) AuthorizeTable(c *fiber.Ctx) error {
+	return s.authorize(c, false)
+}
+
+// AuthorizeSession performs the table checks and additionally verifies that
+// the user belongs to the referenced session, and that any cart or cart item
+// belongs to that session.
+func (s *Server) AuthorizeSession(c *fiber.Ctx) error {
+	return s.authorize(c, true)
+}
+
+func (s *Server) authorize(c *fiber.Ctx, requireMembership bool) error {
+	userId, ok := c.Locals("userId").(float64)
+	if !ok || userId == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User not authenticated",
+		})
+	}
+	tokenCafeId, _ := c.Locals("cafeId").(float64)
+	tokenTableName, _ := c.Locals("tableName").(string)
+
+	req, err := parseScopedRequest(c.Body())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	// Cafe referenced in the body must be the cafe in the token
+	if req.CafeID != "" && req.CafeID != strconv.FormatUint(uint64(tokenCafeId), 10) {
+		return forbidden(c, "Cafe does not match token")
+	}
+
+	// Table referenced in the body must be the table in the token
+	if req.TableName != "" && req.TableName != tokenTableName {
+		return forbidden(c, "Table does not match token")
+	}
+
+	sessionID := req.SessionID
+
+	// Resolve the cart item to its cart
+	if req.CartItemID != "" {
+		var cartItem structures.CartItem
+		if err := s.Db.Where("cart_item_id = ?", req.CartItemID).First(&cartItem).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Cart item not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Database error",
+			})
+		}
+		if req.CartID != "" && req.CartID != cartItem.CartID {
+			return forbidden(c, "Cart item does not belong to cart")
+		}
+		req.CartID = cartItem.CartID
+	}
+
+	// Resolve the cart to its session. A cart that does not exist yet is left
+	// to the handler, which may create it (AddToCart).
+	if req.CartID != "" {
+		var cart structures.Cart
+		err := s.Db.Where("cart_id = ?", req.CartID).First(&cart).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Database error",
+			})
+		}
+		if err == nil {
+			if sessionID != "" && sessionID != cart.SessionID {
+				return forbidden(c, "Cart does not belong to session")
+			}
+			sessionID = cart.SessionID
+		}
+	}
+
+	if sessionID == "" {
+		return c.Next()
+	}
+
+	var session structures.Session
+	if err := s.Db.Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Session not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	if session.CafeID != uint(tokenCafeId) || session.TableName != tokenTableName {
+		return forbidden(c, "Session does not belong to this table")
+	}
+
+	if requireMembership {
+		isMember, err := s.isSessionMember(session, uint(userId))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Database error",
+			})
+		}
+		if !isMember {
+			return forbidden(c, "User is not part of this session")
+		}
+	}
+
+	if session.SessionStatus == structures.Active {
+		if err := s.touchSession(session.SessionID); err != nil {
+			fmt.Println("Failed to record session activity:", err)
+		}
+	}
+
+	c.Locals("session", session)
+
+	return c.Next()
+}
+
+// isSessionMember reports whether the user has joined the session. The
+// creator of a session is always treated as a member.
+func (s *Server) isSessionMember(session structures.Session, userId uint) (bool, error) {
+	if session.CreatedBy == userId {
+		return true, nil
+	}
+
+	var count int
+	if err := s.Db.Model(&structures.UserSession{}).
+		Where("session_id = ? AND user_id = ? AND status = ?", session.SessionID, userId, structures.UserActive).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// joinSession records the user as an active member of the session if they
+// are not one already.
+func (s *Server) joinSession(sessionID string, userId uint, role structures.UserRole) error {
+	var userSession structures.UserSession
+	err := s.Db.Where("session_id = ? AND user_id = ? AND status = ?", sessionID, userId, structures.UserActive).First(&userSession).Error
+	if err == nil {
+		return nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	userSession = structures.UserSession{
+		UserSessionID: ksuid.New().String(),
+		SessionID:     sessionID,
+		UserID:        userId,
+		Status:        structures.UserActive,
+		Role:          role,
+	}
+
+	return s.Db.Create(&userSession).Error
+}
+
+func forbidden(c *fiber.Ctx, message string) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// scopedKeys are the body fields the scope checks read
+var scopedKeys = []string{"cafe_id", "session_id", "cart_id", "cart_item_id", "table_id", "table_number", "table_name"}
+
+// parseScopedRequest extracts the scoping identifiers from a JSON body.
+// Identifiers may be sent as strings or numbers depending on the endpoint.
+// Handlers decode the same body with encoding/json, which matches keys
+// case-insensitively, so keys are folded the same way here and a body that
+// spells one key more than one way is rejected.
+func parseScopedRequest(body []byte) (scopedRequest, error) {
+	var req scopedRequest
+	if len(body) == 0 {
+		return req, nil
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return req, err
+	}
+
+	fields := make(map[string]interface{})
+	for key, value := range raw {
+		for _, name := range scopedKeys {
+			if !strings.EqualFold(key, name) {
+				continue
+			}
+			if _, ok := fields[name]; ok {
+				return req, fmt.Errorf("%s is given more than once", name)
+			}
+			fields[name] = value
+		}
+	}
+
+	req.CafeID = stringField(fields, "cafe_id")
+	req.SessionID = stringField(fields, "session_id")
+	req.CartID = stringField(fields, "cart_id")
+	req.CartItemID = stringField(fields, "cart_item_id")
+
+	// Tables are referred to as table_id, table_number or table_name across endpoints
+	for _, key := range []string{"table_id", "table_number", "table_name"} {
+		if value := stringField(fields, key); value != "" {
+			req.TableName = value
+			break
+		}
+	}
+
+	return req, nil
+}
+
+func stringField(fields map[string]interface{}, key string) string {
+	switch value := fields[key].(type) {
+	case string:
+		return value
+	case float64:
+		if value == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// AuthorizeAdmin verifies that the admin in the token is an active staff
+// member of the cafe in the token.
+func (s *Server) AuthorizeAdmin(c *fiber.Ctx) error {
+	adminId, ok := c.Locals("adminId").(float64)
+	if !ok || adminId == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Admin not authenticated",
+		})
+	}
+	tokenCafeId, _ := c.Locals("cafeId").(float64)
+
+	var admin structures.AdminUser
+	if err := s.Db.Where("id = ?", uint(adminId)).First(&admin).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return forbidden(c, "Admin not found")
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	if admin.Status != "active" || admin.CafeID != uint(tokenCafeId) {
+		return forbidden(c, "Admin is not allowed to manage this cafe")
+	}
+
+	c.Locals("admin", admin)
+
+	return c.Next()
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestParseScopedRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    scopedRequest
+		wantErr bool
+	}{
+		{"empty", ``, scopedRequest{}, false},
+		{"strings and numbers", `{"cafe_id": 3, "session_id": "s1", "cart_item_id": "ci1", "table_number": "T4"}`,
+			scopedRequest{CafeID: "3", SessionID: "s1", CartItemID: "ci1", TableName: "T4"}, false},
+		{"zero is not given", `{"cafe_id": 0}`, scopedRequest{}, false},
+		{"keys fold like encoding/json", `{"Cart_Item_Id": "ci2", "CAFE_ID": 3, "table_Key": "x"}`,
+			scopedRequest{CafeID: "3", CartItemID: "ci2"}, false},
+		{"two spellings of one key", `{"cart_item_id": "mine", "Cart_Item_Id": "victim"}`, scopedRequest{}, true},
+		{"other fields ignored", `{"quantity": 2, "Quantity": 3}`, scopedRequest{}, false},
+		{"not an object", `[1]`, scopedRequest{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseScopedRequest([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseScopedRequest = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+// loadCafeSchedule builds the opening schedule of a cafe from its weekly
+// hours, upcoming holidays and the opening/closing time on the cafe itself.
+func (s *Server) loadCafeSchedule(cafeID uint) (helper.CafeSchedule, error) {
+	var cafe structures.Cafe
+	if err := s.Db.Where("id = ?", cafeID).First(&cafe).Error; err != nil {
+		return helper.CafeSchedule{}, err
+	}
+
+	location := cafeClockFor(cafe).Location
+
+	schedule := helper.CafeSchedule{
+		Location: location,
+		Weekly:   make(map[time.Weekday][]helper.OperatingWindow),
+		Holidays: make(map[string]helper.Holiday),
+	}
+
+	// Opening and closing time on the cafe apply every day unless a weekly schedule exists
+	open := time.Duration(cafe.OpeningTime.Hour())*time.Hour + time.Duration(cafe.OpeningTime.Minute())*time.Minute
+	close := time.Duration(cafe.ClosingTime.Hour())*time.Hour + time.Duration(cafe.ClosingTime.Minute())*time.Minute
+	if open != 0 || close != 0 {
+		schedule.Default = []helper.OperatingWindow{{Open: open, Close: close}}
+	}
+
+	var hours []structures.CafeOperatingHours
+	if err := s.Db.Where("cafe_id = ?", cafeID).Find(&hours).Error; err != nil {
+		return helper.CafeSchedule{}, err
+	}
+	for _, hour := range hours {
+		window, err := parseOperatingWindow(hour.OpenTime, hour.CloseTime)
+		if err != nil {
+			fmt.Printf("Skipping invalid operating hours %d for cafe %d: %v\n", hour.ID, cafeID, err)
+			continue
+		}
+		day := time.Weekday(hour.DayOfWeek)
+		schedule.Weekly[day] = append(schedule.Weekly[day], window)
+	}
+
+	// Holidays from yesterday (for overnight hours) through the next week
+	today := time.Now().In(location)
+	var holidays []structures.CafeHoliday
+	if err := s.Db.Where("cafe_id = ? AND date BETWEEN ? AND ?", cafeID,
+		today.AddDate(0, 0, -1).Format("2006-01-02"), today.AddDate(0, 0, 8).Format("2006-01-02")).
+		Find(&holidays).Error; err != nil {
+		return helper.CafeSchedule{}, err
+	}
+	for _, holiday := range holidays {
+		entry := helper.Holiday{Closed: holiday.IsClosed, Reason: holiday.Reason}
+		if !holiday.IsClosed && holiday.OpenTime != "" && holiday.CloseTime != "" {
+			if window, err := parseOperatingWindow(holiday.OpenTime, holiday.CloseTime); err == nil {
+				entry.Windows = []helper.OperatingWindow{window}
+			}
+		}
+		schedule.Holidays[holiday.Date.Format("2006-01-02")] = entry
+	}
+
+	return schedule, nil
+}
+
+// itemAvailability checks whether the item is archived, the manual
+// availability flag and the item's time-of-day window.
+func itemAvailability(schedule helper.CafeSchedule, item structures.MenuItem, now time.Time) helper.Availability {
+	if item.ArchivedAt != nil {
+		return helper.Availability{Available: false, Reason: "No longer on the menu"}
+	}
+	if !item.IsAvailable {
+		return helper.Availability{Available: false, Reason: "Currently unavailable"}
+	}
+
+	window, err := helper.ParseItemWindow(item.AvailableFrom, item.AvailableTill, item.AvailableAllDay)
+	if err != nil {
+		fmt.Printf("Ignoring invalid availability window for item %d: %v\n", item.ID, err)
+		return helper.Availability{Available: true}
+	}
+
+	return schedule.ItemAvailable(window, now)
+}
+
+// unavailableItemIDs returns the items of a cafe that are outside their
+// availability window right now.
+func (s *Server) unavailableItemIDs(cafeID uint, schedule helper.CafeSchedule, now time.Time) ([]uint, error) {
+	var items []structures.MenuItem
+	if err := s.Db.Select("id, is_available, archived_at, available_from, available_till, available_all_day").
+		Where("cafe_id = ?", cafeID).
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	var ids []uint
+	for _, item := range items {
+		if !itemAvailability(schedule, item, now).Available {
+			ids = append(ids, item.ID)
+		}
+	}
+
+	return ids, nil
+}
+
+// filterAvailableItems drops items that cannot be ordered right now
+func filterAvailableItems(schedule helper.CafeSchedule, items []structures.MenuItem, now time.Time) []structures.MenuItem {
+	available := make([]structures.MenuItem, 0, len(items))
+	for _, item := range items {
+		if itemAvailability(schedule, item, now).Available {
+			available = append(available, item)
+		}
+	}
+	return available
+}
+
+// checkCafeOpen loads the cafe schedule and writes an error response when the
+// cafe is closed. The returned bool is false when the handler should stop.
+func (s *Server) checkCafeOpen(c *fiber.Ctx, cafeID uint) (helper.CafeSchedule, bool, error) {
+	schedule, err := s.loadCafeSchedule(cafeID)
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return schedule, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Cafe not found",
+			})
+		}
+		return schedule, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch cafe schedule",
+		})
+	}
+
+	if availability := schedule.IsOpen(time.Now()); !availability.Available {
+		return schedule, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Cafe is closed",
+			"reason": availability.Reason,
+		})
+	}
+
+	return schedule, true, nil
+}
+
+func parseOperatingWindow(openTime, closeTime string) (helper.OperatingWindow, error) {
+	open, err := helper.ParseTimeOfDay(openTime)
+	if err != nil {
+		return helper.OperatingWindow{}, err
+	}
+	close, err := helper.ParseTimeOfDay(closeTime)
+	if err != nil {
+		return helper.OperatingWindow{}, err
+	}
+	return helper.OperatingWindow{Open: open, Close: close}, nil
+}
+
+func (s *Server) SetOperatingHours(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.SetOperatingHoursRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid timezone",
+			})
+		}
+	}
+
+	for _, hour := range req.Hours {
+		if hour.DayOfWeek < 0 || hour.DayOfWeek > 6 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "day_of_week must be between 0 (Sunday) and 6 (Saturday)",
+			})
+		}
+		if _, err := parseOperatingWindow(hour.OpenTime, hour.CloseTime); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Invalid hours for day %d: %v", hour.DayOfWeek, err),
+			})
+		}
+	}
+
+	tx := s.Db.Begin()
+
+	if req.Timezone != "" {
+		if err := tx.Model(&structures.Cafe{}).Where("id = ?", cafeId).Update("timezone", req.Timezone).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update timezone",
+			})
+		}
+	}
+
+	if err := tx.Where("cafe_id = ?", cafeId).Delete(&structures.CafeOperatingHours{}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update operating hours",
+		})
+	}
+
+	for _, hour := range req.Hours {
+		if err := tx.Create(&structures.CafeOperatingHours{
+			CafeID:    cafeId,
+			DayOfWeek: hour.DayOfWeek,
+			OpenTime:  hour.OpenTime,
+			CloseTime: hour.CloseTime,
+		}).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update operating hours",
+			})
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update operating hours",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Operating hours updated successfully",
+	})
+}
+
+func (s *Server) GetOperatingHours(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var hours []structures.CafeOperatingHours
+	if err := s.Db.Where("cafe_id = ?", cafeId).Order("day_of_week ASC, open_time ASC").Find(&hours).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch operating hours",
+		})
+	}
+
+	var holidays []structures.CafeHoliday
+	if err := s.Db.Where("cafe_id = ? AND date >= ?", cafeId, time.Now().AddDate(0, 0, -1).Format("2006-01-02")).
+		Order("date ASC").Find(&holidays).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch holidays",
+		})
+	}
+
+	schedule, err := s.loadCafeSchedule(cafeId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch cafe schedule",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"hours":        hours,
+		"holidays":     holidays,
+		"availability": schedule.IsOpen(time.Now()),
+	})
+}
+
+func (s *Server) AddHoliday(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.HolidayRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "date must be in YYYY-MM-DD format",
+		})
+	}
+
+	if !req.IsClosed {
+		if _, err := parseOperatingWindow(req.OpenTime, req.CloseTime); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "open_time and close_time are required when the cafe is open",
+			})
+		}
+	}
+
+	holiday := structures.CafeHoliday{
+		CafeID:    cafeId,
+		Date:      date,
+		IsClosed:  req.IsClosed,
+		OpenTime:  req.OpenTime,
+		CloseTime: req.CloseTime,
+		Reason:    req.Reason,
+	}
+	if req.IsClosed {
+		holiday.OpenTime, holiday.CloseTime = "", ""
+	}
+
+	tx := s.Db.Begin()
+	if err := tx.Create(&holiday).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to add holiday",
+		})
+	}
+	// gorm skips zero values on create, so write the flag explicitly
+	if err := tx.Model(&structures.CafeHoliday{}).Where("id = ?", holiday.ID).
+		Updates(map[string]interface{}{"is_closed": req.IsClosed}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to add holiday",
+		})
+	}
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to add holiday",
+		})
+	}
+	holiday.IsClosed = req.IsClosed
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Holiday added successfully",
+		"data":    holiday,
+	})
+}
+
+func (s *Server) DeleteHoliday(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.HolidayRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	result := s.Db.Where("id = ? AND cafe_id = ?", req.ID, cafeId).Delete(&structures.CafeHoliday{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete holiday",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Holiday not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Holiday deleted successfully",
+	})
+}
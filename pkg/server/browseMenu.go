@@ -0,0 +1,365 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	defaultBrowseLimit = 20
+	maxBrowseLimit     = 50
+	maxFilterValues    = 20
+)
+
+type browseSort struct {
+	column string
+	desc   bool
+	text   bool
+}
+
+var browseSorts = map[string]browseSort{
+	"popularity": {column: "popularity_score", desc: true},
+	"rating":     {column: "weighted_rating", desc: true},
+	"price_asc":  {column: "price"},
+	"price_desc": {column: "price", desc: true},
+	"prep_time":  {column: "preparation_time"},
+	"name":       {column: "name", text: true},
+}
+
+// browseCursor is the position after the last item of a page. The sort is
+// kept so a cursor cannot be reused with a different order.
+type browseCursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    uint        `json:"id"`
+}
+
+func browseSortValue(sort string, item structures.MenuItem) interface{} {
+	switch browseSorts[sort].column {
+	case "popularity_score":
+		return item.PopularityScore
+	case "weighted_rating":
+		return item.WeightedRating
+	case "price":
+		return item.Price
+	case "preparation_time":
+		return item.PreparationTime
+	default:
+		return item.Name
+	}
+}
+
+func encodeBrowseCursor(sort string, item structures.MenuItem) string {
+	encoded, _ := json.Marshal(browseCursor{Sort: sort, Value: browseSortValue(sort, item), ID: item.ID})
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeBrowseCursor(raw, sort string) (browseCursor, error) {
+	var cursor browseCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(decoded, &cursor); err != nil {
+		return cursor, errors.New("invalid cursor")
+	}
+	if cursor.Sort != sort {
+		return cursor, errors.New("cursor belongs to a different sort")
+	}
+
+	switch cursor.Value.(type) {
+	case string:
+		if !browseSorts[sort].text {
+			return cursor, errors.New("invalid cursor")
+		}
+	case float64:
+		if browseSorts[sort].text {
+			return cursor, errors.New("invalid cursor")
+		}
+	default:
+		return cursor, errors.New("invalid cursor")
+	}
+	return cursor, nil
+}
+
+func validateBrowseRequest(req *structures.BrowseMenuRequest) error {
+	if req.CafeID == 0 {
+		return errors.New("cafe_id is required")
+	}
+
+	for _, filter := range []struct {
+		name   string
+		values []string
+	}{
+		{"cm_categories", req.CMCategories},
+		{"cuisines", req.Cuisines},
+		{"spice_levels", req.SpiceLevels},
+		{"food_types", req.FoodTypes},
+		{"dietary", req.Dietary},
+		{"tags", req.Tags},
+	} {
+		if len(filter.values) > maxFilterValues {
+			return fmt.Errorf("at most %d %s can be selected", maxFilterValues, filter.name)
+		}
+	}
+
+	if (req.MinPrice != nil && *req.MinPrice < 0) || (req.MaxPrice != nil && *req.MaxPrice < 0) {
+		return errors.New("prices cannot be negative")
+	}
+	if req.MinPrice != nil && req.MaxPrice != nil && *req.MinPrice > *req.MaxPrice {
+		return errors.New("min_price cannot be above max_price")
+	}
+	if req.MinRating != nil && (*req.MinRating < 0 || *req.MinRating > 5) {
+		return errors.New("min_rating must be between 0 and 5")
+	}
+	if req.MaxPrepTime != nil && *req.MaxPrepTime < 0 {
+		return errors.New("max_prep_time cannot be negative")
+	}
+
+	if req.Sort == "" {
+		req.Sort = "popularity"
+	}
+	if _, ok := browseSorts[req.Sort]; !ok {
+		return fmt.Errorf("unknown sort %q", req.Sort)
+	}
+
+	if req.Limit == 0 {
+		req.Limit = defaultBrowseLimit
+	}
+	if req.Limit < 0 || req.Limit > maxBrowseLimit {
+		return fmt.Errorf("limit must be between 1 and %d", maxBrowseLimit)
+	}
+	return nil
+}
+
+// Facet dimensions, a dimension's own filter is left out when counting it
+const (
+	facetPrice      = "price"
+	facetCMCategory = "cm_category"
+	facetCuisine    = "cuisine"
+	facetSpiceLevel = "spice_level"
+	facetFoodType   = "food_type"
+	facetDietary    = "dietary"
+	facetTag        = "tag"
+)
+
+func withColumnValues(query *gorm.DB, column string, values []string) *gorm.DB {
+	normalized := normalizeLabels(values)
+	if len(normalized) == 0 {
+		return query
+	}
+	return query.Where("lower(trim(menu_items."+column+")) IN (?)", normalized)
+}
+
+// browseFilters applies every filter of the request except the skipped dimension
+func browseFilters(query *gorm.DB, req structures.BrowseMenuRequest, skip string) *gorm.DB {
+	if skip != facetPrice {
+		if req.MinPrice != nil {
+			query = query.Where("menu_items.price >= ?", *req.MinPrice)
+		}
+		if req.MaxPrice != nil {
+			query = query.Where("menu_items.price <= ?", *req.MaxPrice)
+		}
+	}
+	if skip != facetCMCategory {
+		query = withColumnValues(query, facetCMCategory, req.CMCategories)
+	}
+	if skip != facetCuisine {
+		query = withColumnValues(query, facetCuisine, req.Cuisines)
+	}
+	if skip != facetSpiceLevel {
+		query = withColumnValues(query, facetSpiceLevel, req.SpiceLevels)
+	}
+	if skip != facetFoodType {
+		query = withColumnValues(query, facetFoodType, req.FoodTypes)
+	}
+	if skip != facetDietary {
+		query = withLabels(query, structures.LabelDietary, req.Dietary)
+	}
+	if skip != facetTag {
+		query = withLabels(query, structures.LabelTag, req.Tags)
+	}
+	if req.MinRating != nil {
+		query = query.Where("menu_items.rating >= ?", *req.MinRating)
+	}
+	if req.MaxPrepTime != nil {
+		query = query.Where("menu_items.preparation_time <= ?", *req.MaxPrepTime)
+	}
+	return query
+}
+
+func columnFacet(query *gorm.DB, column string) ([]structures.FacetCount, error) {
+	counts := []structures.FacetCount{}
+	err := query.
+		Select("lower(trim(menu_items." + column + ")) AS value, COUNT(*) AS count").
+		Where("COALESCE(trim(menu_items." + column + "), '') <> ''").
+		Group("value").
+		Order("count DESC, value ASC").
+		Scan(&counts).Error
+	return counts, err
+}
+
+func labelFacet(query *gorm.DB, kind structures.LabelKind) ([]structures.FacetCount, error) {
+	counts := []structures.FacetCount{}
+	err := query.
+		Joins("JOIN menu_item_labels facet_mil ON facet_mil.menu_item_id = menu_items.id").
+		Joins("JOIN labels facet_l ON facet_l.id = facet_mil.label_id AND facet_l.kind = ?", kind).
+		Select("facet_l.name AS value, COUNT(*) AS count").
+		Group("facet_l.name").
+		Order("count DESC, value ASC").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// browseFacets counts the values of every dimension among the items matching
+// the other filters, so selecting a chip never hides its siblings.
+func browseFacets(base *gorm.DB, req structures.BrowseMenuRequest) (structures.BrowseFacets, error) {
+	var facets structures.BrowseFacets
+	var err error
+
+	for _, facet := range []struct {
+		column string
+		target *[]structures.FacetCount
+	}{
+		{facetCMCategory, &facets.CMCategory},
+		{facetCuisine, &facets.Cuisine},
+		{facetSpiceLevel, &facets.SpiceLevel},
+		{facetFoodType, &facets.FoodType},
+	} {
+		if *facet.target, err = columnFacet(browseFilters(base, req, facet.column), facet.column); err != nil {
+			return facets, err
+		}
+	}
+
+	if facets.Dietary, err = labelFacet(browseFilters(base, req, facetDietary), structures.LabelDietary); err != nil {
+		return facets, err
+	}
+	if facets.Tag, err = labelFacet(browseFilters(base, req, facetTag), structures.LabelTag); err != nil {
+		return facets, err
+	}
+
+	err = browseFilters(base, req, facetPrice).
+		Select("COALESCE(MIN(menu_items.price), 0) AS min, COALESCE(MAX(menu_items.price), 0) AS max").
+		Scan(&facets.Price).Error
+	return facets, err
+}
+
+// BrowseMenu lists the items of a cafe that can be ordered now with
+// combinable filters, facet counts for each filter, sorting and cursor
+// pagination.
+func (s *Server) BrowseMenu(c *fiber.Ctx) error {
+	var req structures.BrowseMenuRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	if err := validateBrowseRequest(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var cursor *browseCursor
+	if req.Cursor != "" {
+		decoded, err := decodeBrowseCursor(req.Cursor, req.Sort)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		cursor = &decoded
+	}
+
+	schedule, open, err := s.checkCafeOpen(c, req.CafeID)
+	if !open {
+		return err
+	}
+
+	excludedIDs, err := s.unavailableItemIDs(req.CafeID, schedule, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch menu",
+		})
+	}
+
+	// Items the user chose to hide are left out of the counts as well
+	profile := s.requestDietaryProfile(c)
+	conflicts, err := s.cafeDietaryConflicts(req.CafeID, profile)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check dietary conflicts",
+		})
+	}
+	if profile.HideConflicts {
+		for id := range conflicts {
+			excludedIDs = append(excludedIDs, id)
+		}
+	}
+
+	base := s.Db.Model(&structures.MenuItem{}).Where("menu_items.cafe_id = ? AND menu_items.archived_at IS NULL", req.CafeID)
+	if len(excludedIDs) > 0 {
+		base = base.Where("menu_items.id NOT IN (?)", excludedIDs)
+	}
+	filtered := browseFilters(base, req, "")
+
+	var total int
+	if err := filtered.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count items",
+		})
+	}
+
+	facets, err := browseFacets(base, req)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count filters",
+		})
+	}
+
+	sort := browseSorts[req.Sort]
+	direction, after := "ASC", ">"
+	if sort.desc {
+		direction, after = "DESC", "<"
+	}
+	page := filtered
+	if cursor != nil {
+		page = page.Where(fmt.Sprintf("(menu_items.%s %s ? OR (menu_items.%s = ? AND menu_items.id > ?))", sort.column, after, sort.column),
+			cursor.Value, cursor.Value, cursor.ID)
+	}
+
+	items := []structures.MenuItem{}
+	if err := page.Order(fmt.Sprintf("menu_items.%s %s, menu_items.id ASC", sort.column, direction)).
+		Limit(req.Limit + 1).Find(&items).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch menu",
+		})
+	}
+
+	response := structures.BrowseMenuResponse{
+		Items:            items,
+		Total:            total,
+		Facets:           facets,
+		DietaryConflicts: make(map[uint][]string),
+	}
+	if len(items) > req.Limit {
+		response.Items = items[:req.Limit]
+		response.NextCursor = encodeBrowseCursor(req.Sort, response.Items[req.Limit-1])
+	}
+	imageSize, webp := imagePreference(c)
+	for i, item := range response.Items {
+		response.Items[i].ImageURL = preferredImageURL(item.ImageURL, imageSize, webp)
+		if itemConflicts, ok := conflicts[item.ID]; ok {
+			response.DietaryConflicts[item.ID] = itemConflicts
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
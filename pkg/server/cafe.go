@@ -1,9 +1,12 @@
 package server
 
 import (
+	"coffeeMustacheBackend/pkg/helper"
 	"coffeeMustacheBackend/pkg/structures"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -36,9 +39,143 @@ func (s *Server) GetCafeDetails(c *fiber.Ctx) error {
 		})
 	}
 
+	// Let the app show whether the cafe is taking orders
+	schedule, err := s.loadCafeSchedule(request.CafeID)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve cafe schedule",
+		})
+	}
+
+	imageSize, webp := imagePreference(c)
+	cafeResponse.ImageURL = preferredImageURL(cafeResponse.ImageURL, imageSize, webp)
+
 	// Return cafe details
 	return c.JSON(fiber.Map{
-		"data": cafeResponse,
+		"data":         cafeResponse,
+		"availability": schedule.IsOpen(time.Now()),
 	})
 
 }
+
+// cafeClockFor builds the clock of an already loaded cafe
+func cafeClockFor(cafe structures.Cafe) helper.CafeClock {
+	return helper.NewCafeClock(cafe.Timezone, cafe.Currency, cafe.Locale)
+}
+
+// cafeClock loads a cafe and returns its clock
+func (s *Server) cafeClock(cafeID uint) (helper.CafeClock, structures.Cafe, error) {
+	var cafe structures.Cafe
+	if err := s.Db.Where("id = ?", cafeID).First(&cafe).Error; err != nil {
+		return helper.CafeClock{}, cafe, err
+	}
+	return cafeClockFor(cafe), cafe, nil
+}
+
+// curatedTimeOfDay picks the curated cart slot for the local time using the
+// cafe's boundaries, falling back to 12:00 and 17:00.
+func curatedTimeOfDay(cafe structures.Cafe, local time.Time) structures.TimeOfDay {
+	morningEnds, err := helper.ParseTimeOfDay(cafe.MorningEndsAt)
+	if err != nil {
+		morningEnds = 12 * time.Hour
+	}
+	afternoonEnds, err := helper.ParseTimeOfDay(cafe.AfternoonEndsAt)
+	if err != nil || afternoonEnds <= morningEnds {
+		afternoonEnds = 17 * time.Hour
+	}
+
+	offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+	switch {
+	case offset < morningEnds:
+		return structures.Morning
+	case offset < afternoonEnds:
+		return structures.Afternoon
+	default:
+		return structures.Night
+	}
+}
+
+func (s *Server) UpdateCafeSettings(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.CafeSettingsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	updates := map[string]interface{}{}
+
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid timezone",
+			})
+		}
+		updates["timezone"] = req.Timezone
+	}
+
+	if req.Currency != "" {
+		currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+		if len(currency) != 3 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "currency must be a 3 letter ISO 4217 code",
+			})
+		}
+		updates["currency"] = currency
+	}
+
+	if req.Locale != "" {
+		updates["locale"] = req.Locale
+	}
+
+	if req.MenuLanguage != "" {
+		language := helper.NormalizeLanguage(req.MenuLanguage)
+		if len(language) < 2 || len(language) > 16 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": "menu_language must be a BCP 47 language tag",
+			})
+		}
+		updates["menu_language"] = language
+	}
+
+	for column, value := range map[string]string{
+		"morning_ends_at":   req.MorningEndsAt,
+		"afternoon_ends_at": req.AfternoonEndsAt,
+	} {
+		if value == "" {
+			continue
+		}
+		if _, err := helper.ParseTimeOfDay(value); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Invalid %s", column),
+			})
+		}
+		updates[column] = value
+	}
+
+	if len(updates) == 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "Nothing to update",
+		})
+	}
+
+	if err := s.Db.Model(&structures.Cafe{}).Where("id = ?", cafeId).Updates(updates).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update cafe settings",
+		})
+	}
+
+	var cafe structures.Cafe
+	if err := s.Db.Where("id = ?", cafeId).First(&cafe).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve cafe details",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Cafe settings updated successfully",
+		"data":    cafe,
+	})
+}
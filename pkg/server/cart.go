@@ -52,6 +52,75 @@ func (s *Server) AddToCart(c *fiber.Ctx) error {
 		})
 	}
 
+	// Reject items that cannot be ordered right now
+	schedule, open, err := s.checkCafeOpen(c, req.CafeID)
+	if !open {
+		return err
+	}
+	now := time.Now()
+	profile := s.requestDietaryProfile(c)
+	dietaryWarnings := []structures.DietaryWarning{}
+	for i, item := range req.Items {
+		var menuItem structures.MenuItem
+		if err := s.Db.Where("id = ? AND cafe_id = ?", item.ItemID, req.CafeID).First(&menuItem).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   "Menu item not found",
+				"item_id": item.ItemID,
+			})
+		}
+		if availability := itemAvailability(schedule, menuItem, now); !availability.Available {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   fmt.Sprintf("%s is not available", menuItem.Name),
+				"item_id": menuItem.ID,
+				"reason":  availability.Reason,
+			})
+		}
+
+		// Items that conflict with the dietary profile are added with a warning
+		conflicts, err := s.itemDietaryConflicts(profile, []uint{menuItem.ID})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check dietary conflicts",
+			})
+		}
+		if len(conflicts[menuItem.ID]) > 0 {
+			dietaryWarnings = append(dietaryWarnings, structures.DietaryWarning{
+				ItemID:    menuItem.ID,
+				Name:      menuItem.Name,
+				Conflicts: conflicts[menuItem.ID],
+			})
+		}
+
+		// Reject combinations the item's customization groups do not allow
+		customizationIDs, err := parseCustomizationIDs(item.CustomizationIDs)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid customization_ids",
+				"item_id": menuItem.ID,
+			})
+		}
+		customizationIDs, customizationErrors, err := s.checkCustomizations(menuItem.ID, customizationIDs)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch customizations",
+			})
+		}
+		if len(customizationErrors) > 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":                fmt.Sprintf("Invalid customizations for %s", menuItem.Name),
+				"item_id":              menuItem.ID,
+				"customization_errors": customizationErrors,
+			})
+		}
+
+		// Store the selection with the group defaults filled in
+		if req.Items[i].CustomizationIDs, err = customizationIDsJSON(customizationIDs); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to encode customizations",
+			})
+		}
+	}
+
 	// Initialize cart ID
 	cartID := req.CartID
 
@@ -145,27 +214,18 @@ func (s *Server) AddToCart(c *fiber.Ctx) error {
 			})
 		}
 
-		// For the given item id, increment the category counter based on category id
+		// Keep the price the customer saw when adding the item
+		snapshot, err := s.currentPriceSnapshot(menuItem)
+		if err != nil {
+			fmt.Println("Failed to record price snapshot:", err)
+		} else {
+			newCartItem.PriceSnapshotID = &snapshot.ID
+		}
+
+		// Count the add towards the popularity of the category
 		if menuItem.CategoryID != 0 {
-			var category structures.Category
-			if err := s.Db.Where("id = ?", menuItem.CategoryID).First(&category).
-				Error; err != nil {
-				if err == gorm.ErrRecordNotFound {
-					return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-						"error": "Category not found",
-					})
-				}
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Database error",
-				})
-			}
-			category.Counter += 1
-			if err := s.Db.Model(&structures.Category{}).
-				Where("id = ?", category.ID).
-				Update("counter", category.Counter).Error; err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to update category counter",
-				})
+			if err := s.recordCategoryAdd(menuItem.CafeID, menuItem.CategoryID); err != nil {
+				fmt.Println("Failed to record category popularity:", err)
 			}
 		}
 
@@ -204,8 +264,9 @@ func (s *Server) AddToCart(c *fiber.Ctx) error {
 
 	// Return success response
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Items added to cart successfully",
-		"cart_id": cartID,
+		"message":          "Items added to cart successfully",
+		"cart_id":          cartID,
+		"dietary_warnings": dietaryWarnings,
 	})
 }
 
@@ -333,8 +394,31 @@ func (s *Server) UpdateCustomizations(c *fiber.Ctx) error {
 		})
 	}
 
-	// Convert to JSON
+	// Validate the new selection against the item's customization groups
 	customizationJSON, _ := json.Marshal(req.CustomizationIDs)
+	customizationIDs, err := parseCustomizationIDs(customizationJSON)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid customization_ids",
+		})
+	}
+	customizationIDs, customizationErrors, err := s.checkCustomizations(cartItem.ItemID, customizationIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch customizations",
+		})
+	}
+	if len(customizationErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":                "Invalid customizations",
+			"customization_errors": customizationErrors,
+		})
+	}
+	if customizationJSON, err = customizationIDsJSON(customizationIDs); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to encode customizations",
+		})
+	}
 
 	// Update customizations using cart ID and item ID
 	if err := s.Db.Model(&structures.CartItem{}).
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// An add counts half as much after categoryHalfLifeDays, adds older than
+	// categoryWindowDays are ignored.
+	categoryHalfLifeDays = 14
+	categoryWindowDays   = 90
+
+	// Rankings only move as carts fill up, so they are kept a few minutes
+	categoryRankingTTL = 10 * time.Minute
+)
+
+// categoryScore is the time decayed popularity of a category
+type categoryScore struct {
+	CategoryID     uint    `json:"category_id"`
+	Name           string  `json:"name"`
+	PinnedPosition *int    `json:"pinned_position"`
+	SlotScore      float64 `json:"slot_score"`  // Adds in the current time of day
+	TotalScore     float64 `json:"total_score"` // Adds at any time of day
+}
+
+// recordCategoryAdd counts an item of the category added to a cart, in the
+// local day and time of day of the cafe.
+func (s *Server) recordCategoryAdd(cafeID, categoryID uint) error {
+	clock, cafe, err := s.cafeClock(cafeID)
+	if err != nil {
+		return err
+	}
+	now := clock.Now()
+
+	if err := s.Db.Exec("UPDATE categories SET counter = counter + 1 WHERE id = ?", categoryID).Error; err != nil {
+		return err
+	}
+	return s.Db.Exec(`
+		INSERT INTO category_popularities (cafe_id, category_id, day, time_of_day, adds)
+		VALUES (?, ?, ?, ?, 1)
+		ON CONFLICT (category_id, day, time_of_day)
+		DO UPDATE SET adds = category_popularities.adds + 1`,
+		cafeID, categoryID, now.Format("2006-01-02"), curatedTimeOfDay(cafe, now)).Error
+}
+
+// queryCategoryScores ranks the unarchived categories of a cafe: pinned ones
+// first in their order, then by popularity in the time of day, then overall.
+func (s *Server) queryCategoryScores(cafeID uint, today string, timeOfDay structures.TimeOfDay) ([]categoryScore, error) {
+	var scores []categoryScore
+	err := s.Db.Raw(`
+		SELECT c.id AS category_id, c.name, c.pinned_position,
+			COALESCE(SUM(CASE WHEN p.time_of_day = ? THEN p.adds * POWER(0.5, (?::date - p.day) / ?::float) END), 0) AS slot_score,
+			COALESCE(SUM(p.adds * POWER(0.5, (?::date - p.day) / ?::float)), 0) AS total_score
+		FROM categories c
+		LEFT JOIN category_popularities p
+		ON p.category_id = c.id
+		AND p.day > ?::date - ?::int
+		WHERE c.cafe_id = ? AND c.archived_at IS NULL
+		GROUP BY c.id, c.name, c.pinned_position`,
+		timeOfDay, today, categoryHalfLifeDays, today, categoryHalfLifeDays,
+		today, categoryWindowDays, cafeID).Scan(&scores).Error
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		a, b := scores[i], scores[j]
+		if (a.PinnedPosition != nil) != (b.PinnedPosition != nil) {
+			return a.PinnedPosition != nil
+		}
+		if a.PinnedPosition != nil && *a.PinnedPosition != *b.PinnedPosition {
+			return *a.PinnedPosition < *b.PinnedPosition
+		}
+		if a.SlotScore != b.SlotScore {
+			return a.SlotScore > b.SlotScore
+		}
+		if a.TotalScore != b.TotalScore {
+			return a.TotalScore > b.TotalScore
+		}
+		return a.Name < b.Name
+	})
+	return scores, nil
+}
+
+// categoryRanking returns the position of every category of the cafe for the
+// current time of day. It is cached per menu revision, so pinning shows at once.
+func (s *Server) categoryRanking(cafe structures.Cafe) (map[uint]int, error) {
+	now := cafeClockFor(cafe).Now()
+	today := now.Format("2006-01-02")
+	timeOfDay := curatedTimeOfDay(cafe, now)
+	key := fmt.Sprintf("category-rank:%d:%d:%s:%s", cafe.ID, cafe.MenuRevision, today, timeOfDay)
+
+	ranking := make(map[uint]int)
+	if encoded, ok := menuLRU.Get(key); ok && json.Unmarshal(encoded, &ranking) == nil {
+		return ranking, nil
+	}
+
+	scores, err := s.queryCategoryScores(cafe.ID, today, timeOfDay)
+	if err != nil {
+		return nil, err
+	}
+	for position, score := range scores {
+		ranking[score.CategoryID] = position
+	}
+	if encoded, err := json.Marshal(ranking); err == nil {
+		menuLRU.Set(key, encoded, categoryRankingTTL)
+	}
+	return ranking, nil
+}
+
+// rankMenuCategories orders the categories of a cached menu by the ranking.
+// Categories missing from it keep their place after the ranked ones.
+func rankMenuCategories(menu []menuCacheCategory, ranking map[uint]int) []menuCacheCategory {
+	ranked := append([]menuCacheCategory(nil), menu...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, aok := ranking[ranked[i].CategoryID]
+		b, bok := ranking[ranked[j].CategoryID]
+		if aok != bok {
+			return aok
+		}
+		return a < b
+	})
+	return ranked
+}
+
+// SetCategoryPins pins categories to the top of the menu in the given order
+// and unpins every other category of the cafe. An empty list unpins all.
+func (s *Server) SetCategoryPins(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.CategoryPinsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	seen := make(map[uint]bool, len(req.CategoryIDs))
+	for _, id := range req.CategoryIDs {
+		if seen[id] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Category %d is listed twice", id),
+			})
+		}
+		seen[id] = true
+	}
+
+	if len(req.CategoryIDs) > 0 {
+		var count int
+		if err := s.Db.Model(&structures.Category{}).
+			Where("id IN (?) AND cafe_id = ? AND archived_at IS NULL", req.CategoryIDs, cafeId).
+			Count(&count).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to pin categories",
+			})
+		}
+		if count != len(req.CategoryIDs) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Category not found",
+			})
+		}
+	}
+
+	tx := s.Db.Begin()
+
+	if err := tx.Model(&structures.Category{}).Where("cafe_id = ?", cafeId).
+		UpdateColumn("pinned_position", gorm.Expr("NULL")).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to pin categories",
+		})
+	}
+	for position, id := range req.CategoryIDs {
+		if err := tx.Model(&structures.Category{}).Where("id = ?", id).
+			UpdateColumn("pinned_position", position+1).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to pin categories",
+			})
+		}
+	}
+
+	if err := invalidateMenuCache(tx, cafeId); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to pin categories",
+		})
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to pin categories",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Categories pinned successfully",
+	})
+}
+
+// GetCategoryRanking shows the owner how the menu is ordered right now and why
+func (s *Server) GetCategoryRanking(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	clock, cafe, err := s.cafeClock(cafeId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve cafe details",
+		})
+	}
+	now := clock.Now()
+	timeOfDay := curatedTimeOfDay(cafe, now)
+
+	scores, err := s.queryCategoryScores(cafeId, now.Format("2006-01-02"), timeOfDay)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to rank categories",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"time_of_day": timeOfDay,
+		"data":        scores,
+	})
+}
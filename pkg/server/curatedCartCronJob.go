@@ -9,7 +9,6 @@ import (
 	"log"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/datatypes"
@@ -33,8 +32,14 @@ func (s *Server) RunCuratedCartsJob(c *fiber.Ctx) error {
 	}
 
 	for _, cafeID := range cafeIDs {
+		clock, _, err := s.cafeClock(cafeID)
+		if err != nil {
+			log.Printf("❌ Failed to fetch cafe %d: %v\n", cafeID, err)
+			continue
+		}
+
 		var menuItems []menuItemInput
-		if err := s.Db.Table("menu_items").Where("cafe_id = ?", cafeID).Find(&menuItems).Error; err != nil {
+		if err := s.Db.Table("menu_items").Where("cafe_id = ? AND archived_at IS NULL", cafeID).Find(&menuItems).Error; err != nil {
 			log.Printf("❌ Failed to fetch menu items for cafe %d: %v\n", cafeID, err)
 			continue
 		}
@@ -139,7 +144,7 @@ func (s *Server) RunCuratedCartsJob(c *fiber.Ctx) error {
 				CafeID:          cafeID,
 				Name:            cart.Name,
 				TimeOfDay:       cart.TimeOfDay,
-				Date:            time.Now(),
+				Date:            clock.Today(),
 				Source:          "ai",
 				CartTotal:       totalAmount,
 				DiscountedTotal: totalAmount - discountAmount,
@@ -1,11 +1,10 @@
 package server
 
 import (
-	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/notification"
 	"coffeeMustacheBackend/pkg/structures"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -34,58 +33,42 @@ func (s *Server) CallWaiter(c *fiber.Ctx) error {
 	customerRequest.UserID = userID
 	customerRequest.CafeID = request.CafeID
 
-	// Get time in Asia/Kolkata zone
-	location, err := time.LoadLocation("Asia/Kolkata")
+	// Get time in the cafe's timezone
+	clock, _, err := s.cafeClock(request.CafeID)
 	if err != nil {
-		fmt.Println("Error loading location:", err)
+		fmt.Println("Error loading cafe clock:", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to load location",
 		})
 	}
-	currentTime := time.Now().In(location)
+	currentTime := clock.Now()
 
 	customerRequest.RequestedAt = currentTime
 
-	// Save customer request to database
-	if err := s.Db.Create(&customerRequest).Error; err != nil {
+	// Save customer request to database and queue the notification to the staff
+	tx := s.Db.Begin()
+	if err := tx.Create(&customerRequest).Error; err != nil {
+		tx.Rollback()
 		fmt.Println("Error saving customer request:", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to save customer request",
 		})
 	}
-
-	// Send a push notification by fetching device tokens from fcm_tokens table based on cafe id
-	var deviceTokens []string
-	if err := s.Db.Model(&structures.FcmToken{}).
-		Where("cafe_id = ?", request.CafeID).
-		Pluck("token", &deviceTokens).Error; err != nil {
-		fmt.Println("Failed to fetch device tokens:", err)
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch device tokens",
+	if err := enqueueCafeNotification(tx, request.CafeID, notification.EventCustomerRequest, map[string]string{
+		"RequestType": request.RequestType,
+		"TableNumber": request.TableNumber,
+	}); err != nil {
+		tx.Rollback()
+		fmt.Println("Error queueing customer request notification:", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to save customer request",
 		})
 	}
-
-	body := fmt.Sprintf("%s request from Table No: %s", request.RequestType, request.TableNumber)
-
-	if len(deviceTokens) > 0 {
-		if request.CafeID == 3 {
-			if err := helper.SendPushNotification(deviceTokens, "Customer Request", body); err != nil {
-				fmt.Println("Failed to send push notification:", err)
-				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to send push notification",
-				})
-			}
-		} else {
-			if err := helper.SendExpoPushNotification(deviceTokens, "Customer Request", body, "https://admin.coffeemustache.in/alerts/waiter-view?tab=customer-requests"); err != nil {
-				fmt.Println("Failed to send push notification:", err)
-				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to send push notification",
-				})
-			}
-		}
-
-	} else {
-		fmt.Println("No device tokens found for the cafe")
+	if err := tx.Commit().Error; err != nil {
+		fmt.Println("Error saving customer request:", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to save customer request",
+		})
 	}
 
 	return c.Status(http.StatusOK).JSON(fiber.Map{
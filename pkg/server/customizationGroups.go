@@ -0,0 +1,516 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+// loadCustomizations returns the live groups and options of a menu item.
+// Options of archived groups are left out.
+func (s *Server) loadCustomizations(itemID uint) ([]structures.CustomizationGroup, []structures.ItemCustomization, error) {
+	var groups []structures.CustomizationGroup
+	if err := s.Db.Where("menu_item_id = ? AND archived_at IS NULL", itemID).
+		Order("position ASC, id ASC").Find(&groups).Error; err != nil {
+		return nil, nil, err
+	}
+	live := make(map[uint]bool, len(groups))
+	for _, group := range groups {
+		live[group.ID] = true
+	}
+
+	var all []structures.ItemCustomization
+	if err := s.Db.Where("menu_item_id = ? AND archived_at IS NULL", itemID).
+		Order("priority ASC, id ASC").Find(&all).Error; err != nil {
+		return nil, nil, err
+	}
+	options := make([]structures.ItemCustomization, 0, len(all))
+	for _, option := range all {
+		if option.GroupID == nil || live[*option.GroupID] {
+			options = append(options, option)
+		}
+	}
+
+	return groups, options, nil
+}
+
+// customizationCategories orders options into their groups for the customer
+// apps. Options without a group follow the groups, sorted by type.
+func customizationCategories(groups []structures.CustomizationGroup, options []structures.ItemCustomization) []structures.CustomizationCategory {
+	categories := make([]structures.CustomizationCategory, 0, len(groups))
+	groupIndex := make(map[uint]int, len(groups))
+	for _, group := range groups {
+		groupIndex[group.ID] = len(categories)
+		categories = append(categories, structures.CustomizationCategory{
+			Category:       group.Name,
+			GroupID:        group.ID,
+			IsRequired:     group.IsRequired,
+			MinSelections:  minSelections(group),
+			MaxSelections:  group.MaxSelections,
+			ParentOptionID: group.ParentOptionID,
+			Items:          []structures.CustomizationItem{},
+		})
+	}
+
+	var types []string
+	ungrouped := make(map[string][]structures.CustomizationItem)
+	for _, option := range options {
+		item := structures.CustomizationItem{
+			ItemName:        option.OptionName,
+			AdditionalCost:  option.AdditionalCost,
+			CustomizationID: option.ID,
+			IsDefault:       option.IsDefault,
+			IsAvailable:     option.IsAvailable,
+		}
+		if option.GroupID != nil {
+			index := groupIndex[*option.GroupID]
+			categories[index].Items = append(categories[index].Items, item)
+			continue
+		}
+		if _, ok := ungrouped[option.CustomizationType]; !ok {
+			types = append(types, option.CustomizationType)
+		}
+		ungrouped[option.CustomizationType] = append(ungrouped[option.CustomizationType], item)
+	}
+
+	sort.Strings(types)
+	for _, customizationType := range types {
+		categories = append(categories, structures.CustomizationCategory{
+			Category: customizationType,
+			Items:    ungrouped[customizationType],
+		})
+	}
+
+	return categories
+}
+
+// minSelections is the lower bound of a group, a required group needs at least one option
+func minSelections(group structures.CustomizationGroup) int {
+	if group.IsRequired && group.MinSelections < 1 {
+		return 1
+	}
+	return group.MinSelections
+}
+
+// parseCustomizationIDs reads the customization ids stored on a cart item.
+// Both ["1", "2"] and [1, 2] are accepted.
+func parseCustomizationIDs(raw []byte) ([]uint, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var values []interface{}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(values))
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			id, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid customization id %q", v)
+			}
+			ids = append(ids, uint(id))
+		case float64:
+			if v < 0 || v != float64(uint(v)) {
+				return nil, fmt.Errorf("invalid customization id %v", v)
+			}
+			ids = append(ids, uint(v))
+		default:
+			return nil, fmt.Errorf("invalid customization id %v", v)
+		}
+	}
+	return ids, nil
+}
+
+// validateCustomizationSelection checks a selection of options against the
+// groups of an item: every option belongs to the item and is available, nested
+// groups only get options when their parent option is selected, and every
+// active group is within its min/max selections.
+func validateCustomizationSelection(groups []structures.CustomizationGroup, options []structures.ItemCustomization, selected []uint) []structures.CustomizationError {
+	errs := []structures.CustomizationError{}
+
+	optionsByID := make(map[uint]structures.ItemCustomization, len(options))
+	for _, option := range options {
+		optionsByID[option.ID] = option
+	}
+
+	chosen := make(map[uint]bool, len(selected))
+	counts := make(map[uint]int)
+	for _, id := range selected {
+		option, ok := optionsByID[id]
+		if !ok {
+			errs = append(errs, structures.CustomizationError{CustomizationID: id, Message: "Option is not offered for this item"})
+			continue
+		}
+		if chosen[id] {
+			errs = append(errs, structures.CustomizationError{CustomizationID: id, Message: fmt.Sprintf("%s is selected more than once", option.OptionName)})
+			continue
+		}
+		chosen[id] = true
+		if !option.IsAvailable {
+			errs = append(errs, structures.CustomizationError{CustomizationID: id, Message: fmt.Sprintf("%s is currently unavailable", option.OptionName)})
+		}
+		if option.GroupID != nil {
+			counts[*option.GroupID]++
+		}
+	}
+
+	for _, group := range groups {
+		// A nested group applies only when its parent option is selected
+		if group.ParentOptionID != nil && !chosen[*group.ParentOptionID] {
+			if counts[group.ID] > 0 {
+				parent := optionsByID[*group.ParentOptionID].OptionName
+				errs = append(errs, structures.CustomizationError{GroupID: group.ID, Group: group.Name,
+					Message: fmt.Sprintf("%s can only be chosen with %s", group.Name, parent)})
+			}
+			continue
+		}
+
+		if min := minSelections(group); counts[group.ID] < min {
+			message := fmt.Sprintf("Choose at least %d from %s", min, group.Name)
+			if min == 1 {
+				message = fmt.Sprintf("Choose a %s", strings.ToLower(group.Name))
+			}
+			errs = append(errs, structures.CustomizationError{GroupID: group.ID, Group: group.Name, Message: message})
+		}
+		if group.MaxSelections > 0 && counts[group.ID] > group.MaxSelections {
+			message := fmt.Sprintf("Choose at most %d from %s", group.MaxSelections, group.Name)
+			if group.MaxSelections == 1 {
+				message = fmt.Sprintf("Only one %s can be chosen", strings.ToLower(group.Name))
+			}
+			errs = append(errs, structures.CustomizationError{GroupID: group.ID, Group: group.Name, Message: message})
+		}
+	}
+
+	return errs
+}
+
+// withGroupDefaults adds the default options of every active group nothing
+// was chosen from, so an item ordered as is gets what the cafe serves by
+// default. Nested groups are filled once their parent option is chosen.
+func withGroupDefaults(groups []structures.CustomizationGroup, options []structures.ItemCustomization, selected []uint) []uint {
+	resolved := append([]uint{}, selected...)
+
+	optionsByID := make(map[uint]structures.ItemCustomization, len(options))
+	defaults := make(map[uint][]structures.ItemCustomization)
+	for _, option := range options {
+		optionsByID[option.ID] = option
+		if option.GroupID != nil && option.IsDefault && option.IsAvailable {
+			defaults[*option.GroupID] = append(defaults[*option.GroupID], option)
+		}
+	}
+
+	chosen := make(map[uint]bool, len(selected))
+	counts := make(map[uint]int)
+	for _, id := range selected {
+		chosen[id] = true
+		if option, ok := optionsByID[id]; ok && option.GroupID != nil {
+			counts[*option.GroupID]++
+		}
+	}
+
+	// A default can open a nested group, so repeat until nothing is added
+	filled := make(map[uint]bool, len(groups))
+	for changed := true; changed; {
+		changed = false
+		for _, group := range groups {
+			if filled[group.ID] || counts[group.ID] > 0 {
+				continue
+			}
+			if group.ParentOptionID != nil && !chosen[*group.ParentOptionID] {
+				continue
+			}
+			filled[group.ID] = true
+			for _, option := range defaults[group.ID] {
+				if group.MaxSelections > 0 && counts[group.ID] >= group.MaxSelections {
+					break
+				}
+				resolved = append(resolved, option.ID)
+				chosen[option.ID] = true
+				counts[group.ID]++
+				changed = true
+			}
+		}
+	}
+
+	return resolved
+}
+
+// checkCustomizations fills in group defaults and validates the selected
+// options of a menu item. It returns the selection to store on the cart item.
+func (s *Server) checkCustomizations(itemID uint, selected []uint) ([]uint, []structures.CustomizationError, error) {
+	groups, options, err := s.loadCustomizations(itemID)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolved := withGroupDefaults(groups, options, selected)
+	return resolved, validateCustomizationSelection(groups, options, resolved), nil
+}
+
+// customizationIDsJSON encodes a selection the way cart items store it
+func customizationIDsJSON(ids []uint) ([]byte, error) {
+	values := make([]string, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, strconv.FormatUint(uint64(id), 10))
+	}
+	return json.Marshal(values)
+}
+
+// customizationGroupForType finds the live group of an item named after a
+// customization type, creating it when the item has none yet
+func customizationGroupForType(tx *gorm.DB, itemID uint, customizationType string) (*uint, error) {
+	var group structures.CustomizationGroup
+	err := tx.Where("menu_item_id = ? AND LOWER(name) = LOWER(?) AND archived_at IS NULL", itemID, customizationType).
+		First(&group).Error
+	if err == nil {
+		return &group.ID, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	var position int
+	if err := tx.Model(&structures.CustomizationGroup{}).Where("menu_item_id = ?", itemID).
+		Select("COALESCE(MAX(position), 0) + 1").Row().Scan(&position); err != nil {
+		return nil, err
+	}
+	group = structures.CustomizationGroup{MenuItemID: itemID, Name: customizationType, Position: position}
+	if err := tx.Create(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group.ID, nil
+}
+
+// validateGroupRequest checks a group against its item. It returns an HTTP
+// status and message when the request is not valid.
+func (s *Server) validateGroupRequest(cafeID uint, req structures.CustomizationGroupRequest) (int, string) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 50 {
+		return fiber.StatusBadRequest, "name is required and must be at most 50 characters"
+	}
+	if req.MinSelections < 0 || req.MaxSelections < 0 {
+		return fiber.StatusBadRequest, "min_selections and max_selections cannot be negative"
+	}
+	min := req.MinSelections
+	if req.IsRequired && min < 1 {
+		min = 1
+	}
+	if req.MaxSelections > 0 && req.MaxSelections < min {
+		return fiber.StatusBadRequest, "max_selections cannot be less than min_selections"
+	}
+
+	var item structures.MenuItem
+	if err := s.Db.Select("id").Where("id = ? AND cafe_id = ?", req.MenuItemID, cafeID).First(&item).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return fiber.StatusNotFound, "Menu item not found"
+		}
+		return fiber.StatusInternalServerError, "Failed to fetch menu item"
+	}
+
+	var duplicates int
+	if err := s.Db.Model(&structures.CustomizationGroup{}).
+		Where("menu_item_id = ? AND LOWER(name) = LOWER(?) AND id <> ? AND archived_at IS NULL", req.MenuItemID, req.Name, req.ID).
+		Count(&duplicates).Error; err != nil {
+		return fiber.StatusInternalServerError, "Failed to validate group"
+	}
+	if duplicates > 0 {
+		return fiber.StatusConflict, "A group with this name already exists for the item"
+	}
+
+	// Walk up the parents to make sure the group does not end up nested in itself
+	parentID := req.ParentOptionID
+	for depth := 0; parentID != nil; depth++ {
+		if depth > 10 {
+			return fiber.StatusBadRequest, "Modifiers are nested too deeply"
+		}
+
+		var option structures.ItemCustomization
+		if err := s.Db.Where("id = ? AND menu_item_id = ? AND archived_at IS NULL", *parentID, req.MenuItemID).First(&option).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return fiber.StatusBadRequest, "parent_option_id must be an option of the same item"
+			}
+			return fiber.StatusInternalServerError, "Failed to validate group"
+		}
+		if option.GroupID == nil {
+			break
+		}
+		if req.ID != 0 && *option.GroupID == req.ID {
+			return fiber.StatusBadRequest, "A group cannot be nested under its own options"
+		}
+
+		var parentGroup structures.CustomizationGroup
+		if err := s.Db.Where("id = ?", *option.GroupID).First(&parentGroup).Error; err != nil {
+			break
+		}
+		parentID = parentGroup.ParentOptionID
+	}
+
+	return fiber.StatusOK, ""
+}
+
+func (s *Server) CreateCustomizationGroup(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.CustomizationGroupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	req.ID = 0
+
+	if status, message := s.validateGroupRequest(cafeId, req); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	group := structures.CustomizationGroup{
+		MenuItemID:     req.MenuItemID,
+		Name:           strings.TrimSpace(req.Name),
+		Position:       req.Position,
+		IsRequired:     req.IsRequired,
+		MinSelections:  req.MinSelections,
+		MaxSelections:  req.MaxSelections,
+		ParentOptionID: req.ParentOptionID,
+	}
+
+	if err := s.Db.Create(&group).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create customization group",
+		})
+	}
+
+	// The item now has options to choose from
+	if err := s.Db.Model(&structures.MenuItem{}).Where("id = ?", req.MenuItemID).Update("is_customizable", true).Error; err != nil {
+		fmt.Println("Failed to mark item as customizable:", err)
+	} else if err := invalidateMenuCache(s.Db, cafeId); err != nil {
+		fmt.Println("Failed to invalidate menu cache:", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Customization group created successfully",
+		"data":    group,
+	})
+}
+
+func (s *Server) UpdateCustomizationGroup(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.CustomizationGroupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var group structures.CustomizationGroup
+	if err := s.Db.Where("id = ? AND menu_item_id IN (SELECT id FROM menu_items WHERE cafe_id = ?)", req.ID, cafeId).
+		First(&group).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Customization group not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch customization group",
+		})
+	}
+	req.MenuItemID = group.MenuItemID
+
+	if status, message := s.validateGroupRequest(cafeId, req); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	name := strings.TrimSpace(req.Name)
+	tx := s.Db.Begin()
+
+	if err := tx.Model(&group).Updates(map[string]interface{}{
+		"name":             name,
+		"position":         req.Position,
+		"is_required":      req.IsRequired,
+		"min_selections":   req.MinSelections,
+		"max_selections":   req.MaxSelections,
+		"parent_option_id": req.ParentOptionID,
+	}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update customization group",
+		})
+	}
+
+	// Options keep the group name as their type for older clients
+	if err := tx.Model(&structures.ItemCustomization{}).Where("group_id = ?", group.ID).
+		Update("customization_type", name).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update customization group",
+		})
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update customization group",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Customization group updated successfully",
+		"data":    group,
+	})
+}
+
+func (s *Server) ArchiveCustomizationGroup(c *fiber.Ctx) error {
+	return s.archiveMenuRecord(c, "customization_groups",
+		"id = ? AND menu_item_id IN (SELECT id FROM menu_items WHERE cafe_id = ?)", "Customization group")
+}
+
+// GetCustomizationGroups returns the groups and options of an item, archived
+// records included, for the admin app.
+func (s *Server) GetCustomizationGroups(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.CustomizationGroupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var item structures.MenuItem
+	if err := s.Db.Select("id").Where("id = ? AND cafe_id = ?", req.MenuItemID, cafeId).First(&item).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Menu item not found",
+		})
+	}
+
+	var groups []structures.CustomizationGroup
+	if err := s.Db.Where("menu_item_id = ?", req.MenuItemID).Order("position ASC, id ASC").Find(&groups).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch customization groups",
+		})
+	}
+
+	var options []structures.ItemCustomization
+	if err := s.Db.Where("menu_item_id = ?", req.MenuItemID).Order("priority ASC, id ASC").Find(&options).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch customizations",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"groups":         groups,
+		"customizations": options,
+	})
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"reflect"
+	"testing"
+)
+
+func uintPtr(v uint) *uint {
+	return &v
+}
+
+// A latte with a required single choice of milk, optional syrups (at most
+// two), and a choice of brand that only applies when oat milk is chosen
+var (
+	testGroups = []structures.CustomizationGroup{
+		{ID: 1, Name: "Milk", IsRequired: true, MaxSelections: 1},
+		{ID: 2, Name: "Syrups", MaxSelections: 2},
+		{ID: 3, Name: "Brand", MinSelections: 1, MaxSelections: 1, ParentOptionID: uintPtr(12)},
+	}
+	testOptions = []structures.ItemCustomization{
+		{ID: 11, OptionName: "Dairy", GroupID: uintPtr(1), IsDefault: true, IsAvailable: true},
+		{ID: 12, OptionName: "Oat", GroupID: uintPtr(1), IsAvailable: true},
+		{ID: 13, OptionName: "Soy", GroupID: uintPtr(1), IsAvailable: false},
+		{ID: 21, OptionName: "Vanilla", GroupID: uintPtr(2), IsAvailable: true},
+		{ID: 22, OptionName: "Hazelnut", GroupID: uintPtr(2), IsAvailable: true},
+		{ID: 23, OptionName: "Caramel", GroupID: uintPtr(2), IsAvailable: true},
+		{ID: 31, OptionName: "Oatly", GroupID: uintPtr(3), IsDefault: true, IsAvailable: true},
+		{ID: 32, OptionName: "Minor Figures", GroupID: uintPtr(3), IsAvailable: true},
+		{ID: 41, OptionName: "Extra shot", IsAvailable: true}, // Not in a group
+	}
+)
+
+func TestValidateCustomizationSelection(t *testing.T) {
+	tests := []struct {
+		name     string
+		selected []uint
+		want     []structures.CustomizationError
+	}{
+		{"valid", []uint{11, 21}, nil},
+		{"valid nested", []uint{12, 32, 21, 22}, nil},
+		{"ungrouped option", []uint{11, 41}, nil},
+		{"required group missing", []uint{21},
+			[]structures.CustomizationError{{GroupID: 1, Group: "Milk", Message: "Choose a milk"}}},
+		{"too many in single choice", []uint{11, 12, 31},
+			[]structures.CustomizationError{{GroupID: 1, Group: "Milk", Message: "Only one milk can be chosen"}}},
+		{"too many in multi choice", []uint{11, 21, 22, 23},
+			[]structures.CustomizationError{{GroupID: 2, Group: "Syrups", Message: "Choose at most 2 from Syrups"}}},
+		{"nested group without parent", []uint{11, 31},
+			[]structures.CustomizationError{{GroupID: 3, Group: "Brand", Message: "Brand can only be chosen with Oat"}}},
+		{"nested group minimum", []uint{12},
+			[]structures.CustomizationError{{GroupID: 3, Group: "Brand", Message: "Choose a brand"}}},
+		{"unavailable option", []uint{13},
+			[]structures.CustomizationError{{CustomizationID: 13, Message: "Soy is currently unavailable"}}},
+		{"unknown option", []uint{11, 99},
+			[]structures.CustomizationError{{CustomizationID: 99, Message: "Option is not offered for this item"}}},
+		{"duplicate option", []uint{11, 21, 21},
+			[]structures.CustomizationError{{CustomizationID: 21, Message: "Vanilla is selected more than once"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateCustomizationSelection(testGroups, testOptions, tt.selected)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithGroupDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		selected []uint
+		want     []uint
+	}{
+		{"nothing chosen", nil, []uint{11}},
+		{"choice kept", []uint{12, 32}, []uint{12, 32}},
+		{"default of nested group", []uint{12}, []uint{12, 31}},
+		{"other groups filled", []uint{21}, []uint{21, 11}},
+		{"unknown ids left for validation", []uint{99}, []uint{99, 11}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := withGroupDefaults(testGroups, testOptions, tt.selected)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withGroupDefaults(%v) = %v, want %v", tt.selected, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithGroupDefaultsOpensNestedGroups(t *testing.T) {
+	groups := []structures.CustomizationGroup{
+		{ID: 1, Name: "Milk", MaxSelections: 1},
+		{ID: 3, Name: "Brand", MaxSelections: 1, ParentOptionID: uintPtr(12)},
+	}
+	options := []structures.ItemCustomization{
+		{ID: 12, OptionName: "Oat", GroupID: uintPtr(1), IsDefault: true, IsAvailable: true},
+		{ID: 31, OptionName: "Oatly", GroupID: uintPtr(3), IsDefault: true, IsAvailable: true},
+		{ID: 32, OptionName: "Minor Figures", GroupID: uintPtr(3), IsDefault: true, IsAvailable: true},
+	}
+
+	// The nested group is listed before its parent and capped at one default
+	got := withGroupDefaults([]structures.CustomizationGroup{groups[1], groups[0]}, options, nil)
+	if want := []uint{12, 31}; !reflect.DeepEqual(got, want) {
+		t.Errorf("withGroupDefaults = %v, want %v", got, want)
+	}
+	if errs := validateCustomizationSelection(groups, options, got); len(errs) > 0 {
+		t.Errorf("defaults are not a valid selection: %+v", errs)
+	}
+}
+
+func TestParseCustomizationIDs(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    []uint
+		wantErr bool
+	}{
+		{``, nil, false},
+		{`null`, nil, false},
+		{`["1", " 2 "]`, []uint{1, 2}, false},
+		{`[3, 4]`, []uint{3, 4}, false},
+		{`["a"]`, nil, true},
+		{`[1.5]`, nil, true},
+		{`[-1]`, nil, true},
+		{`{"id": 1}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseCustomizationIDs([]byte(tt.raw))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCustomizationIDs(%s) err = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && len(got)+len(tt.want) > 0 && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCustomizationIDs(%s) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/notification"
+	"coffeeMustacheBackend/pkg/structures"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+const maxDeviceTokenLength = 255
+
+// isExpoToken reports whether the token was issued by Expo rather than FCM
+func isExpoToken(token string) bool {
+	return (strings.HasPrefix(token, "ExponentPushToken[") || strings.HasPrefix(token, "ExpoPushToken[")) &&
+		strings.HasSuffix(token, "]")
+}
+
+// validateDeviceToken checks the request and fills in the provider
+func validateDeviceToken(req *structures.DeviceTokenRequest) error {
+	req.Token = strings.TrimSpace(req.Token)
+	req.DeviceID = strings.TrimSpace(req.DeviceID)
+	req.Provider = strings.ToLower(strings.TrimSpace(req.Provider))
+
+	if req.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if len(req.Token) > maxDeviceTokenLength {
+		return fmt.Errorf("token must be at most %d characters", maxDeviceTokenLength)
+	}
+	if len(req.DeviceID) > 100 {
+		return fmt.Errorf("device_id must be at most 100 characters")
+	}
+
+	if req.Provider == "" {
+		req.Provider = string(notification.ChannelFCM)
+		if isExpoToken(req.Token) {
+			req.Provider = string(notification.ChannelExpo)
+		}
+	}
+	switch notification.Channel(req.Provider) {
+	case notification.ChannelExpo:
+		if !isExpoToken(req.Token) {
+			return fmt.Errorf("token is not an Expo push token")
+		}
+	case notification.ChannelFCM:
+		if isExpoToken(req.Token) {
+			return fmt.Errorf("token is an Expo push token, use the expo provider")
+		}
+	default:
+		return fmt.Errorf("provider must be fcm or expo")
+	}
+	return nil
+}
+
+// saveDeviceToken stores the token for the admin. A token is stored once, so
+// registering it again moves it to whoever registered it last.
+func saveDeviceToken(tx *gorm.DB, admin structures.AdminUser, req structures.DeviceTokenRequest) error {
+	if req.DeviceID != "" {
+		if err := tx.Where("user_id = ? AND device_id = ? AND token <> ?", admin.ID, req.DeviceID, req.Token).
+			Delete(&structures.FcmToken{}).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Exec(`
+		INSERT INTO fcm_tokens (user_id, token, provider, device_id, cafe_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, NOW(), NOW())
+		ON CONFLICT (token) DO UPDATE SET
+			user_id = EXCLUDED.user_id,
+			provider = EXCLUDED.provider,
+			device_id = EXCLUDED.device_id,
+			cafe_id = EXCLUDED.cafe_id,
+			updated_at = NOW()`,
+		admin.ID, req.Token, req.Provider, req.DeviceID, admin.CafeID).Error
+}
+
+// cafeDeviceTokens loads the tokens of a provider on the devices of the cafe.
+// Devices of staff who left the cafe or were deactivated are skipped.
+func (s *Server) cafeDeviceTokens(cafeID uint, provider string, tokens *[]string) error {
+	return s.Db.Table("fcm_tokens t").
+		Where("t.cafe_id = ? AND t.provider = ?", cafeID, provider).
+		Where("NOT EXISTS (SELECT 1 FROM admin_users a WHERE a.id = t.user_id AND (a.status <> 'active' OR a.cafe_id <> t.cafe_id))").
+		Pluck("t.token", tokens).Error
+}
+
+// RegisterDeviceToken registers the push token of the device the admin is
+// signed in on. The app calls it after sign in and whenever it starts.
+func (s *Server) RegisterDeviceToken(c *fiber.Ctx) error {
+	admin := c.Locals("admin").(structures.AdminUser)
+
+	var req structures.DeviceTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := validateDeviceToken(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	tx := s.Db.Begin()
+	if err := saveDeviceToken(tx, admin, req); err != nil {
+		tx.Rollback()
+		log.Println("❌ Failed to register device token:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to register device",
+		})
+	}
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to register device",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Device registered",
+		"provider": req.Provider,
+	})
+}
+
+// RefreshDeviceToken replaces a token the provider rotated. The old token is
+// only removed when it belongs to the admin.
+func (s *Server) RefreshDeviceToken(c *fiber.Ctx) error {
+	admin := c.Locals("admin").(structures.AdminUser)
+
+	var req structures.DeviceTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	req.OldToken = strings.TrimSpace(req.OldToken)
+	if req.OldToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "old_token is required",
+		})
+	}
+	if err := validateDeviceToken(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	tx := s.Db.Begin()
+	if req.OldToken != req.Token {
+		if err := tx.Where("token = ? AND user_id = ?", req.OldToken, admin.ID).
+			Delete(&structures.FcmToken{}).Error; err != nil {
+			tx.Rollback()
+			log.Println("❌ Failed to remove old device token:", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to refresh device",
+			})
+		}
+	}
+	if err := saveDeviceToken(tx, admin, req); err != nil {
+		tx.Rollback()
+		log.Println("❌ Failed to refresh device token:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to refresh device",
+		})
+	}
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to refresh device",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Device refreshed",
+		"provider": req.Provider,
+	})
+}
+
+// UnregisterDeviceToken stops notifications to a device of the admin, e.g.
+// when they sign out. Unknown tokens are not an error.
+func (s *Server) UnregisterDeviceToken(c *fiber.Ctx) error {
+	admin := c.Locals("admin").(structures.AdminUser)
+
+	var req structures.DeviceTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "token is required",
+		})
+	}
+
+	result := s.Db.Where("token = ? AND user_id = ?", req.Token, admin.ID).Delete(&structures.FcmToken{})
+	if result.Error != nil {
+		log.Println("❌ Failed to unregister device token:", result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unregister device",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Device unregistered",
+		"removed": result.RowsAffected > 0,
+	})
+}
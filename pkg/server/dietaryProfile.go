@@ -0,0 +1,237 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var knownDietaryLabels = map[string]bool{
+	string(structures.GlutenFree):       true,
+	string(structures.HighProtein):      true,
+	string(structures.Vegan):            true,
+	string(structures.Keto):             true,
+	string(structures.LactoseFree):      true,
+	string(structures.LowCarb):          true,
+	string(structures.LowFat):           true,
+	string(structures.Organic):          true,
+	string(structures.SugarFree):        true,
+	string(structures.Paleo):            true,
+	string(structures.Vegetarian):       true,
+	string(structures.Whole30):          true,
+	string(structures.DiabeticFriendly): true,
+}
+
+// loadDietaryProfile reads the allergen and dietary preferences of a user
+func (s *Server) loadDietaryProfile(userID uint) (helper.DietaryProfile, error) {
+	var profile helper.DietaryProfile
+
+	var preferences []structures.Preference
+	if err := s.Db.Where("user_id = ? AND preference_type IN (?)", userID,
+		[]string{structures.PreferenceAllergen, structures.PreferenceDietary, structures.PreferenceConflictsMode}).
+		Order("id ASC").Find(&preferences).Error; err != nil {
+		return profile, err
+	}
+
+	for _, preference := range preferences {
+		switch preference.PreferenceType {
+		case structures.PreferenceAllergen:
+			profile.Allergens = append(profile.Allergens, preference.PreferenceValue)
+		case structures.PreferenceDietary:
+			profile.Dietary = append(profile.Dietary, preference.PreferenceValue)
+		case structures.PreferenceConflictsMode:
+			profile.HideConflicts = preference.PreferenceValue == "hide"
+		}
+	}
+
+	return profile, nil
+}
+
+// requestDietaryProfile loads the profile of the user making the request. A
+// failure only logs, the menu is still served without personalisation.
+func (s *Server) requestDietaryProfile(c *fiber.Ctx) helper.DietaryProfile {
+	userID, ok := c.Locals("userId").(float64)
+	if !ok || userID == 0 {
+		return helper.DietaryProfile{}
+	}
+
+	profile, err := s.loadDietaryProfile(uint(userID))
+	if err != nil {
+		fmt.Println("Failed to load dietary profile:", err)
+		return helper.DietaryProfile{}
+	}
+	return profile
+}
+
+// labelConflicts returns the conflicts of each item with the profile, keyed by item id
+func labelConflicts(profile helper.DietaryProfile, labels map[uint]*itemLabels) map[uint][]string {
+	conflicts := make(map[uint][]string)
+	for itemID, item := range labels {
+		if itemConflicts := profile.Conflicts(item.Allergens, item.Dietary); len(itemConflicts) > 0 {
+			conflicts[itemID] = itemConflicts
+		}
+	}
+	return conflicts
+}
+
+// itemDietaryConflicts returns the conflicts of the given items with the profile
+func (s *Server) itemDietaryConflicts(profile helper.DietaryProfile, itemIDs []uint) (map[uint][]string, error) {
+	if profile.IsEmpty() || len(itemIDs) == 0 {
+		return make(map[uint][]string), nil
+	}
+
+	labels, err := s.loadItemLabels("m.id IN (?)", itemIDs)
+	if err != nil {
+		return nil, err
+	}
+	return labelConflicts(profile, labels), nil
+}
+
+// applyDietaryProfile hides conflicting items when the user asked for that
+// and returns the conflicts of the items that are kept. A failure only logs,
+// the items are then returned unflagged.
+func (s *Server) applyDietaryProfile(profile helper.DietaryProfile, items []structures.MenuItem) ([]structures.MenuItem, map[uint][]string) {
+	itemIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		itemIDs = append(itemIDs, item.ID)
+	}
+
+	conflicts, err := s.itemDietaryConflicts(profile, itemIDs)
+	if err != nil {
+		fmt.Println("Failed to check dietary conflicts:", err)
+		return items, make(map[uint][]string)
+	}
+	if !profile.HideConflicts || len(conflicts) == 0 {
+		return items, conflicts
+	}
+
+	kept := make([]structures.MenuItem, 0, len(items))
+	for _, item := range items {
+		if len(conflicts[item.ID]) == 0 {
+			kept = append(kept, item)
+		}
+	}
+	return kept, make(map[uint][]string)
+}
+
+// cafeDietaryConflicts returns the conflicts of every item of a cafe with the profile
+func (s *Server) cafeDietaryConflicts(cafeID uint, profile helper.DietaryProfile) (map[uint][]string, error) {
+	if profile.IsEmpty() {
+		return make(map[uint][]string), nil
+	}
+
+	labels, err := s.loadItemLabels("m.cafe_id = ?", cafeID)
+	if err != nil {
+		return nil, err
+	}
+	return labelConflicts(profile, labels), nil
+}
+
+func (s *Server) GetDietaryProfile(c *fiber.Ctx) error {
+	userId := uint(c.Locals("userId").(float64))
+
+	profile, err := s.loadDietaryProfile(userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch dietary profile",
+		})
+	}
+	if profile.Allergens == nil {
+		profile.Allergens = []string{}
+	}
+	if profile.Dietary == nil {
+		profile.Dietary = []string{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": profile,
+	})
+}
+
+// SaveDietaryProfile replaces the allergen exclusions and dietary needs of the user
+func (s *Server) SaveDietaryProfile(c *fiber.Ctx) error {
+	userId := uint(c.Locals("userId").(float64))
+
+	var req structures.DietaryProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	if len(req.Allergens) > 20 || len(req.Dietary) > 20 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At most 20 allergens and 20 dietary needs can be saved",
+		})
+	}
+
+	var preferences []structures.Preference
+	seen := make(map[string]bool)
+	for _, allergen := range req.Allergens {
+		allergen = helper.NormalizeLabel(allergen)
+		if allergen == "" || len(allergen) > 100 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Allergens must be between 1 and 100 characters",
+			})
+		}
+		if seen["allergen:"+allergen] {
+			continue
+		}
+		seen["allergen:"+allergen] = true
+		preferences = append(preferences, structures.Preference{UserID: userId, PreferenceType: structures.PreferenceAllergen, PreferenceValue: allergen})
+	}
+	for _, need := range req.Dietary {
+		need = helper.NormalizeLabel(need)
+		if !knownDietaryLabels[need] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Unknown dietary label %q", need),
+			})
+		}
+		if seen["dietary:"+need] {
+			continue
+		}
+		seen["dietary:"+need] = true
+		preferences = append(preferences, structures.Preference{UserID: userId, PreferenceType: structures.PreferenceDietary, PreferenceValue: need})
+	}
+
+	mode := "flag"
+	if req.HideConflicts {
+		mode = "hide"
+	}
+	preferences = append(preferences, structures.Preference{UserID: userId, PreferenceType: structures.PreferenceConflictsMode, PreferenceValue: mode})
+
+	tx := s.Db.Begin()
+
+	if err := tx.Where("user_id = ? AND preference_type IN (?)", userId,
+		[]string{structures.PreferenceAllergen, structures.PreferenceDietary, structures.PreferenceConflictsMode}).
+		Delete(&structures.Preference{}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save dietary profile",
+		})
+	}
+
+	for _, preference := range preferences {
+		preference := preference
+		if err := tx.Create(&preference).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save dietary profile",
+			})
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save dietary profile",
+		})
+	}
+
+	profile, _ := s.loadDietaryProfile(userId)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Dietary profile saved successfully",
+		"data":    profile,
+	})
+}
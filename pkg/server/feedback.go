@@ -1,9 +1,11 @@
 package server
 
 import (
+	"coffeeMustacheBackend/pkg/helper"
 	"coffeeMustacheBackend/pkg/structures"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -122,96 +124,152 @@ func (s *Server) SubmitFeedback(c *fiber.Ctx) error {
 		})
 	}
 
-	// Step 1: Insert ratings for each food item
+	if feedbackReq.SessionID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "session_id is required",
+		})
+	}
 	for _, item := range feedbackReq.Items {
-		itemFeedback := structures.ItemFeedback{
-			UserID:    uint(userId),
-			ItemID:    item.ItemID,
-			SessionID: feedbackReq.SessionID,
-			Rating:    item.Rating,
-			CreatedAt: time.Now(),
+		if item.Rating < 1 || item.Rating > 5 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Ratings must be between 1 and 5",
+			})
 		}
+	}
+	if feedbackReq.CafeRating < 0 || feedbackReq.CafeRating > 5 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cafe_rating must be between 1 and 5 when given",
+		})
+	}
+	feedbackReq.Review = strings.TrimSpace(feedbackReq.Review)
+	if len(feedbackReq.Review) > maxReviewLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("review cannot be longer than %d characters", maxReviewLength),
+		})
+	}
 
-		if err := s.Db.Create(&itemFeedback).Error; err != nil {
+	// Only guests who ordered can write a review
+	var orderID string
+	if feedbackReq.Review != "" {
+		var err error
+		orderID, err = s.reviewerOrder(uint(userId), feedbackReq.CafeID, feedbackReq.SessionID)
+		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to save item feedback",
+				"error": "Failed to save cafe feedback",
 			})
 		}
-
-		// select current rating and number of ratings from menu items table
-		var menuItem structures.MenuItem
-		if err := s.Db.Model(&structures.MenuItem{}).
-			Where("id = ?", item.ItemID).
-			First(&menuItem).Error; err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to retrieve menu item",
+		if orderID == "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only guests who ordered can leave a review",
 			})
 		}
+	}
 
-		newRating := (menuItem.Rating*float64(menuItem.TotalRatings) + float64(item.Rating)) / float64(menuItem.TotalRatings+1)
+	tx := s.Db.Begin()
 
-		// Update the menu items table with new rating and total ratings
-		if err := s.Db.Model(&structures.MenuItem{}).
-			Where("id = ?", item.ItemID).
-			Updates(map[string]interface{}{
-				"rating":        newRating,
-				"total_ratings": menuItem.TotalRatings + 1,
-			}).Error; err != nil {
+	// Step 1: Save and count the rating of each food item, once per session
+	alreadyRated := []uint{}
+	for _, item := range feedbackReq.Items {
+		saved, err := recordItemRating(tx, structures.ItemFeedback{
+			UserID:    uint(userId),
+			ItemID:    item.ItemID,
+			SessionID: feedbackReq.SessionID,
+			Rating:    item.Rating,
+		}, feedbackReq.CafeID)
+		if err != nil {
+			tx.Rollback()
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to update menu item",
+				"error": "Failed to save item feedback",
 			})
 		}
-
+		if !saved {
+			alreadyRated = append(alreadyRated, item.ItemID)
+		}
 	}
 
-	// Step 2: Insert overall cafe feedback
-	cafeFeedback := structures.CafeFeedback{
-		UserID:      uint(userId),
-		CafeID:      feedbackReq.CafeID,
-		Rating:      feedbackReq.CafeRating,
-		SessionID:   feedbackReq.SessionID,
-		WouldReturn: feedbackReq.WouldReturn,
-		Review:      feedbackReq.Review,
-		CreatedAt:   time.Now(),
+	// Ratings are shown on the menu
+	if len(feedbackReq.Items) > len(alreadyRated) {
+		if err := invalidateMenuCache(tx, feedbackReq.CafeID); err != nil {
+			tx.Rollback()
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save item feedback",
+			})
+		}
 	}
 
+	// Step 2: Insert overall cafe feedback, once per session
+	cafeAlreadyRated := false
+	var reviewStatus structures.ReviewStatus
 	if feedbackReq.CafeRating == 0 && len(feedbackReq.Review) == 0 {
 		fmt.Println("Skipping feedback for cafe")
 	} else {
-		if err := s.Db.Create(&cafeFeedback).Error; err != nil {
+		cafeFeedback := structures.CafeFeedback{
+			UserID:      uint(userId),
+			CafeID:      feedbackReq.CafeID,
+			Rating:      feedbackReq.CafeRating,
+			SessionID:   feedbackReq.SessionID,
+			WouldReturn: feedbackReq.WouldReturn,
+			Review:      feedbackReq.Review,
+			CreatedAt:   time.Now(),
+		}
+		// Personal details are removed right away, the classifier runs
+		// in the job worker
+		if feedbackReq.Review != "" {
+			cafeFeedback.OrderID = orderID
+			cafeFeedback.Review, _ = helper.MaskPII(feedbackReq.Review)
+			cafeFeedback.ReviewStatus = structures.ReviewPending
+			cafeFeedback.ModerationReason = reviewAwaitingCheck
+		}
+		saved, err := recordCafeFeedback(tx, &cafeFeedback)
+		if err != nil {
+			tx.Rollback()
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to save cafe feedback",
 			})
 		}
+		if !saved {
+			cafeAlreadyRated = true
+		} else {
+			reviewStatus = cafeFeedback.ReviewStatus
+			if feedbackReq.Review != "" {
+				if err := enqueueJob(tx, jobModerateReview, moderateReviewPayload{FeedbackID: cafeFeedback.ID}); err != nil {
+					tx.Rollback()
+					return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+						"error": "Failed to save cafe feedback",
+					})
+				}
+			}
 
-		// select current rating and number of ratings from cafes table
-		var cafe structures.Cafe
-		if err := s.Db.Model(&structures.Cafe{}).
-			Where("id = ?", feedbackReq.CafeID).
-			First(&cafe).Error; err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to retrieve cafe",
-			})
+			// A review without stars does not count towards the rating
+			if feedbackReq.CafeRating > 0 {
+				if err := addCafeRating(tx, feedbackReq.CafeID, feedbackReq.CafeRating); err != nil {
+					tx.Rollback()
+					return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+						"error": "Failed to update cafe",
+					})
+				}
+			}
 		}
+	}
 
-		newCafeRating := (cafe.Rating*float64(cafe.TotalRatings) + float64(cafe.Rating)) / float64(cafe.TotalRatings+1)
-
-		// Update the cafes table with new rating and total ratings
-		if err := s.Db.Model(&structures.Cafe{}).
-			Where("id = ?", feedbackReq.CafeID).
-			Updates(map[string]interface{}{
-				"rating":        newCafeRating,
-				"total_ratings": cafe.TotalRatings + 1,
-			}).Error; err != nil {
-			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to update cafe",
-			})
-		}
+	if err := completeFeedbackPrompt(tx, feedbackReq.SessionID, uint(userId)); err != nil {
+		tx.Rollback()
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save feedback",
+		})
+	}
 
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save feedback",
+		})
 	}
 
 	// Return success response
 	return c.JSON(fiber.Map{
-		"message": "Feedback submitted successfully",
+		"message":            "Feedback submitted successfully",
+		"already_rated":      alreadyRated,
+		"cafe_already_rated": cafeAlreadyRated,
+		"review_status":      reviewStatus,
 	})
 }
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// maxAnalysesPerRun bounds the reviews analysed by one run of the job,
+	// the rest are picked up by the next run.
+	maxAnalysesPerRun = 500
+
+	// A review that fails maxAnalysisAttempts times is no longer analysed, so
+	// it does not keep newer reviews out of every run
+	maxAnalysisAttempts = 3
+
+	// An item rated lowRatingMax or less in a week is listed in the trends
+	lowRatingMax         = 2
+	lowRatedItemsPerWeek = 5
+)
+
+// feedbackAnalyser returns the configured analyser for review text
+func (s *Server) feedbackAnalyser() (helper.FeedbackAnalyser, error) {
+	switch s.Config.FEEDBACK_ANALYSER {
+	case "", "lexicon":
+		return helper.LexiconAnalyser{}, nil
+	case "openai":
+		if s.Config.OPEN_AI_API_KEY == "" {
+			return nil, errors.New("OPEN_AI_API_KEY is not set")
+		}
+		return helper.OpenAIAnalyser{APIKey: s.Config.OPEN_AI_API_KEY}, nil
+	default:
+		return nil, fmt.Errorf("unknown feedback analyser %q", s.Config.FEEDBACK_ANALYSER)
+	}
+}
+
+// saveFeedbackAnalysis stores the sentiment of a review and replaces its topics
+func (s *Server) saveFeedbackAnalysis(feedback structures.CafeFeedback, analyser string, analysis helper.FeedbackAnalysis) error {
+	tx := s.Db.Begin()
+
+	if err := tx.Model(&structures.CafeFeedback{}).Where("id = ?", feedback.ID).
+		UpdateColumns(map[string]interface{}{
+			"sentiment":       analysis.Sentiment,
+			"sentiment_score": analysis.Score,
+			"analyser":        analyser,
+			"analysed_at":     time.Now(),
+		}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("feedback_id = ?", feedback.ID).Delete(&structures.FeedbackTopic{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, topic := range analysis.Topics {
+		if err := tx.Create(&structures.FeedbackTopic{
+			FeedbackID: feedback.ID,
+			CafeID:     feedback.CafeID,
+			Topic:      topic.Topic,
+			Sentiment:  topic.Sentiment,
+		}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// recordAnalysisFailure counts a failed analysis of a review
+func (s *Server) recordAnalysisFailure(feedback structures.CafeFeedback, err error) {
+	message := err.Error()
+	if len(message) > 255 {
+		message = message[:255]
+	}
+	if err := s.Db.Model(&structures.CafeFeedback{}).Where("id = ?", feedback.ID).
+		UpdateColumns(map[string]interface{}{
+			"analysis_tries": gorm.Expr("analysis_tries + 1"),
+			"analysis_error": message,
+		}).Error; err != nil {
+		log.Printf("❌ Failed to record analysis failure of feedback %d: %v\n", feedback.ID, err)
+	}
+}
+
+// RunFeedbackAnalysisJob classifies the reviews not analysed yet by sentiment
+// and topic. A review that fails is retried by the next runs, up to
+// maxAnalysisAttempts times.
+func (s *Server) RunFeedbackAnalysisJob(c *fiber.Ctx) error {
+	analyser, err := s.feedbackAnalyser()
+	if err != nil {
+		log.Println("❌ Feedback analyser is not configured:", err)
+		return err
+	}
+
+	var feedbacks []structures.CafeFeedback
+	if err := s.Db.Select("id, cafe_id, review").
+		Where("review <> '' AND analysed_at IS NULL AND analysis_tries < ?", maxAnalysisAttempts).
+		Order("id ASC").Limit(maxAnalysesPerRun).Find(&feedbacks).Error; err != nil {
+		log.Println("❌ Failed to fetch feedback to analyse:", err)
+		return err
+	}
+
+	analysed, failed := 0, 0
+	for _, feedback := range feedbacks {
+		analysis, err := analyser.Analyse(feedback.Review)
+		if err != nil {
+			log.Printf("❌ Failed to analyse feedback %d: %v\n", feedback.ID, err)
+			s.recordAnalysisFailure(feedback, err)
+			failed++
+			continue
+		}
+		if err := s.saveFeedbackAnalysis(feedback, analyser.Name(), analysis); err != nil {
+			log.Printf("❌ Failed to save analysis of feedback %d: %v\n", feedback.ID, err)
+			s.recordAnalysisFailure(feedback, err)
+			failed++
+			continue
+		}
+		analysed++
+	}
+
+	log.Printf("Feedback analysis analysed %d reviews, %d failed\n", analysed, failed)
+	if c == nil {
+		return nil
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":  "Feedback analysed",
+		"analysed": analysed,
+		"failed":   failed,
+	})
+}
+
+// topicTrend counts the mentions of a topic in a week
+type topicTrend struct {
+	Week     string `json:"-"`
+	Topic    string `json:"topic"`
+	Mentions int    `json:"mentions"`
+	Positive int    `json:"positive"`
+	Neutral  int    `json:"neutral"`
+	Negative int    `json:"negative"`
+}
+
+// lowRatedItem is an item guests rated badly in a week. Negative reviews and
+// their topics come from the same guests in the same visits.
+type lowRatedItem struct {
+	Week            string   `json:"-"`
+	ItemID          uint     `json:"item_id"`
+	Name            string   `json:"name"`
+	Ratings         int      `json:"ratings"`
+	AvgRating       float64  `json:"avg_rating"`
+	LowRatings      int      `json:"low_ratings"`
+	NegativeReviews int      `json:"negative_reviews"`
+	RawTopics       string   `json:"-"`
+	Topics          []string `json:"topics"`
+}
+
+// feedbackWeek is the feedback of a cafe in one week, starting on Monday
+type feedbackWeek struct {
+	Week           string         `json:"week"`
+	Feedbacks      int            `json:"feedbacks"`
+	Reviews        int            `json:"reviews"`
+	AvgRating      float64        `json:"avg_rating"`
+	Positive       int            `json:"positive"`
+	Neutral        int            `json:"neutral"`
+	Negative       int            `json:"negative"`
+	SentimentScore float64        `json:"sentiment_score"`
+	Topics         []topicTrend   `json:"topics"`
+	LowRatedItems  []lowRatedItem `json:"low_rated_items"`
+}
+
+// GetFeedbackTrends aggregates the feedback of the cafe per week: ratings,
+// sentiment, topics and the items rated badly, for the last weeks (default 8).
+func (s *Server) GetFeedbackTrends(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	weeks := c.QueryInt("weeks", 8)
+	if weeks < 1 || weeks > 52 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "weeks must be between 1 and 52",
+		})
+	}
+
+	clock, _, err := s.cafeClock(cafeId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve cafe details",
+		})
+	}
+	timezone := clock.Now().Location().String()
+
+	// Weeks start on Monday in the timezone of the cafe
+	start := clock.StartOfDay()
+	start = start.AddDate(0, 0, -((int(start.Weekday())+6)%7)-7*(weeks-1))
+
+	var summaries []feedbackWeek
+	if err := s.Db.Raw(`
+		SELECT TO_CHAR(DATE_TRUNC('week', created_at AT TIME ZONE ?), 'YYYY-MM-DD') AS week,
+			COUNT(*) AS feedbacks,
+			COUNT(*) FILTER (WHERE review <> '') AS reviews,
+			COALESCE(AVG(rating) FILTER (WHERE rating BETWEEN 1 AND 5), 0) AS avg_rating,
+			COUNT(*) FILTER (WHERE sentiment = ?) AS positive,
+			COUNT(*) FILTER (WHERE sentiment = ?) AS neutral,
+			COUNT(*) FILTER (WHERE sentiment = ?) AS negative,
+			COALESCE(AVG(sentiment_score) FILTER (WHERE analysed_at IS NOT NULL), 0) AS sentiment_score
+		FROM cafe_feedbacks
+		WHERE cafe_id = ? AND created_at >= ?
+		GROUP BY 1`,
+		timezone, helper.SentimentPositive, helper.SentimentNeutral, helper.SentimentNegative,
+		cafeId, start).Scan(&summaries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch feedback trends",
+		})
+	}
+
+	var topics []topicTrend
+	if err := s.Db.Raw(`
+		SELECT TO_CHAR(DATE_TRUNC('week', f.created_at AT TIME ZONE ?), 'YYYY-MM-DD') AS week,
+			t.topic,
+			COUNT(*) AS mentions,
+			COUNT(*) FILTER (WHERE t.sentiment = ?) AS positive,
+			COUNT(*) FILTER (WHERE t.sentiment = ?) AS neutral,
+			COUNT(*) FILTER (WHERE t.sentiment = ?) AS negative
+		FROM feedback_topics t
+		JOIN cafe_feedbacks f ON f.id = t.feedback_id
+		WHERE t.cafe_id = ? AND f.created_at >= ?
+		GROUP BY 1, t.topic
+		ORDER BY mentions DESC, t.topic`,
+		timezone, helper.SentimentPositive, helper.SentimentNeutral, helper.SentimentNegative,
+		cafeId, start).Scan(&topics).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch feedback trends",
+		})
+	}
+
+	var items []lowRatedItem
+	if err := s.Db.Raw(`
+		SELECT TO_CHAR(DATE_TRUNC('week', i.created_at AT TIME ZONE ?), 'YYYY-MM-DD') AS week,
+			i.item_id, m.name,
+			COUNT(*) AS ratings,
+			AVG(i.rating) AS avg_rating,
+			COUNT(*) FILTER (WHERE i.rating <= ?) AS low_ratings,
+			COUNT(DISTINCT f.id) FILTER (WHERE f.sentiment = ?) AS negative_reviews,
+			COALESCE(STRING_AGG(t.topics, ','), '') AS raw_topics
+		FROM item_feedbacks i
+		JOIN menu_items m ON m.id = i.item_id
+		LEFT JOIN cafe_feedbacks f
+		ON f.user_id = i.user_id AND f.session_id = i.session_id AND f.cafe_id = m.cafe_id
+		LEFT JOIN (
+			SELECT feedback_id, STRING_AGG(topic, ',') AS topics
+			FROM feedback_topics
+			WHERE cafe_id = ? AND sentiment = ?
+			GROUP BY feedback_id
+		) t ON t.feedback_id = f.id AND i.rating <= ?
+		WHERE m.cafe_id = ? AND i.created_at >= ?
+		GROUP BY 1, i.item_id, m.name
+		HAVING COUNT(*) FILTER (WHERE i.rating <= ?) > 0
+		ORDER BY low_ratings DESC, avg_rating ASC`,
+		timezone, lowRatingMax, helper.SentimentNegative,
+		cafeId, helper.SentimentNegative, lowRatingMax,
+		cafeId, start, lowRatingMax).Scan(&items).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch feedback trends",
+		})
+	}
+
+	// Every week is listed, weeks without feedback too
+	byWeek := make(map[string]*feedbackWeek, weeks)
+	result := make([]feedbackWeek, weeks)
+	for i := range result {
+		week := start.AddDate(0, 0, 7*i).Format("2006-01-02")
+		result[i] = feedbackWeek{Week: week, Topics: []topicTrend{}, LowRatedItems: []lowRatedItem{}}
+		byWeek[week] = &result[i]
+	}
+	for _, summary := range summaries {
+		if week, ok := byWeek[summary.Week]; ok {
+			summary.Topics, summary.LowRatedItems = week.Topics, week.LowRatedItems
+			*week = summary
+		}
+	}
+	for _, topic := range topics {
+		if week, ok := byWeek[topic.Week]; ok {
+			week.Topics = append(week.Topics, topic)
+		}
+	}
+	for _, item := range items {
+		week, ok := byWeek[item.Week]
+		if !ok || len(week.LowRatedItems) >= lowRatedItemsPerWeek {
+			continue
+		}
+		item.Topics = uniqueTopics(item.RawTopics)
+		week.LowRatedItems = append(week.LowRatedItems, item)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"timezone": timezone,
+		"data":     result,
+	})
+}
+
+// uniqueTopics splits the topics aggregated over several reviews
+func uniqueTopics(raw string) []string {
+	seen := make(map[string]bool)
+	topics := []string{}
+	for _, topic := range strings.Split(raw, ",") {
+		if topic != "" && !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
@@ -0,0 +1,437 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/notification"
+	"coffeeMustacheBackend/pkg/structures"
+	"html/template"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// maxPromptsPerRun bounds the prompts sent by one run of the job
+	maxPromptsPerRun = 200
+
+	// A prompt that fails is retried maxPromptAttempts times, a little later each time
+	maxPromptAttempts = 3
+	promptRetryDelay  = 15 * time.Minute
+)
+
+// feedbackPromptSettings holds when prompts are sent
+type feedbackPromptSettings struct {
+	Delay      time.Duration // After the visit ends or is paid
+	QuietStart time.Duration // Local time of the cafe
+	QuietEnd   time.Duration
+}
+
+func (s *Server) feedbackPromptSettings() feedbackPromptSettings {
+	settings := feedbackPromptSettings{
+		Delay:      helper.MinutesOrDefault(s.Config.FEEDBACK_PROMPT_DELAY_MINUTES, 60),
+		QuietStart: 22 * time.Hour,
+		QuietEnd:   9 * time.Hour,
+	}
+	if start, err := helper.ParseTimeOfDay(s.Config.QUIET_HOURS_START); err == nil {
+		settings.QuietStart = start
+	}
+	if end, err := helper.ParseTimeOfDay(s.Config.QUIET_HOURS_END); err == nil {
+		settings.QuietEnd = end
+	}
+	return settings
+}
+
+// quietUntil reports when the quiet hours around the local time end, or the
+// zero time when it is not in them. Quiet hours may span midnight.
+func (settings feedbackPromptSettings) quietUntil(local time.Time) time.Time {
+	if settings.QuietStart == settings.QuietEnd {
+		return time.Time{}
+	}
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	offset := local.Sub(midnight)
+
+	if settings.QuietStart < settings.QuietEnd {
+		if offset >= settings.QuietStart && offset < settings.QuietEnd {
+			return midnight.Add(settings.QuietEnd)
+		}
+		return time.Time{}
+	}
+	switch {
+	case offset >= settings.QuietStart:
+		return midnight.AddDate(0, 0, 1).Add(settings.QuietEnd)
+	case offset < settings.QuietEnd:
+		return midnight.Add(settings.QuietEnd)
+	default:
+		return time.Time{}
+	}
+}
+
+// scheduleFeedbackPrompts schedules a prompt for every guest who ordered in
+// the session. A guest is prompted once per session however often it is
+// called.
+func (s *Server) scheduleFeedbackPrompts(sessionID string) error {
+	var guests []struct {
+		UserID uint
+		CafeID uint
+	}
+	if err := s.Db.Raw(`
+		SELECT DISTINCT user_id, cafe_id
+		FROM orders
+		WHERE session_id = ? AND order_status <> ?`,
+		sessionID, structures.OrderCancelled).Scan(&guests).Error; err != nil {
+		return err
+	}
+
+	dueAt := time.Now().Add(s.feedbackPromptSettings().Delay)
+	for _, guest := range guests {
+		token, err := helper.GenerateToken(16)
+		if err != nil {
+			return err
+		}
+		if err := s.Db.Exec(`
+			INSERT INTO feedback_prompts (session_id, user_id, cafe_id, token, status, due_at, attempts, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, 0, NOW())
+			ON CONFLICT (session_id, user_id) DO NOTHING`,
+			sessionID, guest.UserID, guest.CafeID, token, structures.PromptScheduled, dueAt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// completeFeedbackPrompt records that the guest gave feedback for the session
+func completeFeedbackPrompt(tx *gorm.DB, sessionID string, userID uint) error {
+	return tx.Model(&structures.FeedbackPrompt{}).
+		Where("session_id = ? AND user_id = ? AND completed_at IS NULL", sessionID, userID).
+		UpdateColumn("completed_at", time.Now()).Error
+}
+
+// feedbackPromptLink is the page a prompt opens
+func (s *Server) feedbackPromptLink(token string) string {
+	return s.Config.FEEDBACK_LINK_URL + "?prompt=" + url.QueryEscape(token)
+}
+
+// guestPushChannel is the push service that issued the token of the guest.
+// Tokens saved before the provider was stored are told apart by their format.
+func guestPushChannel(user structures.User) notification.Channel {
+	switch notification.Channel(user.PushTokenProvider) {
+	case notification.ChannelExpo, notification.ChannelFCM:
+		return notification.Channel(user.PushTokenProvider)
+	}
+	if isExpoToken(user.PushToken) {
+		return notification.ChannelExpo
+	}
+	return notification.ChannelFCM
+}
+
+// sendFeedbackPrompt delivers one prompt and returns the channel used, or ""
+// when the guest cannot be reached.
+func (s *Server) sendFeedbackPrompt(prompt structures.FeedbackPrompt, user structures.User, cafeName string) (string, error) {
+	data := map[string]string{
+		"CafeName": cafeName,
+		"Link":     s.feedbackPromptLink(prompt.Token),
+	}
+
+	channel, recipient := guestPushChannel(user), user.PushToken
+	if recipient == "" {
+		if user.Phone == "" {
+			return "", nil
+		}
+		channel, recipient = notification.ChannelSMS, user.Phone
+		if s.Config.API_BASE_URL != "" {
+			data["unsubscribe_url"] = s.Config.API_BASE_URL + "/feedbackPromptOptOut?token=" + url.QueryEscape(prompt.Token)
+		}
+	}
+
+	result := s.notifyGuest(prompt.CafeID, notification.EventFeedbackPrompt, channel, recipient, data)
+	return string(channel), result.Err
+}
+
+// RunFeedbackPromptJob schedules prompts for guests who paid and sends the
+// prompts that are due, outside the quiet hours of the cafe.
+func (s *Server) RunFeedbackPromptJob(c *fiber.Ctx) error {
+	settings := s.feedbackPromptSettings()
+
+	// Sessions ended from the app schedule their prompts right away, paid
+	// orders are picked up here.
+	var paidSessionIDs []string
+	if err := s.Db.Raw(`
+		SELECT DISTINCT o.session_id
+		FROM orders o
+		WHERE o.payment_status = ? AND o.order_status <> ? AND o.order_time > NOW() - INTERVAL '1 day'
+		AND NOT EXISTS (
+			SELECT 1 FROM feedback_prompts p
+			WHERE p.session_id = o.session_id AND p.user_id = o.user_id
+		)`, structures.Completed, structures.OrderCancelled).Pluck("session_id", &paidSessionIDs).Error; err != nil {
+		log.Println("❌ Failed to fetch paid sessions:", err)
+		return err
+	}
+	for _, sessionID := range paidSessionIDs {
+		if err := s.scheduleFeedbackPrompts(sessionID); err != nil {
+			log.Printf("❌ Failed to schedule feedback prompts for session %s: %v\n", sessionID, err)
+		}
+	}
+
+	var prompts []structures.FeedbackPrompt
+	if err := s.Db.Where("status = ? AND due_at <= ?", structures.PromptScheduled, time.Now()).
+		Order("due_at ASC").Limit(maxPromptsPerRun).Find(&prompts).Error; err != nil {
+		log.Println("❌ Failed to fetch feedback prompts:", err)
+		return err
+	}
+
+	sent, skipped, failed := 0, 0, 0
+	for _, prompt := range prompts {
+		var user structures.User
+		if err := s.Db.Where("id = ?", prompt.UserID).First(&user).Error; err != nil {
+			log.Printf("❌ Failed to fetch user %d: %v\n", prompt.UserID, err)
+			continue
+		}
+		clock, cafe, err := s.cafeClock(prompt.CafeID)
+		if err != nil {
+			log.Printf("❌ Failed to fetch cafe %d: %v\n", prompt.CafeID, err)
+			continue
+		}
+
+		if user.FeedbackPromptsOptOut || prompt.CompletedAt != nil {
+			s.Db.Model(&prompt).UpdateColumn("status", structures.PromptSkipped)
+			skipped++
+			continue
+		}
+		if until := settings.quietUntil(clock.Now()); !until.IsZero() {
+			s.Db.Model(&prompt).UpdateColumn("due_at", until)
+			continue
+		}
+
+		channel, err := s.sendFeedbackPrompt(prompt, user, cafe.Name)
+		now := time.Now()
+		switch {
+		case err != nil:
+			log.Printf("❌ Failed to send feedback prompt %d: %v\n", prompt.ID, err)
+			updates := map[string]interface{}{
+				"attempts":   prompt.Attempts + 1,
+				"last_error": err.Error(),
+				"channel":    channel,
+				"due_at":     now.Add(promptRetryDelay * time.Duration(prompt.Attempts+1)),
+			}
+			if prompt.Attempts+1 >= maxPromptAttempts {
+				updates["status"] = structures.PromptFailed
+			}
+			s.Db.Model(&prompt).UpdateColumns(updates)
+			failed++
+		case channel == "":
+			s.Db.Model(&prompt).UpdateColumns(map[string]interface{}{
+				"status":     structures.PromptSkipped,
+				"last_error": "No push token or phone number",
+			})
+			skipped++
+		default:
+			s.Db.Model(&prompt).UpdateColumns(map[string]interface{}{
+				"status":   structures.PromptSent,
+				"channel":  channel,
+				"attempts": prompt.Attempts + 1,
+				"sent_at":  now,
+			})
+			sent++
+		}
+	}
+
+	log.Printf("Feedback prompts sent %d, skipped %d, failed %d\n", sent, skipped, failed)
+	if c == nil {
+		return nil
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Feedback prompts processed",
+		"sent":    sent,
+		"skipped": skipped,
+		"failed":  failed,
+	})
+}
+
+// OpenFeedbackPrompt is called by the page a prompt links to. It records that
+// the prompt was opened and tells the app which visit to ask about.
+func (s *Server) OpenFeedbackPrompt(c *fiber.Ctx) error {
+	var prompt structures.FeedbackPrompt
+	if err := s.Db.Where("token = ?", c.Query("token")).First(&prompt).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Feedback link not found",
+		})
+	}
+
+	if prompt.OpenedAt == nil {
+		if err := s.Db.Model(&prompt).UpdateColumn("opened_at", time.Now()).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to open feedback link",
+			})
+		}
+	}
+
+	var cafe structures.Cafe
+	if err := s.Db.Select("id, name").Where("id = ?", prompt.CafeID).First(&cafe).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve cafe details",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"session_id": prompt.SessionID,
+		"cafe_id":    prompt.CafeID,
+		"cafe_name":  cafe.Name,
+		"completed":  prompt.CompletedAt != nil,
+	})
+}
+
+// feedbackOptOutPage asks the guest to confirm before opting out, so link
+// previews and scanners that open the link do not opt them out
+var feedbackOptOutPage = template.Must(template.New("optOut").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Feedback requests</title>
+</head>
+<body>
+{{if .Error}}<p>{{.Error}}</p>
+{{else if .Done}}<p>You will not be asked for feedback again.</p>
+{{else}}<p>Stop asking for feedback after your visits to {{.CafeName}} and other cafes?</p>
+<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Stop feedback requests</button>
+</form>
+{{end}}</body>
+</html>
+`))
+
+type feedbackOptOutView struct {
+	Token    string
+	CafeName string
+	Done     bool
+	Error    string
+}
+
+func renderFeedbackOptOut(c *fiber.Ctx, status int, view feedbackOptOutView) error {
+	var page strings.Builder
+	if err := feedbackOptOutPage.Execute(&page, view); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to render page")
+	}
+	c.Type("html", "utf-8")
+	return c.Status(status).SendString(page.String())
+}
+
+// FeedbackPromptOptOutPage is the page the opt-out link in a message opens.
+// It only asks for confirmation, OptOutOfFeedbackPrompts opts out.
+func (s *Server) FeedbackPromptOptOutPage(c *fiber.Ctx) error {
+	var prompt structures.FeedbackPrompt
+	if err := s.Db.Where("token = ?", c.Query("token")).First(&prompt).Error; err != nil {
+		return renderFeedbackOptOut(c, fiber.StatusNotFound, feedbackOptOutView{Error: "This link is not valid."})
+	}
+
+	var cafe structures.Cafe
+	if err := s.Db.Select("id, name").Where("id = ?", prompt.CafeID).First(&cafe).Error; err != nil {
+		return renderFeedbackOptOut(c, fiber.StatusInternalServerError, feedbackOptOutView{Error: "Something went wrong, please try again."})
+	}
+
+	return renderFeedbackOptOut(c, fiber.StatusOK, feedbackOptOutView{Token: prompt.Token, CafeName: cafe.Name})
+}
+
+// OptOutOfFeedbackPrompts stops prompts for the guest a prompt was sent to.
+// It is posted by the confirmation page, without signing in.
+func (s *Server) OptOutOfFeedbackPrompts(c *fiber.Ctx) error {
+	token := c.FormValue("token")
+	if token == "" {
+		token = c.Query("token")
+	}
+
+	var prompt structures.FeedbackPrompt
+	if err := s.Db.Where("token = ?", token).First(&prompt).Error; err != nil {
+		return renderFeedbackOptOut(c, fiber.StatusNotFound, feedbackOptOutView{Error: "This link is not valid."})
+	}
+
+	if err := s.Db.Model(&structures.User{}).Where("id = ?", prompt.UserID).
+		UpdateColumn("feedback_prompts_opt_out", true).Error; err != nil {
+		return renderFeedbackOptOut(c, fiber.StatusInternalServerError, feedbackOptOutView{Error: "Failed to update your preferences, please try again."})
+	}
+
+	return renderFeedbackOptOut(c, fiber.StatusOK, feedbackOptOutView{Done: true})
+}
+
+// SetNotificationPreferences registers the push token of the guest app and
+// turns feedback prompts on or off. Fields left out are not changed.
+func (s *Server) SetNotificationPreferences(c *fiber.Ctx) error {
+	userId := uint(c.Locals("userId").(float64))
+
+	var req structures.NotificationPreferencesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	updates := map[string]interface{}{}
+	if req.PushToken != nil {
+		updates["push_token"], updates["push_token_provider"] = "", ""
+		if strings.TrimSpace(*req.PushToken) != "" {
+			token := structures.DeviceTokenRequest{Token: *req.PushToken, Provider: req.PushTokenProvider}
+			if err := validateDeviceToken(&token); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "push_token: " + err.Error(),
+				})
+			}
+			updates["push_token"], updates["push_token_provider"] = token.Token, token.Provider
+		}
+	}
+	if req.FeedbackPrompts != nil {
+		updates["feedback_prompts_opt_out"] = !*req.FeedbackPrompts
+	}
+	if len(updates) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Nothing to update",
+		})
+	}
+
+	if err := s.Db.Model(&structures.User{}).Where("id = ?", userId).UpdateColumns(updates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update preferences",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Preferences updated successfully",
+	})
+}
+
+// GetFeedbackPromptStats shows the owner how prompts of the last 30 days did
+func (s *Server) GetFeedbackPromptStats(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var stats struct {
+		Scheduled int `json:"scheduled"`
+		Sent      int `json:"sent"`
+		Skipped   int `json:"skipped"`
+		Failed    int `json:"failed"`
+		Opened    int `json:"opened"`
+		Completed int `json:"completed"`
+	}
+	if err := s.Db.Raw(`
+		SELECT COUNT(*) FILTER (WHERE status = ?) AS scheduled,
+			COUNT(*) FILTER (WHERE status = ?) AS sent,
+			COUNT(*) FILTER (WHERE status = ?) AS skipped,
+			COUNT(*) FILTER (WHERE status = ?) AS failed,
+			COUNT(*) FILTER (WHERE status = ? AND opened_at IS NOT NULL) AS opened,
+			COUNT(*) FILTER (WHERE status = ? AND completed_at IS NOT NULL) AS completed
+		FROM feedback_prompts
+		WHERE cafe_id = ? AND created_at > NOW() - INTERVAL '30 days'`,
+		structures.PromptScheduled, structures.PromptSent, structures.PromptSkipped, structures.PromptFailed,
+		structures.PromptSent, structures.PromptSent, cafeId).Scan(&stats).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch prompt stats",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": stats,
+	})
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/notification"
+	"coffeeMustacheBackend/pkg/structures"
+	"testing"
+	"time"
+)
+
+func TestFeedbackPromptQuietUntil(t *testing.T) {
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	local := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, ist)
+	}
+	overnight := feedbackPromptSettings{QuietStart: 22 * time.Hour, QuietEnd: 9 * time.Hour}
+	daytime := feedbackPromptSettings{QuietStart: 13 * time.Hour, QuietEnd: 15 * time.Hour}
+
+	tests := []struct {
+		name     string
+		settings feedbackPromptSettings
+		now      time.Time
+		want     time.Time
+	}{
+		{"evening before quiet", overnight, local(19, 21, 59), time.Time{}},
+		{"start of quiet", overnight, local(19, 22, 0), local(20, 9, 0)},
+		{"before midnight", overnight, local(19, 23, 30), local(20, 9, 0)},
+		{"after midnight", overnight, local(20, 0, 15), local(20, 9, 0)},
+		{"end of quiet", overnight, local(20, 9, 0), time.Time{}},
+		{"end of month", overnight, local(31, 23, 0), time.Date(2026, 11, 1, 9, 0, 0, 0, ist)},
+		{"daytime quiet", daytime, local(19, 14, 0), local(19, 15, 0)},
+		{"outside daytime quiet", daytime, local(19, 23, 0), time.Time{}},
+		{"no quiet hours", feedbackPromptSettings{QuietStart: 9 * time.Hour, QuietEnd: 9 * time.Hour}, local(19, 9, 30), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.settings.quietUntil(tt.now); !got.Equal(tt.want) {
+				t.Errorf("quietUntil(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuestPushChannel(t *testing.T) {
+	tests := []struct {
+		name string
+		user structures.User
+		want notification.Channel
+	}{
+		{"stored fcm", structures.User{PushToken: "abc:def", PushTokenProvider: "fcm"}, notification.ChannelFCM},
+		{"stored expo", structures.User{PushToken: "ExponentPushToken[x]", PushTokenProvider: "expo"}, notification.ChannelExpo},
+		{"expo token without provider", structures.User{PushToken: "ExpoPushToken[x]"}, notification.ChannelExpo},
+		{"fcm token without provider", structures.User{PushToken: "abc:def"}, notification.ChannelFCM},
+		{"unknown provider", structures.User{PushToken: "ExponentPushToken[x]", PushTokenProvider: "apns"}, notification.ChannelExpo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := guestPushChannel(tt.user); got != tt.want {
+				t.Errorf("guestPushChannel = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
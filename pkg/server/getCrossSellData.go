@@ -74,7 +74,7 @@ func (s *Server) GetCrossSellData(c *fiber.Ctx) error {
 				mi.name AS item_name
 			FROM cross_sells cs
 			JOIN menu_items mi ON cs.cross_sell_item_id = mi.id
-			WHERE cs.base_item_id = ?
+			WHERE cs.base_item_id = ? AND cs.archived_at IS NULL AND mi.archived_at IS NULL
 			ORDER BY cs.priority DESC
 		`, req.BaseItemID).Scan(&crossSellItems).Error; err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
@@ -126,7 +126,7 @@ func (s *Server) GetCrossSellData(c *fiber.Ctx) error {
 				mi.name AS item_name
 			FROM cross_sells cs
 			JOIN menu_items mi ON cs.cross_sell_item_id = mi.id
-			WHERE cs.base_item_id = ?
+			WHERE cs.base_item_id = ? AND cs.archived_at IS NULL AND mi.archived_at IS NULL
 			ORDER BY cs.priority DESC
 		`, req.BaseItemID).Scan(&crossSellItems).Error
 		if err != nil {
@@ -2,7 +2,7 @@ package server
 
 import (
 	"coffeeMustacheBackend/pkg/structures"
-	"time"
+	"fmt"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -20,27 +20,18 @@ func (s *Server) GetCuratedCart(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get the current date and time in IST
-	location, err := time.LoadLocation("Asia/Kolkata")
+	// Get the current date and time in the cafe's timezone
+	clock, cafe, err := s.cafeClock(req.CafeID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to load location",
 		})
 	}
-	currentTime := time.Now().In(location)
+	currentTime := clock.Now()
 	currentDate := currentTime.Format("2006-01-02")
-	currentHour := currentTime.Hour()
-
-	// Determine time of day
-	var timeOfDay structures.TimeOfDay
-	switch {
-	case currentHour < 12:
-		timeOfDay = structures.Morning
-	case currentHour >= 12 && currentHour < 17:
-		timeOfDay = structures.Afternoon
-	default:
-		timeOfDay = structures.Night
-	}
+
+	// Determine time of day using the cafe's boundaries
+	timeOfDay := curatedTimeOfDay(cafe, currentTime)
 
 	// Fetch curated carts for the given cafe, current date, and time of day
 	var curatedCarts []structures.CuratedCart
@@ -51,11 +42,12 @@ func (s *Server) GetCuratedCart(c *fiber.Ctx) error {
 	}
 
 	type CuratedCartItemDetailResponse struct {
-		ItemID         uint    `json:"item_id"`
-		Name           string  `json:"name"`
-		Price          float64 `json:"price"`
-		ImageURL       string  `json:"image_url"`
-		IsCustomizable bool    `json:"is_customizable"`
+		ItemID           uint     `json:"item_id"`
+		Name             string   `json:"name"`
+		Price            float64  `json:"price"`
+		ImageURL         string   `json:"image_url"`
+		IsCustomizable   bool     `json:"is_customizable"`
+		DietaryConflicts []string `json:"dietary_conflicts,omitempty"`
 	}
 
 	// Prepare a response with carts and their items, including item name and price
@@ -66,12 +58,23 @@ func (s *Server) GetCuratedCart(c *fiber.Ctx) error {
 		TimeOfDay       string                          `json:"time_of_day"`
 		Date            string                          `json:"date"`
 		Source          string                          `json:"source"`
+		ImageURL        string                          `json:"image_url"`
 		CartTotal       float64                         `json:"cart_total"`
 		DiscountedTotal float64                         `json:"discounted_total"`
 		DiscountPercent float64                         `json:"discount_percent"`
 		Items           []CuratedCartItemDetailResponse `json:"items"`
 	}
 
+	profile := s.requestDietaryProfile(c)
+	language := s.requestLanguage(c, cafe)
+	dietaryConflicts, err := s.cafeDietaryConflicts(req.CafeID, profile)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check dietary conflicts",
+		})
+	}
+
+	imageSize, webp := imagePreference(c)
 	var response []CuratedCartResponse
 	for _, cart := range curatedCarts {
 		// Fetch items for each curated cart with item name and price
@@ -82,21 +85,42 @@ func (s *Server) GetCuratedCart(c *fiber.Ctx) error {
 			})
 		}
 
+		itemIDs := make([]uint, 0, len(curatedItems))
+		for _, item := range curatedItems {
+			itemIDs = append(itemIDs, item.ItemID)
+		}
+		translations, err := s.itemTranslations(language, itemIDs)
+		if err != nil {
+			fmt.Println("Failed to load translations:", err)
+		}
+
 		var itemDetails []CuratedCartItemDetailResponse
+		hasConflicts := false
 		for _, item := range curatedItems {
 			// Fetch item name and price from the MenuItem table
 			var menuItem structures.MenuItem
 			if err := s.Db.Select("id, name, price, image_url, is_customizable").Where("id = ?", item.ItemID).First(&menuItem).Error; err == nil {
+				if translation, ok := translations[menuItem.ID]; ok {
+					applyTranslation(&menuItem, translation)
+				}
+				conflicts := dietaryConflicts[menuItem.ID]
+				hasConflicts = hasConflicts || len(conflicts) > 0
 				itemDetails = append(itemDetails, CuratedCartItemDetailResponse{
-					ItemID:         menuItem.ID,
-					Name:           menuItem.Name,
-					Price:          menuItem.Price,
-					ImageURL:       menuItem.ImageURL,
-					IsCustomizable: menuItem.IsCustomizable,
+					ItemID:           menuItem.ID,
+					Name:             menuItem.Name,
+					Price:            menuItem.Price,
+					ImageURL:         preferredImageURL(menuItem.ImageURL, imageSize, webp),
+					IsCustomizable:   menuItem.IsCustomizable,
+					DietaryConflicts: conflicts,
 				})
 			}
 		}
 
+		// Skip carts the user cannot eat when they chose to hide conflicts
+		if hasConflicts && profile.HideConflicts {
+			continue
+		}
+
 		// Add cart and items to response
 		response = append(response, CuratedCartResponse{
 			ID:              cart.ID,
@@ -105,6 +129,7 @@ func (s *Server) GetCuratedCart(c *fiber.Ctx) error {
 			TimeOfDay:       string(cart.TimeOfDay),
 			Date:            cart.Date.Format("2006-01-02"),
 			Source:          cart.Source,
+			ImageURL:        preferredImageURL(cart.ImageURL, imageSize, webp),
 			CartTotal:       cart.CartTotal,
 			DiscountedTotal: cart.DiscountedTotal,
 			DiscountPercent: cart.DiscountPercent,
@@ -116,5 +141,6 @@ func (s *Server) GetCuratedCart(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message":       "Curated carts fetched successfully",
 		"curated_carts": response,
+		"currency":      clock.Currency,
 	})
 }
@@ -2,17 +2,21 @@ package server
 
 import (
 	"coffeeMustacheBackend/pkg/structures"
-	"encoding/json"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/jinzhu/gorm" // For jsonb handling in Go
 )
 
 type TopPicksRequest struct {
-	Tag    string `json:"tag"`
-	CafeID uint   `json:"cafe_id"`
+	Tag              string   `json:"tag"`
+	Tags             []string `json:"tags"`              // Every tag must be present
+	Dietary          []string `json:"dietary"`           // Every dietary label must be met
+	ExcludeAllergens []string `json:"exclude_allergens"` // Items with any of these are left out
+	CafeID           uint     `json:"cafe_id"`
 }
 
+// GetFilteredList is the fixed chip list of the home screen. BrowseMenu
+// supersedes it with combinable filters, facets and pagination.
 func (s *Server) GetFilteredList(c *fiber.Ctx) error {
 	var req TopPicksRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -21,74 +25,49 @@ func (s *Server) GetFilteredList(c *fiber.Ctx) error {
 		})
 	}
 
-	// Tags : “price 200-400”, “bestrated”, “trending”, “bestsellers”, "toppicks" check if the tag is valid
-	validTags := map[string]bool{
-		"price 200-400": true,
-		"bestrated":     true,
-		"trending":      true,
-		"bestseller":    true,
-		"toppicks":      true,
+	// Tags are menu data now, any tag is accepted. "price 200-400" is kept for
+	// older clients, BrowseMenu takes a real price range.
+	if req.Tag == "" && len(req.Tags) == 0 && len(req.Dietary) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "A tag or dietary label is required",
+		})
 	}
-
-	if !validTags[req.Tag] {
+	if len(req.Tags)+len(req.Dietary)+len(req.ExcludeAllergens) > 20 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid tag",
+			"error": "At most 20 labels can be used in one filter",
 		})
 	}
 
-	var items []structures.MenuItem
+	schedule, open, err := s.checkCafeOpen(c, req.CafeID)
+	if !open {
+		return err
+	}
+	now := time.Now()
+	profile := s.requestDietaryProfile(c)
 
-	// if the tag is price 200-400, run a sql query on menu items table to get all items with price between 200 and 400 and return the response directly.
+	// Labels are matched in SQL through the menu item label links
+	query := s.Db.Where("cafe_id = ?", req.CafeID)
+	tags := req.Tags
 	if req.Tag == "price 200-400" {
-		if err := s.Db.Where("price BETWEEN 200 AND 400 AND cafe_id = ?", req.CafeID).Find(&items).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-					"error": "No items found",
-				})
-			}
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Database error",
-			})
-		}
-		return c.JSON(fiber.Map{
-			"items": items,
-		})
+		query = query.Where("price BETWEEN 200 AND 400")
+	} else if req.Tag != "" {
+		tags = append(tags, req.Tag)
 	}
+	query = withLabels(query, structures.LabelTag, tags)
+	query = withLabels(query, structures.LabelDietary, req.Dietary)
+	query = withoutLabels(query, structures.LabelAllergen, req.ExcludeAllergens)
 
-	// Fetch all items for the given cafe and their tags
-	if err := s.Db.Where("cafe_id = ?", req.CafeID).Find(&items).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error": "No items found",
-			})
-		}
+	var items []structures.MenuItem
+	if err := query.Find(&items).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Database error",
 		})
 	}
 
-	var filteredItems []structures.MenuItem
-	// Loop over the fetched items and check if the tag exists in the 'tags' field
-	for _, item := range items {
-		var tags []string
-		// Parse the jsonb tags column into a Go slice of strings
-		if err := json.Unmarshal(item.Tag, &tags); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Error processing tags data",
-			})
-		}
-
-		// Check if the requested tag exists in the tags slice
-		for _, tag := range tags {
-			if tag == req.Tag {
-				// If the tag matches, add it to the filtered list
-				filteredItems = append(filteredItems, item)
-				break
-			}
-		}
-	}
+	filteredItems, conflicts := s.applyDietaryProfile(profile, filterAvailableItems(schedule, items, now))
 
-	if len(filteredItems) == 0 {
+	// The price list is returned even when it is empty
+	if len(filteredItems) == 0 && req.Tag != "price 200-400" {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "No items found for the given tag",
 		})
@@ -96,6 +75,7 @@ func (s *Server) GetFilteredList(c *fiber.Ctx) error {
 
 	// Return the filtered items as JSON response
 	return c.JSON(fiber.Map{
-		"items": filteredItems,
+		"items":             filteredItems,
+		"dietary_conflicts": conflicts,
 	})
 }
@@ -7,12 +7,15 @@ import (
 )
 
 // GetItemAudio handles the request to get the audio URL for a specific menu item.
-// It expects a JSON body with cafe_id, item_id, and language.
+// It expects a JSON body with cafe_id, item_id, and language. Without a
+// language the Accept-Language header is used, and items without audio in
+// that language fall back to the audio of the cafe's menu language.
 func (s *Server) GetItemAudio(c *fiber.Ctx) error {
 	// Parse request body
 	var request struct {
-		CafeID uint `json:"cafe_id"`
-		ItemID uint `json:"item_id"`
+		CafeID   uint   `json:"cafe_id"`
+		ItemID   uint   `json:"item_id"`
+		Language string `json:"language"`
 	}
 
 	if err := c.BodyParser(&request); err != nil {
@@ -29,8 +32,34 @@ func (s *Server) GetItemAudio(c *fiber.Ctx) error {
 		})
 	}
 
+	cafe, err := s.menuCafe(request.CafeID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch cafe details",
+		})
+	}
+
+	preferred := request.Language
+	if preferred == "" {
+		preferred = c.Get(fiber.HeaderAcceptLanguage)
+	}
+	language := s.resolveLanguage(preferred, cafe)
+
+	// Use the translated audio when the item has one
+	audioURL, audioLanguage := menuItem.AudioURL, cafeMenuLanguage(cafe)
+	translations, err := s.itemTranslations(language, []uint{menuItem.ID})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch translations",
+		})
+	}
+	if translation, ok := translations[menuItem.ID]; ok && translation.AudioURL != "" {
+		audioURL, audioLanguage = translation.AudioURL, language
+	}
+
 	// Return the audio URL.
 	return c.JSON(fiber.Map{
-		"audio_url": menuItem.AudioURL,
+		"audio_url": audioURL,
+		"language":  audioLanguage,
 	})
 }
@@ -1,7 +1,11 @@
 package server
 
 import (
+	"coffeeMustacheBackend/pkg/structures"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -99,6 +103,24 @@ func (s *Server) GetMenu(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cafe_id is required"})
 	}
 
+	cafeID, err := strconv.ParseUint(req.CafeID, 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cafe_id"})
+	}
+
+	// closed cafes have no menu to show
+	schedule, open, err := s.checkCafeOpen(c, uint(cafeID))
+	if !open {
+		return err
+	}
+
+	// hide or flag items that conflict with the user's dietary profile
+	profile := s.requestDietaryProfile(c)
+	conflicts, err := s.cafeDietaryConflicts(uint(cafeID), profile)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to fetch menu"})
+	}
+
 	// map foodType shortcut
 	foodTypeFilter := ""
 	switch req.FoodType {
@@ -108,58 +130,75 @@ func (s *Server) GetMenu(c *fiber.Ctx) error {
 		foodTypeFilter = "non-veg"
 	}
 
-	// build SQL
-	sql := `
-	SELECT
-	c.name AS category,
-	COALESCE(
-		json_agg(
-		json_build_object(
-			'id'               , m.id,
-			'cafe_id'          , m.cafe_id,
-			'category_id'      , m.category_id,
-			'name'             , m.name,
-			'description'      , m.description,
-			'short_description', m.short_description,
-			'price'            , m.price,
-			'is_customizable'  , m.is_customizable,
-			'image_url'        , m.image_url,
-			'video_url'        , m.video_url,
-			'rating'           , m.rating,
-			'total_ratings'    , m.total_ratings
-		) ORDER BY m.name
-		) FILTER (WHERE m.id IS NOT NULL),
-		'[]'
-	) AS items
-	FROM categories c
-	LEFT JOIN menu_items m
-	ON m.category_id = c.id
-	AND m.cafe_id     = c.cafe_id
-	AND m.is_available = true
-	`
-
-	// optional food_type
-	args := []interface{}{}
-	if foodTypeFilter != "" {
-		sql += " AND m.food_type = ?\n"
-		args = append(args, foodTypeFilter)
+	cafe, err := s.menuCafe(uint(cafeID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to fetch menu"})
 	}
 
-	sql += `
-	WHERE c.cafe_id = ?
-	GROUP BY c.name, c.counter
-	ORDER BY c.counter ASC;
-	`
-	args = append(args, req.CafeID)
-
-	// execute
-	var out []struct {
-		Category string          `json:"category"`
-		Items    json.RawMessage `json:"items"`
+	menu, err := s.cachedMenu(cafe, foodTypeFilter, s.requestLanguage(c, cafe))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to fetch menu"})
 	}
-	if err := s.Db.Raw(sql, args...).Scan(&out).Error; err != nil {
+
+	// most popular categories for this time of day first, behind pinned ones
+	ranking, err := s.categoryRanking(cafe)
+	if err != nil {
+		fmt.Println("Failed to rank categories:", err)
+	} else {
+		menu = rankMenuCategories(menu, ranking)
+	}
+
+	type menuResponseItem struct {
+		menuItemView
+		DietaryConflicts []string `json:"dietary_conflicts,omitempty"`
+	}
+	type menuResponseCategory struct {
+		Category string             `json:"category"`
+		Items    []menuResponseItem `json:"items"`
+	}
+
+	// hide items outside their availability window
+	now := time.Now()
+	imageSize, webp := imagePreference(c)
+	out := make([]menuResponseCategory, 0, len(menu))
+	for _, category := range menu {
+		items := make([]menuResponseItem, 0, len(category.Items))
+		for _, item := range category.Items {
+			availability := itemAvailability(schedule, structures.MenuItem{
+				ID:              item.ID,
+				IsAvailable:     true,
+				AvailableFrom:   item.AvailableFrom,
+				AvailableTill:   item.AvailableTill,
+				AvailableAllDay: item.AvailableAllDay,
+			}, now)
+			if !availability.Available {
+				continue
+			}
+
+			itemConflicts := conflicts[item.ID]
+			if len(itemConflicts) > 0 && profile.HideConflicts {
+				continue
+			}
+			view := item.menuItemView
+			view.ImageURL = preferredImageURL(view.ImageURL, imageSize, webp)
+			items = append(items, menuResponseItem{menuItemView: view, DietaryConflicts: itemConflicts})
+		}
+		out = append(out, menuResponseCategory{Category: category.Category, Items: items})
+	}
+
+	body, err := json.Marshal(out)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to fetch menu"})
 	}
 
-	return c.JSON(out)
+	// the response depends on the time and the user, clients revalidate every time
+	etag := menuETag(body)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	if etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(body)
 }
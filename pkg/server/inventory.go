@@ -0,0 +1,698 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/notification"
+	"coffeeMustacheBackend/pkg/structures"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+// stockAlert is a low or out of stock notice for the cafe staff
+type stockAlert struct {
+	Name       string
+	Remaining  float64
+	Unit       string
+	OutOfStock bool
+}
+
+type cartItemQuantity struct {
+	ItemID   uint
+	Quantity int
+}
+
+// consumeStock takes the stock needed for a cart out of the item and
+// ingredient counts inside tx. Items that cannot be served are returned as
+// shortages, in which case the caller must roll back.
+func consumeStock(tx *gorm.DB, cafeID uint, cartID, orderID string) ([]structures.UnavailableItem, []stockAlert, error) {
+	var quantities []cartItemQuantity
+	if err := tx.Table("cart_items").
+		Select("item_id, SUM(quantity) AS quantity").
+		Where("cart_id = ? AND (status IS NULL OR status <> ?)", cartID, structures.CartItemCanceled).
+		Group("item_id").
+		Scan(&quantities).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(quantities) == 0 {
+		return nil, nil, nil
+	}
+
+	var shortages []structures.UnavailableItem
+	var alerts []stockAlert
+	itemNames := make(map[uint]string)
+	ordered := make(map[uint]int)
+	var itemIDs []uint
+
+	// Item level stock
+	for _, quantity := range quantities {
+		var item structures.MenuItem
+		if err := tx.Where("id = ?", quantity.ItemID).First(&item).Error; err != nil {
+			return nil, nil, err
+		}
+		itemNames[item.ID] = item.Name
+		ordered[item.ID] = quantity.Quantity
+		itemIDs = append(itemIDs, item.ID)
+
+		if item.StockQuantity == nil {
+			continue
+		}
+
+		var remaining int
+		err := tx.Raw(`UPDATE menu_items SET stock_quantity = stock_quantity - ? WHERE id = ? AND stock_quantity >= ? RETURNING stock_quantity`,
+			quantity.Quantity, item.ID, quantity.Quantity).Row().Scan(&remaining)
+		if err == sql.ErrNoRows {
+			shortages = append(shortages, structures.UnavailableItem{
+				ItemID: item.ID,
+				Name:   item.Name,
+				Reason: fmt.Sprintf("Only %d left in stock", *item.StockQuantity),
+			})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		itemID := item.ID
+		if err := tx.Create(&structures.InventoryTransaction{
+			CafeID:     cafeID,
+			MenuItemID: &itemID,
+			Change:     -float64(quantity.Quantity),
+			Balance:    float64(remaining),
+			Reason:     structures.InventoryOrder,
+			OrderID:    orderID,
+		}).Error; err != nil {
+			return nil, nil, err
+		}
+
+		if remaining <= 0 {
+			if err := tx.Model(&structures.MenuItem{}).Where("id = ?", item.ID).
+				Updates(map[string]interface{}{"is_available": false, "out_of_stock": true}).Error; err != nil {
+				return nil, nil, err
+			}
+			if err := invalidateMenuCache(tx, cafeID); err != nil {
+				return nil, nil, err
+			}
+		}
+		if remaining <= 0 || (remaining <= item.LowStockThreshold && remaining+quantity.Quantity > item.LowStockThreshold) {
+			alerts = append(alerts, stockAlert{Name: item.Name, Remaining: float64(remaining), OutOfStock: remaining <= 0})
+		}
+	}
+
+	// Ingredient stock from the recipes of the ordered items
+	var recipes []structures.RecipeItem
+	if err := tx.Where("menu_item_id IN (?)", itemIDs).Find(&recipes).Error; err != nil {
+		return nil, nil, err
+	}
+
+	needed := make(map[uint]float64)
+	usedBy := make(map[uint][]uint)
+	for _, recipe := range recipes {
+		needed[recipe.IngredientID] += recipe.Quantity * float64(ordered[recipe.MenuItemID])
+		usedBy[recipe.IngredientID] = append(usedBy[recipe.IngredientID], recipe.MenuItemID)
+	}
+
+	// Update ingredients in id order so concurrent orders lock rows consistently
+	ingredientIDs := make([]uint, 0, len(needed))
+	for id := range needed {
+		ingredientIDs = append(ingredientIDs, id)
+	}
+	sort.Slice(ingredientIDs, func(i, j int) bool { return ingredientIDs[i] < ingredientIDs[j] })
+
+	short := make(map[uint]bool)
+	for _, item := range shortages {
+		short[item.ItemID] = true
+	}
+
+	for _, ingredientID := range ingredientIDs {
+		var ingredient structures.Ingredient
+		if err := tx.Where("id = ?", ingredientID).First(&ingredient).Error; err != nil {
+			return nil, nil, err
+		}
+
+		var remaining float64
+		err := tx.Raw(`UPDATE ingredients SET stock_quantity = stock_quantity - ? WHERE id = ? AND stock_quantity >= ? RETURNING stock_quantity`,
+			needed[ingredientID], ingredientID, needed[ingredientID]).Row().Scan(&remaining)
+		if err == sql.ErrNoRows {
+			for _, itemID := range usedBy[ingredientID] {
+				if short[itemID] {
+					continue
+				}
+				short[itemID] = true
+				shortages = append(shortages, structures.UnavailableItem{
+					ItemID: itemID,
+					Name:   itemNames[itemID],
+					Reason: fmt.Sprintf("Not enough %s in stock", ingredient.Name),
+				})
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		id := ingredientID
+		if err := tx.Create(&structures.InventoryTransaction{
+			CafeID:       cafeID,
+			IngredientID: &id,
+			Change:       -needed[ingredientID],
+			Balance:      remaining,
+			Reason:       structures.InventoryOrder,
+			OrderID:      orderID,
+		}).Error; err != nil {
+			return nil, nil, err
+		}
+
+		// 86 every item that can no longer be made from what is left
+		result := tx.Exec(`
+			UPDATE menu_items SET is_available = false, out_of_stock = true
+			WHERE is_available = true
+			AND id IN (SELECT menu_item_id FROM recipe_items WHERE ingredient_id = ? AND quantity > ?)
+		`, ingredientID, remaining)
+		if result.Error != nil {
+			return nil, nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			if err := invalidateMenuCache(tx, cafeID); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if remaining <= 0 || (remaining <= ingredient.LowStockThreshold && remaining+needed[ingredientID] > ingredient.LowStockThreshold) {
+			alerts = append(alerts, stockAlert{Name: ingredient.Name, Remaining: remaining, Unit: ingredient.Unit, OutOfStock: remaining <= 0})
+		}
+	}
+
+	return shortages, alerts, nil
+}
+
+// restoreInStockItems makes items that inventory marked unavailable orderable
+// again once their own stock and every ingredient of their recipe allow it.
+func restoreInStockItems(tx *gorm.DB, cafeID uint) error {
+	result := tx.Exec(`
+		UPDATE menu_items m SET is_available = true, out_of_stock = false
+		WHERE m.cafe_id = ? AND m.out_of_stock = true
+		AND (m.stock_quantity IS NULL OR m.stock_quantity > 0)
+		AND NOT EXISTS (
+			SELECT 1 FROM recipe_items r
+			JOIN ingredients i ON i.id = r.ingredient_id
+			WHERE r.menu_item_id = m.id AND i.stock_quantity < r.quantity
+		)
+	`, cafeID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return invalidateMenuCache(tx, cafeID)
+	}
+	return nil
+}
+
+// enqueueStockAlerts queues a notification to the cafe staff about low and
+// exhausted stock
+func enqueueStockAlerts(db *gorm.DB, cafeID uint, alerts []stockAlert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		if alert.OutOfStock {
+			lines = append(lines, fmt.Sprintf("%s is out of stock", alert.Name))
+		} else {
+			lines = append(lines, strings.TrimSpace(fmt.Sprintf("%s is running low: %g %s left", alert.Name, alert.Remaining, alert.Unit)))
+		}
+	}
+	return enqueueCafeNotification(db, cafeID, notification.EventLowStock, map[string]string{
+		"Items": strings.Join(lines, "\n"),
+	})
+}
+
+func (s *Server) CreateIngredient(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.IngredientRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name is required",
+		})
+	}
+	if req.StockQuantity < 0 || req.LowStockThreshold < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "stock_quantity and low_stock_threshold cannot be negative",
+		})
+	}
+
+	ingredient := structures.Ingredient{
+		CafeID:            cafeId,
+		Name:              req.Name,
+		Unit:              req.Unit,
+		StockQuantity:     req.StockQuantity,
+		LowStockThreshold: req.LowStockThreshold,
+	}
+
+	if err := s.Db.Create(&ingredient).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create ingredient",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Ingredient created successfully",
+		"data":    ingredient,
+	})
+}
+
+func (s *Server) GetIngredients(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var ingredients []structures.Ingredient
+	query := s.Db.Where("cafe_id = ?", cafeId)
+	if c.Query("low_stock") == "true" {
+		query = query.Where("stock_quantity <= low_stock_threshold")
+	}
+	if err := query.Order("name ASC").Find(&ingredients).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch ingredients",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": ingredients,
+	})
+}
+
+func (s *Server) UpdateIngredient(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.IngredientRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var ingredient structures.Ingredient
+	if err := s.Db.Where("id = ? AND cafe_id = ?", req.ID, cafeId).First(&ingredient).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Ingredient not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch ingredient",
+		})
+	}
+
+	if req.LowStockThreshold < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "low_stock_threshold cannot be negative",
+		})
+	}
+
+	// Stock is changed through the restock endpoint so every change is recorded
+	updates := map[string]interface{}{
+		"unit":                req.Unit,
+		"low_stock_threshold": req.LowStockThreshold,
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		updates["name"] = name
+	}
+
+	if err := s.Db.Model(&ingredient).Updates(updates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update ingredient",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Ingredient updated successfully",
+		"data":    ingredient,
+	})
+}
+
+func (s *Server) DeleteIngredient(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.IngredientRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var recipeCount int
+	if err := s.Db.Model(&structures.RecipeItem{}).Where("ingredient_id = ?", req.ID).Count(&recipeCount).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check recipes",
+		})
+	}
+	if recipeCount > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Ingredient is used in recipes",
+		})
+	}
+
+	result := s.Db.Where("id = ? AND cafe_id = ?", req.ID, cafeId).Delete(&structures.Ingredient{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete ingredient",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Ingredient not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Ingredient deleted successfully",
+	})
+}
+
+func (s *Server) SetRecipe(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.SetRecipeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var menuItem structures.MenuItem
+	if err := s.Db.Where("id = ? AND cafe_id = ?", req.MenuItemID, cafeId).First(&menuItem).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Menu item not found",
+		})
+	}
+
+	ingredientIDs := make([]uint, 0, len(req.Ingredients))
+	for _, ingredient := range req.Ingredients {
+		if ingredient.Quantity <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "quantity must be greater than zero",
+			})
+		}
+		ingredientIDs = append(ingredientIDs, ingredient.IngredientID)
+	}
+
+	if len(ingredientIDs) > 0 {
+		var count int
+		if err := s.Db.Model(&structures.Ingredient{}).Where("id IN (?) AND cafe_id = ?", ingredientIDs, cafeId).Count(&count).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch ingredients",
+			})
+		}
+		if count != len(ingredientIDs) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unknown or duplicate ingredient",
+			})
+		}
+	}
+
+	tx := s.Db.Begin()
+
+	if err := tx.Where("menu_item_id = ?", menuItem.ID).Delete(&structures.RecipeItem{}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update recipe",
+		})
+	}
+
+	for _, ingredient := range req.Ingredients {
+		if err := tx.Create(&structures.RecipeItem{
+			MenuItemID:   menuItem.ID,
+			IngredientID: ingredient.IngredientID,
+			Quantity:     ingredient.Quantity,
+		}).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update recipe",
+			})
+		}
+	}
+
+	if err := restoreInStockItems(tx, cafeId); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update item availability",
+		})
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update recipe",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Recipe updated successfully",
+	})
+}
+
+func (s *Server) GetRecipe(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.SetRecipeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	type recipeLine struct {
+		IngredientID uint    `json:"ingredient_id"`
+		Name         string  `json:"name"`
+		Unit         string  `json:"unit"`
+		Quantity     float64 `json:"quantity"`
+		InStock      float64 `json:"in_stock"`
+	}
+
+	var recipe []recipeLine
+	if err := s.Db.Table("recipe_items r").
+		Select("r.ingredient_id, i.name, i.unit, r.quantity, i.stock_quantity AS in_stock").
+		Joins("JOIN ingredients i ON i.id = r.ingredient_id").
+		Where("r.menu_item_id = ? AND i.cafe_id = ?", req.MenuItemID, cafeId).
+		Order("i.name ASC").
+		Scan(&recipe).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch recipe",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": recipe,
+	})
+}
+
+func (s *Server) SetItemStock(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.SetItemStockRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	if (req.StockQuantity != nil && *req.StockQuantity < 0) || req.LowStockThreshold < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "stock_quantity and low_stock_threshold cannot be negative",
+		})
+	}
+
+	tx := s.Db.Begin()
+
+	updates := map[string]interface{}{
+		"stock_quantity":      req.StockQuantity,
+		"low_stock_threshold": req.LowStockThreshold,
+	}
+	if req.StockQuantity != nil && *req.StockQuantity == 0 {
+		updates["is_available"] = false
+		updates["out_of_stock"] = true
+		if err := invalidateMenuCache(tx, cafeId); err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update item stock",
+			})
+		}
+	}
+
+	result := tx.Model(&structures.MenuItem{}).Where("id = ? AND cafe_id = ?", req.MenuItemID, cafeId).Updates(updates)
+	if result.Error != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update item stock",
+		})
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Menu item not found",
+		})
+	}
+
+	if req.StockQuantity != nil {
+		itemID := req.MenuItemID
+		if err := tx.Create(&structures.InventoryTransaction{
+			CafeID:     cafeId,
+			MenuItemID: &itemID,
+			Change:     float64(*req.StockQuantity),
+			Balance:    float64(*req.StockQuantity),
+			Reason:     structures.InventoryAdjust,
+		}).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to record stock change",
+			})
+		}
+	}
+
+	if err := restoreInStockItems(tx, cafeId); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update item availability",
+		})
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update item stock",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Item stock updated successfully",
+	})
+}
+
+func (s *Server) Restock(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.RestockRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	if (req.IngredientID == 0) == (req.MenuItemID == 0) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Provide either ingredient_id or menu_item_id",
+		})
+	}
+	if req.Quantity < 0 || (!req.Set && req.Quantity == 0) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "quantity must be greater than zero",
+		})
+	}
+
+	tx := s.Db.Begin()
+
+	var balance, change float64
+	transaction := structures.InventoryTransaction{CafeID: cafeId, Reason: structures.InventoryRestock}
+	if req.Set {
+		transaction.Reason = structures.InventoryAdjust
+	}
+
+	if req.IngredientID != 0 {
+		var previous float64
+		if err := tx.Raw(`SELECT stock_quantity FROM ingredients WHERE id = ? AND cafe_id = ? FOR UPDATE`, req.IngredientID, cafeId).
+			Row().Scan(&previous); err != nil {
+			tx.Rollback()
+			if err == sql.ErrNoRows {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Ingredient not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch ingredient",
+			})
+		}
+
+		balance = previous + req.Quantity
+		if req.Set {
+			balance = req.Quantity
+		}
+		change = balance - previous
+
+		if err := tx.Model(&structures.Ingredient{}).Where("id = ?", req.IngredientID).
+			UpdateColumn("stock_quantity", balance).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to restock ingredient",
+			})
+		}
+		transaction.IngredientID = &req.IngredientID
+	} else {
+		var previous sql.NullInt64
+		if err := tx.Raw(`SELECT stock_quantity FROM menu_items WHERE id = ? AND cafe_id = ? FOR UPDATE`, req.MenuItemID, cafeId).
+			Row().Scan(&previous); err != nil {
+			tx.Rollback()
+			if err == sql.ErrNoRows {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Menu item not found",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch menu item",
+			})
+		}
+
+		// Items are counted in whole portions
+		quantity := int64(req.Quantity)
+		newStock := previous.Int64 + quantity
+		if req.Set {
+			newStock = quantity
+		}
+		balance = float64(newStock)
+		change = float64(newStock - previous.Int64)
+
+		if err := tx.Model(&structures.MenuItem{}).Where("id = ?", req.MenuItemID).
+			UpdateColumn("stock_quantity", newStock).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to restock menu item",
+			})
+		}
+		transaction.MenuItemID = &req.MenuItemID
+	}
+
+	transaction.Change = change
+	transaction.Balance = balance
+	if err := tx.Create(&transaction).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record stock change",
+		})
+	}
+
+	if err := restoreInStockItems(tx, cafeId); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update item availability",
+		})
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to restock",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Restocked successfully",
+		"balance": balance,
+	})
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxAudioPerRun bounds the narrations generated by one run of the job, the
+// rest are picked up by the next run.
+const maxAudioPerRun = 50
+
+// speechSynthesizer returns the configured TTS provider
+func (s *Server) speechSynthesizer() (helper.SpeechSynthesizer, error) {
+	switch s.Config.TTS_PROVIDER {
+	case "", "stub":
+		return helper.StubSynthesizer{}, nil
+	case "openai":
+		if s.Config.OPEN_AI_API_KEY == "" {
+			return nil, errors.New("OPEN_AI_API_KEY is not set")
+		}
+		return helper.OpenAISynthesizer{APIKey: s.Config.OPEN_AI_API_KEY, Voice: s.Config.TTS_VOICE}, nil
+	default:
+		return nil, fmt.Errorf("unknown TTS provider %q", s.Config.TTS_PROVIDER)
+	}
+}
+
+// fileStorage returns the configured storage for uploaded and generated files
+func (s *Server) fileStorage() (helper.FileStorage, error) {
+	switch s.Config.STORAGE_DRIVER {
+	case "local":
+		dir, baseURL := s.Config.LOCAL_STORAGE_DIR, s.Config.LOCAL_STORAGE_URL
+		if dir == "" {
+			dir = "media"
+		}
+		if baseURL == "" {
+			baseURL = "/media"
+		}
+		return helper.LocalStorage{Dir: dir, BaseURL: baseURL}, nil
+	case "s3":
+		if s.Config.S3_BUCKET == "" || s.Config.S3_REGION == "" {
+			return nil, errors.New("S3_BUCKET and S3_REGION are required")
+		}
+		return helper.S3Storage{
+			Endpoint:        s.Config.S3_ENDPOINT,
+			Region:          s.Config.S3_REGION,
+			Bucket:          s.Config.S3_BUCKET,
+			AccessKeyID:     s.Config.S3_ACCESS_KEY_ID,
+			SecretAccessKey: s.Config.S3_SECRET_ACCESS_KEY,
+			PublicURL:       s.Config.S3_PUBLIC_URL,
+		}, nil
+	case "":
+		return nil, errors.New("STORAGE_DRIVER is not set")
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", s.Config.STORAGE_DRIVER)
+	}
+}
+
+// narrationText is what the audio of an item reads out, its name followed by
+// the description or, without one, the short description.
+func narrationText(name, description, shortDescription string) string {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		description = strings.TrimSpace(shortDescription)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || description == "" {
+		return name + description
+	}
+	return strings.TrimSuffix(name, ".") + ". " + description
+}
+
+// audioSourceHash identifies the narrated text, language and voice
+func audioSourceHash(synthesizer helper.SpeechSynthesizer, language, text string) string {
+	sum := sha256.Sum256([]byte(synthesizer.Name() + "\n" + language + "\n" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// needsAudio tells whether the audio of an item or translation is missing or
+// stale. Audio set by hand has no hash and is left alone.
+func needsAudio(audioURL, storedHash, hash string) bool {
+	if audioURL != "" && storedHash == "" {
+		return false
+	}
+	return storedHash != hash
+}
+
+// generateAudio synthesizes the text and stores it under a key derived from
+// the hash, so regenerated audio never overwrites a cached file.
+func generateAudio(synthesizer helper.SpeechSynthesizer, storage helper.FileStorage, item structures.MenuItem, language, text, hash string) (string, error) {
+	audio, err := synthesizer.Synthesize(text, language)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("audio/%d/%d-%s-%s%s", item.CafeID, item.ID, language, hash[:12], audio.Extension)
+	return storage.Put(key, audio.Data, audio.ContentType)
+}
+
+// RunItemAudioJob generates narration audio for menu items and their
+// translations whose text changed since the audio was generated.
+func (s *Server) RunItemAudioJob(c *fiber.Ctx) error {
+	synthesizer, err := s.speechSynthesizer()
+	if err != nil {
+		log.Println("❌ Item audio job is not configured:", err)
+		return err
+	}
+	storage, err := s.fileStorage()
+	if err != nil {
+		log.Println("❌ Item audio job is not configured:", err)
+		return err
+	}
+
+	var cafes []structures.Cafe
+	if err := s.Db.Select("id, timezone, currency, locale, menu_language").Find(&cafes).Error; err != nil {
+		log.Println("❌ Failed to fetch cafes:", err)
+		return err
+	}
+	languages := make(map[uint]string, len(cafes))
+	for _, cafe := range cafes {
+		languages[cafe.ID] = cafeMenuLanguage(cafe)
+	}
+
+	var items []structures.MenuItem
+	if err := s.Db.Select("id, cafe_id, name, description, short_description, audio_url, audio_source_hash").
+		Where("archived_at IS NULL").Order("id ASC").Find(&items).Error; err != nil {
+		log.Println("❌ Failed to fetch menu items:", err)
+		return err
+	}
+	itemsByID := make(map[uint]structures.MenuItem, len(items))
+	for _, item := range items {
+		itemsByID[item.ID] = item
+	}
+
+	generated, failed := 0, 0
+	for _, item := range items {
+		if generated >= maxAudioPerRun {
+			break
+		}
+		text := narrationText(item.Name, item.Description, item.ShortDescription)
+		if text == "" {
+			continue
+		}
+		language := languages[item.CafeID]
+		hash := audioSourceHash(synthesizer, language, text)
+		if !needsAudio(item.AudioURL, item.AudioSourceHash, hash) {
+			continue
+		}
+
+		url, err := generateAudio(synthesizer, storage, item, language, text, hash)
+		if err != nil {
+			log.Printf("❌ Failed to generate audio for item %d: %v\n", item.ID, err)
+			failed++
+			continue
+		}
+		if err := s.Db.Model(&structures.MenuItem{}).Where("id = ?", item.ID).
+			UpdateColumns(map[string]interface{}{"audio_url": url, "audio_source_hash": hash}).Error; err != nil {
+			log.Printf("❌ Failed to save audio for item %d: %v\n", item.ID, err)
+			failed++
+			continue
+		}
+		generated++
+	}
+
+	var translations []structures.MenuItemTranslation
+	if err := s.Db.Order("id ASC").Find(&translations).Error; err != nil {
+		log.Println("❌ Failed to fetch translations:", err)
+		return err
+	}
+
+	for _, translation := range translations {
+		if generated >= maxAudioPerRun {
+			break
+		}
+		item, ok := itemsByID[translation.MenuItemID]
+		if !ok {
+			continue // Archived
+		}
+		// Only the name is translated, the description would be read in the wrong language
+		if translation.Description == "" && translation.ShortDescription == "" {
+			continue
+		}
+		name := translation.Name
+		if name == "" {
+			name = item.Name
+		}
+		text := narrationText(name, translation.Description, translation.ShortDescription)
+		hash := audioSourceHash(synthesizer, translation.Language, text)
+		if !needsAudio(translation.AudioURL, translation.AudioSourceHash, hash) {
+			continue
+		}
+
+		url, err := generateAudio(synthesizer, storage, item, translation.Language, text, hash)
+		if err != nil {
+			log.Printf("❌ Failed to generate %s audio for item %d: %v\n", translation.Language, item.ID, err)
+			failed++
+			continue
+		}
+		if err := s.Db.Model(&structures.MenuItemTranslation{}).Where("id = ?", translation.ID).
+			UpdateColumns(map[string]interface{}{"audio_url": url, "audio_source_hash": hash}).Error; err != nil {
+			log.Printf("❌ Failed to save %s audio for item %d: %v\n", translation.Language, item.ID, err)
+			failed++
+			continue
+		}
+		generated++
+	}
+
+	log.Printf("Item audio job generated %d narrations, %d failed\n", generated, failed)
+	if c == nil {
+		return nil
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":   "Item audio generated",
+		"generated": generated,
+		"failed":    failed,
+	})
+}
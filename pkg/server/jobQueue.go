@@ -0,0 +1,300 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	jobWorkerBudget  = 50 * time.Second // A scheduled run stops before the next one starts
+	jobRequestBudget = 25 * time.Second // Stays under the API Gateway timeout
+	jobPollInterval  = time.Second
+	jobLockTimeout   = 10 * time.Minute // A running job older than this is taken over
+	maxJobBackoff    = time.Hour
+	jobRetention     = 7 * 24 * time.Hour
+)
+
+// Kinds of queued jobs
+const (
+	jobNotifyCafe     = "notify_cafe"
+	jobCreditRewards  = "credit_rewards"
+	jobModerateReview = "moderate_review"
+	jobLogAIRecord    = "log_ai_record"
+)
+
+// jobKind runs the jobs of a kind. A failed job is retried after backoff,
+// doubled on every attempt, until it has been tried maxAttempts times.
+type jobKind struct {
+	run         func(s *Server, payload []byte) error
+	maxAttempts int
+	backoff     time.Duration
+}
+
+var jobKinds = map[string]jobKind{
+	jobNotifyCafe:     {run: (*Server).runNotifyCafeJob, maxAttempts: 5, backoff: 30 * time.Second},
+	jobCreditRewards:  {run: (*Server).runCreditRewardsJob, maxAttempts: 10, backoff: time.Minute},
+	jobModerateReview: {run: (*Server).runModerateReviewJob, maxAttempts: 5, backoff: time.Minute},
+	jobLogAIRecord:    {run: (*Server).runLogAIRecordJob, maxAttempts: 5, backoff: 30 * time.Second},
+}
+
+type notifyCafePayload struct {
+	CafeID uint              `json:"cafe_id"`
+	Event  string            `json:"event"`
+	Data   map[string]string `json:"data"`
+}
+
+type creditRewardsPayload struct {
+	UserID     uint      `json:"user_id"`
+	CafeID     uint      `json:"cafe_id"`
+	SessionID  string    `json:"session_id"`
+	OrderID    string    `json:"order_id"`
+	Mustaches  uint      `json:"mustaches"`
+	EarnedDate time.Time `json:"earned_date"`
+}
+
+type moderateReviewPayload struct {
+	FeedbackID uint `json:"feedback_id"`
+}
+
+// enqueueJob queues a job to run as soon as a worker is free. Pass the
+// transaction of the request so the job is only queued when it commits.
+func enqueueJob(db *gorm.DB, kind string, payload interface{}) error {
+	jk, ok := jobKinds[kind]
+	if !ok {
+		return fmt.Errorf("unknown job kind %q", kind)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return db.Create(&structures.QueuedJob{
+		Kind:        kind,
+		Payload:     string(body),
+		Status:      structures.JobQueued,
+		RunAt:       time.Now(),
+		MaxAttempts: jk.maxAttempts,
+	}).Error
+}
+
+// enqueueCafeNotification queues an event for the staff of a cafe
+func enqueueCafeNotification(db *gorm.DB, cafeID uint, event string, data map[string]string) error {
+	return enqueueJob(db, jobNotifyCafe, notifyCafePayload{CafeID: cafeID, Event: event, Data: data})
+}
+
+// claimJob takes the next due job, or a running one whose worker is gone.
+// SKIP LOCKED lets several workers claim jobs at the same time.
+func (s *Server) claimJob() (*structures.QueuedJob, error) {
+	var jobs []structures.QueuedJob
+	if err := s.Db.Raw(`
+		UPDATE queued_jobs
+		SET status = ?, locked_at = NOW(), attempts = attempts + 1, updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM queued_jobs
+			WHERE (status = ? AND run_at <= NOW())
+			OR (status = ? AND locked_at < NOW() - ?::interval)
+			ORDER BY run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		structures.JobRunning, structures.JobQueued, structures.JobRunning,
+		fmt.Sprintf("%d seconds", int(jobLockTimeout.Seconds()))).Scan(&jobs).Error; err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return &jobs[0], nil
+}
+
+// runJob runs a claimed job and records the outcome. It reports whether the
+// job succeeded.
+func (s *Server) runJob(job *structures.QueuedJob) bool {
+	err := func() (err error) {
+		jk, ok := jobKinds[job.Kind]
+		if !ok {
+			return fmt.Errorf("unknown job kind %q", job.Kind)
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return jk.run(s, []byte(job.Payload))
+	}()
+
+	if err == nil {
+		if err := s.Db.Model(job).UpdateColumns(map[string]interface{}{
+			"status":     structures.JobDone,
+			"last_error": "",
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			log.Printf("❌ Failed to complete job %d: %v\n", job.ID, err)
+		}
+		return true
+	}
+
+	log.Printf("❌ Job %d (%s) failed on attempt %d: %v\n", job.ID, job.Kind, job.Attempts, err)
+	updates := map[string]interface{}{
+		"status":     structures.JobQueued,
+		"last_error": err.Error(),
+		"run_at":     time.Now().Add(jobBackoff(job.Kind, job.Attempts)),
+		"updated_at": time.Now(),
+	}
+	if job.Attempts >= job.MaxAttempts {
+		updates["status"] = structures.JobFailed
+	}
+	if err := s.Db.Model(job).UpdateColumns(updates).Error; err != nil {
+		log.Printf("❌ Failed to reschedule job %d: %v\n", job.ID, err)
+	}
+	return false
+}
+
+// jobBackoff is how long a job waits after its nth failed attempt
+func jobBackoff(kind string, attempts int) time.Duration {
+	delay := jobKinds[kind].backoff
+	if delay <= 0 {
+		delay = time.Minute
+	}
+	for i := 1; i < attempts && delay < maxJobBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxJobBackoff {
+		delay = maxJobBackoff
+	}
+	return delay
+}
+
+// RunJobWorker runs queued jobs. Scheduled runs keep polling for new jobs
+// until their time is up, a request stops once the queue is empty.
+func (s *Server) RunJobWorker(c *fiber.Ctx) error {
+	budget := jobWorkerBudget
+	if c != nil {
+		budget = jobRequestBudget
+	}
+	deadline := time.Now().Add(budget)
+
+	done, failed := 0, 0
+	for time.Now().Before(deadline) {
+		job, err := s.claimJob()
+		if err != nil {
+			log.Println("❌ Failed to claim job:", err)
+			break
+		}
+		if job == nil {
+			if c != nil {
+				break
+			}
+			time.Sleep(jobPollInterval)
+			continue
+		}
+		if s.runJob(job) {
+			done++
+		} else {
+			failed++
+		}
+	}
+
+	if err := s.Db.Where("status = ? AND updated_at < ?", structures.JobDone, time.Now().Add(-jobRetention)).
+		Delete(&structures.QueuedJob{}).Error; err != nil {
+		log.Println("❌ Failed to remove finished jobs:", err)
+	}
+
+	if done+failed > 0 {
+		log.Printf("Jobs done %d, failed %d\n", done, failed)
+	}
+	if c == nil {
+		return nil
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Jobs processed",
+		"done":    done,
+		"failed":  failed,
+	})
+}
+
+func (s *Server) runNotifyCafeJob(payload []byte) error {
+	var p notifyCafePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	return s.notifyCafe(p.CafeID, p.Event, p.Data)
+}
+
+// runCreditRewardsJob credits the mustaches earned with an order. An order is
+// credited once, so a retried job does not credit it again.
+func (s *Server) runCreditRewardsJob(payload []byte) error {
+	var p creditRewardsPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	return s.Db.Exec(`
+		INSERT INTO reward_transactions (user_id, cafe_id, session_id, transaction_type, mustaches, earned_date, order_id, created_at, updated_at)
+		VALUES (?, ?, ?, 'credited', ?, ?, ?, NOW(), NOW())
+		ON CONFLICT (order_id) DO NOTHING`,
+		p.UserID, p.CafeID, p.SessionID, p.Mustaches, p.EarnedDate, p.OrderID).Error
+}
+
+// runModerateReviewJob checks a review that is waiting for the classifier.
+// Reviews the owner already handled are left alone.
+func (s *Server) runModerateReviewJob(payload []byte) error {
+	var p moderateReviewPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	var feedback structures.CafeFeedback
+	if err := s.Db.Where("id = ?", p.FeedbackID).First(&feedback).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if feedback.ReviewStatus != structures.ReviewPending || feedback.ModerationReason != reviewAwaitingCheck {
+		return nil
+	}
+
+	status, reason := structures.ReviewPending, "Not checked automatically"
+	classifier, err := s.reviewClassifier()
+	if err != nil {
+		log.Println("❌ Review classifier is not configured:", err)
+	} else {
+		verdict, err := classifier.Classify(feedback.Review)
+		if err != nil {
+			return err
+		}
+		status, reason = structures.ReviewApproved, ""
+		if verdict.Flagged {
+			status, reason = structures.ReviewPending, "Flagged: "+strings.Join(verdict.Reasons, ", ")
+		}
+	}
+
+	return s.Db.Model(&structures.CafeFeedback{}).
+		Where("id = ? AND review_status = ? AND moderation_reason = ?", feedback.ID, structures.ReviewPending, reviewAwaitingCheck).
+		UpdateColumns(map[string]interface{}{
+			"review_status":     status,
+			"moderation_reason": reason,
+		}).Error
+}
+
+// runLogAIRecordJob saves a question asked to the menu AI and its answer. A
+// record is saved once, so a retried job does not save it again.
+func (s *Server) runLogAIRecordJob(payload []byte) error {
+	var record structures.MenuAIRecords
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return err
+	}
+	return s.Db.Exec(`
+		INSERT INTO menu_ai_records (prompt_id, user_id, cafe_id, generated_sql, answer, created_at, prompt, user_response)
+		VALUES (?, ?, ?, ?, ?, ?, ?, false)
+		ON CONFLICT (prompt_id) DO NOTHING`,
+		record.PromptId, record.UserId, record.CafeId, record.GeneratedSql, record.Answer, record.CreatedAt, record.Prompt).Error
+}
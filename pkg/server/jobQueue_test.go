@@ -0,0 +1,33 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobBackoff(t *testing.T) {
+	tests := []struct {
+		kind     string
+		attempts int
+		want     time.Duration
+	}{
+		{jobNotifyCafe, 0, 30 * time.Second},
+		{jobNotifyCafe, 1, 30 * time.Second},
+		{jobNotifyCafe, 2, time.Minute},
+		{jobNotifyCafe, 3, 2 * time.Minute},
+		{jobLogAIRecord, 4, 4 * time.Minute},
+		{jobCreditRewards, 1, time.Minute},
+		{jobCreditRewards, 6, 32 * time.Minute},
+		{jobCreditRewards, 7, time.Hour},
+		{jobCreditRewards, 1000, time.Hour},
+		{jobModerateReview, 2, 2 * time.Minute},
+		{"unknown", 1, time.Minute},
+		{"unknown", 3, 4 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := jobBackoff(tt.kind, tt.attempts); got != tt.want {
+			t.Errorf("jobBackoff(%q, %d) = %v, want %v", tt.kind, tt.attempts, got, tt.want)
+		}
+	}
+}
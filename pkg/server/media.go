@@ -0,0 +1,402 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	maxImageUploadBytes = 8 << 20
+	maxVideoUploadBytes = 10 << 20
+	mediaUploadTTL      = 15 * time.Minute
+	webpQuality         = 80
+)
+
+// mediaOwner is the row and column an uploaded file of a kind is set on
+type mediaOwner struct {
+	table  string
+	column string
+	key    string
+	video  bool
+	menu   bool // The column is part of the cached menu
+}
+
+var mediaOwners = map[structures.MediaKind]mediaOwner{
+	structures.MediaMenuItemImage:    {table: "menu_items", column: "image_url", key: "id", menu: true},
+	structures.MediaMenuItemVideo:    {table: "menu_items", column: "video_url", key: "id", video: true, menu: true},
+	structures.MediaCafeImage:        {table: "cafes", column: "image_url", key: "id"},
+	structures.MediaCuratedCartImage: {table: "curated_carts", column: "image_url", key: "id"},
+	structures.MediaPaymentImage:     {table: "sessions", column: "payment_image_url", key: "session_id"},
+}
+
+// Content types accepted for uploads, as sniffed from the file itself
+var (
+	imageExtensions = map[string]string{"image/jpeg": ".jpg", "image/png": ".png", "image/gif": ".gif"}
+	videoExtensions = map[string]string{"video/mp4": ".mp4", "video/webm": ".webm"}
+)
+
+// checkUploadSize validates the declared type and size of an upload of a kind
+func checkUploadSize(owner mediaOwner, contentType string, size int) string {
+	extensions, limit, what := imageExtensions, maxImageUploadBytes, "image"
+	if owner.video {
+		extensions, limit, what = videoExtensions, maxVideoUploadBytes, "video"
+	}
+	if _, ok := extensions[contentType]; !ok {
+		return fmt.Sprintf("content_type %q is not a supported %s type", contentType, what)
+	}
+	if size <= 0 || size > limit {
+		return fmt.Sprintf("size must be between 1 and %d bytes", limit)
+	}
+	return ""
+}
+
+// signMediaUpload creates the pending asset and the URL the file is PUT to
+func (s *Server) signMediaUpload(c *fiber.Ctx, asset structures.MediaAsset) error {
+	if err := s.Db.Create(&asset).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create upload",
+		})
+	}
+
+	expiresAt := time.Now().Add(mediaUploadTTL)
+	token, err := helper.SignMediaUpload(structures.MediaUploadPayload{
+		AssetID:   asset.ID,
+		CafeID:    asset.CafeID,
+		ExpiresAt: expiresAt.Unix(),
+	}, s.qrSecret())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to sign upload",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"asset_id":   asset.ID,
+		"method":     fiber.MethodPut,
+		"upload_url": strings.TrimSuffix(s.Config.API_BASE_URL, "/") + "/uploadMedia?token=" + url.QueryEscape(token),
+		"headers":    fiber.Map{fiber.HeaderContentType: asset.ContentType},
+		"expires_at": expiresAt,
+	})
+}
+
+// CreateMediaUpload signs the upload of an image or video for a menu item,
+// curated cart or the cafe itself.
+func (s *Server) CreateMediaUpload(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.MediaUploadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	owner, ok := mediaOwners[req.Kind]
+	if !ok || req.Kind == structures.MediaPaymentImage {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "kind must be menu_item_image, menu_item_video, cafe_image or curated_cart_image",
+		})
+	}
+	if msg := checkUploadSize(owner, req.ContentType, req.Size); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	ownerID := cafeId
+	if req.Kind != structures.MediaCafeImage {
+		query := s.Db.Table(owner.table).Where("id = ? AND cafe_id = ?", req.OwnerID, cafeId)
+		if owner.table == "menu_items" {
+			query = query.Where("archived_at IS NULL")
+		}
+		var count int
+		if err := query.Count(&count).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create upload",
+			})
+		}
+		if count == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Owner not found",
+			})
+		}
+		ownerID = req.OwnerID
+	}
+
+	return s.signMediaUpload(c, structures.MediaAsset{
+		CafeID:      cafeId,
+		Kind:        req.Kind,
+		OwnerID:     strconv.FormatUint(uint64(ownerID), 10),
+		Status:      structures.MediaPending,
+		ContentType: req.ContentType,
+		Size:        req.Size,
+	})
+}
+
+// CreatePaymentImageUpload signs the upload of a payment screenshot for the
+// session of the customer.
+func (s *Server) CreatePaymentImageUpload(c *fiber.Ctx) error {
+	session, ok := c.Locals("session").(structures.Session)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "session_id is required",
+		})
+	}
+	if session.SessionStatus != structures.Active {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Session is no longer active",
+		})
+	}
+
+	var req structures.PaymentImageUploadRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	if msg := checkUploadSize(mediaOwners[structures.MediaPaymentImage], req.ContentType, req.Size); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	return s.signMediaUpload(c, structures.MediaAsset{
+		CafeID:      session.CafeID,
+		Kind:        structures.MediaPaymentImage,
+		OwnerID:     session.SessionID,
+		Status:      structures.MediaPending,
+		ContentType: req.ContentType,
+		Size:        req.Size,
+	})
+}
+
+// storeImage validates an uploaded image and stores the original with every
+// variant in its format and as WebP. The owner is pointed at the large one.
+func storeImage(storage helper.FileStorage, asset *structures.MediaAsset, data []byte, extension string) error {
+	decoded, err := helper.DecodeImage(data)
+	if err != nil {
+		return err
+	}
+
+	prefix := fmt.Sprintf("images/%d/%d/", asset.CafeID, asset.ID)
+	original, err := storage.Put(prefix+"original"+extension, data, asset.ContentType)
+	if err != nil {
+		return err
+	}
+
+	opaque := decoded.Opaque()
+	variants := make(map[string]structures.MediaVariant, len(helper.ImageVariants))
+	for _, variant := range helper.ImageVariants {
+		img := helper.ResizeImage(decoded, variant)
+
+		encoded, contentType, ext, err := helper.EncodeImage(img, opaque)
+		if err != nil {
+			return err
+		}
+		variantURL, err := storage.Put(prefix+variant.Name+ext, encoded, contentType)
+		if err != nil {
+			return err
+		}
+
+		webp, err := helper.EncodeWebP(img, webpQuality)
+		if err != nil {
+			return err
+		}
+		webpURL, err := storage.Put(prefix+variant.Name+".webp", webp, "image/webp")
+		if err != nil {
+			return err
+		}
+
+		variants[variant.Name] = structures.MediaVariant{
+			Width:   img.Bounds().Dx(),
+			Height:  img.Bounds().Dy(),
+			URL:     variantURL,
+			WebPURL: webpURL,
+		}
+	}
+
+	encodedVariants, err := json.Marshal(variants)
+	if err != nil {
+		return err
+	}
+
+	asset.Width, asset.Height = decoded.Width(), decoded.Height()
+	asset.OriginalURL = original
+	asset.URL = variants["large"].URL
+	asset.Variants = encodedVariants
+	return nil
+}
+
+// UploadMedia receives the file of a signed upload as the raw request body.
+// The token in the query string is the only authorization.
+func (s *Server) UploadMedia(c *fiber.Ctx) error {
+	payload, err := helper.VerifyMediaUpload(c.Query("token"), s.qrSecret(), time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired upload URL",
+		})
+	}
+
+	var asset structures.MediaAsset
+	if err := s.Db.Where("id = ? AND cafe_id = ?", payload.AssetID, payload.CafeID).First(&asset).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Upload not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load upload",
+		})
+	}
+	if asset.Status != structures.MediaPending {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "File was already uploaded",
+		})
+	}
+
+	owner := mediaOwners[asset.Kind]
+	data := c.Body()
+	extensions, limit := imageExtensions, maxImageUploadBytes
+	if owner.video {
+		extensions, limit = videoExtensions, maxVideoUploadBytes
+	}
+	if len(data) == 0 || len(data) > limit {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": fmt.Sprintf("File must be between 1 and %d bytes", limit),
+		})
+	}
+
+	// Trust the content, not the declared type
+	contentType := http.DetectContentType(data)
+	extension, ok := extensions[contentType]
+	if !ok {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": fmt.Sprintf("Unsupported file type %s", contentType),
+		})
+	}
+	asset.ContentType = contentType
+	asset.Size = len(data)
+
+	storage, err := s.fileStorage()
+	if err != nil {
+		log.Println("❌ Media storage is not configured:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store file",
+		})
+	}
+
+	if owner.video {
+		asset.URL, err = storage.Put(fmt.Sprintf("videos/%d/%d%s", asset.CafeID, asset.ID, extension), data, contentType)
+		asset.OriginalURL = asset.URL
+	} else {
+		err = storeImage(storage, &asset, data, extension)
+		if err == helper.ErrUnsupportedImage || err == helper.ErrImageTooLarge {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+	if err != nil {
+		log.Printf("❌ Failed to store media asset %d: %v\n", asset.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store file",
+		})
+	}
+
+	now := time.Now()
+	asset.UploadedAt = &now
+	asset.Status = structures.MediaReady
+
+	tx := s.Db.Begin()
+
+	// Only one upload of the token wins
+	result := tx.Model(&structures.MediaAsset{}).Where("id = ? AND status = ?", asset.ID, structures.MediaPending).
+		UpdateColumns(map[string]interface{}{
+			"status":       asset.Status,
+			"content_type": asset.ContentType,
+			"size":         asset.Size,
+			"width":        asset.Width,
+			"height":       asset.Height,
+			"url":          asset.URL,
+			"original_url": asset.OriginalURL,
+			"variants":     asset.Variants,
+			"uploaded_at":  asset.UploadedAt,
+		})
+	if result.Error != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save upload",
+		})
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "File was already uploaded",
+		})
+	}
+
+	ownerRow := tx.Table(owner.table).Where(owner.key+" = ?", asset.OwnerID)
+	if owner.table != "cafes" {
+		ownerRow = ownerRow.Where("cafe_id = ?", asset.CafeID)
+	}
+	if err := ownerRow.UpdateColumn(owner.column, asset.URL).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save upload",
+		})
+	}
+
+	if owner.menu {
+		if err := invalidateMenuCache(tx, asset.CafeID); err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save upload",
+			})
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save upload",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "File uploaded successfully",
+		"data":    asset,
+	})
+}
+
+// imagePreference reads the image variant a client wants. X-Image-Size picks
+// thumbnail, medium or large and WebP is served when the Accept or
+// X-Image-Accept header lists it.
+func imagePreference(c *fiber.Ctx) (string, bool) {
+	size := ""
+	requested := strings.ToLower(strings.TrimSpace(c.Get("X-Image-Size")))
+	for _, variant := range helper.ImageVariants {
+		if variant.Name == requested {
+			size = requested
+		}
+	}
+	webp := strings.Contains(c.Get(fiber.HeaderAccept), "image/webp") || strings.Contains(c.Get("X-Image-Accept"), "image/webp")
+	return size, webp
+}
+
+// preferredImageURL points an uploaded image at the variant the client wants
+func preferredImageURL(imageURL, size string, webp bool) string {
+	if size == "" && !webp {
+		return imageURL
+	}
+	return helper.ImageVariantURL(imageURL, size, webp)
+}
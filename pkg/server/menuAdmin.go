@@ -0,0 +1,266 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// saveMenuDocument validates and applies a single row document. Creating a
+// row that matches an existing record is a conflict, updating one that does
+// not exist is reported by the plan as a row error.
+func (s *Server) saveMenuDocument(c *fiber.Ctx, doc structures.MenuDocument, create bool, label string) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	plan, err := newMenuPlan(s.Db, cafeId, doc, 0)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load menu",
+		})
+	}
+
+	if len(plan.result.Errors) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Invalid " + label,
+			"errors": plan.result.Errors,
+		})
+	}
+	if create && plan.result.Created == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("%s already exists", label),
+		})
+	}
+	if len(plan.steps) == 0 {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "No changes",
+			"changes": plan.result.Changes,
+		})
+	}
+
+	ctx, err := s.applyMenuPlan(plan, nil)
+	if errors.Is(err, errMenuChanged) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  "The menu changed meanwhile, " + label + " is no longer valid",
+			"errors": plan.result.Errors,
+		})
+	}
+	if err != nil {
+		fmt.Printf("Failed to save %s: %v\n", label, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save " + label,
+		})
+	}
+
+	var id uint
+	if len(ctx.savedIDs) > 0 {
+		id = ctx.savedIDs[len(ctx.savedIDs)-1]
+	}
+
+	action := "updated"
+	if create {
+		action = "created"
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": fmt.Sprintf("%s %s successfully", label, action),
+		"id":      id,
+		"changes": plan.result.Changes,
+	})
+}
+
+func (s *Server) CreateCategory(c *fiber.Ctx) error {
+	var req structures.MenuCategoryRow
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	req.ID = 0
+
+	return s.saveMenuDocument(c, structures.MenuDocument{Categories: []structures.MenuCategoryRow{req}}, true, "Category")
+}
+
+func (s *Server) UpdateCategory(c *fiber.Ctx) error {
+	var req structures.MenuCategoryRow
+	if err := c.BodyParser(&req); err != nil || req.ID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	return s.saveMenuDocument(c, structures.MenuDocument{Categories: []structures.MenuCategoryRow{req}}, false, "Category")
+}
+
+func (s *Server) CreateMenuItem(c *fiber.Ctx) error {
+	var req structures.MenuItemRow
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	req.ID = 0
+
+	return s.saveMenuDocument(c, structures.MenuDocument{Items: []structures.MenuItemRow{req}}, true, "Menu item")
+}
+
+func (s *Server) UpdateMenuItem(c *fiber.Ctx) error {
+	var req structures.MenuItemRow
+	if err := c.BodyParser(&req); err != nil || req.ID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	return s.saveMenuDocument(c, structures.MenuDocument{Items: []structures.MenuItemRow{req}}, false, "Menu item")
+}
+
+func (s *Server) CreateCustomization(c *fiber.Ctx) error {
+	var req structures.MenuCustomizationRow
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	req.ID = 0
+
+	return s.saveMenuDocument(c, structures.MenuDocument{Customizations: []structures.MenuCustomizationRow{req}}, true, "Customization")
+}
+
+func (s *Server) UpdateCustomization(c *fiber.Ctx) error {
+	var req structures.MenuCustomizationRow
+	if err := c.BodyParser(&req); err != nil || req.ID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	return s.saveMenuDocument(c, structures.MenuDocument{Customizations: []structures.MenuCustomizationRow{req}}, false, "Customization")
+}
+
+func (s *Server) CreateCrossSell(c *fiber.Ctx) error {
+	var req structures.MenuCrossSellRow
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	req.ID = 0
+
+	return s.saveMenuDocument(c, structures.MenuDocument{CrossSells: []structures.MenuCrossSellRow{req}}, true, "Cross sell")
+}
+
+func (s *Server) UpdateCrossSell(c *fiber.Ctx) error {
+	var req structures.MenuCrossSellRow
+	if err := c.BodyParser(&req); err != nil || req.ID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	return s.saveMenuDocument(c, structures.MenuDocument{CrossSells: []structures.MenuCrossSellRow{req}}, false, "Cross sell")
+}
+
+// archiveMenuRecord sets or clears archived_at on a record owned by the cafe.
+// scope restricts the update to the cafe and takes the record id and cafe id.
+func (s *Server) archiveMenuRecord(c *fiber.Ctx, table, scope, label string) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.ArchiveRequest
+	if err := c.BodyParser(&req); err != nil || req.ID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var archivedAt interface{}
+	if req.Archived {
+		archivedAt = time.Now()
+	}
+
+	tx := s.Db.Begin()
+
+	result := tx.Table(table).Where(scope, req.ID, cafeId).Updates(map[string]interface{}{
+		"archived_at": archivedAt,
+		"updated_at":  time.Now(),
+	})
+	if result.Error != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update " + label,
+		})
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": label + " not found",
+		})
+	}
+
+	if err := invalidateMenuCache(tx, cafeId); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update " + label,
+		})
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update " + label,
+		})
+	}
+
+	action := "restored"
+	if req.Archived {
+		action = "archived"
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": fmt.Sprintf("%s %s successfully", label, action),
+	})
+}
+
+func (s *Server) ArchiveCategory(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.ArchiveRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	// A category can only be archived once all of its items are
+	if req.Archived {
+		var activeItems int
+		if err := s.Db.Model(&structures.MenuItem{}).
+			Where("category_id = ? AND cafe_id = ? AND archived_at IS NULL", req.ID, cafeId).
+			Count(&activeItems).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check category items",
+			})
+		}
+		if activeItems > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":        "Category still has items that are not archived",
+				"active_items": activeItems,
+			})
+		}
+	}
+
+	return s.archiveMenuRecord(c, "categories", "id = ? AND cafe_id = ?", "Category")
+}
+
+func (s *Server) ArchiveMenuItem(c *fiber.Ctx) error {
+	return s.archiveMenuRecord(c, "menu_items", "id = ? AND cafe_id = ?", "Menu item")
+}
+
+func (s *Server) ArchiveCustomization(c *fiber.Ctx) error {
+	return s.archiveMenuRecord(c, "item_customizations",
+		"id = ? AND menu_item_id IN (SELECT id FROM menu_items WHERE cafe_id = ?)", "Customization")
+}
+
+func (s *Server) ArchiveCrossSell(c *fiber.Ctx) error {
+	return s.archiveMenuRecord(c, "cross_sells",
+		"id = ? AND base_item_id IN (SELECT id FROM menu_items WHERE cafe_id = ?)", "Cross sell")
+}
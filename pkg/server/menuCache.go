@@ -0,0 +1,186 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Menus are cached per cafe revision, so a stale entry is never read once the
+// revision moved on. The ttl only bounds how long unused entries are kept.
+const menuCacheTTL = 30 * time.Minute
+
+var menuLRU = helper.NewLRUCache(256)
+
+// menuItemView is what customers see of an item on the menu
+type menuItemView struct {
+	ID               uint    `json:"id"`
+	CafeID           uint    `json:"cafe_id"`
+	CategoryID       uint    `json:"category_id"`
+	Name             string  `json:"name"`
+	Description      string  `json:"description"`
+	ShortDescription string  `json:"short_description"`
+	Price            float64 `json:"price"`
+	IsCustomizable   bool    `json:"is_customizable"`
+	ImageURL         string  `json:"image_url"`
+	VideoURL         string  `json:"video_url"`
+	Rating           float64 `json:"rating"`
+	WeightedRating   float64 `json:"weighted_rating"`
+	TotalRatings     int     `json:"total_ratings"`
+}
+
+// menuCacheItem keeps the availability window next to the item so the time
+// dependent filtering happens on every request, not when the menu is cached.
+type menuCacheItem struct {
+	menuItemView
+	AvailableFrom   string `json:"available_from"`
+	AvailableTill   string `json:"available_till"`
+	AvailableAllDay string `json:"available_all_day"`
+}
+
+type menuCacheCategory struct {
+	CategoryID uint            `json:"category_id"`
+	Category   string          `json:"category"`
+	Items      []menuCacheItem `json:"items"`
+}
+
+// invalidateMenuCache moves the cafe to a new menu revision. Pass the
+// transaction making the change so the bump commits with it.
+func invalidateMenuCache(db *gorm.DB, cafeID uint) error {
+	return db.Exec("UPDATE cafes SET menu_revision = menu_revision + 1 WHERE id = ?", cafeID).Error
+}
+
+// menuCafe loads the cafe fields the menu cache, category ranking and
+// language resolution need
+func (s *Server) menuCafe(cafeID uint) (structures.Cafe, error) {
+	var cafe structures.Cafe
+	err := s.Db.Select("id, timezone, currency, locale, menu_language, menu_revision, morning_ends_at, afternoon_ends_at").Where("id = ?", cafeID).First(&cafe).Error
+	return cafe, err
+}
+
+// queryMenu reads the available, unarchived items of a cafe grouped by
+// category, translated into the language where a translation exists.
+func (s *Server) queryMenu(cafeID uint, foodType, language string) ([]menuCacheCategory, error) {
+	sql := `
+	SELECT
+	c.id AS category_id,
+	c.name AS category,
+	COALESCE(
+		json_agg(
+		json_build_object(
+			'id'               , m.id,
+			'cafe_id'          , m.cafe_id,
+			'category_id'      , m.category_id,
+			'name'             , COALESCE(NULLIF(t.name, ''), m.name),
+			'description'      , COALESCE(NULLIF(t.description, ''), m.description),
+			'short_description', COALESCE(NULLIF(t.short_description, ''), m.short_description),
+			'price'            , m.price,
+			'is_customizable'  , m.is_customizable,
+			'image_url'        , m.image_url,
+			'video_url'        , m.video_url,
+			'rating'           , m.rating,
+			'weighted_rating'  , m.weighted_rating,
+			'total_ratings'    , m.total_ratings,
+			'available_from'   , m.available_from,
+			'available_till'   , m.available_till,
+			'available_all_day', m.available_all_day
+		) ORDER BY COALESCE(NULLIF(t.name, ''), m.name)
+		) FILTER (WHERE m.id IS NOT NULL),
+		'[]'
+	) AS items
+	FROM categories c
+	LEFT JOIN menu_items m
+	ON m.category_id = c.id
+	AND m.cafe_id     = c.cafe_id
+	AND m.is_available = true
+	AND m.archived_at IS NULL
+	`
+
+	// optional food_type
+	args := []interface{}{}
+	if foodType != "" {
+		sql += " AND m.food_type = ?\n"
+		args = append(args, foodType)
+	}
+
+	sql += `
+	LEFT JOIN menu_item_translations t
+	ON t.menu_item_id = m.id
+	AND t.language    = ?
+	WHERE c.cafe_id = ? AND c.archived_at IS NULL
+	GROUP BY c.id, c.name
+	ORDER BY c.name ASC;
+	`
+	args = append(args, language, cafeID)
+
+	var rows []struct {
+		CategoryID uint
+		Category   string
+		Items      json.RawMessage
+	}
+	if err := s.Db.Raw(sql, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	menu := make([]menuCacheCategory, 0, len(rows))
+	for _, row := range rows {
+		category := menuCacheCategory{CategoryID: row.CategoryID, Category: row.Category}
+		if err := json.Unmarshal(row.Items, &category.Items); err != nil {
+			return nil, err
+		}
+		menu = append(menu, category)
+	}
+	return menu, nil
+}
+
+// cachedMenu returns the menu of a cafe at its current revision from the
+// in-process cache, then the shared cache, then the database, filling the
+// caches on the way back.
+func (s *Server) cachedMenu(cafe structures.Cafe, foodType, language string) ([]menuCacheCategory, error) {
+	key := fmt.Sprintf("menu:v2:%d:%d:%s:%s", cafe.ID, cafe.MenuRevision, foodType, language)
+
+	var menu []menuCacheCategory
+	if encoded, ok := menuLRU.Get(key); ok && json.Unmarshal(encoded, &menu) == nil {
+		return menu, nil
+	}
+	if s.Cache != nil {
+		if encoded, ok := s.Cache.Get(key); ok && json.Unmarshal(encoded, &menu) == nil {
+			menuLRU.Set(key, encoded, menuCacheTTL)
+			return menu, nil
+		}
+	}
+
+	menu, err := s.queryMenu(cafe.ID, foodType, language)
+	if err != nil {
+		return nil, err
+	}
+	if encoded, err := json.Marshal(menu); err == nil {
+		menuLRU.Set(key, encoded, menuCacheTTL)
+		if s.Cache != nil {
+			s.Cache.Set(key, encoded, menuCacheTTL)
+		}
+	}
+	return menu, nil
+}
+
+// menuETag is a strong validator of a response body
+func menuETag(body []byte) string {
+	return fmt.Sprintf(`"%x"`, sha1.Sum(body))
+}
+
+// etagMatches reports whether an If-None-Match header names the etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"reflect"
+	"testing"
+)
+
+// countingCache is a shared cache that counts its reads
+type countingCache struct {
+	*helper.LRUCache
+	gets int
+}
+
+func (c *countingCache) Get(key string) ([]byte, bool) {
+	c.gets++
+	return c.LRUCache.Get(key)
+}
+
+func TestCachedMenuReadsThroughSharedCache(t *testing.T) {
+	shared := &countingCache{LRUCache: helper.NewLRUCache(0)}
+	s := &Server{Cache: shared}
+	cafe := structures.Cafe{ID: 9001, MenuRevision: 7}
+	want := []menuCacheCategory{{CategoryID: 1, Category: "Coffee", Items: []menuCacheItem{}}}
+
+	// Another instance built the menu. Without a database the shared cache is
+	// the only place it can come from.
+	shared.Set("menu:v2:9001:7:veg:en", []byte(`[{"category_id":1,"category":"Coffee","items":[]}]`), menuCacheTTL)
+
+	for i := 0; i < 2; i++ {
+		got, err := s.cachedMenu(cafe, "veg", "en")
+		if err != nil {
+			t.Fatalf("cachedMenu: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("cachedMenu = %+v, want %+v", got, want)
+		}
+	}
+	// The second read is served by the in-process cache
+	if shared.gets != 1 {
+		t.Errorf("shared cache read %d times, want 1", shared.gets)
+	}
+	menuLRU.Delete("menu:v2:9001:7:veg:en")
+}
@@ -0,0 +1,1281 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+// menuApplyContext carries ids between the steps of a menu plan so rows can
+// reference categories and items created earlier in the same import.
+type menuApplyContext struct {
+	cafeID      uint
+	now         time.Time
+	categoryIDs map[string]uint // Keyed by lower case name
+	itemIDs     map[string]uint // Keyed by lower case name
+	savedIDs    []uint
+}
+
+// menuPlan is the validated set of changes for a menu document. Nothing is
+// written until apply is called.
+type menuPlan struct {
+	cafeID           uint
+	rowOffset        int // Added to the slice index to get the row number shown to users
+	doc              structures.MenuDocument
+	archivesUnlisted bool
+	result           structures.ImportMenuResponse
+	steps            []func(tx *gorm.DB, ctx *menuApplyContext) error
+
+	categoriesByID   map[uint]structures.Category
+	categoriesByName map[string]structures.Category
+	itemsByID        map[uint]structures.MenuItem
+	itemsByName      map[string]structures.MenuItem
+	customizations   []structures.ItemCustomization
+	groupsByID       map[uint]structures.CustomizationGroup
+	crossSells       []structures.CrossSell
+
+	categoryNames map[string]string        // Every category after the import, lower case name to display name
+	itemNames     map[string]string        // Every item after the import, lower case name to display name
+	matched       map[string]map[uint]bool // Existing records each entity's rows matched
+}
+
+// menuItemRef points at an item either by id or by lower case name
+type menuItemRef struct {
+	id  uint
+	key string
+}
+
+func (r menuItemRef) resolve(ctx *menuApplyContext) uint {
+	if r.id != 0 {
+		return r.id
+	}
+	return ctx.itemIDs[r.key]
+}
+
+func nameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// archivedAt converts the archived flag of a row into the archived_at column,
+// keeping the original timestamp of records that stay archived.
+func archivedAt(archived bool, current *time.Time, now time.Time) interface{} {
+	if !archived {
+		return nil
+	}
+	if current != nil {
+		return *current
+	}
+	return now
+}
+
+// errMenuChanged is returned when the menu changed between validating a plan
+// and applying it, and the plan no longer validates
+var errMenuChanged = errors.New("menu changed while the plan was applied")
+
+// newMenuPlan loads the current menu of a cafe and validates doc against it
+func newMenuPlan(db *gorm.DB, cafeID uint, doc structures.MenuDocument, rowOffset int) (*menuPlan, error) {
+	plan := &menuPlan{
+		cafeID:           cafeID,
+		rowOffset:        rowOffset,
+		doc:              doc,
+		result:           structures.ImportMenuResponse{Changes: []structures.MenuChange{}, Errors: []structures.MenuRowError{}},
+		categoriesByID:   make(map[uint]structures.Category),
+		categoriesByName: make(map[string]structures.Category),
+		itemsByID:        make(map[uint]structures.MenuItem),
+		itemsByName:      make(map[string]structures.MenuItem),
+		groupsByID:       make(map[uint]structures.CustomizationGroup),
+		categoryNames:    make(map[string]string),
+		itemNames:        make(map[string]string),
+		matched: map[string]map[uint]bool{
+			structures.MenuEntityCategories:     {},
+			structures.MenuEntityItems:          {},
+			structures.MenuEntityCustomizations: {},
+			structures.MenuEntityCrossSells:     {},
+		},
+	}
+
+	var categories []structures.Category
+	if err := db.Where("cafe_id = ?", cafeID).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	for _, category := range categories {
+		plan.categoriesByID[category.ID] = category
+		plan.categoriesByName[nameKey(category.Name)] = category
+		plan.categoryNames[nameKey(category.Name)] = category.Name
+	}
+
+	var items []structures.MenuItem
+	if err := db.Where("cafe_id = ?", cafeID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	itemIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		plan.itemsByID[item.ID] = item
+		plan.itemsByName[nameKey(item.Name)] = item
+		plan.itemNames[nameKey(item.Name)] = item.Name
+		itemIDs = append(itemIDs, item.ID)
+	}
+
+	if len(itemIDs) > 0 {
+		if err := db.Where("menu_item_id IN (?)", itemIDs).Find(&plan.customizations).Error; err != nil {
+			return nil, err
+		}
+		var groups []structures.CustomizationGroup
+		if err := db.Where("menu_item_id IN (?)", itemIDs).Find(&groups).Error; err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			plan.groupsByID[group.ID] = group
+		}
+		if err := db.Where("base_item_id IN (?)", itemIDs).Find(&plan.crossSells).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	plan.planCategories(doc.Categories)
+	plan.planItems(doc.Items)
+	plan.checkArchivedCategories(doc.Categories, doc.Items)
+	plan.planCustomizations(doc.Customizations)
+	plan.planCrossSells(doc.CrossSells)
+
+	return plan, nil
+}
+
+func (p *menuPlan) addError(entity string, index int, field, message string) {
+	p.result.Errors = append(p.result.Errors, structures.MenuRowError{
+		Entity:  entity,
+		Row:     index + p.rowOffset,
+		Field:   field,
+		Message: message,
+	})
+}
+
+// record compares the desired columns with the existing ones and counts the
+// row. It returns false when nothing needs to be written.
+func (p *menuPlan) record(entity, key string, isNew bool, existing, desired map[string]interface{}) bool {
+	changes := make(map[string]structures.MenuFieldChange)
+	for column, value := range desired {
+		if isNew {
+			changes[column] = structures.MenuFieldChange{To: value}
+			continue
+		}
+		if fmt.Sprint(existing[column]) != fmt.Sprint(value) {
+			changes[column] = structures.MenuFieldChange{From: existing[column], To: value}
+		}
+	}
+
+	if !isNew && len(changes) == 0 {
+		p.result.Unchanged++
+		return false
+	}
+
+	action := "update"
+	if isNew {
+		action = "create"
+		p.result.Created++
+	} else {
+		p.result.Updated++
+	}
+	p.result.Changes = append(p.result.Changes, structures.MenuChange{Entity: entity, Action: action, Key: key, Changes: changes})
+	return true
+}
+
+func checkLength(p *menuPlan, entity string, index int, field, value string, max int) {
+	if len(value) > max {
+		p.addError(entity, index, field, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+func (p *menuPlan) planCategories(rows []structures.MenuCategoryRow) {
+	const entity = structures.MenuEntityCategories
+	seen := make(map[string]bool)
+
+	for i, row := range rows {
+		errorCount := len(p.result.Errors)
+		name := strings.TrimSpace(row.Name)
+		key := nameKey(name)
+
+		if name == "" {
+			p.addError(entity, i, "name", "is required")
+			continue
+		}
+		checkLength(p, entity, i, "name", name, 100)
+		if seen[key] {
+			p.addError(entity, i, "name", "appears more than once")
+		}
+		seen[key] = true
+
+		var existing *structures.Category
+		if row.ID != 0 {
+			category, ok := p.categoriesByID[row.ID]
+			if !ok {
+				p.addError(entity, i, "id", fmt.Sprintf("category %d not found", row.ID))
+				continue
+			}
+			existing = &category
+			if other, ok := p.categoriesByName[key]; ok && other.ID != category.ID {
+				p.addError(entity, i, "name", "another category already uses this name")
+			}
+		} else if category, ok := p.categoriesByName[key]; ok {
+			existing = &category
+		}
+		if len(p.result.Errors) > errorCount {
+			continue
+		}
+
+		if existing != nil {
+			p.matched[entity][existing.ID] = true
+			delete(p.categoryNames, nameKey(existing.Name))
+		}
+		p.categoryNames[key] = name
+
+		desired := map[string]interface{}{
+			"name":        name,
+			"description": row.Description,
+			"counter":     row.Counter,
+			"archived":    row.Archived,
+		}
+		var current map[string]interface{}
+		if existing != nil {
+			current = map[string]interface{}{
+				"name":        existing.Name,
+				"description": existing.Description,
+				"counter":     existing.Counter,
+				"archived":    existing.ArchivedAt != nil,
+			}
+		}
+		if !p.record(entity, name, existing == nil, current, desired) {
+			continue
+		}
+
+		row := row
+		p.steps = append(p.steps, func(tx *gorm.DB, ctx *menuApplyContext) error {
+			if existing == nil {
+				category := structures.Category{
+					CafeID:      ctx.cafeID,
+					Name:        name,
+					Description: row.Description,
+					Counter:     row.Counter,
+				}
+				if row.Archived {
+					category.ArchivedAt = &ctx.now
+				}
+				if err := tx.Create(&category).Error; err != nil {
+					return err
+				}
+				ctx.categoryIDs[key] = category.ID
+				ctx.savedIDs = append(ctx.savedIDs, category.ID)
+				return nil
+			}
+
+			if err := tx.Model(&structures.Category{}).Where("id = ?", existing.ID).Updates(map[string]interface{}{
+				"name":        name,
+				"description": row.Description,
+				"counter":     row.Counter,
+				"archived_at": archivedAt(row.Archived, existing.ArchivedAt, ctx.now),
+			}).Error; err != nil {
+				return err
+			}
+			ctx.categoryIDs[key] = existing.ID
+			ctx.savedIDs = append(ctx.savedIDs, existing.ID)
+			return nil
+		})
+	}
+}
+
+func menuItemColumns(item structures.MenuItem, categoryName string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":              item.Name,
+		"category":          categoryName,
+		"description":       item.Description,
+		"short_description": item.ShortDescription,
+		"price":             item.Price,
+		"food_type":         item.FoodType,
+		"cuisine":           string(item.Cuisine),
+		"dietary_labels":    strings.Join(helper.SplitLabels(string(item.DietaryLabels)), ", "),
+		"tags":              labelList(item.Tag),
+		"allergens":         labelList(item.Allergens),
+		"spice_level":       string(item.SpiceLevel),
+		"cm_category":       string(item.CMCategory),
+		"ingredients":       item.Ingredients,
+		"serving_size":      item.ServingSize,
+		"calories":          item.Calories,
+		"preparation_time":  item.PreparationTime,
+		"image_url":         item.ImageURL,
+		"video_url":         item.VideoUrl,
+		"available_from":    item.AvailableFrom,
+		"available_till":    item.AvailableTill,
+		"available_all_day": item.AvailableAllDay,
+		"is_available":      item.IsAvailable,
+		"is_customizable":   item.IsCustomizable,
+		"kitchen_area":      item.KitchenArea,
+		"archived":          item.ArchivedAt != nil,
+	}
+}
+
+// validateMenuItemRow reports field errors for an item row
+func (p *menuPlan) validateMenuItemRow(index int, row structures.MenuItemRow) {
+	const entity = structures.MenuEntityItems
+
+	if strings.TrimSpace(row.Name) == "" {
+		p.addError(entity, index, "name", "is required")
+	}
+	if strings.TrimSpace(row.Category) == "" {
+		p.addError(entity, index, "category", "is required")
+	} else if _, ok := p.categoryNames[nameKey(row.Category)]; !ok {
+		p.addError(entity, index, "category", fmt.Sprintf("unknown category %q", row.Category))
+	}
+	if row.Price < 0 {
+		p.addError(entity, index, "price", "cannot be negative")
+	}
+	if strings.TrimSpace(row.FoodType) == "" {
+		p.addError(entity, index, "food_type", "is required")
+	}
+	if row.Calories < 0 {
+		p.addError(entity, index, "calories", "cannot be negative")
+	}
+	if row.PreparationTime < 0 {
+		p.addError(entity, index, "preparation_time", "cannot be negative")
+	}
+	if _, err := helper.ParseItemWindow(row.AvailableFrom, row.AvailableTill, row.AvailableAllDay); err != nil {
+		p.addError(entity, index, "available_from", err.Error())
+	}
+
+	checkLength(p, entity, index, "name", strings.TrimSpace(row.Name), 100)
+	checkLength(p, entity, index, "short_description", row.ShortDescription, 255)
+	checkLength(p, entity, index, "food_type", row.FoodType, 10)
+	checkLength(p, entity, index, "cuisine", row.Cuisine, 50)
+	checkLength(p, entity, index, "dietary_labels", row.DietaryLabels, 255)
+	for _, list := range []struct{ field, value string }{
+		{"dietary_labels", row.DietaryLabels}, {"tags", row.Tags}, {"allergens", row.Allergens},
+	} {
+		for _, label := range helper.SplitLabels(list.value) {
+			checkLength(p, entity, index, list.field, label, 100)
+		}
+	}
+	checkLength(p, entity, index, "spice_level", row.SpiceLevel, 20)
+	checkLength(p, entity, index, "cm_category", row.CMCategory, 50)
+	checkLength(p, entity, index, "serving_size", row.ServingSize, 50)
+	checkLength(p, entity, index, "image_url", row.ImageURL, 255)
+	checkLength(p, entity, index, "video_url", row.VideoURL, 255)
+	checkLength(p, entity, index, "available_from", row.AvailableFrom, 255)
+	checkLength(p, entity, index, "available_till", row.AvailableTill, 255)
+	checkLength(p, entity, index, "kitchen_area", row.KitchenArea, 255)
+}
+
+func (p *menuPlan) planItems(rows []structures.MenuItemRow) {
+	const entity = structures.MenuEntityItems
+	seen := make(map[string]bool)
+
+	for i, row := range rows {
+		errorCount := len(p.result.Errors)
+		name := strings.TrimSpace(row.Name)
+		key := nameKey(name)
+
+		p.validateMenuItemRow(i, row)
+		if name != "" && seen[key] {
+			p.addError(entity, i, "name", "appears more than once")
+		}
+		seen[key] = true
+
+		var existing *structures.MenuItem
+		if row.ID != 0 {
+			item, ok := p.itemsByID[row.ID]
+			if !ok {
+				p.addError(entity, i, "id", fmt.Sprintf("item %d not found", row.ID))
+				continue
+			}
+			existing = &item
+			if other, ok := p.itemsByName[key]; ok && other.ID != item.ID {
+				p.addError(entity, i, "name", "another item already uses this name")
+			}
+		} else if item, ok := p.itemsByName[key]; ok {
+			existing = &item
+		}
+		if len(p.result.Errors) > errorCount {
+			continue
+		}
+
+		if existing != nil {
+			p.matched[entity][existing.ID] = true
+			delete(p.itemNames, nameKey(existing.Name))
+		}
+		p.itemNames[key] = name
+
+		categoryKey := nameKey(row.Category)
+		categoryName := p.categoryNames[categoryKey]
+
+		isAvailable := true
+		if row.IsAvailable != nil {
+			isAvailable = *row.IsAvailable
+		} else if existing != nil {
+			isAvailable = existing.IsAvailable
+		}
+
+		desiredItem := structures.MenuItem{
+			Name:             name,
+			Description:      row.Description,
+			ShortDescription: row.ShortDescription,
+			Price:            row.Price,
+			FoodType:         strings.TrimSpace(row.FoodType),
+			Cuisine:          structures.Cuisine(row.Cuisine),
+			DietaryLabels:    structures.DietaryLabel(strings.Join(helper.SplitLabels(row.DietaryLabels), ", ")),
+			Tag:              labelJSON(row.Tags),
+			Allergens:        labelJSON(row.Allergens),
+			SpiceLevel:       structures.SpiceLevel(row.SpiceLevel),
+			CMCategory:       structures.CMCategory(row.CMCategory),
+			Ingredients:      row.Ingredients,
+			ServingSize:      row.ServingSize,
+			Calories:         row.Calories,
+			PreparationTime:  row.PreparationTime,
+			ImageURL:         row.ImageURL,
+			VideoUrl:         row.VideoURL,
+			AvailableFrom:    row.AvailableFrom,
+			AvailableTill:    row.AvailableTill,
+			AvailableAllDay:  row.AvailableAllDay,
+			IsAvailable:      isAvailable,
+			IsCustomizable:   row.IsCustomizable,
+			KitchenArea:      row.KitchenArea,
+		}
+		desired := menuItemColumns(desiredItem, categoryName)
+		desired["archived"] = row.Archived
+
+		var current map[string]interface{}
+		if existing != nil {
+			currentCategory := existing.Category
+			if category, ok := p.categoriesByID[existing.CategoryID]; ok {
+				currentCategory = category.Name
+			}
+			current = menuItemColumns(*existing, currentCategory)
+		}
+		if !p.record(entity, name, existing == nil, current, desired) {
+			continue
+		}
+
+		archived := row.Archived
+		p.steps = append(p.steps, func(tx *gorm.DB, ctx *menuApplyContext) error {
+			columns := map[string]interface{}{
+				"name":              desiredItem.Name,
+				"category":          categoryName,
+				"category_id":       ctx.categoryIDs[categoryKey],
+				"description":       desiredItem.Description,
+				"short_description": desiredItem.ShortDescription,
+				"price":             desiredItem.Price,
+				"food_type":         desiredItem.FoodType,
+				"cuisine":           desiredItem.Cuisine,
+				"dietary_labels":    desiredItem.DietaryLabels,
+				"tag":               desiredItem.Tag,
+				"allergens":         desiredItem.Allergens,
+				"spice_level":       desiredItem.SpiceLevel,
+				"cm_category":       desiredItem.CMCategory,
+				"ingredients":       desiredItem.Ingredients,
+				"serving_size":      desiredItem.ServingSize,
+				"calories":          desiredItem.Calories,
+				"preparation_time":  desiredItem.PreparationTime,
+				"image_url":         desiredItem.ImageURL,
+				"video_url":         desiredItem.VideoUrl,
+				"available_from":    desiredItem.AvailableFrom,
+				"available_till":    desiredItem.AvailableTill,
+				"available_all_day": desiredItem.AvailableAllDay,
+				"is_available":      desiredItem.IsAvailable,
+				"is_customizable":   desiredItem.IsCustomizable,
+				"kitchen_area":      desiredItem.KitchenArea,
+			}
+
+			if existing == nil {
+				item := desiredItem
+				item.CafeID = ctx.cafeID
+				item.Category = categoryName
+				item.CategoryID = ctx.categoryIDs[categoryKey]
+				if archived {
+					item.ArchivedAt = &ctx.now
+				}
+				if err := tx.Create(&item).Error; err != nil {
+					return err
+				}
+				// gorm skips zero values on create, so write the flags explicitly
+				if err := tx.Model(&structures.MenuItem{}).Where("id = ?", item.ID).
+					Updates(map[string]interface{}{"is_available": desiredItem.IsAvailable}).Error; err != nil {
+					return err
+				}
+				ctx.itemIDs[key] = item.ID
+				ctx.savedIDs = append(ctx.savedIDs, item.ID)
+				return nil
+			}
+
+			columns["archived_at"] = archivedAt(archived, existing.ArchivedAt, ctx.now)
+			if err := tx.Model(&structures.MenuItem{}).Where("id = ?", existing.ID).Updates(columns).Error; err != nil {
+				return err
+			}
+			ctx.itemIDs[key] = existing.ID
+			ctx.savedIDs = append(ctx.savedIDs, existing.ID)
+			return nil
+		})
+	}
+}
+
+// checkArchivedCategories rejects archiving a category that would still hold
+// items customers can see.
+func (p *menuPlan) checkArchivedCategories(categories []structures.MenuCategoryRow, items []structures.MenuItemRow) {
+	// Category and archived state of every item once the import is applied
+	type itemState struct {
+		category string
+		archived bool
+	}
+	final := make(map[string]itemState)
+	for key, item := range p.itemsByName {
+		category := nameKey(item.Category)
+		if existing, ok := p.categoriesByID[item.CategoryID]; ok {
+			category = nameKey(existing.Name)
+		}
+		final[key] = itemState{category: category, archived: item.ArchivedAt != nil}
+	}
+	for _, row := range items {
+		if row.ID != 0 {
+			if item, ok := p.itemsByID[row.ID]; ok {
+				delete(final, nameKey(item.Name))
+			}
+		}
+		final[nameKey(row.Name)] = itemState{category: nameKey(row.Category), archived: row.Archived}
+	}
+
+	for i, row := range categories {
+		if !row.Archived {
+			continue
+		}
+		key := nameKey(row.Name)
+		if row.ID != 0 {
+			if category, ok := p.categoriesByID[row.ID]; ok {
+				key = nameKey(category.Name)
+			}
+		}
+		for _, state := range final {
+			if (state.category == key || state.category == nameKey(row.Name)) && !state.archived {
+				p.addError(structures.MenuEntityCategories, i, "archived", "category still has items that are not archived")
+				break
+			}
+		}
+	}
+}
+
+// resolveItemRef finds an item by id or name, returning its ref and display name
+func (p *menuPlan) resolveItemRef(entity string, index int, field string, id uint, name string) (menuItemRef, string, bool) {
+	if id != 0 {
+		item, ok := p.itemsByID[id]
+		if !ok {
+			p.addError(entity, index, field, fmt.Sprintf("item %d not found", id))
+			return menuItemRef{}, "", false
+		}
+		return menuItemRef{id: id}, item.Name, true
+	}
+
+	key := nameKey(name)
+	if key == "" {
+		p.addError(entity, index, field, "is required")
+		return menuItemRef{}, "", false
+	}
+	display, ok := p.itemNames[key]
+	if !ok {
+		if item, found := p.itemsByName[key]; found {
+			return menuItemRef{id: item.ID}, item.Name, true
+		}
+		p.addError(entity, index, field, fmt.Sprintf("unknown item %q", name))
+		return menuItemRef{}, "", false
+	}
+	if item, found := p.itemsByName[key]; found {
+		return menuItemRef{id: item.ID}, display, true
+	}
+	return menuItemRef{key: key}, display, true
+}
+
+func (p *menuPlan) planCustomizations(rows []structures.MenuCustomizationRow) {
+	const entity = structures.MenuEntityCustomizations
+	seen := make(map[string]bool)
+
+	for i, row := range rows {
+		errorCount := len(p.result.Errors)
+		ref, itemName, ok := p.resolveItemRef(entity, i, "item", row.MenuItemID, row.Item)
+		customizationType := strings.TrimSpace(row.Type)
+		option := strings.TrimSpace(row.Option)
+
+		var groupID *uint
+		if row.GroupID != 0 {
+			group, found := p.groupsByID[row.GroupID]
+			switch {
+			case !found || group.ArchivedAt != nil:
+				p.addError(entity, i, "group_id", fmt.Sprintf("group %d not found", row.GroupID))
+			case !ok || group.MenuItemID != ref.id:
+				p.addError(entity, i, "group_id", "group belongs to another item")
+			default:
+				customizationType = group.Name
+				groupID = &group.ID
+			}
+		} else if ok && ref.id != 0 {
+			// Options listed by type go into the group of that name
+			for _, group := range p.groupsByID {
+				if group.MenuItemID == ref.id && group.ArchivedAt == nil && strings.EqualFold(group.Name, customizationType) {
+					customizationType = group.Name
+					groupID = &group.ID
+					break
+				}
+			}
+		}
+
+		if customizationType == "" {
+			p.addError(entity, i, "type", "is required")
+		}
+		if option == "" {
+			p.addError(entity, i, "option", "is required")
+		}
+		checkLength(p, entity, i, "type", customizationType, 50)
+		checkLength(p, entity, i, "option", option, 50)
+		if row.AdditionalCost < 0 {
+			p.addError(entity, i, "additional_cost", "cannot be negative")
+		}
+		if !ok || len(p.result.Errors) > errorCount {
+			continue
+		}
+
+		key := fmt.Sprintf("%s / %s / %s", itemName, customizationType, option)
+		if seen[strings.ToLower(key)] {
+			p.addError(entity, i, "option", "appears more than once")
+			continue
+		}
+		seen[strings.ToLower(key)] = true
+
+		var existing *structures.ItemCustomization
+		for j := range p.customizations {
+			customization := p.customizations[j]
+			if row.ID != 0 {
+				if customization.ID == row.ID {
+					existing = &customization
+					break
+				}
+				continue
+			}
+			if ref.id != 0 && customization.MenuItemID == ref.id &&
+				strings.EqualFold(customization.CustomizationType, customizationType) &&
+				strings.EqualFold(customization.OptionName, option) {
+				existing = &customization
+				break
+			}
+		}
+		if row.ID != 0 && existing == nil {
+			p.addError(entity, i, "id", fmt.Sprintf("customization %d not found", row.ID))
+			continue
+		}
+		if existing != nil {
+			p.matched[entity][existing.ID] = true
+		}
+
+		isAvailable := true
+		if row.IsAvailable != nil {
+			isAvailable = *row.IsAvailable
+		} else if existing != nil {
+			isAvailable = existing.IsAvailable
+		}
+
+		var desiredGroup uint
+		if groupID != nil {
+			desiredGroup = *groupID
+		}
+		desired := map[string]interface{}{
+			"item":            itemName,
+			"group_id":        desiredGroup,
+			"type":            customizationType,
+			"option":          option,
+			"additional_cost": row.AdditionalCost,
+			"priority":        row.Priority,
+			"is_default":      row.IsDefault,
+			"is_available":    isAvailable,
+			"archived":        row.Archived,
+		}
+		var current map[string]interface{}
+		if existing != nil {
+			var currentGroup uint
+			if existing.GroupID != nil {
+				currentGroup = *existing.GroupID
+			}
+			current = map[string]interface{}{
+				"item":            p.itemsByID[existing.MenuItemID].Name,
+				"group_id":        currentGroup,
+				"type":            existing.CustomizationType,
+				"option":          existing.OptionName,
+				"additional_cost": existing.AdditionalCost,
+				"priority":        existing.Priority,
+				"is_default":      existing.IsDefault,
+				"is_available":    existing.IsAvailable,
+				"archived":        existing.ArchivedAt != nil,
+			}
+		}
+		if !p.record(entity, key, existing == nil, current, desired) {
+			continue
+		}
+
+		row := row
+		p.steps = append(p.steps, func(tx *gorm.DB, ctx *menuApplyContext) error {
+			groupID := groupID
+			if groupID == nil {
+				var err error
+				if groupID, err = customizationGroupForType(tx, ref.resolve(ctx), customizationType); err != nil {
+					return err
+				}
+			}
+
+			if existing == nil {
+				customization := structures.ItemCustomization{
+					MenuItemID:        ref.resolve(ctx),
+					CustomizationType: customizationType,
+					OptionName:        option,
+					AdditionalCost:    row.AdditionalCost,
+					Priority:          row.Priority,
+					GroupID:           groupID,
+					IsDefault:         row.IsDefault,
+				}
+				if row.Archived {
+					customization.ArchivedAt = &ctx.now
+				}
+				if err := tx.Create(&customization).Error; err != nil {
+					return err
+				}
+				// gorm skips zero values on create, so write the flag explicitly
+				if err := tx.Model(&structures.ItemCustomization{}).Where("id = ?", customization.ID).
+					Updates(map[string]interface{}{"is_available": isAvailable}).Error; err != nil {
+					return err
+				}
+				ctx.savedIDs = append(ctx.savedIDs, customization.ID)
+				return nil
+			}
+
+			ctx.savedIDs = append(ctx.savedIDs, existing.ID)
+			return tx.Model(&structures.ItemCustomization{}).Where("id = ?", existing.ID).Updates(map[string]interface{}{
+				"menu_item_id":       ref.resolve(ctx),
+				"group_id":           groupID,
+				"customization_type": customizationType,
+				"option_name":        option,
+				"additional_cost":    row.AdditionalCost,
+				"priority":           row.Priority,
+				"is_default":         row.IsDefault,
+				"is_available":       isAvailable,
+				"archived_at":        archivedAt(row.Archived, existing.ArchivedAt, ctx.now),
+			}).Error
+		})
+	}
+}
+
+func (p *menuPlan) planCrossSells(rows []structures.MenuCrossSellRow) {
+	const entity = structures.MenuEntityCrossSells
+	seen := make(map[string]bool)
+
+	for i, row := range rows {
+		errorCount := len(p.result.Errors)
+		baseRef, baseName, baseOK := p.resolveItemRef(entity, i, "base_item", row.BaseItemID, row.BaseItem)
+		crossRef, crossName, crossOK := p.resolveItemRef(entity, i, "cross_sell_item", row.CrossSellItemID, row.CrossSellItem)
+		if !baseOK || !crossOK {
+			continue
+		}
+		if strings.EqualFold(baseName, crossName) {
+			p.addError(entity, i, "cross_sell_item", "cannot be the same as base_item")
+		}
+		checkLength(p, entity, i, "category", row.Category, 100)
+		if len(p.result.Errors) > errorCount {
+			continue
+		}
+
+		key := fmt.Sprintf("%s -> %s", baseName, crossName)
+		if seen[strings.ToLower(key)] {
+			p.addError(entity, i, "cross_sell_item", "pair appears more than once")
+			continue
+		}
+		seen[strings.ToLower(key)] = true
+
+		var existing *structures.CrossSell
+		for j := range p.crossSells {
+			crossSell := p.crossSells[j]
+			if row.ID != 0 {
+				if crossSell.ID == row.ID {
+					existing = &crossSell
+					break
+				}
+				continue
+			}
+			if baseRef.id != 0 && crossRef.id != 0 && crossSell.BaseItemID == baseRef.id && crossSell.CrossSellItemID == crossRef.id {
+				existing = &crossSell
+				break
+			}
+		}
+		if row.ID != 0 && existing == nil {
+			p.addError(entity, i, "id", fmt.Sprintf("cross sell %d not found", row.ID))
+			continue
+		}
+		if existing != nil {
+			p.matched[entity][existing.ID] = true
+		}
+
+		desired := map[string]interface{}{
+			"base_item":       baseName,
+			"cross_sell_item": crossName,
+			"category":        row.Category,
+			"priority":        row.Priority,
+			"description":     row.Description,
+			"archived":        row.Archived,
+		}
+		var current map[string]interface{}
+		if existing != nil {
+			current = map[string]interface{}{
+				"base_item":       p.itemsByID[existing.BaseItemID].Name,
+				"cross_sell_item": p.itemsByID[existing.CrossSellItemID].Name,
+				"category":        existing.CrossSellCategory,
+				"priority":        existing.Priority,
+				"description":     existing.Description,
+				"archived":        existing.ArchivedAt != nil,
+			}
+		}
+		if !p.record(entity, key, existing == nil, current, desired) {
+			continue
+		}
+
+		row := row
+		p.steps = append(p.steps, func(tx *gorm.DB, ctx *menuApplyContext) error {
+			if existing == nil {
+				crossSell := structures.CrossSell{
+					BaseItemID:        baseRef.resolve(ctx),
+					CrossSellItemID:   crossRef.resolve(ctx),
+					CrossSellCategory: row.Category,
+					Priority:          row.Priority,
+					Description:       row.Description,
+				}
+				if row.Archived {
+					crossSell.ArchivedAt = &ctx.now
+				}
+				if err := tx.Create(&crossSell).Error; err != nil {
+					return err
+				}
+				ctx.savedIDs = append(ctx.savedIDs, crossSell.ID)
+				return nil
+			}
+
+			ctx.savedIDs = append(ctx.savedIDs, existing.ID)
+			return tx.Model(&structures.CrossSell{}).Where("id = ?", existing.ID).Updates(map[string]interface{}{
+				"base_item_id":        baseRef.resolve(ctx),
+				"cross_sell_item_id":  crossRef.resolve(ctx),
+				"cross_sell_category": row.Category,
+				"priority":            row.Priority,
+				"description":         row.Description,
+				"archived_at":         archivedAt(row.Archived, existing.ArchivedAt, ctx.now),
+			}).Error
+		})
+	}
+}
+
+// archiveUnlisted archives every record of the cafe that doc does not
+// mention, so applying the plan replaces the whole menu. Categories still used
+// by an item of doc are kept.
+func (p *menuPlan) archiveUnlisted(doc structures.MenuDocument) {
+	p.archivesUnlisted = true
+	usedCategories := make(map[string]bool)
+	for _, row := range doc.Items {
+		if !row.Archived {
+			usedCategories[nameKey(row.Category)] = true
+		}
+	}
+
+	archive := func(entity, key, table string, id uint) {
+		p.record(entity, key, false, map[string]interface{}{"archived": false}, map[string]interface{}{"archived": true})
+		p.steps = append(p.steps, func(tx *gorm.DB, ctx *menuApplyContext) error {
+			return tx.Table(table).Where("id = ?", id).Updates(map[string]interface{}{
+				"archived_at": ctx.now,
+				"updated_at":  ctx.now,
+			}).Error
+		})
+	}
+
+	categoryIDs := make([]uint, 0, len(p.categoriesByID))
+	for id := range p.categoriesByID {
+		categoryIDs = append(categoryIDs, id)
+	}
+	sort.Slice(categoryIDs, func(i, j int) bool { return categoryIDs[i] < categoryIDs[j] })
+	for _, id := range categoryIDs {
+		category := p.categoriesByID[id]
+		if p.matched[structures.MenuEntityCategories][id] || category.ArchivedAt != nil || usedCategories[nameKey(category.Name)] {
+			continue
+		}
+		archive(structures.MenuEntityCategories, category.Name, "categories", id)
+	}
+
+	itemIDs := make([]uint, 0, len(p.itemsByID))
+	for id := range p.itemsByID {
+		itemIDs = append(itemIDs, id)
+	}
+	sort.Slice(itemIDs, func(i, j int) bool { return itemIDs[i] < itemIDs[j] })
+	for _, id := range itemIDs {
+		item := p.itemsByID[id]
+		if p.matched[structures.MenuEntityItems][id] || item.ArchivedAt != nil {
+			continue
+		}
+		archive(structures.MenuEntityItems, item.Name, "menu_items", id)
+	}
+
+	for _, customization := range p.customizations {
+		if p.matched[structures.MenuEntityCustomizations][customization.ID] || customization.ArchivedAt != nil {
+			continue
+		}
+		key := fmt.Sprintf("%s / %s / %s", p.itemsByID[customization.MenuItemID].Name, customization.CustomizationType, customization.OptionName)
+		archive(structures.MenuEntityCustomizations, key, "item_customizations", customization.ID)
+	}
+
+	for _, crossSell := range p.crossSells {
+		if p.matched[structures.MenuEntityCrossSells][crossSell.ID] || crossSell.ArchivedAt != nil {
+			continue
+		}
+		key := fmt.Sprintf("%s -> %s", p.itemsByID[crossSell.BaseItemID].Name, p.itemsByID[crossSell.CrossSellItemID].Name)
+		archive(structures.MenuEntityCrossSells, key, "cross_sells", crossSell.ID)
+	}
+}
+
+// applyMenuPlan writes every step of the plan in one transaction and records
+// the resulting item prices and labels. Imports for the same cafe are
+// serialized with an advisory lock, and the plan is rebuilt once the lock is
+// held so it never applies a diff against a stale menu. The rebuilt plan
+// replaces *plan; errMenuChanged means it no longer validates. When version
+// is set it becomes the published menu version.
+func (s *Server) applyMenuPlan(plan *menuPlan, version *structures.MenuVersion) (*menuApplyContext, error) {
+	tx := s.Db.Begin()
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", int64(plan.cafeID)).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	fresh, err := newMenuPlan(tx, plan.cafeID, plan.doc, plan.rowOffset)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if plan.archivesUnlisted {
+		fresh.archiveUnlisted(plan.doc)
+	}
+	*plan = *fresh
+	if len(plan.result.Errors) > 0 {
+		tx.Rollback()
+		return nil, errMenuChanged
+	}
+
+	ctx := &menuApplyContext{
+		cafeID:      plan.cafeID,
+		now:         time.Now(),
+		categoryIDs: make(map[string]uint),
+		itemIDs:     make(map[string]uint),
+	}
+	for key, category := range plan.categoriesByName {
+		ctx.categoryIDs[key] = category.ID
+	}
+	for key, item := range plan.itemsByName {
+		ctx.itemIDs[key] = item.ID
+	}
+
+	for _, step := range plan.steps {
+		if err := step(tx, ctx); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	var versionID *uint
+	if version != nil {
+		versionID = &version.ID
+		if err := markVersionPublished(tx, *version, ctx.now); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := recordPriceSnapshots(tx, plan.cafeID, versionID, ctx.now); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := syncMenuLabels(tx, plan.cafeID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := invalidateMenuCache(tx, plan.cafeID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
+}
+
+func (s *Server) ImportMenu(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.ImportMenuRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var doc structures.MenuDocument
+	var cellErrors []structures.MenuRowError
+	rowOffset := 1
+
+	switch strings.ToLower(req.Format) {
+	case "", "json":
+		if req.Menu != nil {
+			doc = *req.Menu
+		} else if err := json.Unmarshal([]byte(req.Content), &doc); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid JSON menu: " + err.Error(),
+			})
+		}
+	case "csv":
+		// Row numbers match the line numbers of the file, after the header
+		rowOffset = 2
+
+		var target interface{}
+		switch req.Entity {
+		case structures.MenuEntityCategories:
+			target = &doc.Categories
+		case structures.MenuEntityItems:
+			target = &doc.Items
+		case structures.MenuEntityCustomizations:
+			target = &doc.Customizations
+		case structures.MenuEntityCrossSells:
+			target = &doc.CrossSells
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "entity must be one of categories, items, customizations or cross_sells",
+			})
+		}
+
+		errs, err := helper.UnmarshalCSV([]byte(req.Content), target)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid CSV: " + err.Error(),
+			})
+		}
+		for _, cellError := range errs {
+			cellErrors = append(cellErrors, structures.MenuRowError{
+				Entity:  req.Entity,
+				Row:     cellError.Row,
+				Field:   cellError.Column,
+				Message: cellError.Message,
+			})
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be json or csv",
+		})
+	}
+
+	plan, err := newMenuPlan(s.Db, cafeId, doc, rowOffset)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load menu",
+		})
+	}
+	plan.result.Errors = append(cellErrors, plan.result.Errors...)
+	plan.result.DryRun = req.DryRun
+
+	if len(plan.result.Errors) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(plan.result)
+	}
+	if req.DryRun || len(plan.steps) == 0 {
+		return c.Status(fiber.StatusOK).JSON(plan.result)
+	}
+
+	if _, err := s.applyMenuPlan(plan, nil); err != nil {
+		if errors.Is(err, errMenuChanged) {
+			return c.Status(fiber.StatusConflict).JSON(plan.result)
+		}
+		fmt.Println("Failed to import menu:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to import menu, no changes were applied",
+		})
+	}
+
+	plan.result.Applied = true
+	return c.Status(fiber.StatusOK).JSON(plan.result)
+}
+
+// exportMenuDocument builds the portable menu of a cafe, archived rows included
+func (s *Server) exportMenuDocument(cafeID uint) (structures.MenuDocument, error) {
+	doc := structures.MenuDocument{
+		Categories:     []structures.MenuCategoryRow{},
+		Items:          []structures.MenuItemRow{},
+		Customizations: []structures.MenuCustomizationRow{},
+		CrossSells:     []structures.MenuCrossSellRow{},
+	}
+
+	var categories []structures.Category
+	if err := s.Db.Where("cafe_id = ?", cafeID).Order("counter ASC, name ASC").Find(&categories).Error; err != nil {
+		return doc, err
+	}
+	categoryNames := make(map[uint]string)
+	for _, category := range categories {
+		categoryNames[category.ID] = category.Name
+		doc.Categories = append(doc.Categories, structures.MenuCategoryRow{
+			ID:          category.ID,
+			Name:        category.Name,
+			Description: category.Description,
+			Counter:     category.Counter,
+			Archived:    category.ArchivedAt != nil,
+		})
+	}
+
+	var items []structures.MenuItem
+	if err := s.Db.Where("cafe_id = ?", cafeID).Order("category ASC, name ASC").Find(&items).Error; err != nil {
+		return doc, err
+	}
+	itemNames := make(map[uint]string)
+	itemIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		itemNames[item.ID] = item.Name
+		itemIDs = append(itemIDs, item.ID)
+
+		category := item.Category
+		if name, ok := categoryNames[item.CategoryID]; ok {
+			category = name
+		}
+		isAvailable := item.IsAvailable
+		doc.Items = append(doc.Items, structures.MenuItemRow{
+			ID:               item.ID,
+			Name:             item.Name,
+			Category:         category,
+			Description:      item.Description,
+			ShortDescription: item.ShortDescription,
+			Price:            item.Price,
+			FoodType:         item.FoodType,
+			Cuisine:          string(item.Cuisine),
+			DietaryLabels:    string(item.DietaryLabels),
+			Tags:             labelList(item.Tag),
+			Allergens:        labelList(item.Allergens),
+			SpiceLevel:       string(item.SpiceLevel),
+			CMCategory:       string(item.CMCategory),
+			Ingredients:      item.Ingredients,
+			ServingSize:      item.ServingSize,
+			Calories:         item.Calories,
+			PreparationTime:  item.PreparationTime,
+			ImageURL:         item.ImageURL,
+			VideoURL:         item.VideoUrl,
+			AvailableFrom:    item.AvailableFrom,
+			AvailableTill:    item.AvailableTill,
+			AvailableAllDay:  item.AvailableAllDay,
+			IsAvailable:      &isAvailable,
+			IsCustomizable:   item.IsCustomizable,
+			KitchenArea:      item.KitchenArea,
+			Archived:         item.ArchivedAt != nil,
+		})
+	}
+
+	if len(itemIDs) == 0 {
+		return doc, nil
+	}
+
+	var customizations []structures.ItemCustomization
+	if err := s.Db.Where("menu_item_id IN (?)", itemIDs).Order("menu_item_id ASC, priority ASC, id ASC").Find(&customizations).Error; err != nil {
+		return doc, err
+	}
+	for _, customization := range customizations {
+		var groupID uint
+		if customization.GroupID != nil {
+			groupID = *customization.GroupID
+		}
+		isAvailable := customization.IsAvailable
+		doc.Customizations = append(doc.Customizations, structures.MenuCustomizationRow{
+			ID:             customization.ID,
+			MenuItemID:     customization.MenuItemID,
+			Item:           itemNames[customization.MenuItemID],
+			GroupID:        groupID,
+			Type:           customization.CustomizationType,
+			Option:         customization.OptionName,
+			AdditionalCost: customization.AdditionalCost,
+			Priority:       customization.Priority,
+			IsDefault:      customization.IsDefault,
+			IsAvailable:    &isAvailable,
+			Archived:       customization.ArchivedAt != nil,
+		})
+	}
+
+	var crossSells []structures.CrossSell
+	if err := s.Db.Where("base_item_id IN (?)", itemIDs).Order("base_item_id ASC, priority DESC, id ASC").Find(&crossSells).Error; err != nil {
+		return doc, err
+	}
+	for _, crossSell := range crossSells {
+		doc.CrossSells = append(doc.CrossSells, structures.MenuCrossSellRow{
+			ID:              crossSell.ID,
+			BaseItemID:      crossSell.BaseItemID,
+			BaseItem:        itemNames[crossSell.BaseItemID],
+			CrossSellItemID: crossSell.CrossSellItemID,
+			CrossSellItem:   itemNames[crossSell.CrossSellItemID],
+			Category:        crossSell.CrossSellCategory,
+			Priority:        crossSell.Priority,
+			Description:     crossSell.Description,
+			Archived:        crossSell.ArchivedAt != nil,
+		})
+	}
+
+	return doc, nil
+}
+
+func (s *Server) ExportMenu(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	doc, err := s.exportMenuDocument(cafeId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to export menu",
+		})
+	}
+
+	switch strings.ToLower(c.Query("format", "json")) {
+	case "json":
+		return c.Status(fiber.StatusOK).JSON(doc)
+	case "csv":
+		var rows interface{}
+		entity := c.Query("entity", structures.MenuEntityItems)
+		switch entity {
+		case structures.MenuEntityCategories:
+			rows = doc.Categories
+		case structures.MenuEntityItems:
+			rows = doc.Items
+		case structures.MenuEntityCustomizations:
+			rows = doc.Customizations
+		case structures.MenuEntityCrossSells:
+			rows = doc.CrossSells
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "entity must be one of categories, items, customizations or cross_sells",
+			})
+		}
+
+		content, err := helper.MarshalCSV(rows)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to export menu",
+			})
+		}
+
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="menu-%d-%s.csv"`, cafeId, entity))
+		return c.Status(fiber.StatusOK).Send(content)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be json or csv",
+		})
+	}
+}
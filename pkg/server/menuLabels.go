@@ -0,0 +1,198 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+	"gorm.io/datatypes"
+)
+
+// itemLabelSource lists the labels of every menu item in scope as read from
+// the dietary_labels, tag and allergens columns. Veg items are vegetarian.
+// Each branch takes the cafe id twice, 0 means every cafe.
+const itemLabelSource = `
+WITH item_labels AS (
+	SELECT m.id AS menu_item_id, 'dietary' AS kind, left(lower(trim(v.name)), 100) AS name
+	FROM menu_items m, regexp_split_to_table(COALESCE(m.dietary_labels, ''), ',') AS v(name)
+	WHERE (? = 0 OR m.cafe_id = ?)
+	UNION
+	SELECT m.id, 'dietary', 'vegetarian'
+	FROM menu_items m
+	WHERE lower(trim(m.food_type)) = 'veg' AND (? = 0 OR m.cafe_id = ?)
+	UNION
+	SELECT m.id, 'tag', left(lower(trim(v.name)), 100)
+	FROM menu_items m, jsonb_array_elements_text(CASE WHEN jsonb_typeof(m.tag) = 'array' THEN m.tag ELSE '[]'::jsonb END) AS v(name)
+	WHERE (? = 0 OR m.cafe_id = ?)
+	UNION
+	SELECT m.id, 'allergen', left(lower(trim(v.name)), 100)
+	FROM menu_items m, jsonb_array_elements_text(CASE WHEN jsonb_typeof(m.allergens) = 'array' THEN m.allergens ELSE '[]'::jsonb END) AS v(name)
+	WHERE (? = 0 OR m.cafe_id = ?)
+)
+`
+
+// syncMenuLabels rebuilds the label links of every item of a cafe from its
+// columns. A cafe id of 0 rebuilds every cafe.
+func syncMenuLabels(tx *gorm.DB, cafeID uint) error {
+	sourceArgs := []interface{}{cafeID, cafeID, cafeID, cafeID, cafeID, cafeID, cafeID, cafeID}
+
+	if err := tx.Exec(itemLabelSource+`
+		INSERT INTO labels (kind, name, created_at)
+		SELECT DISTINCT kind, name, NOW() FROM item_labels WHERE name <> ''
+		ON CONFLICT (kind, name) DO NOTHING`, sourceArgs...).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Exec(`DELETE FROM menu_item_labels
+		WHERE menu_item_id IN (SELECT id FROM menu_items WHERE (? = 0 OR cafe_id = ?))`, cafeID, cafeID).Error; err != nil {
+		return err
+	}
+
+	return tx.Exec(itemLabelSource+`
+		INSERT INTO menu_item_labels (menu_item_id, label_id)
+		SELECT DISTINCT il.menu_item_id, l.id
+		FROM item_labels il
+		JOIN labels l ON l.kind = il.kind AND l.name = il.name
+		ON CONFLICT DO NOTHING`, sourceArgs...).Error
+}
+
+const itemLabelExists = `EXISTS (SELECT 1 FROM menu_item_labels mil JOIN labels l ON l.id = mil.label_id
+	WHERE mil.menu_item_id = menu_items.id AND l.kind = ? AND l.name IN (?))`
+
+func normalizeLabels(names []string) []string {
+	var normalized []string
+	for _, name := range names {
+		if name = helper.NormalizeLabel(name); name != "" {
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized
+}
+
+// withLabels keeps the menu items that carry every one of the labels. A
+// dietary label is also met by a stricter label, vegan items are vegetarian.
+func withLabels(query *gorm.DB, kind structures.LabelKind, names []string) *gorm.DB {
+	for _, name := range normalizeLabels(names) {
+		candidates := []string{name}
+		if kind == structures.LabelDietary {
+			candidates = helper.LabelsSatisfying(name)
+		}
+		query = query.Where(itemLabelExists, kind, candidates)
+	}
+	return query
+}
+
+// withoutLabels drops the menu items that carry any of the labels
+func withoutLabels(query *gorm.DB, kind structures.LabelKind, names []string) *gorm.DB {
+	normalized := normalizeLabels(names)
+	if len(normalized) == 0 {
+		return query
+	}
+	return query.Where("NOT "+itemLabelExists, kind, normalized)
+}
+
+// itemLabels are the labels of one menu item grouped by kind
+type itemLabels struct {
+	Dietary   []string
+	Tags      []string
+	Allergens []string
+}
+
+// loadItemLabels reads the labels of the menu items matching the condition on
+// menu_items m. Matching items without labels get an empty entry.
+func (s *Server) loadItemLabels(condition string, args ...interface{}) (map[uint]*itemLabels, error) {
+	var rows []struct {
+		MenuItemID uint
+		Kind       structures.LabelKind
+		Name       string
+	}
+	if err := s.Db.Table("menu_items m").
+		Select("m.id AS menu_item_id, COALESCE(l.kind, '') AS kind, COALESCE(l.name, '') AS name").
+		Joins("LEFT JOIN menu_item_labels mil ON mil.menu_item_id = m.id").
+		Joins("LEFT JOIN labels l ON l.id = mil.label_id").
+		Where(condition, args...).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	labels := make(map[uint]*itemLabels)
+	for _, row := range rows {
+		item, ok := labels[row.MenuItemID]
+		if !ok {
+			item = &itemLabels{}
+			labels[row.MenuItemID] = item
+		}
+		switch row.Kind {
+		case structures.LabelDietary:
+			item.Dietary = append(item.Dietary, row.Name)
+		case structures.LabelTag:
+			item.Tags = append(item.Tags, row.Name)
+		case structures.LabelAllergen:
+			item.Allergens = append(item.Allergens, row.Name)
+		}
+	}
+	return labels, nil
+}
+
+// labelJSON stores a comma separated list as the jsonb array kept on menu items
+func labelJSON(value string) datatypes.JSON {
+	labels := helper.SplitLabels(value)
+	if labels == nil {
+		labels = []string{}
+	}
+	encoded, _ := json.Marshal(labels)
+	return datatypes.JSON(encoded)
+}
+
+// labelList reads a jsonb array of labels back as a comma separated list
+func labelList(raw datatypes.JSON) string {
+	var labels []string
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &labels); err != nil {
+			return ""
+		}
+	}
+	return strings.Join(normalizeLabels(labels), ", ")
+}
+
+// migrateMenuLabels widens dietary_labels to hold several labels and builds
+// the label links of every menu item from the existing columns
+func migrateMenuLabels(tx *gorm.DB) error {
+	if err := tx.Exec("ALTER TABLE menu_items ALTER COLUMN dietary_labels TYPE varchar(255)").Error; err != nil {
+		return err
+	}
+	return syncMenuLabels(tx, 0)
+}
+
+// RunLabelMigrationJob rebuilds the label links of every menu item. The
+// links are first built by a migration at startup, this repairs them.
+func (s *Server) RunLabelMigrationJob(c *fiber.Ctx) error {
+	tx := s.Db.Begin()
+
+	if err := migrateMenuLabels(tx); err != nil {
+		tx.Rollback()
+		log.Println("❌ Failed to build menu item labels:", err)
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Println("❌ Failed to commit menu item labels:", err)
+		return err
+	}
+
+	var links int
+	s.Db.Model(&structures.MenuItemLabel{}).Count(&links)
+
+	log.Printf("Label migration linked %d item labels\n", links)
+	if c == nil {
+		return nil
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Label migration completed",
+		"links":   links,
+	})
+}
@@ -0,0 +1,529 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+var errInvalidMenuVersion = errors.New("menu version has validation errors")
+
+// recordPriceSnapshots closes the price snapshots of items whose name or
+// price changed and opens a new snapshot for every item without a current one.
+func recordPriceSnapshots(tx *gorm.DB, cafeID uint, versionID *uint, now time.Time) error {
+	if err := tx.Exec(`
+		UPDATE menu_item_prices p SET effective_to = ?
+		FROM menu_items m
+		WHERE p.menu_item_id = m.id AND m.cafe_id = ? AND p.effective_to IS NULL
+		AND (p.price <> m.price OR p.name <> m.name)
+	`, now, cafeID).Error; err != nil {
+		return err
+	}
+
+	// An item has one open snapshot, a concurrent writer may have added it
+	return tx.Exec(`
+		INSERT INTO menu_item_prices (cafe_id, menu_item_id, menu_version_id, name, price, effective_from, created_at)
+		SELECT m.cafe_id, m.id, ?, m.name, m.price, ?, ?
+		FROM menu_items m
+		WHERE m.cafe_id = ?
+		AND NOT EXISTS (
+			SELECT 1 FROM menu_item_prices p
+			WHERE p.menu_item_id = m.id AND p.effective_to IS NULL
+		)
+		ON CONFLICT (menu_item_id) WHERE effective_to IS NULL DO NOTHING
+	`, versionID, now, now, cafeID).Error
+}
+
+// currentPriceSnapshot returns the snapshot matching the item's live name and
+// price, creating one for items that have never been snapshotted.
+func (s *Server) currentPriceSnapshot(item structures.MenuItem) (structures.MenuItemPrice, error) {
+	var snapshot structures.MenuItemPrice
+	err := s.Db.Where("menu_item_id = ? AND effective_to IS NULL", item.ID).First(&snapshot).Error
+	if err == nil && snapshot.Price == item.Price && snapshot.Name == item.Name {
+		return snapshot, nil
+	}
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return snapshot, err
+	}
+
+	// The item was changed outside the menu admin, so record its price now
+	tx := s.Db.Begin()
+	if err := recordPriceSnapshots(tx, item.CafeID, nil, time.Now()); err != nil {
+		tx.Rollback()
+		return snapshot, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return snapshot, err
+	}
+	err = s.Db.Where("menu_item_id = ? AND effective_to IS NULL", item.ID).First(&snapshot).Error
+	return snapshot, err
+}
+
+// publishedMenuVersionID returns the published version of a cafe, if any
+func (s *Server) publishedMenuVersionID(cafeID uint) *uint {
+	var version structures.MenuVersion
+	if err := s.Db.Select("id").Where("cafe_id = ? AND status = ?", cafeID, structures.MenuVersionPublished).
+		First(&version).Error; err != nil {
+		return nil
+	}
+	return &version.ID
+}
+
+// markVersionPublished supersedes the current published version of the cafe
+func markVersionPublished(tx *gorm.DB, version structures.MenuVersion, now time.Time) error {
+	if err := tx.Model(&structures.MenuVersion{}).
+		Where("cafe_id = ? AND status = ? AND id <> ?", version.CafeID, structures.MenuVersionPublished, version.ID).
+		Update("status", structures.MenuVersionSuperseded).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&structures.MenuVersion{}).Where("id = ?", version.ID).Updates(map[string]interface{}{
+		"status":        structures.MenuVersionPublished,
+		"published_at":  now,
+		"publish_error": "",
+	}).Error
+}
+
+// planMenuVersion validates the menu of a version against the live menu. The
+// plan archives everything the version does not list.
+func (s *Server) planMenuVersion(cafeID uint, doc structures.MenuDocument) (*menuPlan, error) {
+	plan, err := newMenuPlan(s.Db, cafeID, doc, 1)
+	if err != nil {
+		return nil, err
+	}
+	plan.archiveUnlisted(doc)
+	return plan, nil
+}
+
+// publishMenuVersion applies the menu of a version and makes it the published one
+func (s *Server) publishMenuVersion(version structures.MenuVersion) (structures.ImportMenuResponse, error) {
+	var doc structures.MenuDocument
+	if err := json.Unmarshal(version.Menu, &doc); err != nil {
+		return structures.ImportMenuResponse{}, err
+	}
+
+	plan, err := s.planMenuVersion(version.CafeID, doc)
+	if err != nil {
+		return structures.ImportMenuResponse{}, err
+	}
+	if len(plan.result.Errors) > 0 {
+		return plan.result, errInvalidMenuVersion
+	}
+
+	if _, err := s.applyMenuPlan(plan, &version); err != nil {
+		if errors.Is(err, errMenuChanged) {
+			return plan.result, errInvalidMenuVersion
+		}
+		return plan.result, err
+	}
+
+	plan.result.Applied = true
+	return plan.result, nil
+}
+
+// saveMenuVersion validates doc and stores it as a new draft of the cafe
+func (s *Server) saveMenuVersion(cafeID uint, doc structures.MenuDocument, note string, rolledBackFrom *uint) (structures.MenuVersion, *menuPlan, error) {
+	plan, err := s.planMenuVersion(cafeID, doc)
+	if err != nil || len(plan.result.Errors) > 0 {
+		return structures.MenuVersion{}, plan, err
+	}
+
+	menu, err := json.Marshal(doc)
+	if err != nil {
+		return structures.MenuVersion{}, plan, err
+	}
+
+	version := structures.MenuVersion{
+		CafeID:           cafeID,
+		Status:           structures.MenuVersionDraft,
+		Note:             note,
+		Menu:             menu,
+		RolledBackFromID: rolledBackFrom,
+	}
+
+	tx := s.Db.Begin()
+	if err := tx.Raw("SELECT COALESCE(MAX(number), 0) + 1 FROM menu_versions WHERE cafe_id = ?", cafeID).
+		Row().Scan(&version.Number); err != nil {
+		tx.Rollback()
+		return version, plan, err
+	}
+	if err := tx.Create(&version).Error; err != nil {
+		tx.Rollback()
+		return version, plan, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return version, plan, err
+	}
+
+	return version, plan, nil
+}
+
+func (s *Server) findMenuVersion(c *fiber.Ctx, id uint) (structures.MenuVersion, bool, error) {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var version structures.MenuVersion
+	if err := s.Db.Where("id = ? AND cafe_id = ?", id, cafeId).First(&version).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return version, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Menu version not found",
+			})
+		}
+		return version, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch menu version",
+		})
+	}
+
+	return version, true, nil
+}
+
+func (s *Server) CreateMenuDraft(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.MenuDraftRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var doc structures.MenuDocument
+	if req.Menu != nil {
+		doc = *req.Menu
+	} else {
+		live, err := s.exportMenuDocument(cafeId)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load menu",
+			})
+		}
+		doc = live
+	}
+
+	version, plan, err := s.saveMenuVersion(cafeId, doc, req.Note, nil)
+	if err != nil {
+		fmt.Println("Failed to create menu draft:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create menu draft",
+		})
+	}
+	if len(plan.result.Errors) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(plan.result)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Menu draft created successfully",
+		"data":    version,
+		"diff":    plan.result,
+	})
+}
+
+func (s *Server) UpdateMenuDraft(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.MenuDraftRequest
+	if err := c.BodyParser(&req); err != nil || req.Menu == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	version, found, err := s.findMenuVersion(c, req.ID)
+	if !found {
+		return err
+	}
+	if version.Status != structures.MenuVersionDraft {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only drafts can be edited",
+		})
+	}
+
+	plan, err := s.planMenuVersion(cafeId, *req.Menu)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load menu",
+		})
+	}
+	if len(plan.result.Errors) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(plan.result)
+	}
+
+	menu, err := json.Marshal(req.Menu)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update menu draft",
+		})
+	}
+
+	if err := s.Db.Model(&version).Updates(map[string]interface{}{
+		"note": req.Note,
+		"menu": menu,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update menu draft",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Menu draft updated successfully",
+		"data":    version,
+		"diff":    plan.result,
+	})
+}
+
+func (s *Server) GetMenuVersions(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var versions []structures.MenuVersion
+	if err := s.Db.Select("id, cafe_id, number, status, note, publish_at, published_at, publish_error, rolled_back_from_id, created_at, updated_at").
+		Where("cafe_id = ?", cafeId).Order("number DESC").Find(&versions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch menu versions",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": versions,
+	})
+}
+
+// GetMenuVersion returns a version with the changes publishing it would make
+func (s *Server) GetMenuVersion(c *fiber.Ctx) error {
+	var req structures.MenuVersionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	version, found, err := s.findMenuVersion(c, req.ID)
+	if !found {
+		return err
+	}
+
+	var doc structures.MenuDocument
+	if err := json.Unmarshal(version.Menu, &doc); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to read menu version",
+		})
+	}
+
+	plan, err := s.planMenuVersion(version.CafeID, doc)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load menu",
+		})
+	}
+	plan.result.DryRun = true
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": version,
+		"diff": plan.result,
+	})
+}
+
+func (s *Server) ScheduleMenuVersion(c *fiber.Ctx) error {
+	var req structures.ScheduleMenuRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	version, found, err := s.findMenuVersion(c, req.ID)
+	if !found {
+		return err
+	}
+	if version.Status != structures.MenuVersionDraft && version.Status != structures.MenuVersionScheduled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only drafts can be scheduled",
+		})
+	}
+
+	updates := map[string]interface{}{
+		"status":        structures.MenuVersionDraft,
+		"publish_at":    nil,
+		"publish_error": "",
+	}
+	if req.PublishAt != "" {
+		publishAt, err := time.Parse(time.RFC3339, req.PublishAt)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "publish_at must be an RFC 3339 timestamp",
+			})
+		}
+		if !publishAt.After(time.Now()) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "publish_at must be in the future",
+			})
+		}
+		updates["status"] = structures.MenuVersionScheduled
+		updates["publish_at"] = publishAt
+	}
+
+	if err := s.Db.Model(&version).Updates(updates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to schedule menu version",
+		})
+	}
+	version.Menu = nil
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Menu version schedule updated successfully",
+		"data":    version,
+	})
+}
+
+func (s *Server) PublishMenuVersion(c *fiber.Ctx) error {
+	var req structures.MenuVersionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	version, found, err := s.findMenuVersion(c, req.ID)
+	if !found {
+		return err
+	}
+	if version.Status != structures.MenuVersionDraft && version.Status != structures.MenuVersionScheduled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Version has already been published, roll back to it instead",
+		})
+	}
+
+	return s.respondPublish(c, version, "Menu version published successfully")
+}
+
+// RollbackMenuVersion publishes a copy of a previously published version
+func (s *Server) RollbackMenuVersion(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.MenuVersionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	target, found, err := s.findMenuVersion(c, req.ID)
+	if !found {
+		return err
+	}
+	if target.PublishedAt == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only previously published versions can be rolled back to",
+		})
+	}
+
+	var doc structures.MenuDocument
+	if err := json.Unmarshal(target.Menu, &doc); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to read menu version",
+		})
+	}
+
+	version, plan, err := s.saveMenuVersion(cafeId, doc, fmt.Sprintf("Rollback to version %d", target.Number), &target.ID)
+	if err != nil {
+		fmt.Println("Failed to create rollback version:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to roll back menu",
+		})
+	}
+	if len(plan.result.Errors) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(plan.result)
+	}
+
+	return s.respondPublish(c, version, fmt.Sprintf("Menu rolled back to version %d successfully", target.Number))
+}
+
+func (s *Server) respondPublish(c *fiber.Ctx, version structures.MenuVersion, message string) error {
+	result, err := s.publishMenuVersion(version)
+	if errors.Is(err, errInvalidMenuVersion) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(result)
+	}
+	if err != nil {
+		fmt.Println("Failed to publish menu version:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to publish menu version, no changes were applied",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":    message,
+		"version_id": version.ID,
+		"number":     version.Number,
+		"diff":       result,
+	})
+}
+
+func (s *Server) GetItemPriceHistory(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.PriceHistoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var prices []structures.MenuItemPrice
+	if err := s.Db.Where("menu_item_id = ? AND cafe_id = ?", req.MenuItemID, cafeId).
+		Order("effective_from DESC, id DESC").Find(&prices).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch price history",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": prices,
+	})
+}
+
+// RunMenuPublishJob publishes scheduled menu versions that are due. A version
+// that fails validation goes back to draft with the reason.
+func (s *Server) RunMenuPublishJob(c *fiber.Ctx) error {
+	var versions []structures.MenuVersion
+	if err := s.Db.Where("status = ? AND publish_at <= ?", structures.MenuVersionScheduled, time.Now()).
+		Order("publish_at ASC").Find(&versions).Error; err != nil {
+		log.Println("❌ Failed to fetch scheduled menu versions:", err)
+		return err
+	}
+
+	published := 0
+	for _, version := range versions {
+		result, err := s.publishMenuVersion(version)
+		if err == nil {
+			published++
+			continue
+		}
+
+		reason := err.Error()
+		if errors.Is(err, errInvalidMenuVersion) && len(result.Errors) > 0 {
+			first := result.Errors[0]
+			reason = fmt.Sprintf("%s row %d %s: %s", first.Entity, first.Row, first.Field, first.Message)
+		}
+		log.Printf("❌ Failed to publish menu version %d for cafe %d: %s\n", version.ID, version.CafeID, reason)
+
+		if err := s.Db.Model(&structures.MenuVersion{}).Where("id = ?", version.ID).Updates(map[string]interface{}{
+			"status":        structures.MenuVersionDraft,
+			"publish_error": reason,
+		}).Error; err != nil {
+			log.Printf("❌ Failed to reset menu version %d: %v\n", version.ID, err)
+		}
+	}
+
+	log.Printf("Published %d of %d scheduled menu versions\n", published, len(versions))
+	if c == nil {
+		return nil
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":   "Menu publish job completed",
+		"published": published,
+	})
+}
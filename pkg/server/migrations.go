@@ -0,0 +1,174 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// migrationLockKey serializes migrations across instances starting together
+const migrationLockKey = 727274
+
+// migration fixes up existing data once, after AutoMigrate created the
+// columns it needs. Names are recorded when applied, so never rename one.
+type migration struct {
+	name string
+	run  func(tx *gorm.DB) error
+}
+
+// migrations run in this order, append new ones at the end
+var migrations = []migration{
+	{name: "close_duplicate_open_price_snapshots", run: closeDuplicatePriceSnapshots},
+	{name: "group_ungrouped_customizations", run: groupUngroupedCustomizations},
+	{name: "build_menu_item_labels", run: migrateMenuLabels},
+	{name: "dedupe_item_ratings_and_fill_rating_sum", run: migrateRatings},
+	{name: "fill_guest_push_token_provider", run: fillGuestPushTokenProvider},
+	{name: "seed_cafe_3_fcm_channel", run: seedCafe3FcmChannel},
+	{name: "dedupe_device_tokens_and_fill_provider", run: migrateDeviceTokens},
+	{name: "unique_menu_ai_record_prompt_id", run: uniqueMenuAIRecordPromptID},
+	{name: "dedupe_cafe_feedback_per_session", run: migrateCafeFeedback},
+}
+
+// RunMigrations applies the migrations that have not run yet. Each runs in
+// its own transaction together with its record, under an advisory lock so
+// two cold starts never apply the same one.
+func RunMigrations(db *gorm.DB) error {
+	if err := db.AutoMigrate(&structures.SchemaMigration{}).Error; err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		tx := db.Begin()
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockKey).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		var applied int
+		if err := tx.Model(&structures.SchemaMigration{}).Where("name = ?", m.name).Count(&applied).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if applied > 0 {
+			tx.Rollback()
+			continue
+		}
+
+		if err := m.run(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+		if err := tx.Create(&structures.SchemaMigration{Name: m.name, AppliedAt: time.Now()}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit().Error; err != nil {
+			return err
+		}
+		log.Printf("Applied migration %s\n", m.name)
+	}
+	return nil
+}
+
+// closeDuplicatePriceSnapshots keeps the newest open snapshot of every item
+// and adds the index that keeps it that way
+func closeDuplicatePriceSnapshots(tx *gorm.DB) error {
+	if err := tx.Exec(`
+		UPDATE menu_item_prices p SET effective_to = newer.effective_from
+		FROM menu_item_prices newer
+		WHERE p.menu_item_id = newer.menu_item_id AND p.id < newer.id
+		AND p.effective_to IS NULL AND newer.effective_to IS NULL
+	`).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_menu_item_price_open
+		ON menu_item_prices (menu_item_id) WHERE effective_to IS NULL`).Error
+}
+
+// groupUngroupedCustomizations moves options that were only grouped by their
+// type into a group of that name. The groups get no limits, so carts keep
+// accepting what they did before until the owner sets them.
+func groupUngroupedCustomizations(tx *gorm.DB) error {
+	if err := tx.Exec(`
+		INSERT INTO customization_groups (menu_item_id, name, position, is_required, min_selections, max_selections, created_at, updated_at)
+		SELECT t.menu_item_id, t.customization_type,
+			COALESCE((SELECT MAX(g.position) FROM customization_groups g WHERE g.menu_item_id = t.menu_item_id), 0)
+				+ ROW_NUMBER() OVER (PARTITION BY t.menu_item_id ORDER BY t.customization_type),
+			false, 0, 0, NOW(), NOW()
+		FROM (
+			SELECT DISTINCT ON (c.menu_item_id, LOWER(c.customization_type)) c.menu_item_id, c.customization_type
+			FROM item_customizations c
+			WHERE c.group_id IS NULL AND c.archived_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM customization_groups g
+				WHERE g.menu_item_id = c.menu_item_id AND LOWER(g.name) = LOWER(c.customization_type) AND g.archived_at IS NULL
+			)
+			ORDER BY c.menu_item_id, LOWER(c.customization_type), c.id
+		) t
+	`).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`
+		UPDATE item_customizations c SET group_id = g.id, updated_at = NOW()
+		FROM customization_groups g
+		WHERE c.group_id IS NULL AND g.menu_item_id = c.menu_item_id
+		AND LOWER(g.name) = LOWER(c.customization_type) AND g.archived_at IS NULL
+	`).Error; err != nil {
+		return err
+	}
+	// Cached menus still list the options by type
+	return tx.Exec("UPDATE cafes SET menu_revision = menu_revision + 1").Error
+}
+
+// fillGuestPushTokenProvider stores the provider of the push tokens guests
+// registered before it was stored, telling them apart by their format
+func fillGuestPushTokenProvider(tx *gorm.DB) error {
+	return tx.Exec(`
+		UPDATE users SET push_token_provider = CASE
+			WHEN push_token LIKE 'ExponentPushToken[%' OR push_token LIKE 'ExpoPushToken[%' THEN 'expo'
+			ELSE 'fcm'
+		END
+		WHERE push_token <> '' AND COALESCE(push_token_provider, '') = ''
+	`).Error
+}
+
+// seedCafe3FcmChannel keeps cafe 3 notified through FCM, as it was before
+// channels were configurable
+func seedCafe3FcmChannel(tx *gorm.DB) error {
+	return tx.Exec(`INSERT INTO notification_channels (cafe_id, channel, target, events, enabled, created_at, updated_at)
+		SELECT 3, 'fcm', '', '', true, NOW(), NOW()
+		WHERE EXISTS (SELECT 1 FROM cafes WHERE id = 3)
+		AND NOT EXISTS (SELECT 1 FROM notification_channels WHERE cafe_id = 3)`).Error
+}
+
+// migrateDeviceTokens keeps the newest copy of device tokens stored before
+// tokens had a unique index, and marks the Expo tokens registered before the
+// provider was stored
+func migrateDeviceTokens(tx *gorm.DB) error {
+	if tx.HasTable(&structures.FcmToken{}) {
+		if err := tx.Exec(`DELETE FROM fcm_tokens a USING fcm_tokens b
+			WHERE a.token = b.token AND a.id < b.id`).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.AutoMigrate(&structures.FcmToken{}).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`UPDATE fcm_tokens SET provider = 'expo'
+		WHERE provider = 'fcm' AND (token LIKE 'ExponentPushToken[%' OR token LIKE 'ExpoPushToken[%')`).Error
+}
+
+// uniqueMenuAIRecordPromptID adds the index the AI record job inserts
+// against. The primaryKey tag on prompt_id means nothing to gorm v1, so the
+// table was created without one.
+func uniqueMenuAIRecordPromptID(tx *gorm.DB) error {
+	if err := tx.Exec(`DELETE FROM menu_ai_records a USING menu_ai_records b
+		WHERE a.prompt_id = b.prompt_id AND a.ctid < b.ctid`).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_menu_ai_record_prompt
+		ON menu_ai_records (prompt_id)`).Error
+}
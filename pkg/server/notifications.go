@@ -0,0 +1,486 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/notification"
+	"coffeeMustacheBackend/pkg/structures"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+// The dispatcher keeps the Firebase client, so it is built once per process
+var (
+	dispatcherOnce sync.Once
+	dispatcher     *notification.Dispatcher
+)
+
+// notifications returns the dispatcher with a provider for every configured
+// channel. Expo needs no credentials and is always available.
+func (s *Server) notifications() *notification.Dispatcher {
+	dispatcherOnce.Do(func() {
+		dispatcher = &notification.Dispatcher{}
+		dispatcher.Register(notification.ExpoProvider{})
+		dispatcher.Register(notification.WebhookProvider{Secret: s.Config.WEBHOOK_SECRET})
+
+		if s.Config.FIREBASE_AUTH_KEY != "" {
+			credentials, err := base64.StdEncoding.DecodeString(s.Config.FIREBASE_AUTH_KEY)
+			if err != nil {
+				log.Println("❌ FIREBASE_AUTH_KEY is not valid base64:", err)
+			} else {
+				dispatcher.Register(&notification.FCMProvider{CredentialsJSON: credentials})
+			}
+		}
+		if sender, err := s.smsSender(); err != nil {
+			log.Println("❌ SMS is not configured:", err)
+		} else {
+			dispatcher.Register(notification.SMSProvider{Sender: sender})
+		}
+		if s.Config.SMTP_HOST != "" {
+			dispatcher.Register(notification.EmailProvider{
+				Host:     s.Config.SMTP_HOST,
+				Port:     s.Config.SMTP_PORT,
+				Username: s.Config.SMTP_USERNAME,
+				Password: s.Config.SMTP_PASSWORD,
+				From:     s.Config.SMTP_FROM,
+			})
+		}
+	})
+	return dispatcher
+}
+
+// smsSender returns the configured SMS provider
+func (s *Server) smsSender() (helper.SMSSender, error) {
+	switch s.Config.SMS_PROVIDER {
+	case "", "log":
+		return helper.LogSMSSender{}, nil
+	case "twilio":
+		if s.Config.TWILIO_ACCOUNT_SID == "" || s.Config.TWILIO_AUTH_TOKEN == "" || s.Config.TWILIO_FROM == "" {
+			return nil, errors.New("TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM are required")
+		}
+		return helper.TwilioSMSSender{
+			AccountSID: s.Config.TWILIO_ACCOUNT_SID,
+			AuthToken:  s.Config.TWILIO_AUTH_TOKEN,
+			From:       s.Config.TWILIO_FROM,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown SMS provider %q", s.Config.SMS_PROVIDER)
+	}
+}
+
+// notificationTemplate returns the template of the event for the cafe
+func (s *Server) notificationTemplate(cafeID uint, event string) (notification.Template, error) {
+	var custom structures.NotificationTemplate
+	err := s.Db.Where("cafe_id = ? AND event = ?", cafeID, event).First(&custom).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return notification.DefaultTemplates[event], nil
+	}
+	if err != nil {
+		return notification.Template{}, err
+	}
+	return notification.Template{Title: custom.Title, Body: custom.Body, URL: custom.URL}, nil
+}
+
+// cafeChannels returns the enabled channels of the cafe subscribed to the event.
+// A cafe that configured none is notified by push on every staff device.
+func (s *Server) cafeChannels(cafeID uint, event string) ([]structures.NotificationChannel, error) {
+	var channels []structures.NotificationChannel
+	if err := s.Db.Where("cafe_id = ?", cafeID).Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return []structures.NotificationChannel{
+			{CafeID: cafeID, Channel: string(notification.ChannelFCM), Enabled: true},
+			{CafeID: cafeID, Channel: string(notification.ChannelExpo), Enabled: true},
+		}, nil
+	}
+
+	subscribed := channels[:0]
+	for _, channel := range channels {
+		if !channel.Enabled {
+			continue
+		}
+		if channel.Events == "" || containsString(strings.Split(channel.Events, ","), event) {
+			subscribed = append(subscribed, channel)
+		}
+	}
+	return subscribed, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// logDelivery records the outcome of a delivery
+func (s *Server) logDelivery(cafeID uint, event string, result notification.Result) {
+	delivery := structures.NotificationDelivery{
+		CafeID:    cafeID,
+		Event:     event,
+		Channel:   string(result.Channel),
+		Recipient: result.Recipient,
+		Status:    structures.DeliverySent,
+		Attempts:  result.Attempts,
+	}
+	if len(delivery.Recipient) > 255 {
+		delivery.Recipient = delivery.Recipient[:255]
+	}
+	if result.Err != nil {
+		delivery.Status = structures.DeliveryFailed
+		if result.Invalid() {
+			delivery.Status = structures.DeliveryInvalid
+		}
+		delivery.Error = result.Err.Error()
+	}
+	if err := s.Db.Create(&delivery).Error; err != nil {
+		log.Println("❌ Failed to log notification delivery:", err)
+	}
+}
+
+// notifyCafe sends the event to the staff of a cafe through every channel it
+// configured. Push tokens the provider no longer knows are removed. Failed
+// deliveries are only logged, so retrying does not notify everyone again.
+func (s *Server) notifyCafe(cafeID uint, event string, data map[string]string) error {
+	template, err := s.notificationTemplate(cafeID, event)
+	if err != nil {
+		return fmt.Errorf("loading %s template of cafe %d: %w", event, cafeID, err)
+	}
+	msg, err := template.Render(event, data)
+	if err != nil {
+		return fmt.Errorf("rendering %s notification of cafe %d: %w", event, cafeID, err)
+	}
+
+	channels, err := s.cafeChannels(cafeID, event)
+	if err != nil {
+		return fmt.Errorf("loading notification channels of cafe %d: %w", cafeID, err)
+	}
+
+	for _, channel := range channels {
+		recipients := []string{channel.Target}
+		if notification.Channel(channel.Channel).IsPush() {
+			recipients = nil
+			if err := s.cafeDeviceTokens(cafeID, channel.Channel, &recipients); err != nil {
+				log.Printf("❌ Failed to fetch device tokens of cafe %d: %v\n", cafeID, err)
+				continue
+			}
+		}
+
+		for _, recipient := range recipients {
+			result := s.notifications().Send(notification.Channel(channel.Channel), recipient, msg)
+			s.logDelivery(cafeID, event, result)
+			if result.Invalid() && notification.Channel(channel.Channel).IsPush() {
+				if err := s.Db.Where("token = ?", recipient).Delete(&structures.FcmToken{}).Error; err != nil {
+					log.Println("❌ Failed to remove device token:", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// notifyGuest sends the event of a cafe to one guest
+func (s *Server) notifyGuest(cafeID uint, event string, channel notification.Channel, recipient string, data map[string]string) notification.Result {
+	result := notification.Result{Channel: channel, Recipient: recipient}
+
+	template, err := s.notificationTemplate(cafeID, event)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	msg, err := template.Render(event, data)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result = s.notifications().Send(channel, recipient, msg)
+	s.logDelivery(cafeID, event, result)
+	if result.Invalid() && channel.IsPush() {
+		if err := s.Db.Model(&structures.User{}).Where("push_token = ?", recipient).
+			UpdateColumns(map[string]interface{}{"push_token": "", "push_token_provider": ""}).Error; err != nil {
+			log.Println("❌ Failed to remove push token:", err)
+		}
+	}
+	return result
+}
+
+// GetNotificationChannels lists how the cafe is notified
+func (s *Server) GetNotificationChannels(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	channels := []structures.NotificationChannel{}
+	if err := s.Db.Where("cafe_id = ?", cafeId).Order("id ASC").Find(&channels).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch notification channels",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":   channels,
+		"events": eventNames(),
+	})
+}
+
+func eventNames() []string {
+	events := make([]string, 0, len(notification.DefaultTemplates))
+	for event := range notification.DefaultTemplates {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	return events
+}
+
+// validateChannelTarget checks the target fits the channel
+func validateChannelTarget(channel notification.Channel, target string) error {
+	switch channel {
+	case notification.ChannelFCM, notification.ChannelExpo:
+		if target != "" {
+			return fmt.Errorf("%s channels deliver to the staff devices and take no target", channel)
+		}
+	case notification.ChannelSMS:
+		if len(target) < 8 || strings.Trim(target, "+0123456789 ") != "" {
+			return fmt.Errorf("%q is not a phone number", target)
+		}
+	case notification.ChannelEmail:
+		if _, err := mail.ParseAddress(target); err != nil {
+			return fmt.Errorf("%q is not an email address", target)
+		}
+	case notification.ChannelWebhook:
+		if u, err := url.Parse(target); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("%q is not an https URL", target)
+		}
+	default:
+		return fmt.Errorf("unknown channel %q", channel)
+	}
+	return nil
+}
+
+// SetNotificationChannels replaces the channels of the cafe. An empty list
+// restores the default, Expo push to the staff devices.
+func (s *Server) SetNotificationChannels(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.SetNotificationChannelsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	channels := make([]structures.NotificationChannel, 0, len(req.Channels))
+	for _, ch := range req.Channels {
+		ch.Target = strings.TrimSpace(ch.Target)
+		if err := validateChannelTarget(notification.Channel(ch.Channel), ch.Target); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		for _, event := range ch.Events {
+			if _, ok := notification.DefaultTemplates[event]; !ok {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": fmt.Sprintf("Unknown event %q", event),
+				})
+			}
+		}
+
+		enabled := true
+		if ch.Enabled != nil {
+			enabled = *ch.Enabled
+		}
+		channels = append(channels, structures.NotificationChannel{
+			CafeID:  cafeId,
+			Channel: ch.Channel,
+			Target:  ch.Target,
+			Events:  strings.Join(ch.Events, ","),
+			Enabled: enabled,
+		})
+	}
+
+	tx := s.Db.Begin()
+
+	if err := tx.Where("cafe_id = ?", cafeId).Delete(&structures.NotificationChannel{}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save notification channels",
+		})
+	}
+	for i := range channels {
+		if err := tx.Create(&channels[i]).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save notification channels",
+			})
+		}
+		// gorm skips zero values on create, so write the flag explicitly
+		if err := tx.Model(&structures.NotificationChannel{}).Where("id = ?", channels[i].ID).
+			Updates(map[string]interface{}{"enabled": channels[i].Enabled}).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save notification channels",
+			})
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save notification channels",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Notification channels saved successfully",
+		"data":    channels,
+	})
+}
+
+// GetNotificationTemplates lists the template of every event, the default
+// where the cafe has not customised it.
+func (s *Server) GetNotificationTemplates(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var custom []structures.NotificationTemplate
+	if err := s.Db.Where("cafe_id = ?", cafeId).Find(&custom).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch notification templates",
+		})
+	}
+	customised := make(map[string]structures.NotificationTemplate, len(custom))
+	for _, t := range custom {
+		customised[t.Event] = t
+	}
+
+	type templateView struct {
+		Event      string                `json:"event"`
+		Template   notification.Template `json:"template"`
+		Default    notification.Template `json:"default"`
+		Customised bool                  `json:"customised"`
+	}
+	templates := []templateView{}
+	for _, event := range eventNames() {
+		view := templateView{Event: event, Template: notification.DefaultTemplates[event], Default: notification.DefaultTemplates[event]}
+		if t, ok := customised[event]; ok {
+			view.Template = notification.Template{Title: t.Title, Body: t.Body, URL: t.URL}
+			view.Customised = true
+		}
+		templates = append(templates, view)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": templates,
+	})
+}
+
+// SetNotificationTemplate customises the message of an event for the cafe
+func (s *Server) SetNotificationTemplate(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.NotificationTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	if _, ok := notification.DefaultTemplates[req.Event]; !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Unknown event %q", req.Event),
+		})
+	}
+
+	if strings.TrimSpace(req.Title) == "" && strings.TrimSpace(req.Body) == "" {
+		if err := s.Db.Where("cafe_id = ? AND event = ?", cafeId, req.Event).
+			Delete(&structures.NotificationTemplate{}).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save notification template",
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "Notification template reset to the default",
+		})
+	}
+
+	template := notification.Template{Title: req.Title, Body: req.Body, URL: req.URL}
+	if len(req.Title) > 255 || len(req.URL) > 500 || len(req.Body) > 2000 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Template is too long",
+		})
+	}
+	if err := template.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := s.Db.Exec(`
+		INSERT INTO notification_templates (cafe_id, event, title, body, url, updated_at)
+		VALUES (?, ?, ?, ?, ?, NOW())
+		ON CONFLICT (cafe_id, event)
+		DO UPDATE SET title = EXCLUDED.title, body = EXCLUDED.body, url = EXCLUDED.url, updated_at = NOW()`,
+		cafeId, req.Event, req.Title, req.Body, req.URL).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save notification template",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Notification template saved successfully",
+	})
+}
+
+// GetNotificationLog lists the deliveries of the cafe, newest first. Pass the
+// next_cursor of a page to get the following one.
+func (s *Server) GetNotificationLog(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 200 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "limit must be between 1 and 200",
+		})
+	}
+
+	query := s.Db.Where("cafe_id = ?", cafeId)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		before, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		query = query.Where("id < ?", before)
+	}
+
+	deliveries := []structures.NotificationDelivery{}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&deliveries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch notification log",
+		})
+	}
+
+	nextCursor := ""
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		nextCursor = strconv.FormatUint(uint64(deliveries[limit-1].ID), 10)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":        deliveries,
+		"next_cursor": nextCursor,
+	})
+}
@@ -1,8 +1,9 @@
 package server
 
 import (
-	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/notification"
 	"coffeeMustacheBackend/pkg/structures"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -74,14 +75,49 @@ func (s *Server) PlaceOrder(c *fiber.Ctx) error {
 		})
 	}
 
+	// Make sure the cafe is open and every item in the cart can still be ordered
+	schedule, open, err := s.checkCafeOpen(c, req.CafeID)
+	if !open {
+		return err
+	}
+
+	var cartMenuItems []structures.MenuItem
+	if err := s.Db.Table("menu_items").
+		Joins("JOIN cart_items ON cart_items.item_id = menu_items.id").
+		Where("cart_items.cart_id = ? AND (cart_items.status IS NULL OR cart_items.status <> ?)", req.CartID, structures.CartItemCanceled).
+		Select("DISTINCT menu_items.*").
+		Scan(&cartMenuItems).Error; err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch cart items",
+		})
+	}
+
+	now := time.Now()
+	unavailableItems := []structures.UnavailableItem{}
+	for _, item := range cartMenuItems {
+		if availability := itemAvailability(schedule, item, now); !availability.Available {
+			unavailableItems = append(unavailableItems, structures.UnavailableItem{
+				ItemID: item.ID,
+				Name:   item.Name,
+				Reason: availability.Reason,
+			})
+		}
+	}
+	if len(unavailableItems) > 0 {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error":             "Some items in the cart are not available right now",
+			"unavailable_items": unavailableItems,
+		})
+	}
+
 	// Generate a new Order ID using ksuid
 	orderID := ksuid.New().String()
 	fmt.Println("Printing Order ID", orderID)
 
 	// Create a new order instance
-	location, err := time.LoadLocation("Asia/Kolkata")
+	clock, _, err := s.cafeClock(req.CafeID)
 	if err != nil {
-		fmt.Println("Failed to load location:", err)
+		fmt.Println("Failed to load cafe clock:", err)
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to process order time",
 		})
@@ -97,11 +133,150 @@ func (s *Server) PlaceOrder(c *fiber.Ctx) error {
 		OrderStatus:    structures.OrderPlaced, // Set status to "Placed"
 		PaymentStatus:  structures.Pending,     // Set payment status to "Pending"
 		TotalAmount:    req.TotalAmount,
-		OrderTime:      time.Now().In(location).Truncate(time.Second), // Use Asia/Kolkata timezone
+		OrderTime:      clock.Now().Truncate(time.Second), // Use the cafe's timezone
+		MenuVersionID:  s.publishedMenuVersionID(req.CafeID),
+	}
+
+	// Take the stock for the cart and insert the order in one transaction
+	tx := s.Db.Begin()
+
+	// Lock the cart so a concurrent order for it waits here and then finds
+	// this order, instead of taking the stock a second time
+	var lockedCartID string
+	if err := tx.Raw(`SELECT cart_id FROM carts WHERE cart_id = ? FOR UPDATE`, req.CartID).
+		Row().Scan(&lockedCartID); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{
+				"error": "Cart not found",
+			})
+		}
+		fmt.Println("Error locking cart:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to place order",
+		})
+	}
+	var placedOrders []structures.Order
+	if err := tx.Where("cart_id = ?", req.CartID).Limit(1).Find(&placedOrders).Error; err != nil {
+		tx.Rollback()
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+	if len(placedOrders) > 0 {
+		tx.Rollback()
+		return c.Status(http.StatusOK).JSON(fiber.Map{
+			"status": "Cart id already exists",
+			"data":   placedOrders[0],
+		})
+	}
+
+	shortages, stockAlerts, err := consumeStock(tx, req.CafeID, req.CartID, orderID)
+	if err != nil {
+		tx.Rollback()
+		fmt.Println("Error updating stock:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update stock",
+		})
+	}
+	if len(shortages) > 0 {
+		tx.Rollback()
+		return c.Status(http.StatusConflict).JSON(fiber.Map{
+			"error":             "Some items in the cart are out of stock",
+			"unavailable_items": shortages,
+		})
 	}
 
 	// Insert into the database
-	if err := s.Db.Create(&order).Error; err != nil {
+	if err := tx.Create(&order).Error; err != nil {
+		tx.Rollback()
+		fmt.Println("Error placing order:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to place order",
+		})
+	}
+
+	// Staff are notified by the job worker once the order is committed
+	if err := enqueueStockAlerts(tx, req.CafeID, stockAlerts); err != nil {
+		tx.Rollback()
+		fmt.Println("Error queueing stock alerts:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to place order",
+		})
+	}
+	if err := enqueueCafeNotification(tx, req.CafeID, notification.EventOrderPlaced, map[string]string{
+		"TableName": session.TableName,
+		"OrderID":   orderID,
+	}); err != nil {
+		tx.Rollback()
+		fmt.Println("Error queueing order notification:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to place order",
+		})
+	}
+
+	// Work out the loyalty points earned with the cart and queue their credit
+	// with the order, so a committed order is always credited
+	var cart structures.Cart
+	if err := tx.Where("cart_id = ?", req.CartID).First(&cart).Error; err != nil {
+		tx.Rollback()
+		fmt.Println("Failed to fetch cart details:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch cart details",
+		})
+	}
+
+	var loyaltyPoints uint
+
+	// Get upsell_data entry for the given cart ID
+	var upsellData structures.UpsellData
+	if err := tx.Where("cart_id = ?", req.CartID).First(&upsellData).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fmt.Println("No upsell data found for the cart")
+		} else {
+			fmt.Println("Failed to fetch upsell data:", err)
+		}
+	} else {
+		if cart.TotalAmount >= upsellData.TargetAmount {
+			// If the cart total is greater than or equal to the target amount, add the mustaches to the loyalty points
+			loyaltyPoints = upsellData.MustachesToGive
+			fmt.Println("Loyalty points earned from upsell data:", loyaltyPoints)
+
+			// Update OfferAccepted to true in upsell_data table
+			if err := tx.Model(&structures.UpsellData{}).
+				Where("cart_id = ?", req.CartID).
+				Update("offer_accepted", true).Error; err != nil {
+				tx.Rollback()
+				fmt.Println("Failed to update upsell data:", err)
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to update upsell data",
+				})
+			}
+			fmt.Println("Upsell data updated successfully")
+
+		} else {
+			fmt.Println("Cart total is less than the target amount for upsell data")
+			loyaltyPoints = uint(cart.TotalAmount / 50)
+		}
+	}
+
+	// Queue the credit of the earned loyalty points for the user
+	if err := enqueueJob(tx, jobCreditRewards, creditRewardsPayload{
+		UserID:     userId,
+		CafeID:     req.CafeID,
+		SessionID:  req.SessionID,
+		OrderID:    orderID,
+		Mustaches:  loyaltyPoints,
+		EarnedDate: clock.Now().Truncate(time.Second), // Use the cafe's timezone
+	}); err != nil {
+		tx.Rollback()
+		fmt.Println("Failed to queue reward transaction:", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update reward transactions",
+		})
+	}
+
+	if err := tx.Commit().Error; err != nil {
 		fmt.Println("Error placing order:", err)
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to place order",
@@ -169,98 +344,6 @@ func (s *Server) PlaceOrder(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get the cart total from cart table based on cart id
-	var cart structures.Cart
-	if err := s.Db.Where("cart_id = ?", req.CartID).First(&cart).Error; err != nil {
-		fmt.Println("Failed to fetch cart details:", err)
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch cart details",
-		})
-	}
-
-	var loyaltyPoints uint
-
-	// Get upsell_data entry for the given cart ID
-	var upsellData structures.UpsellData
-	if err := s.Db.Where("cart_id = ?", req.CartID).First(&upsellData).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			fmt.Println("No upsell data found for the cart")
-		} else {
-			fmt.Println("Failed to fetch upsell data:", err)
-		}
-	} else {
-		if cart.TotalAmount >= upsellData.TargetAmount {
-			// If the cart total is greater than or equal to the target amount, add the mustaches to the loyalty points
-			loyaltyPoints = upsellData.MustachesToGive
-			fmt.Println("Loyalty points earned from upsell data:", loyaltyPoints)
-
-			// Update OfferAccepted to true in upsell_data table
-			if err := s.Db.Model(&structures.UpsellData{}).
-				Where("cart_id = ?", req.CartID).
-				Update("offer_accepted", true).Error; err != nil {
-				fmt.Println("Failed to update upsell data:", err)
-				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to update upsell data",
-				})
-			}
-			fmt.Println("Upsell data updated successfully")
-
-		} else {
-			fmt.Println("Cart total is less than the target amount for upsell data")
-			loyaltyPoints = uint(cart.TotalAmount / 50)
-		}
-	}
-
-	// Update the reward_transactions table with the earned loyalty points for the user
-	earnedDate := time.Now().In(location).Truncate(time.Second) // Use Asia/Kolkata timezone
-	if err := s.Db.Create(&structures.RewardTransaction{
-		UserID:          userId,
-		CafeID:          req.CafeID,
-		SessionID:       req.SessionID,
-		TransactionType: "credited",
-		Mustaches:       loyaltyPoints,
-		EarnedDate:      &earnedDate,
-	}).Error; err != nil {
-		fmt.Println("Failed to update reward transactions:", err)
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update reward transactions",
-		})
-	}
-
-	// Send a push notification by fetching device tokens from fcm_tokens table based on cafe id
-	var deviceTokens []string
-	if err := s.Db.Model(&structures.FcmToken{}).
-		Where("cafe_id = ?", req.CafeID).
-		Pluck("token", &deviceTokens).Error; err != nil {
-		fmt.Println("Failed to fetch device tokens:", err)
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch device tokens",
-		})
-	}
-
-	body := fmt.Sprintf("New order received for Table No: %s", session.TableName)
-
-	if len(deviceTokens) > 0 {
-		if req.CafeID == 3 {
-			if err := helper.SendPushNotification(deviceTokens, "Order Update", body); err != nil {
-				fmt.Println("Failed to send push notification:", err)
-				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to send push notification",
-				})
-			}
-		} else {
-			if err := helper.SendExpoPushNotification(deviceTokens, "Order Update", body, "https://admin.coffeemustache.in/alerts/waiter-view?tab=new-orders"); err != nil {
-				fmt.Println("Failed to send push notification:", err)
-				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Failed to send push notification",
-				})
-			}
-		}
-
-	} else {
-		fmt.Println("No device tokens found for the cafe")
-	}
-
 	fmt.Println("Order placed successfully with ID:", orderID)
 
 	// Return the generated order ID
@@ -290,29 +373,21 @@ func (s *Server) FetchOrderDetails(c *fiber.Ctx) error {
 
 	cafeID := uint(c.Locals("cafeId").(float64))
 
-	// GEt current time in Asia/Kolkata timezone
-	location, err := time.LoadLocation("Asia/Kolkata")
+	// Get current time in the cafe's timezone
+	clock, cafe, err := s.cafeClock(cafeID)
 	if err != nil {
-		fmt.Println("Failed to load location:", err)
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to process time",
-		})
-	}
-
-	currentTime := time.Now().In(location).Truncate(time.Second) // Use Asia/Kolkata timezone
-
-	// Get Start time of the day in Asia/Kolkata timezone
-	startOfDay := time.Date(currentTime.Year(), currentTime.Month(), currentTime.Day(), 0, 0, 0, 0, location)
-
-	// Get complete_pos status for the cafe
-	var cafe structures.Cafe
-	if err := s.Db.Where("id = ?", cafeID).First(&cafe).Error; err != nil {
 		fmt.Println("Failed to fetch cafe details:", err)
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch cafe details",
 		})
 	}
 
+	currentTime := clock.Now().Truncate(time.Second)
+	language := s.requestLanguage(c, cafe)
+
+	// Get Start time of the day in the cafe's timezone
+	startOfDay := clock.StartOfDay()
+
 	// 1) Fetch all orders for the session (payment pending/failed)
 	var orders []structures.Order
 
@@ -408,8 +483,24 @@ func (s *Server) FetchOrderDetails(c *fiber.Ctx) error {
 				continue
 			}
 
+			// Show the item as it was named when it was added to the cart
+			itemName := item.Name
+			if ci.PriceSnapshotID != nil {
+				var snapshot structures.MenuItemPrice
+				if err := s.Db.Where("id = ?", *ci.PriceSnapshotID).First(&snapshot).Error; err == nil {
+					itemName = snapshot.Name
+				}
+			}
+
+			// A translation into the customer's language wins over the snapshot
+			if translations, err := s.itemTranslations(language, []uint{item.ID}); err == nil {
+				if translation, ok := translations[item.ID]; ok && translation.Name != "" {
+					itemName = translation.Name
+				}
+			}
+
 			cartItemDetails = append(cartItemDetails, structures.CartItemDetail{
-				ItemName:       item.Name,
+				ItemName:       itemName,
 				ImageURL:       item.ImageURL,
 				CartItemID:     ci.CartItemID,
 				ItemID:         ci.ItemID,
@@ -429,8 +520,8 @@ func (s *Server) FetchOrderDetails(c *fiber.Ctx) error {
 			})
 		}
 
-		// First convert order time to Asia/Kolkata timezone
-		order.OrderTime = order.OrderTime.In(location)
+		// First convert order time to the cafe's timezone
+		order.OrderTime = clock.In(order.OrderTime)
 
 		// Build an OrderResponse
 		response := structures.OrderResponse{
@@ -440,7 +531,8 @@ func (s *Server) FetchOrderDetails(c *fiber.Ctx) error {
 			OrderedAt:          order.OrderTime,
 			Discount:           discount.DiscountValue,
 			TotalAmount:        order.TotalAmount,
-			OrderTimeFormatted: order.OrderTime.Format("03:04 PM"), // Only time in am/pm format
+			TotalFormatted:     clock.FormatMoney(order.TotalAmount),
+			OrderTimeFormatted: clock.FormatTime(order.OrderTime), // Only time, in the cafe's locale
 		}
 
 		results[order.UserID] = append(results[order.UserID], response)
@@ -479,11 +571,12 @@ func (s *Server) FetchOrderDetails(c *fiber.Ctx) error {
 		}
 
 		userSummary := structures.UserOrderSummary{
-			UserID:   userID,
-			UserName: user.Name,
-			Total:    totalAmount,
-			Discount: totalDiscount,
-			Orders:   userOrders,
+			UserID:         userID,
+			UserName:       user.Name,
+			Total:          totalAmount,
+			Discount:       totalDiscount,
+			TotalFormatted: clock.FormatMoney(totalAmount),
+			Orders:         userOrders,
 		}
 
 		userSummaries = append(userSummaries, userSummary)
@@ -495,6 +588,8 @@ func (s *Server) FetchOrderDetails(c *fiber.Ctx) error {
 		Timestamp:            finalTimeStamp,
 		Users:                userSummaries,
 		CumilativeOrderTotal: cumilative_order_total,
+		CumilativeFormatted:  clock.FormatMoney(cumilative_order_total),
+		Currency:             clock.Currency,
 	}
 
 	// Fetch advertisement for the cafe
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"coffeeMustacheBackend/pkg/helper"
 	"coffeeMustacheBackend/pkg/structures"
 	"fmt"
 
@@ -11,6 +12,7 @@ import (
 type Server struct {
 	Db     *gorm.DB
 	Config structures.Config
+	Cache  helper.Cache // Optional cache shared between instances
 }
 
 func (s *Server) HealthCheck(c *fiber.Ctx) error {
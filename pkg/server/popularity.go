@@ -0,0 +1,327 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"encoding/json"
+	"log"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+// Tags owned by the popularity job, set and cleared on every run
+const (
+	tagBestseller = "bestseller"
+	tagTrending   = "trending"
+	tagBestRated  = "bestrated"
+)
+
+// Orders older than popularityWindowDays do not count
+const popularityWindowDays = 90
+
+var defaultPopularitySettings = structures.CafePopularitySettings{
+	HalfLifeDays:         14,
+	BestsellerTopPercent: 10,
+	BestsellerMinOrders:  5,
+	TrendingMinOrders:    3,
+	TrendingGrowth:       1.5,
+	BestRatedMinRating:   4.5,
+	BestRatedMinRatings:  5,
+}
+
+// itemPopularity is what the job knows of one menu item
+type itemPopularity struct {
+	ID             uint
+	Tag            []byte
+	Score          float64 // Current popularity score
+	DecayedOrders  float64 // Ordered quantity weighted by age
+	Orders         int     // Ordered quantity in the last 30 days
+	RecentOrders   int     // Ordered quantity in the last 7 days
+	PreviousOrders int     // Ordered quantity in the 7 days before
+	RatingSum      int
+	Ratings        int
+}
+
+// popularitySettings returns the thresholds of a cafe, the defaults when it
+// has none.
+func (s *Server) popularitySettings(cafeID uint) (structures.CafePopularitySettings, error) {
+	var settings structures.CafePopularitySettings
+	err := s.Db.Where("cafe_id = ?", cafeID).First(&settings).Error
+	if gorm.IsRecordNotFoundError(err) {
+		settings = defaultPopularitySettings
+		settings.CafeID = cafeID
+		return settings, nil
+	}
+	return settings, err
+}
+
+// loadItemPopularity aggregates the ordered cart items and ratings of the
+// unarchived items of a cafe.
+func (s *Server) loadItemPopularity(cafeID uint, halfLifeDays float64) ([]itemPopularity, error) {
+	var items []itemPopularity
+	err := s.Db.Raw(`
+		SELECT m.id, m.tag, m.popularity_score AS score,
+			COALESCE(o.decayed_orders, 0) AS decayed_orders,
+			COALESCE(o.orders, 0) AS orders,
+			COALESCE(o.recent_orders, 0) AS recent_orders,
+			COALESCE(o.previous_orders, 0) AS previous_orders,
+			COALESCE(r.rating_sum, 0) AS rating_sum,
+			COALESCE(r.ratings, 0) AS ratings
+		FROM menu_items m
+		LEFT JOIN (
+			SELECT ci.item_id,
+				SUM(ci.quantity * POWER(0.5, EXTRACT(EPOCH FROM NOW() - ci.added_at) / 86400 / ?::float)) AS decayed_orders,
+				SUM(ci.quantity) FILTER (WHERE ci.added_at > NOW() - INTERVAL '30 days') AS orders,
+				SUM(ci.quantity) FILTER (WHERE ci.added_at > NOW() - INTERVAL '7 days') AS recent_orders,
+				SUM(ci.quantity) FILTER (WHERE ci.added_at <= NOW() - INTERVAL '7 days' AND ci.added_at > NOW() - INTERVAL '14 days') AS previous_orders
+			FROM cart_items ci
+			WHERE ci.status IN (?) AND ci.added_at > NOW() - ?::int * INTERVAL '1 day'
+			GROUP BY ci.item_id
+		) o ON o.item_id = m.id
+		LEFT JOIN (
+			SELECT item_id, SUM(rating) AS rating_sum, COUNT(*) AS ratings
+			FROM item_feedbacks
+			WHERE rating BETWEEN 1 AND 5
+			GROUP BY item_id
+		) r ON r.item_id = m.id
+		WHERE m.cafe_id = ? AND m.archived_at IS NULL
+		ORDER BY m.id`,
+		halfLifeDays,
+		[]structures.CartItemStatus{structures.CartItemOrdered, structures.CartItemDelivered},
+		popularityWindowDays, cafeID).Scan(&items).Error
+	return items, err
+}
+
+// scorePopularity rates every item from 0 to 5, seven tenths from how much it
+// is ordered compared to the cafe's most ordered item and three tenths from
+// its smoothed rating. It also picks the tags each item earns.
+func scorePopularity(items []itemPopularity, settings structures.CafePopularitySettings) (map[uint]float64, map[uint][]string) {
+	maxDemand, ratingSum, ratings := 0.0, 0, 0
+	for _, item := range items {
+		maxDemand = math.Max(maxDemand, item.DecayedOrders)
+		ratingSum += item.RatingSum
+		ratings += item.Ratings
+	}
+	cafeAverage := 3.0
+	if ratings > 0 {
+		cafeAverage = float64(ratingSum) / float64(ratings)
+	}
+
+	scores := make(map[uint]float64, len(items))
+	tags := make(map[uint][]string, len(items))
+	for _, item := range items {
+		demand := 0.0
+		if maxDemand > 0 {
+			demand = item.DecayedOrders / maxDemand
+		}
+		smoothed := bayesianRating(float64(item.RatingSum), item.Ratings, cafeAverage)
+		score := 5 * (0.7*demand + 0.3*(smoothed-1)/4)
+		scores[item.ID] = math.Round(score*100) / 100
+
+		if item.RecentOrders >= settings.TrendingMinOrders &&
+			float64(item.RecentOrders) >= settings.TrendingGrowth*float64(item.PreviousOrders) {
+			tags[item.ID] = append(tags[item.ID], tagTrending)
+		}
+		if item.Ratings >= settings.BestRatedMinRatings &&
+			float64(item.RatingSum)/float64(item.Ratings) >= settings.BestRatedMinRating {
+			tags[item.ID] = append(tags[item.ID], tagBestRated)
+		}
+	}
+
+	// Bestsellers are the top share of the items by orders, at least one
+	ranked := append([]itemPopularity(nil), items...)
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Orders > ranked[j].Orders })
+	top := int(math.Ceil(float64(len(ranked)) * settings.BestsellerTopPercent / 100))
+	for _, item := range ranked[:min(top, len(ranked))] {
+		if item.Orders < settings.BestsellerMinOrders {
+			break
+		}
+		tags[item.ID] = append(tags[item.ID], tagBestseller)
+	}
+
+	return scores, tags
+}
+
+// mergeAutomaticTags replaces the job's tags in the existing tags with the
+// earned ones and keeps the tags set by the owner.
+func mergeAutomaticTags(existing []string, earned []string) []string {
+	merged := []string{}
+	for _, tag := range existing {
+		switch helper.NormalizeLabel(tag) {
+		case tagBestseller, tagTrending, tagBestRated:
+			continue
+		}
+		merged = append(merged, tag)
+	}
+	sort.Strings(earned)
+	return append(merged, earned...)
+}
+
+// updateCafePopularity scores the items of one cafe and saves the changed
+// scores and tags. It returns how many items changed.
+func (s *Server) updateCafePopularity(cafeID uint) (int, error) {
+	settings, err := s.popularitySettings(cafeID)
+	if err != nil {
+		return 0, err
+	}
+	items, err := s.loadItemPopularity(cafeID, settings.HalfLifeDays)
+	if err != nil {
+		return 0, err
+	}
+	scores, earned := scorePopularity(items, settings)
+
+	tx := s.Db.Begin()
+
+	changed, tagsChanged := 0, false
+	for _, item := range items {
+		var existing []string
+		if len(item.Tag) > 0 {
+			json.Unmarshal(item.Tag, &existing)
+		}
+		tags := mergeAutomaticTags(existing, earned[item.ID])
+
+		updates := map[string]interface{}{}
+		if scores[item.ID] != item.Score {
+			updates["popularity_score"] = scores[item.ID]
+		}
+		if strings.Join(tags, ",") != strings.Join(existing, ",") {
+			updates["tag"] = labelJSON(strings.Join(tags, ","))
+			tagsChanged = true
+		}
+		if len(updates) == 0 {
+			continue
+		}
+
+		if err := tx.Model(&structures.MenuItem{}).Where("id = ?", item.ID).UpdateColumns(updates).Error; err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		changed++
+	}
+
+	// GetFilteredList matches tags through the label links
+	if tagsChanged {
+		if err := syncMenuLabels(tx, cafeID); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	return changed, tx.Commit().Error
+}
+
+// RunPopularityJob recomputes the popularity score and the bestseller,
+// trending and bestrated tags of every menu item.
+func (s *Server) RunPopularityJob(c *fiber.Ctx) error {
+	var cafeIDs []uint
+	if err := s.Db.Model(&structures.Cafe{}).Pluck("id", &cafeIDs).Error; err != nil {
+		log.Println("❌ Failed to fetch cafes:", err)
+		return err
+	}
+
+	updated, failed := 0, 0
+	for _, cafeID := range cafeIDs {
+		changed, err := s.updateCafePopularity(cafeID)
+		if err != nil {
+			log.Printf("❌ Failed to update popularity of cafe %d: %v\n", cafeID, err)
+			failed++
+			continue
+		}
+		updated += changed
+	}
+
+	log.Printf("Popularity job updated %d items, %d cafes failed\n", updated, failed)
+	if c == nil {
+		return nil
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Popularity updated",
+		"updated": updated,
+		"failed":  failed,
+	})
+}
+
+func (s *Server) GetPopularitySettings(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	settings, err := s.popularitySettings(cafeId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch popularity settings",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": settings,
+	})
+}
+
+// SetPopularitySettings changes the thresholds the popularity job uses for
+// the cafe. They apply from the next run of the job.
+func (s *Server) SetPopularitySettings(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.PopularitySettingsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	switch {
+	case req.HalfLifeDays < 0:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "half_life_days must be positive"})
+	case req.BestsellerTopPercent < 0 || req.BestsellerTopPercent > 100:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bestseller_top_percent must be between 0 and 100"})
+	case req.TrendingGrowth < 0:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "trending_growth must be positive"})
+	case req.BestRatedMinRating < 0 || req.BestRatedMinRating > 5:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "best_rated_min_rating must be between 1 and 5"})
+	case req.BestsellerMinOrders < 0 || req.TrendingMinOrders < 0 || req.BestRatedMinRatings < 0:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Minimums cannot be negative"})
+	}
+
+	settings, err := s.popularitySettings(cafeId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch popularity settings",
+		})
+	}
+
+	if req.HalfLifeDays > 0 {
+		settings.HalfLifeDays = req.HalfLifeDays
+	}
+	if req.BestsellerTopPercent > 0 {
+		settings.BestsellerTopPercent = req.BestsellerTopPercent
+	}
+	if req.BestsellerMinOrders > 0 {
+		settings.BestsellerMinOrders = req.BestsellerMinOrders
+	}
+	if req.TrendingMinOrders > 0 {
+		settings.TrendingMinOrders = req.TrendingMinOrders
+	}
+	if req.TrendingGrowth > 0 {
+		settings.TrendingGrowth = req.TrendingGrowth
+	}
+	if req.BestRatedMinRating > 0 {
+		settings.BestRatedMinRating = req.BestRatedMinRating
+	}
+	if req.BestRatedMinRatings > 0 {
+		settings.BestRatedMinRatings = req.BestRatedMinRatings
+	}
+
+	if err := s.Db.Save(&settings).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save popularity settings",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Popularity settings updated successfully",
+		"data":    settings,
+	})
+}
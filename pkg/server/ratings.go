@@ -0,0 +1,207 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/structures"
+	"database/sql"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+// Weighted ratings start at ratingPrior and move towards the real average as
+// ratings come in, as if ratingPriorWeight ratings of ratingPrior were given.
+// A single 5 star rating does not put an item above one rated 4.8 by hundreds.
+const (
+	ratingPrior       = 3.5
+	ratingPriorWeight = 5
+)
+
+// bayesianRating is the average of the ratings smoothed towards the prior
+func bayesianRating(sum float64, count int, prior float64) float64 {
+	return (sum + prior*ratingPriorWeight) / float64(count+ratingPriorWeight)
+}
+
+// ratingAggregates updates rating_sum and total_ratings by the deltas and
+// derives rating and weighted_rating from them, all in one statement. Postgres
+// rereads a row updated concurrently before applying it, so no rating is lost.
+const ratingAggregates = `
+	rating_sum = rating_sum + ?,
+	total_ratings = total_ratings + ?,
+	rating = COALESCE((rating_sum + ?)::float / NULLIF(total_ratings + ?, 0), 0),
+	weighted_rating = (rating_sum + ? + ?::float * ?) / (total_ratings + ? + ?)`
+
+func ratingAggregateArgs(rating int) []interface{} {
+	return []interface{}{rating, 1, rating, 1, rating, ratingPrior, ratingPriorWeight, 1, ratingPriorWeight}
+}
+
+// addItemRating counts one rating of an item
+func addItemRating(tx *gorm.DB, itemID uint, rating int) error {
+	args := append(ratingAggregateArgs(rating), itemID)
+	return tx.Exec("UPDATE menu_items SET"+ratingAggregates+" WHERE id = ?", args...).Error
+}
+
+// addCafeRating counts one rating of a cafe
+func addCafeRating(tx *gorm.DB, cafeID uint, rating int) error {
+	args := append(ratingAggregateArgs(rating), cafeID)
+	return tx.Exec("UPDATE cafes SET"+ratingAggregates+" WHERE id = ?", args...).Error
+}
+
+// rebuildRatings recomputes the aggregates of every item and cafe from the
+// feedback tables. Ratings outside 1 to 5 are ignored.
+func rebuildRatings(tx *gorm.DB) error {
+	for _, source := range []struct{ table, feedback, key string }{
+		{"menu_items", "item_feedbacks", "item_id"},
+		{"cafes", "cafe_feedbacks", "cafe_id"},
+	} {
+		if err := tx.Exec(`
+			UPDATE `+source.table+` t SET
+				rating_sum = COALESCE(a.rating_sum, 0),
+				total_ratings = COALESCE(a.ratings, 0),
+				rating = COALESCE(a.rating_sum::float / NULLIF(a.ratings, 0), 0),
+				weighted_rating = (COALESCE(a.rating_sum, 0) + ?::float * ?) / (COALESCE(a.ratings, 0) + ?)
+			FROM `+source.table+` r
+			LEFT JOIN (
+				SELECT `+source.key+` AS id, SUM(rating) AS rating_sum, COUNT(*) AS ratings
+				FROM `+source.feedback+`
+				WHERE rating BETWEEN 1 AND 5
+				GROUP BY `+source.key+`
+			) a ON a.id = r.id
+			WHERE t.id = r.id`,
+			ratingPrior, ratingPriorWeight, ratingPriorWeight).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeDuplicateItemRatings keeps the newest of duplicate item ratings and
+// adds the index that allows one rating per user, item and session. It
+// returns how many ratings were removed.
+func removeDuplicateItemRatings(tx *gorm.DB) (int64, error) {
+	result := tx.Exec(`DELETE FROM item_feedbacks a USING item_feedbacks b
+		WHERE a.user_id = b.user_id AND a.item_id = b.item_id AND a.session_id = b.session_id AND a.id < b.id`)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_item_feedback_user_session
+		ON item_feedbacks (user_id, item_id, session_id)`).Error; err != nil {
+		return 0, err
+	}
+	return result.RowsAffected, nil
+}
+
+// migrateRatings removes duplicate item ratings before their unique index is
+// created and fills rating_sum and weighted_rating of the existing rows
+func migrateRatings(tx *gorm.DB) error {
+	if !tx.HasTable(&structures.ItemFeedback{}) {
+		if err := tx.AutoMigrate(&structures.ItemFeedback{}).Error; err != nil {
+			return err
+		}
+	}
+	if _, err := removeDuplicateItemRatings(tx); err != nil {
+		return err
+	}
+	if err := rebuildRatings(tx); err != nil {
+		return err
+	}
+	// Ratings are shown on the menu of every cafe
+	return tx.Exec("UPDATE cafes SET menu_revision = menu_revision + 1").Error
+}
+
+// RunRatingRebuildJob keeps the newest of duplicate item ratings, enforces one
+// rating per user, item and session, and recomputes every rating aggregate.
+// The ratings are first migrated at startup, this repairs them.
+func (s *Server) RunRatingRebuildJob(c *fiber.Ctx) error {
+	tx := s.Db.Begin()
+
+	duplicates, err := removeDuplicateItemRatings(tx)
+	if err != nil {
+		tx.Rollback()
+		log.Println("❌ Failed to remove duplicate item ratings:", err)
+		return err
+	}
+
+	if err := rebuildRatings(tx); err != nil {
+		tx.Rollback()
+		log.Println("❌ Failed to rebuild ratings:", err)
+		return err
+	}
+
+	// Ratings are shown on the menu of every cafe
+	if err := tx.Exec("UPDATE cafes SET menu_revision = menu_revision + 1").Error; err != nil {
+		tx.Rollback()
+		log.Println("❌ Failed to invalidate menus:", err)
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Println("❌ Failed to commit ratings:", err)
+		return err
+	}
+
+	log.Printf("Rating rebuild removed %d duplicate item ratings\n", duplicates)
+	if c == nil {
+		return nil
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":    "Ratings rebuilt",
+		"duplicates": duplicates,
+	})
+}
+
+// recordItemRating saves the rating of an item by a user in a session and
+// counts it. It reports false when the user already rated the item in the
+// session, the first rating stands.
+func recordItemRating(tx *gorm.DB, feedback structures.ItemFeedback, cafeID uint) (bool, error) {
+	result := tx.Exec(`INSERT INTO item_feedbacks (user_id, item_id, rating, session_id, created_at)
+		SELECT ?, id, ?, ?, NOW() FROM menu_items WHERE id = ? AND cafe_id = ?
+		ON CONFLICT (user_id, item_id, session_id) DO NOTHING`,
+		feedback.UserID, feedback.Rating, feedback.SessionID, feedback.ItemID, cafeID)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	return true, addItemRating(tx, feedback.ItemID, feedback.Rating)
+}
+
+// recordCafeFeedback saves the feedback of a user on a cafe in a session and
+// fills in its ID. It reports false when the user already gave feedback in
+// the session, the first feedback stands.
+func recordCafeFeedback(tx *gorm.DB, feedback *structures.CafeFeedback) (bool, error) {
+	err := tx.Raw(`INSERT INTO cafe_feedbacks (user_id, cafe_id, rating, would_return, review, session_id, created_at,
+			review_status, moderation_reason, order_id, owner_reply, sentiment, analyser, analysis_error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, '', '', '', '')
+		ON CONFLICT (user_id, cafe_id, session_id) DO NOTHING
+		RETURNING id`,
+		feedback.UserID, feedback.CafeID, feedback.Rating, feedback.WouldReturn, feedback.Review, feedback.SessionID,
+		feedback.CreatedAt, feedback.ReviewStatus, feedback.ModerationReason, feedback.OrderID).
+		Row().Scan(&feedback.ID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// migrateCafeFeedback keeps the first feedback of a user on a cafe in a
+// session, adds the index that keeps it that way and recounts the ratings
+// of the cafes
+func migrateCafeFeedback(tx *gorm.DB) error {
+	if err := tx.Exec(`DELETE FROM feedback_topics t USING cafe_feedbacks a, cafe_feedbacks b
+		WHERE t.feedback_id = a.id
+		AND a.user_id = b.user_id AND a.cafe_id = b.cafe_id AND a.session_id = b.session_id AND a.id > b.id`).Error; err != nil {
+		return err
+	}
+	result := tx.Exec(`DELETE FROM cafe_feedbacks a USING cafe_feedbacks b
+		WHERE a.user_id = b.user_id AND a.cafe_id = b.cafe_id AND a.session_id = b.session_id AND a.id > b.id`)
+	if result.Error != nil {
+		return result.Error
+	}
+	if err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_cafe_feedback_user_session
+		ON cafe_feedbacks (user_id, cafe_id, session_id)`).Error; err != nil {
+		return err
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	return rebuildRatings(tx)
+}
@@ -1,11 +1,14 @@
 package server
 
 import (
+	"coffeeMustacheBackend/pkg/helper"
 	"coffeeMustacheBackend/pkg/structures"
+	"crypto/subtle"
 	"fmt"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
 	"github.com/segmentio/ksuid"
 )
 
@@ -15,9 +18,8 @@ func (s *Server) RecordUserSession(c *fiber.Ctx) error {
 
 	// Parse table ID from request body
 	type RecordSessionRequest struct {
-		TableId     string `json:"table_id"`
-		CafeId      uint   `json:"cafe_id"`
-		CompletePos bool   `json:"complete_pos"`
+		TableId string `json:"table_id"`
+		CafeId  uint   `json:"cafe_id"`
 	}
 
 	var req RecordSessionRequest
@@ -28,24 +30,35 @@ func (s *Server) RecordUserSession(c *fiber.Ctx) error {
 	}
 
 	// Check if the given table ID exists for given cafe ID
-	// var table structures.Table
-	// if err := s.Db.Where("name =? AND cafe_id =?", req.TableId, req.CafeId).First(&table).Error; err != nil {
-	// 	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-	// 		"error": "Table not found",
-	// 	})
-	// }
+	var table structures.Table
+	if err := s.Db.Where("name = ? AND cafe_id = ?", req.TableId, req.CafeId).First(&table).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Table not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch table",
+		})
+	}
 
 	status := true
 
-	// Check if the cafe has a complete_pos true or false
-	// var cafe structures.Cafe
-	// if err := s.Db.Where("id = ?", req.CafeId).First(&cafe).Error; err != nil {
-	// 	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-	// 		"error": "Cafe not found",
-	// 	})
-	// }
+	// Whether the cafe has a complete POS decides if guests need the table
+	// code, so it is read from the cafe rather than trusted from the request
+	var cafe structures.Cafe
+	if err := s.Db.Where("id = ?", req.CafeId).First(&cafe).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Cafe not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch cafe",
+		})
+	}
 
-	if !req.CompletePos {
+	if !cafe.CompletePos {
 		// Get session details from the session table
 		var session structures.Session
 		if err := s.Db.Where("table_name = ? AND cafe_id = ? AND session_status = ?", req.TableId, req.CafeId, structures.Active).First(&session).Error; err != nil {
@@ -54,6 +67,13 @@ func (s *Server) RecordUserSession(c *fiber.Ctx) error {
 			})
 		}
 
+		// Without a complete POS there is no table code step, so the user joins directly
+		if err := s.joinSession(session.SessionID, userId, structures.Guest); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to join session",
+			})
+		}
+
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"message":    "User session recorded successfully",
 			"session_id": session.SessionID,
@@ -67,19 +87,27 @@ func (s *Server) RecordUserSession(c *fiber.Ctx) error {
 	if err := s.Db.Where("table_name = ? AND session_status = ? AND cafe_id = ?", req.TableId, "Active", req.CafeId).First(&session).Error; err != nil {
 		// If no active session, create a new session with a unique session ID using ksuid
 
-		// Generate a random 4-digit numeric code for the table
-		tableCode := fmt.Sprintf("%04d", time.Now().UnixNano()%10000)
-
 		// if record not found create a new session
 		if err.Error() == "record not found" {
+			// Generate a random 4-digit numeric code for the table
+			tableCode, err := helper.GenerateTableCode()
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to generate table code",
+				})
+			}
+
+			now := time.Now()
 			newSession := structures.Session{
-				SessionID:     ksuid.New().String(),
-				TableName:     req.TableId,
-				TableCode:     tableCode,
-				CafeID:        req.CafeId,
-				SessionStatus: structures.Active,
-				StartTime:     time.Now(),
-				CreatedBy:     userId,
+				SessionID:          ksuid.New().String(),
+				TableName:          req.TableId,
+				TableCode:          tableCode,
+				CafeID:             req.CafeId,
+				SessionStatus:      structures.Active,
+				StartTime:          now,
+				CreatedBy:          userId,
+				LastActivityAt:     &now,
+				TableCodeRotatedAt: &now,
 			}
 
 			if err := s.Db.Create(&newSession).Error; err != nil {
@@ -88,6 +116,12 @@ func (s *Server) RecordUserSession(c *fiber.Ctx) error {
 				})
 			}
 
+			if err := s.joinSession(newSession.SessionID, userId, structures.Host); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to join session",
+				})
+			}
+
 			// Assign the newly created session for further user session checks
 			session = newSession
 			status = false
@@ -100,26 +134,37 @@ func (s *Server) RecordUserSession(c *fiber.Ctx) error {
 	}
 
 	if session.TableCode == "" {
-		// Generate a random 4-digit numeric code for the table
-		tableCode := fmt.Sprintf("%04d", time.Now().UnixNano()%10000)
-		session.TableCode = tableCode
-
-		// Update the session with the new table code
-		if err := s.Db.Model(&structures.Session{}).Where("session_id = ?", session.SessionID).Update("table_code", tableCode).Error; err != nil {
+		// Issue a table code for sessions created before codes existed
+		tableCode, err := s.rotateTableCode(session.SessionID)
+		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to update session with table code",
 			})
 		}
+		session.TableCode = tableCode
 	}
 
-	// Return success response
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+	response := fiber.Map{
 		"message":    "User session recorded successfully",
 		"session_id": session.SessionID,
-		"table_code": session.TableCode,
 		"user_id":    userId,
 		"status":     status,
-	})
+	}
+
+	// The code proves a guest is at the table, so only the host and guests
+	// who already joined get it back. Everyone else has to ask the table.
+	isMember, err := s.isSessionMember(session, userId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch session",
+		})
+	}
+	if isMember {
+		response["table_code"] = session.TableCode
+	}
+
+	// Return success response
+	return c.Status(fiber.StatusOK).JSON(response)
 }
 
 func (s *Server) InvalidateSession(c *fiber.Ctx) error {
@@ -135,30 +180,13 @@ func (s *Server) InvalidateSession(c *fiber.Ctx) error {
 		})
 	}
 
-	// Find and update the session status to Inactive and set the end time
-	if err := s.Db.Model(&structures.Session{}).
-		Where("session_id = ?", req.SessionID).
-		Updates(map[string]interface{}{
-			"session_status": structures.Inactive,
-			"end_time":       time.Now(),
-		}).Error; err != nil {
+	// Mark the session and its user sessions inactive, recording a manual end
+	if err := s.endSession(req.SessionID, structures.SessionEndedManually); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to invalidate session",
 		})
 	}
 
-	// Invalidate the user sessions related to this session ID by setting LeftAt and updating the status
-	if err := s.Db.Model(&structures.UserSession{}).
-		Where("session_id = ? AND left_at IS NULL", req.SessionID).
-		Updates(map[string]interface{}{
-			"left_at": time.Now(),
-			"status":  structures.UserInactive,
-		}).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to invalidate user sessions",
-		})
-	}
-
 	// Return success response
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Session invalidated successfully",
@@ -212,7 +240,7 @@ func (s *Server) VerifyTableCode(c *fiber.Ctx) error {
 	}
 
 	var session structures.Session
-	if err := s.Db.Where("session_id = ? AND table_code = ? AND session_status = ?", req.SessionID, req.TableCode, structures.Active).First(&session).Error; err != nil {
+	if err := s.Db.Where("session_id = ? AND session_status = ?", req.SessionID, structures.Active).First(&session).Error; err != nil {
 		if err.Error() == "record not found" {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "Invalid table code or session ID",
@@ -223,8 +251,76 @@ func (s *Server) VerifyTableCode(c *fiber.Ctx) error {
 		})
 	}
 
+	userId := uint(c.Locals("userId").(float64))
+
+	// Reject attempts while the user is locked out after too many wrong codes
+	now := time.Now()
+	var attempt structures.TableCodeAttempt
+	if err := s.Db.Where("session_id = ? AND user_id = ?", session.SessionID, userId).First(&attempt).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify table code",
+		})
+	}
+	if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":       "Too many incorrect attempts, please try again later",
+			"retry_after": int(attempt.LockedUntil.Sub(now).Seconds()),
+		})
+	}
+
+	if session.TableCode == "" || subtle.ConstantTimeCompare([]byte(session.TableCode), []byte(req.TableCode)) != 1 {
+		if err := s.recordFailedCodeAttempt(session.SessionID, userId, now); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to verify table code",
+			})
+		}
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invalid table code or session ID",
+		})
+	}
+
+	if attempt.ID != 0 {
+		if err := s.Db.Delete(&attempt).Error; err != nil {
+			fmt.Println("Failed to reset table code attempts:", err)
+		}
+	}
+
+	// A verified table code admits the user to the session
+	if err := s.joinSession(session.SessionID, userId, structures.Guest); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to join session",
+		})
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Table code verified successfully",
 		"table":   session.TableCode,
 	})
 }
+
+// recordFailedCodeAttempt counts a wrong table code for the user and locks
+// them out once they reach the limit
+func (s *Server) recordFailedCodeAttempt(sessionID string, userId uint, now time.Time) error {
+	settings := s.sessionSettings()
+
+	var counts []struct{ Failures int }
+	if err := s.Db.Raw(`
+		INSERT INTO table_code_attempts (session_id, user_id, failures, updated_at)
+		VALUES (?, ?, 1, NOW())
+		ON CONFLICT (session_id, user_id) DO UPDATE SET
+			failures = table_code_attempts.failures + 1,
+			updated_at = NOW()
+		RETURNING failures`, sessionID, userId).Scan(&counts).Error; err != nil {
+		return err
+	}
+	if len(counts) == 0 || counts[0].Failures < settings.MaxCodeAttempts {
+		return nil
+	}
+
+	return s.Db.Model(&structures.TableCodeAttempt{}).
+		Where("session_id = ? AND user_id = ?", sessionID, userId).
+		UpdateColumns(map[string]interface{}{
+			"failures":     0,
+			"locked_until": now.Add(settings.CodeLockout),
+		}).Error
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	maxReviewLength      = 2000
+	maxReviewReplyLength = 1000
+	reviewPageSize       = 20
+	reviewAwaitingCheck  = "Awaiting automatic check" // Moderation reason until the classifier ran
+)
+
+// reviewClassifier returns the configured classifier for review text
+func (s *Server) reviewClassifier() (helper.ReviewClassifier, error) {
+	switch s.Config.REVIEW_CLASSIFIER {
+	case "", "wordlist":
+		return helper.WordListClassifier{}, nil
+	case "openai":
+		if s.Config.OPEN_AI_API_KEY == "" {
+			return nil, errors.New("OPEN_AI_API_KEY is not set")
+		}
+		return helper.OpenAIModerationClassifier{APIKey: s.Config.OPEN_AI_API_KEY}, nil
+	default:
+		return nil, fmt.Errorf("unknown review classifier %q", s.Config.REVIEW_CLASSIFIER)
+	}
+}
+
+// reviewerOrder finds the order a guest placed in the session, reviews are
+// only accepted from guests who ordered.
+func (s *Server) reviewerOrder(userID, cafeID uint, sessionID string) (string, error) {
+	var order structures.Order
+	err := s.Db.Select("order_id").
+		Where("session_id = ? AND user_id = ? AND cafe_id = ? AND order_status <> ?", sessionID, userID, cafeID, structures.OrderCancelled).
+		Order("order_time DESC").First(&order).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return "", nil
+	}
+	return order.OrderID, err
+}
+
+// firstName is how a reviewer is shown publicly
+func firstName(name string) string {
+	if fields := strings.Fields(name); len(fields) > 0 {
+		return fields[0]
+	}
+	return "Guest"
+}
+
+// GetCafeReviews lists the approved reviews of a cafe, newest first. It is
+// public, pass the next_cursor of a page to get the following one.
+func (s *Server) GetCafeReviews(c *fiber.Ctx) error {
+	cafeID, err := strconv.ParseUint(c.Query("cafe_id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cafe_id is required",
+		})
+	}
+
+	limit := c.QueryInt("limit", reviewPageSize)
+	if limit < 1 || limit > 50 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "limit must be between 1 and 50",
+		})
+	}
+
+	query := s.Db.Table("cafe_feedbacks f").
+		Select("f.id, u.name AS reviewer, f.rating, f.would_return, f.review, COALESCE(f.order_id, '') <> '' AS verified, f.owner_reply, f.replied_at, f.created_at").
+		Joins("LEFT JOIN users u ON u.id = f.user_id").
+		Where("f.cafe_id = ? AND f.review_status = ?", cafeID, structures.ReviewApproved)
+	if cursor := c.Query("cursor"); cursor != "" {
+		before, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		query = query.Where("f.id < ?", before)
+	}
+
+	reviews := []structures.CafeReview{}
+	if err := query.Order("f.id DESC").Limit(limit + 1).Scan(&reviews).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch reviews",
+		})
+	}
+
+	nextCursor := ""
+	if len(reviews) > limit {
+		reviews = reviews[:limit]
+		nextCursor = strconv.FormatUint(uint64(reviews[limit-1].ID), 10)
+	}
+	for i := range reviews {
+		reviews[i].Reviewer = firstName(reviews[i].Reviewer)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":        reviews,
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetReviewQueue lists the reviews of the cafe waiting for the owner, oldest first
+func (s *Server) GetReviewQueue(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var reviews []structures.CafeFeedback
+	if err := s.Db.Where("cafe_id = ? AND review_status = ?", cafeId, structures.ReviewPending).
+		Order("id ASC").Limit(100).Find(&reviews).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch reviews",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": reviews,
+	})
+}
+
+// ModerateReview approves or rejects a review. Approved reviews can still be
+// rejected later and the other way round.
+func (s *Server) ModerateReview(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.ModerateReviewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var status structures.ReviewStatus
+	switch req.Action {
+	case "approve":
+		status = structures.ReviewApproved
+	case "reject":
+		status = structures.ReviewRejected
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "action must be approve or reject",
+		})
+	}
+	if len(req.Reason) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "reason cannot be longer than 255 characters",
+		})
+	}
+
+	now := time.Now()
+	result := s.Db.Model(&structures.CafeFeedback{}).
+		Where("id = ? AND cafe_id = ? AND review_status <> ''", req.ReviewID, cafeId).
+		UpdateColumns(map[string]interface{}{
+			"review_status":     status,
+			"moderation_reason": req.Reason,
+			"moderated_at":      now,
+		})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to moderate review",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Review not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Review moderated successfully",
+	})
+}
+
+// ReplyToReview sets the public reply of the owner to a review
+func (s *Server) ReplyToReview(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.ReviewReplyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	req.Reply = strings.TrimSpace(req.Reply)
+	if len(req.Reply) > maxReviewReplyLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("reply cannot be longer than %d characters", maxReviewReplyLength),
+		})
+	}
+
+	updates := map[string]interface{}{"owner_reply": req.Reply, "replied_at": nil}
+	if req.Reply != "" {
+		updates["replied_at"] = time.Now()
+	}
+
+	result := s.Db.Model(&structures.CafeFeedback{}).
+		Where("id = ? AND cafe_id = ? AND review_status IN (?)", req.ReviewID, cafeId,
+			[]structures.ReviewStatus{structures.ReviewPending, structures.ReviewApproved}).
+		UpdateColumns(updates)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save reply",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Review not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Reply saved successfully",
+	})
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sessionSettings holds the session lifecycle configuration
+type sessionSettings struct {
+	IdleTimeout      time.Duration // Close sessions with no activity for this long
+	PaidGrace        time.Duration // Close fully paid sessions after this long without activity
+	CodeRotation     time.Duration // Issue a new table code after this long
+	MaxCodeAttempts  int           // Failed VerifyTableCode attempts before locking the user out
+	CodeLockout      time.Duration // How long VerifyTableCode stays locked for them
+	activityThrottle time.Duration // Minimum gap between last_activity_at writes
+}
+
+func (s *Server) sessionSettings() sessionSettings {
+	return sessionSettings{
+		IdleTimeout:      helper.MinutesOrDefault(s.Config.SESSION_IDLE_MINUTES, 120),
+		PaidGrace:        helper.MinutesOrDefault(s.Config.SESSION_PAID_GRACE_MINUTES, 15),
+		CodeRotation:     helper.MinutesOrDefault(s.Config.TABLE_CODE_ROTATION_MINUTES, 30),
+		MaxCodeAttempts:  helper.IntOrDefault(s.Config.TABLE_CODE_MAX_ATTEMPTS, 5),
+		CodeLockout:      helper.MinutesOrDefault(s.Config.TABLE_CODE_LOCK_MINUTES, 5),
+		activityThrottle: time.Minute,
+	}
+}
+
+// endSession marks the session and all of its user sessions inactive and
+// records why it ended.
+func (s *Server) endSession(sessionID string, reason structures.SessionEndReason) error {
+	now := time.Now()
+
+	if err := s.Db.Model(&structures.Session{}).
+		Where("session_id = ? AND session_status = ?", sessionID, structures.Active).
+		Updates(map[string]interface{}{
+			"session_status": structures.Inactive,
+			"end_time":       now,
+			"end_reason":     reason,
+		}).Error; err != nil {
+		return err
+	}
+
+	if err := s.Db.Model(&structures.UserSession{}).
+		Where("session_id = ? AND left_at IS NULL", sessionID).
+		Updates(map[string]interface{}{
+			"left_at": now,
+			"status":  structures.UserInactive,
+		}).Error; err != nil {
+		return err
+	}
+
+	// Guests who ordered are asked for feedback a while after they leave
+	if err := s.scheduleFeedbackPrompts(sessionID); err != nil {
+		log.Printf("❌ Failed to schedule feedback prompts for session %s: %v\n", sessionID, err)
+	}
+	return nil
+}
+
+// touchSession records activity on the session. Writes are throttled so a
+// busy table does not update the row on every request.
+func (s *Server) touchSession(sessionID string) error {
+	now := time.Now()
+	return s.Db.Model(&structures.Session{}).
+		Where("session_id = ? AND (last_activity_at IS NULL OR last_activity_at < ?)", sessionID, now.Add(-s.sessionSettings().activityThrottle)).
+		UpdateColumn("last_activity_at", now).Error
+}
+
+// rotateTableCode issues a new table code and clears failed attempts
+func (s *Server) rotateTableCode(sessionID string) (string, error) {
+	tableCode, err := helper.GenerateTableCode()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.Db.Model(&structures.Session{}).
+		Where("session_id = ?", sessionID).
+		Updates(map[string]interface{}{
+			"table_code":            tableCode,
+			"table_code_rotated_at": time.Now(),
+		}).Error; err != nil {
+		return "", err
+	}
+
+	if err := s.Db.Where("session_id = ?", sessionID).Delete(&structures.TableCodeAttempt{}).Error; err != nil {
+		return "", err
+	}
+
+	return tableCode, nil
+}
+
+// RunSessionExpiryJob closes idle and fully paid sessions and rotates the
+// table codes of the sessions that remain open.
+func (s *Server) RunSessionExpiryJob(c *fiber.Ctx) error {
+	settings := s.sessionSettings()
+	now := time.Now()
+
+	// Sessions with no activity within the idle timeout
+	var idleSessionIDs []string
+	if err := s.Db.Model(&structures.Session{}).
+		Where("session_status = ? AND COALESCE(last_activity_at, updated_at) < ?", structures.Active, now.Add(-settings.IdleTimeout)).
+		Pluck("session_id", &idleSessionIDs).Error; err != nil {
+		log.Println("❌ Failed to fetch idle sessions:", err)
+		return err
+	}
+
+	for _, sessionID := range idleSessionIDs {
+		if err := s.endSession(sessionID, structures.SessionEndedIdle); err != nil {
+			log.Printf("❌ Failed to close idle session %s: %v\n", sessionID, err)
+		}
+	}
+
+	// Sessions where every order has been paid and the table has gone quiet
+	var paidSessionIDs []string
+	if err := s.Db.Raw(`
+		SELECT s.session_id
+		FROM sessions s
+		WHERE s.session_status = ?
+		AND COALESCE(s.last_activity_at, s.updated_at) < ?
+		AND EXISTS (
+			SELECT 1 FROM orders o
+			WHERE o.session_id = s.session_id AND o.order_status <> ?
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM orders o
+			WHERE o.session_id = s.session_id AND o.order_status <> ? AND o.payment_status <> ?
+		)
+	`, structures.Active, now.Add(-settings.PaidGrace), structures.OrderCancelled, structures.OrderCancelled, structures.Completed).
+		Pluck("session_id", &paidSessionIDs).Error; err != nil {
+		log.Println("❌ Failed to fetch paid sessions:", err)
+		return err
+	}
+
+	for _, sessionID := range paidSessionIDs {
+		if err := s.endSession(sessionID, structures.SessionEndedBillPaid); err != nil {
+			log.Printf("❌ Failed to close paid session %s: %v\n", sessionID, err)
+		}
+	}
+
+	// Rotate table codes that have been in use for too long
+	var staleCodeSessionIDs []string
+	if err := s.Db.Model(&structures.Session{}).
+		Where("session_status = ? AND COALESCE(table_code_rotated_at, start_time) < ?", structures.Active, now.Add(-settings.CodeRotation)).
+		Pluck("session_id", &staleCodeSessionIDs).Error; err != nil {
+		log.Println("❌ Failed to fetch sessions for code rotation:", err)
+		return err
+	}
+
+	for _, sessionID := range staleCodeSessionIDs {
+		if _, err := s.rotateTableCode(sessionID); err != nil {
+			log.Printf("❌ Failed to rotate table code for session %s: %v\n", sessionID, err)
+		}
+	}
+
+	fmt.Printf("Session expiry job done: %d idle, %d paid, %d codes rotated\n", len(idleSessionIDs), len(paidSessionIDs), len(staleCodeSessionIDs))
+
+	if c == nil {
+		return nil
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"closed_idle":   len(idleSessionIDs),
+		"closed_paid":   len(paidSessionIDs),
+		"codes_rotated": len(staleCodeSessionIDs),
+	})
+}
@@ -0,0 +1,508 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+func (s *Server) CreateSeatingArea(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.SeatingAreaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name is required",
+		})
+	}
+
+	seatingArea := structures.SeatingArea{
+		Name:        req.Name,
+		Description: req.Description,
+		CafeID:      cafeId,
+	}
+
+	if err := s.Db.Create(&seatingArea).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create seating area",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Seating area created successfully",
+		"data":    seatingArea,
+	})
+}
+
+func (s *Server) GetSeatingAreas(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var seatingAreas []structures.SeatingArea
+	if err := s.Db.Where("cafe_id = ?", cafeId).Order("name ASC").Find(&seatingAreas).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch seating areas",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": seatingAreas,
+	})
+}
+
+func (s *Server) UpdateSeatingArea(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.SeatingAreaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var seatingArea structures.SeatingArea
+	if err := s.Db.Where("id = ? AND cafe_id = ?", req.ID, cafeId).First(&seatingArea).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Seating area not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	if name := strings.TrimSpace(req.Name); name != "" {
+		seatingArea.Name = name
+	}
+	seatingArea.Description = req.Description
+
+	if err := s.Db.Model(&structures.SeatingArea{}).
+		Where("id = ?", seatingArea.ID).
+		Updates(map[string]interface{}{
+			"name":        seatingArea.Name,
+			"description": seatingArea.Description,
+		}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update seating area",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Seating area updated successfully",
+		"data":    seatingArea,
+	})
+}
+
+func (s *Server) DeleteSeatingArea(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.SeatingAreaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	// A seating area can only be removed once its tables have been moved or deleted
+	var tableCount int
+	if err := s.Db.Model(&structures.Table{}).
+		Where("seating_area_id = ? AND cafe_id = ?", req.ID, cafeId).
+		Count(&tableCount).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+	if tableCount > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Seating area still has tables",
+		})
+	}
+
+	result := s.Db.Where("id = ? AND cafe_id = ?", req.ID, cafeId).Delete(&structures.SeatingArea{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete seating area",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Seating area not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Seating area deleted successfully",
+	})
+}
+
+func (s *Server) CreateTable(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.TableRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.Capacity == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name and capacity are required",
+		})
+	}
+
+	if status, message := s.validateTable(cafeId, 0, req); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	table := structures.Table{
+		Name:          req.Name,
+		Description:   req.Description,
+		CafeID:        cafeId,
+		Capacity:      req.Capacity,
+		SeatingAreaID: req.SeatingAreaID,
+		QRVersion:     1,
+	}
+
+	if err := s.Db.Create(&table).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create table",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Table created successfully",
+		"data":    table,
+	})
+}
+
+func (s *Server) GetTables(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var tables []structures.Table
+	if err := s.Db.Where("cafe_id = ?", cafeId).Order("seating_area_id ASC, name ASC").Find(&tables).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch tables",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": tables,
+	})
+}
+
+func (s *Server) UpdateTable(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.TableRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var table structures.Table
+	if err := s.Db.Where("id = ? AND cafe_id = ?", req.ID, cafeId).First(&table).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Table not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	// Fill in fields that were not sent so validation sees the final state
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = table.Name
+	}
+	if req.Capacity == 0 {
+		req.Capacity = table.Capacity
+	}
+	if req.SeatingAreaID == 0 {
+		req.SeatingAreaID = table.SeatingAreaID
+	}
+
+	if status, message := s.validateTable(cafeId, table.ID, req); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	// Renaming a table changes the QR payload, so bump the version to retire old codes
+	qrVersion := table.QRVersion
+	if req.Name != table.Name {
+		qrVersion++
+	}
+
+	if err := s.Db.Model(&structures.Table{}).
+		Where("id = ?", table.ID).
+		Updates(map[string]interface{}{
+			"name":            req.Name,
+			"description":     req.Description,
+			"capacity":        req.Capacity,
+			"seating_area_id": req.SeatingAreaID,
+			"qr_version":      qrVersion,
+		}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update table",
+		})
+	}
+
+	table.Name = req.Name
+	table.Description = req.Description
+	table.Capacity = req.Capacity
+	table.SeatingAreaID = req.SeatingAreaID
+	table.QRVersion = qrVersion
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Table updated successfully",
+		"data":    table,
+	})
+}
+
+func (s *Server) DeleteTable(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.TableRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var table structures.Table
+	if err := s.Db.Where("id = ? AND cafe_id = ?", req.ID, cafeId).First(&table).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Table not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	// Do not remove a table while guests are seated at it
+	var activeSessions int
+	if err := s.Db.Model(&structures.Session{}).
+		Where("table_name = ? AND cafe_id = ? AND session_status = ?", table.Name, cafeId, structures.Active).
+		Count(&activeSessions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+	if activeSessions > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Table has an active session",
+		})
+	}
+
+	if err := s.Db.Where("id = ?", table.ID).Delete(&structures.Table{}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete table",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Table deleted successfully",
+	})
+}
+
+// GetTableQR returns the signed QR payload for a table along with the QR
+// image, either as a base64 encoded PNG or as an SVG document.
+func (s *Server) GetTableQR(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.TableQRRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var table structures.Table
+	if err := s.Db.Where("id = ? AND cafe_id = ?", req.TableID, cafeId).First(&table).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Table not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	payload, err := helper.SignTableQR(structures.TableQRPayload{
+		CafeID:    table.CafeID,
+		TableID:   table.ID,
+		TableName: table.Name,
+		Version:   table.QRVersion,
+	}, s.qrSecret())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to sign QR payload",
+		})
+	}
+
+	content := helper.TableQRContent(payload, s.Config.QR_BASE_URL)
+
+	response := fiber.Map{
+		"table_id": table.ID,
+		"payload":  payload,
+		"content":  content,
+	}
+
+	switch req.Format {
+	case "svg":
+		svg, err := helper.QRCodeSVG(content)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate QR code",
+			})
+		}
+		response["format"] = "svg"
+		response["image"] = svg
+	case "", "png":
+		size := req.Size
+		if size <= 0 {
+			size = 512
+		}
+		png, err := helper.QRCodePNG(content, size)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate QR code",
+			})
+		}
+		response["format"] = "png"
+		response["image"] = base64.StdEncoding.EncodeToString(png)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be png or svg",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// RotateTableQR invalidates every QR code printed for a table so far
+func (s *Server) RotateTableQR(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.TableQRRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	result := s.Db.Model(&structures.Table{}).
+		Where("id = ? AND cafe_id = ?", req.TableID, cafeId).
+		Update("qr_version", gorm.Expr("qr_version + 1"))
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to rotate QR code",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Table not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "QR code rotated successfully",
+	})
+}
+
+// ResolveTableQR verifies a scanned QR payload and returns the cafe and
+// table it belongs to, so the app can start a session for that table.
+func (s *Server) ResolveTableQR(c *fiber.Ctx) error {
+	var req structures.ResolveTableQRRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	payload, err := helper.VerifyTableQR(req.Payload, s.qrSecret())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid QR code",
+		})
+	}
+
+	var table structures.Table
+	if err := s.Db.Where("id = ? AND cafe_id = ?", payload.TableID, payload.CafeID).First(&table).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Table not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Database error",
+		})
+	}
+
+	if table.QRVersion != payload.Version || table.Name != payload.TableName {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": "QR code is no longer valid",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"cafe_id":    table.CafeID,
+		"table_id":   table.ID,
+		"table_name": table.Name,
+		"capacity":   table.Capacity,
+	})
+}
+
+// validateTable checks that the seating area belongs to the cafe and that no
+// other table in the cafe already uses the name.
+func (s *Server) validateTable(cafeId, tableId uint, req structures.TableRequest) (int, string) {
+	if req.SeatingAreaID != 0 {
+		var seatingArea structures.SeatingArea
+		if err := s.Db.Where("id = ? AND cafe_id = ?", req.SeatingAreaID, cafeId).First(&seatingArea).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return fiber.StatusBadRequest, "Seating area not found"
+			}
+			return fiber.StatusInternalServerError, "Database error"
+		}
+	}
+
+	var duplicates int
+	if err := s.Db.Model(&structures.Table{}).
+		Where("cafe_id = ? AND name = ? AND id <> ?", cafeId, req.Name, tableId).
+		Count(&duplicates).Error; err != nil {
+		return fiber.StatusInternalServerError, "Database error"
+	}
+	if duplicates > 0 {
+		return fiber.StatusConflict, fmt.Sprintf("Table %s already exists", req.Name)
+	}
+
+	return fiber.StatusOK, ""
+}
+
+// qrSecret signs table QR codes and media upload tokens. It is required at
+// startup and kept apart from the JWT secret.
+func (s *Server) qrSecret() string {
+	return s.Config.QR_SECRET
+}
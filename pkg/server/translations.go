@@ -0,0 +1,293 @@
+package server
+
+import (
+	"coffeeMustacheBackend/pkg/helper"
+	"coffeeMustacheBackend/pkg/structures"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jinzhu/gorm"
+)
+
+// cafeMenuLanguage is the language the menu items of a cafe are written in
+func cafeMenuLanguage(cafe structures.Cafe) string {
+	if cafe.MenuLanguage != "" {
+		return helper.NormalizeLanguage(cafe.MenuLanguage)
+	}
+	return helper.LocaleLanguage(cafeClockFor(cafe).Locale)
+}
+
+// cafeLanguages lists the languages the menu of a cafe can be shown in, its
+// menu language first.
+func (s *Server) cafeLanguages(cafe structures.Cafe) ([]string, error) {
+	var translated []string
+	if err := s.Db.Table("menu_item_translations t").
+		Joins("JOIN menu_items m ON m.id = t.menu_item_id").
+		Where("m.cafe_id = ?", cafe.ID).
+		Pluck("DISTINCT t.language", &translated).Error; err != nil {
+		return nil, err
+	}
+	return append([]string{cafeMenuLanguage(cafe)}, translated...), nil
+}
+
+// resolveLanguage picks the language to answer in from an Accept-Language
+// style list. It falls back to the cafe's menu language.
+func (s *Server) resolveLanguage(acceptLanguage string, cafe structures.Cafe) string {
+	fallback := cafeMenuLanguage(cafe)
+	preferred := helper.ParseAcceptLanguage(acceptLanguage)
+	if len(preferred) == 0 {
+		return fallback
+	}
+
+	available, err := s.cafeLanguages(cafe)
+	if err != nil {
+		fmt.Println("Failed to load cafe languages:", err)
+		return fallback
+	}
+	if language := helper.MatchLanguage(preferred, available); language != "" {
+		return language
+	}
+	return fallback
+}
+
+// requestLanguage resolves the language of a customer request from its
+// Accept-Language header.
+func (s *Server) requestLanguage(c *fiber.Ctx, cafe structures.Cafe) string {
+	language := s.resolveLanguage(c.Get(fiber.HeaderAcceptLanguage), cafe)
+	c.Set(fiber.HeaderContentLanguage, language)
+	return language
+}
+
+// itemTranslations loads the translations of the items into a language, keyed by item id
+func (s *Server) itemTranslations(language string, itemIDs []uint) (map[uint]structures.MenuItemTranslation, error) {
+	translations := make(map[uint]structures.MenuItemTranslation)
+	if language == "" || len(itemIDs) == 0 {
+		return translations, nil
+	}
+
+	var rows []structures.MenuItemTranslation
+	if err := s.Db.Where("language = ? AND menu_item_id IN (?)", language, itemIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		translations[row.MenuItemID] = row
+	}
+	return translations, nil
+}
+
+// applyTranslation replaces the content of an item with the non empty fields of its translation
+func applyTranslation(item *structures.MenuItem, translation structures.MenuItemTranslation) {
+	if translation.Name != "" {
+		item.Name = translation.Name
+	}
+	if translation.Description != "" {
+		item.Description = translation.Description
+	}
+	if translation.ShortDescription != "" {
+		item.ShortDescription = translation.ShortDescription
+	}
+	if translation.Ingredients != "" {
+		item.Ingredients = translation.Ingredients
+	}
+	if translation.AudioURL != "" {
+		item.AudioURL = translation.AudioURL
+	}
+}
+
+// translateMenuItems translates the items in place. A failure only logs, the
+// items are then shown in the menu language.
+func (s *Server) translateMenuItems(language string, items []structures.MenuItem) {
+	itemIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		itemIDs = append(itemIDs, item.ID)
+	}
+
+	translations, err := s.itemTranslations(language, itemIDs)
+	if err != nil {
+		fmt.Println("Failed to load translations:", err)
+		return
+	}
+	for i := range items {
+		if translation, ok := translations[items[i].ID]; ok {
+			applyTranslation(&items[i], translation)
+		}
+	}
+}
+
+// SetItemTranslation creates or replaces the translation of an item into one language
+func (s *Server) SetItemTranslation(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.ItemTranslationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	language := helper.NormalizeLanguage(req.Language)
+	if len(language) < 2 || len(language) > 16 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "language must be a BCP 47 language tag",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" && req.Description == "" && req.ShortDescription == "" && req.Ingredients == "" && req.AudioURL == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Nothing to translate",
+		})
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"name", req.Name, 100},
+		{"short_description", req.ShortDescription, 255},
+		{"audio_url", req.AudioURL, 255},
+	} {
+		if len(field.value) > field.max {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("%s cannot be longer than %d characters", field.name, field.max),
+			})
+		}
+	}
+
+	var cafe structures.Cafe
+	if err := s.Db.Where("id = ?", cafeId).First(&cafe).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve cafe details",
+		})
+	}
+	if language == cafeMenuLanguage(cafe) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The menu is already written in this language, edit the item instead",
+		})
+	}
+
+	var item structures.MenuItem
+	if err := s.Db.Select("id").Where("id = ? AND cafe_id = ?", req.MenuItemID, cafeId).First(&item).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Menu item not found",
+		})
+	}
+
+	tx := s.Db.Begin()
+
+	var translation structures.MenuItemTranslation
+	err := tx.Where("menu_item_id = ? AND language = ?", item.ID, language).First(&translation).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save translation",
+		})
+	}
+
+	translation.MenuItemID = item.ID
+	translation.Language = language
+	translation.Name = req.Name
+	translation.Description = req.Description
+	translation.ShortDescription = req.ShortDescription
+	translation.Ingredients = req.Ingredients
+	if translation.AudioURL != req.AudioURL {
+		// Audio set by hand is kept, an emptied one is generated again
+		translation.AudioURL = req.AudioURL
+		translation.AudioSourceHash = ""
+	}
+
+	// Save writes empty fields too, so clearing a field works
+	if err := tx.Save(&translation).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save translation",
+		})
+	}
+
+	if err := invalidateMenuCache(tx, cafeId); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save translation",
+		})
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save translation",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Translation saved successfully",
+		"data":    translation,
+	})
+}
+
+func (s *Server) GetItemTranslations(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.ItemTranslationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var translations []structures.MenuItemTranslation
+	if err := s.Db.Where("menu_item_id = ? AND menu_item_id IN (SELECT id FROM menu_items WHERE cafe_id = ?)", req.MenuItemID, cafeId).
+		Order("language ASC").Find(&translations).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch translations",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": translations,
+	})
+}
+
+func (s *Server) DeleteItemTranslation(c *fiber.Ctx) error {
+	cafeId := uint(c.Locals("cafeId").(float64))
+
+	var req structures.ItemTranslationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	tx := s.Db.Begin()
+
+	result := tx.Where("menu_item_id = ? AND language = ? AND menu_item_id IN (SELECT id FROM menu_items WHERE cafe_id = ?)",
+		req.MenuItemID, helper.NormalizeLanguage(req.Language), cafeId).Delete(&structures.MenuItemTranslation{})
+	if result.Error != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete translation",
+		})
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Translation not found",
+		})
+	}
+
+	if err := invalidateMenuCache(tx, cafeId); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete translation",
+		})
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete translation",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "Translation deleted successfully",
+	})
+}
@@ -84,7 +84,7 @@ func (s *Server) UpgradeCart(c *fiber.Ctx) error {
 		err := s.Db.Raw(`
 			SELECT id AS item_id, name, category, price
 			FROM menu_items 
-			WHERE id NOT IN (?) AND cafe_id = ?
+			WHERE id NOT IN (?) AND cafe_id = ? AND archived_at IS NULL
 		`, req.ItemIDs, req.CafeID).Scan(&menuItems).Error
 		if err != nil {
 			fetchMenuErr = err
@@ -105,6 +105,23 @@ func (s *Server) UpgradeCart(c *fiber.Ctx) error {
 		})
 	}
 
+	// Never suggest an item that conflicts with the user's dietary profile
+	conflicts, err := s.cafeDietaryConflicts(req.CafeID, s.requestDietaryProfile(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch menu items",
+		})
+	}
+	if len(conflicts) > 0 {
+		suitable := make([]UpgradeCartResponse, 0, len(menuItems))
+		for _, item := range menuItems {
+			if _, ok := conflicts[item.ItemID]; !ok {
+				suitable = append(suitable, item)
+			}
+		}
+		menuItems = suitable
+	}
+
 	// Convert cart items & menu items to JSON for AI
 	cartJSON, _ := json.Marshal(cartItems)
 	menuJSON, _ := json.Marshal(menuItems)
@@ -28,33 +28,14 @@ func (s *Server) UpsellItem(c *fiber.Ctx) error {
 		})
 	}
 
-	// Fetch customizations related to the item
-	var customizations []structures.ItemCustomization
-	if err := s.Db.Where("menu_item_id = ?", itemId).Find(&customizations).Error; err != nil {
+	// Fetch customization groups and options of the item, in display order
+	groups, customizations, err := s.loadCustomizations(menuItem.ID)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch customizations",
 		})
 	}
-
-	// Group customizations by category
-	customizationMap := make(map[string][]structures.CustomizationItem)
-	for _, customization := range customizations {
-		item := structures.CustomizationItem{
-			ItemName:        customization.OptionName,
-			AdditionalCost:  customization.AdditionalCost,
-			CustomizationID: customization.ID,
-		}
-		customizationMap[customization.CustomizationType] = append(customizationMap[customization.CustomizationType], item)
-	}
-
-	// Convert map to structured response
-	var responseCategories []structures.CustomizationCategory
-	for category, items := range customizationMap {
-		responseCategories = append(responseCategories, structures.CustomizationCategory{
-			Category: category,
-			Items:    items,
-		})
-	}
+	responseCategories := customizationCategories(groups, customizations)
 
 	// Construct response
 	response := structures.CustomizationResponse{
@@ -31,7 +31,9 @@ func (s *Server) GetUpsellAndCrossSell(c *fiber.Ctx) error {
 
 	// Fetch Upsells (Customizations)
 	var upsells []structures.ItemCustomization
-	err := s.Db.Where("menu_item_id = ?", itemId).Find(&upsells).Error
+	err := s.Db.Where("menu_item_id = ? AND archived_at IS NULL AND is_available = true", itemId).
+		Where("group_id IS NULL OR group_id IN (SELECT id FROM customization_groups WHERE archived_at IS NULL)").
+		Order("priority ASC, id ASC").Find(&upsells).Error
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch upsells",
@@ -59,7 +61,7 @@ func (s *Server) GetUpsellAndCrossSell(c *fiber.Ctx) error {
 			cs.priority
 		FROM cross_sells cs
 		JOIN menu_items mi ON cs.cross_sell_item_id = mi.id
-		WHERE cs.base_item_id = ?
+		WHERE cs.base_item_id = ? AND cs.archived_at IS NULL AND mi.archived_at IS NULL
 		ORDER BY cs.priority DESC
 	`, itemId).Scan(&crossSells).Error
 	if err != nil {
@@ -0,0 +1,29 @@
+package structures
+
+type OperatingWindowRequest struct {
+	DayOfWeek int    `json:"day_of_week"`
+	OpenTime  string `json:"open_time"`
+	CloseTime string `json:"close_time"`
+}
+
+// SetOperatingHoursRequest replaces the whole weekly schedule of a cafe
+type SetOperatingHoursRequest struct {
+	Timezone string                   `json:"timezone"`
+	Hours    []OperatingWindowRequest `json:"hours"`
+}
+
+type HolidayRequest struct {
+	ID        uint   `json:"id"`
+	Date      string `json:"date"` // 2006-01-02
+	IsClosed  bool   `json:"is_closed"`
+	OpenTime  string `json:"open_time"`
+	CloseTime string `json:"close_time"`
+	Reason    string `json:"reason"`
+}
+
+// UnavailableItem explains why an item in a cart cannot be ordered
+type UnavailableItem struct {
+	ItemID uint   `json:"item_id"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,51 @@
+package structures
+
+// BrowseMenuRequest filters the menu of a cafe. Values within one filter are
+// alternatives, except dietary labels and tags which must all be present.
+// Different filters are combined.
+type BrowseMenuRequest struct {
+	CafeID       uint     `json:"cafe_id"`
+	MinPrice     *float64 `json:"min_price"`
+	MaxPrice     *float64 `json:"max_price"`
+	CMCategories []string `json:"cm_categories"`
+	Cuisines     []string `json:"cuisines"`
+	SpiceLevels  []string `json:"spice_levels"`
+	FoodTypes    []string `json:"food_types"`
+	Dietary      []string `json:"dietary"`
+	Tags         []string `json:"tags"`
+	MinRating    *float64 `json:"min_rating"`
+	MaxPrepTime  *int     `json:"max_prep_time"` // Minutes
+	Sort         string   `json:"sort"`          // popularity, rating, price_asc, price_desc, prep_time or name
+	Cursor       string   `json:"cursor"`        // next_cursor of the previous page
+	Limit        int      `json:"limit"`
+}
+
+// FacetCount is how many items would match if the value was selected
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// PriceRange is the price span of the items matching every other filter
+type PriceRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+type BrowseFacets struct {
+	CMCategory []FacetCount `json:"cm_category"`
+	Cuisine    []FacetCount `json:"cuisine"`
+	SpiceLevel []FacetCount `json:"spice_level"`
+	FoodType   []FacetCount `json:"food_type"`
+	Dietary    []FacetCount `json:"dietary"`
+	Tag        []FacetCount `json:"tag"`
+	Price      PriceRange   `json:"price"`
+}
+
+type BrowseMenuResponse struct {
+	Items            []MenuItem        `json:"items"`
+	Total            int               `json:"total"`
+	NextCursor       string            `json:"next_cursor,omitempty"`
+	Facets           BrowseFacets      `json:"facets"`
+	DietaryConflicts map[uint][]string `json:"dietary_conflicts"`
+}
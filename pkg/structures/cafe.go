@@ -0,0 +1,24 @@
+package structures
+
+// CafeSettingsRequest updates the regional settings of a cafe. Empty fields
+// are left unchanged.
+type CafeSettingsRequest struct {
+	Timezone        string `json:"timezone"`
+	Currency        string `json:"currency"`
+	Locale          string `json:"locale"`
+	MenuLanguage    string `json:"menu_language"`
+	MorningEndsAt   string `json:"morning_ends_at"`
+	AfternoonEndsAt string `json:"afternoon_ends_at"`
+}
+
+// PopularitySettingsRequest changes the popularity thresholds of a cafe.
+// Zero fields are left unchanged.
+type PopularitySettingsRequest struct {
+	HalfLifeDays         float64 `json:"half_life_days"`
+	BestsellerTopPercent float64 `json:"bestseller_top_percent"`
+	BestsellerMinOrders  int     `json:"bestseller_min_orders"`
+	TrendingMinOrders    int     `json:"trending_min_orders"`
+	TrendingGrowth       float64 `json:"trending_growth"`
+	BestRatedMinRating   float64 `json:"best_rated_min_rating"`
+	BestRatedMinRatings  int     `json:"best_rated_min_ratings"`
+}
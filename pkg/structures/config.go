@@ -12,4 +12,45 @@ type Config struct {
 	TWILIO_SERVICES_ID string `json:"TWILIO_SERVICES_ID"`
 	OPEN_AI_API_KEY    string `json:"OPEN_AI_API_KEY"`
 	JWT_SECRET         string `json:"JWT_SECRET"`
+	QR_SECRET          string `json:"QR_SECRET"`
+	QR_BASE_URL        string `json:"QR_BASE_URL"`
+	API_BASE_URL       string `json:"API_BASE_URL"` // Public URL of this API, used in upload URLs
+
+	SESSION_IDLE_MINUTES        string `json:"SESSION_IDLE_MINUTES"`
+	SESSION_PAID_GRACE_MINUTES  string `json:"SESSION_PAID_GRACE_MINUTES"`
+	TABLE_CODE_ROTATION_MINUTES string `json:"TABLE_CODE_ROTATION_MINUTES"`
+	TABLE_CODE_MAX_ATTEMPTS     string `json:"TABLE_CODE_MAX_ATTEMPTS"`
+	TABLE_CODE_LOCK_MINUTES     string `json:"TABLE_CODE_LOCK_MINUTES"`
+
+	TTS_PROVIDER string `json:"TTS_PROVIDER"` // stub or openai
+	TTS_VOICE    string `json:"TTS_VOICE"`
+
+	REVIEW_CLASSIFIER string `json:"REVIEW_CLASSIFIER"` // wordlist or openai
+	FEEDBACK_ANALYSER string `json:"FEEDBACK_ANALYSER"` // lexicon or openai
+
+	STORAGE_DRIVER       string `json:"STORAGE_DRIVER"` // local or s3
+	LOCAL_STORAGE_DIR    string `json:"LOCAL_STORAGE_DIR"`
+	LOCAL_STORAGE_URL    string `json:"LOCAL_STORAGE_URL"`
+	S3_ENDPOINT          string `json:"S3_ENDPOINT"`
+	S3_REGION            string `json:"S3_REGION"`
+	S3_BUCKET            string `json:"S3_BUCKET"`
+	S3_ACCESS_KEY_ID     string `json:"S3_ACCESS_KEY_ID"`
+	S3_SECRET_ACCESS_KEY string `json:"S3_SECRET_ACCESS_KEY"`
+	S3_PUBLIC_URL        string `json:"S3_PUBLIC_URL"`
+
+	FEEDBACK_LINK_URL             string `json:"FEEDBACK_LINK_URL"` // App page opened by feedback prompts
+	FEEDBACK_PROMPT_DELAY_MINUTES string `json:"FEEDBACK_PROMPT_DELAY_MINUTES"`
+	QUIET_HOURS_START             string `json:"QUIET_HOURS_START"` // Local time of the cafe, e.g. 22:00
+	QUIET_HOURS_END               string `json:"QUIET_HOURS_END"`
+
+	FIREBASE_AUTH_KEY string `json:"FIREBASE_AUTH_KEY"` // Base64 service account JSON
+	SMTP_HOST         string `json:"SMTP_HOST"`
+	SMTP_PORT         string `json:"SMTP_PORT"`
+	SMTP_USERNAME     string `json:"SMTP_USERNAME"`
+	SMTP_PASSWORD     string `json:"SMTP_PASSWORD"`
+	SMTP_FROM         string `json:"SMTP_FROM"`
+	WEBHOOK_SECRET    string `json:"WEBHOOK_SECRET"` // Signs webhook notifications
+
+	SMS_PROVIDER string `json:"SMS_PROVIDER"` // log or twilio
+	TWILIO_FROM  string `json:"TWILIO_FROM"`  // Sender of SMS, the Twilio account is shared with OTP
 }
@@ -22,6 +22,15 @@ const (
 	Inactive SessionStatus = "Inactive"
 )
 
+// SessionEndReason Enum
+type SessionEndReason string
+
+const (
+	SessionEndedManually SessionEndReason = "Manual"
+	SessionEndedIdle     SessionEndReason = "IdleTimeout"
+	SessionEndedBillPaid SessionEndReason = "BillPaid"
+)
+
 type CartInsertType string
 
 const (
@@ -173,6 +182,10 @@ type User struct {
 	TermsAccepted bool      `gorm:"default:false" json:"terms_accepted"`
 	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	PushToken             string `gorm:"type:varchar(255)" json:"-"`                    // Push token of the guest app
+	PushTokenProvider     string `gorm:"type:varchar(10)" json:"-"`                     // fcm or expo, the service that issued PushToken
+	FeedbackPromptsOptOut bool   `gorm:"default:false" json:"feedback_prompts_opt_out"` // No feedback prompts after visits
 }
 
 type TermsAndConditions struct {
@@ -182,6 +195,13 @@ type TermsAndConditions struct {
 	UserID     uint      `gorm:"not null" json:"user_id"`
 }
 
+// Preference types read by the dietary profile
+const (
+	PreferenceAllergen      = "allergen"       // An allergen to exclude
+	PreferenceDietary       = "dietary"        // A dietary label every item must have
+	PreferenceConflictsMode = "conflicts_mode" // "hide" or "flag"
+)
+
 type Preference struct {
 	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
 	UserID          uint      `gorm:"not null" json:"user_id"`
@@ -192,63 +212,92 @@ type Preference struct {
 }
 
 type MenuItem struct {
-	ID               uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	CafeID           uint           `gorm:"not null" json:"cafe_id"`
-	Category         string         `gorm:"type:varchar(50);not null" json:"category"`
-	CategoryID       uint           `gorm:"type:int" json:"category_id"` // Foreign key to Category table
-	Name             string         `gorm:"type:varchar(100);not null" json:"name"`
-	Description      string         `gorm:"type:text" json:"description"`
-	ShortDescription string         `gorm:"type:varchar(255)" json:"short_description"`
-	Price            float64        `gorm:"type:decimal(10,2);not null" json:"price"`
-	IsCustomizable   bool           `gorm:"default:false" json:"is_customizable"`
-	FoodType         string         `gorm:"type:varchar(10);not null" json:"food_type"`
-	Cuisine          Cuisine        `gorm:"type:varchar(50)" json:"cuisine"`        // Cuisine as enum
-	DietaryLabels    DietaryLabel   `gorm:"type:varchar(50)" json:"dietary_labels"` // Dietary label as enum
-	SpiceLevel       SpiceLevel     `gorm:"type:varchar(20)" json:"spice_level"`    // Spice level as enum
-	CMCategory       CMCategory     `gorm:"type:varchar(50)" json:"cm_category"`    // CM Category as enum
-	Ingredients      string         `gorm:"type:text" json:"ingredients"`
-	Allergens        datatypes.JSON `gorm:"type:jsonb" json:"allergens"`
-	ServingSize      string         `gorm:"type:varchar(50)" json:"serving_size"`
-	Calories         int            `gorm:"type:int" json:"calories"`
-	PreparationTime  int            `gorm:"type:int" json:"preparation_time"`
-	Discount         float64        `gorm:"type: decimal(5,2); default:0.0" json:"discount"`
-	DiscountSection  string         `gorm:"type:varchar(255)" json:"discount_section"`
-	PopularityScore  float64        `gorm:"default:0.0" json:"popularity_score"`
-	ImageURL         string         `gorm:"type:varchar(255)" json:"image_url"`
-	VideoUrl         string         `gorm:"type:varchar(255)" json:"video_url"`
-	AvailableFrom    string         `gorm:"type:varchar(255)" json:"available_from"`
-	AvailableTill    string         `gorm:"type:varchar(255)" json:"available_till"`
-	AvailableAllDay  string         `gorm:"type:varchar(255)" json:"available_all_day"`
-	IsAvailable      bool           `gorm:"default:true" json:"is_available"`
-	KitchenArea      string         `gorm:"type:varchar(255)" json:"kitchen_area"`
-	Tag              datatypes.JSON `gorm:"type:jsonb" json:"tag"`
-	AudioURL         string         `gorm:"type:varchar(255)" json:"audio_url"`
-	Rating           float64        `gorm:"default:0.0;not null" json:"rating"`
-	TotalRatings     int            `gorm:"default:0;not null" json:"total_ratings"`
-	CreatedAt        time.Time      `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt        time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeID            uint           `gorm:"not null" json:"cafe_id"`
+	Category          string         `gorm:"type:varchar(50);not null" json:"category"`
+	CategoryID        uint           `gorm:"type:int" json:"category_id"` // Foreign key to Category table
+	Name              string         `gorm:"type:varchar(100);not null" json:"name"`
+	Description       string         `gorm:"type:text" json:"description"`
+	ShortDescription  string         `gorm:"type:varchar(255)" json:"short_description"`
+	Price             float64        `gorm:"type:decimal(10,2);not null" json:"price"`
+	IsCustomizable    bool           `gorm:"default:false" json:"is_customizable"`
+	FoodType          string         `gorm:"type:varchar(10);not null" json:"food_type"`
+	Cuisine           Cuisine        `gorm:"type:varchar(50)" json:"cuisine"`         // Cuisine as enum
+	DietaryLabels     DietaryLabel   `gorm:"type:varchar(255)" json:"dietary_labels"` // Comma separated dietary labels
+	SpiceLevel        SpiceLevel     `gorm:"type:varchar(20)" json:"spice_level"`     // Spice level as enum
+	CMCategory        CMCategory     `gorm:"type:varchar(50)" json:"cm_category"`     // CM Category as enum
+	Ingredients       string         `gorm:"type:text" json:"ingredients"`
+	Allergens         datatypes.JSON `gorm:"type:jsonb" json:"allergens"`
+	ServingSize       string         `gorm:"type:varchar(50)" json:"serving_size"`
+	Calories          int            `gorm:"type:int" json:"calories"`
+	PreparationTime   int            `gorm:"type:int" json:"preparation_time"`
+	Discount          float64        `gorm:"type: decimal(5,2); default:0.0" json:"discount"`
+	DiscountSection   string         `gorm:"type:varchar(255)" json:"discount_section"`
+	PopularityScore   float64        `gorm:"default:0.0" json:"popularity_score"`
+	ImageURL          string         `gorm:"type:varchar(255)" json:"image_url"`
+	VideoUrl          string         `gorm:"type:varchar(255)" json:"video_url"`
+	AvailableFrom     string         `gorm:"type:varchar(255)" json:"available_from"`
+	AvailableTill     string         `gorm:"type:varchar(255)" json:"available_till"`
+	AvailableAllDay   string         `gorm:"type:varchar(255)" json:"available_all_day"`
+	IsAvailable       bool           `gorm:"default:true" json:"is_available"`
+	KitchenArea       string         `gorm:"type:varchar(255)" json:"kitchen_area"`
+	Tag               datatypes.JSON `gorm:"type:jsonb" json:"tag"`
+	AudioURL          string         `gorm:"type:varchar(255)" json:"audio_url"`
+	AudioSourceHash   string         `gorm:"type:varchar(64)" json:"-"` // Hash of the narrated text, empty when the audio was set by hand
+	Rating            float64        `gorm:"default:0.0;not null" json:"rating"`
+	TotalRatings      int            `gorm:"default:0;not null" json:"total_ratings"`
+	RatingSum         int            `gorm:"default:0;not null" json:"-"`                 // Sum of all ratings, rating is derived from it
+	WeightedRating    float64        `gorm:"default:0.0;not null" json:"weighted_rating"` // Bayesian average, pulled towards the prior while there are few ratings
+	StockQuantity     *int           `gorm:"type:int" json:"stock_quantity"`              // Item level stock, nil when not tracked
+	LowStockThreshold int            `gorm:"default:0" json:"low_stock_threshold"`        // Alert when stock falls to this level
+	OutOfStock        bool           `gorm:"default:false" json:"out_of_stock"`           // Set when inventory made the item unavailable
+	ArchivedAt        *time.Time     `json:"archived_at"`                                 // Archived items are hidden from customers
+	CreatedAt         time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 type ItemCustomization struct {
-	ID                uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	MenuItemID        uint      `gorm:"not null" json:"menu_item_id"`
-	CustomizationType string    `gorm:"type:varchar(50);not null" json:"customization_type"`
-	OptionName        string    `gorm:"type:varchar(50);not null" json:"option_name"`
-	AdditionalCost    float64   `gorm:"type:decimal(10,2);default:0" json:"additional_cost"`
-	Priority          int       `gorm:"default:1" json:"priority"`
-	CreatedAt         time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	MenuItemID        uint       `gorm:"not null" json:"menu_item_id"`
+	CustomizationType string     `gorm:"type:varchar(50);not null" json:"customization_type"`
+	OptionName        string     `gorm:"type:varchar(50);not null" json:"option_name"`
+	AdditionalCost    float64    `gorm:"type:decimal(10,2);default:0" json:"additional_cost"`
+	Priority          int        `gorm:"default:1" json:"priority"`
+	GroupID           *uint      `gorm:"index" json:"group_id"` // Empty for options grouped only by CustomizationType
+	IsDefault         bool       `gorm:"default:false" json:"is_default"`
+	IsAvailable       bool       `gorm:"default:true" json:"is_available"`
+	ArchivedAt        *time.Time `json:"archived_at"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// CustomizationGroup is an ordered set of options of a menu item, e.g. Size
+// or Milk. A group with a parent option is a nested modifier that only applies
+// when that option is selected.
+type CustomizationGroup struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	MenuItemID     uint       `gorm:"not null;index" json:"menu_item_id"`
+	Name           string     `gorm:"type:varchar(50);not null" json:"name"`
+	Position       int        `gorm:"default:0" json:"position"`
+	IsRequired     bool       `gorm:"default:false" json:"is_required"`
+	MinSelections  int        `gorm:"default:0" json:"min_selections"`
+	MaxSelections  int        `gorm:"default:0" json:"max_selections"` // 0 means no limit
+	ParentOptionID *uint      `json:"parent_option_id"`
+	ArchivedAt     *time.Time `json:"archived_at"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 type CrossSell struct {
-	ID                uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	BaseItemID        uint      `gorm:"not null" json:"base_item_id"`
-	CrossSellItemID   uint      `gorm:"not null" json:"cross_sell_item_id"`
-	CrossSellCategory string    `gorm:"type:varchar(100)" json:"cross_sell_category"`
-	Priority          int       `gorm:"default:1" json:"priority"`
-	Description       string    `gorm:"type:text" json:"description"`
-	CreatedAt         time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	BaseItemID        uint       `gorm:"not null" json:"base_item_id"`
+	CrossSellItemID   uint       `gorm:"not null" json:"cross_sell_item_id"`
+	CrossSellCategory string     `gorm:"type:varchar(100)" json:"cross_sell_category"`
+	Priority          int        `gorm:"default:1" json:"priority"`
+	Description       string     `gorm:"type:text" json:"description"`
+	ArchivedAt        *time.Time `json:"archived_at"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 type CuratedCart struct {
@@ -287,6 +336,21 @@ type Session struct {
 	CreatedBy       uint          `gorm:"not null" json:"created_by"`
 	CreatedAt       time.Time     `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt       time.Time     `gorm:"autoUpdateTime" json:"updated_at"`
+
+	LastActivityAt     *time.Time       `json:"last_activity_at,omitempty"`
+	EndReason          SessionEndReason `gorm:"type:varchar(50)" json:"end_reason,omitempty"`
+	TableCodeRotatedAt *time.Time       `json:"-"`
+}
+
+// TableCodeAttempt counts the wrong table codes a user entered for a session,
+// so one guest guessing does not lock out the rest of the table.
+type TableCodeAttempt struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	SessionID   string     `gorm:"type:varchar(100);not null;unique_index:idx_table_code_attempt" json:"session_id"`
+	UserID      uint       `gorm:"not null;unique_index:idx_table_code_attempt" json:"user_id"`
+	Failures    int        `gorm:"not null" json:"failures"` // Since the last rotation or lockout
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 // User Sessions Table
@@ -334,6 +398,7 @@ type CartItem struct {
 	IsDelivered      bool           `gorm:"default:false" json:"is_delivered"`
 	KOTStatus        bool           `gorm:"default:false" json:"kot_status"`
 	DeliveredAt      *time.Time     `gorm:"type:time" json:"delivered_at"` // Changed to pointer for optional value
+	PriceSnapshotID  *uint          `json:"price_snapshot_id"`             // MenuItemPrice at the time the item was added
 	CreatedAt        time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt        time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -355,6 +420,7 @@ type Order struct {
 	OrderTime      time.Time     `gorm:"autoCreateTime" json:"order_time"`
 	IsMessageSent  bool          `gorm:"default:false" json:"is_message_sent"` // Indicates if a message has been sent to the user
 	CompletedTime  *time.Time    `json:"completed_time,omitempty"`
+	MenuVersionID  *uint         `json:"menu_version_id"` // Published menu version when the order was placed
 }
 
 type UpdateCartResult struct {
@@ -397,15 +463,25 @@ type MenuAIRecords struct {
 	UserResponse bool      `gorm:"default:false" json:"user_response"`
 }
 
+// ItemFeedback is the rating of an item by a user. A user rates an item once
+// per session.
 type ItemFeedback struct {
 	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID    uint      `gorm:"not null" json:"user_id"` // User who gave feedback
-	ItemID    uint      `gorm:"not null" json:"item_id"` // Item being rated
-	Rating    int       `gorm:"not null" json:"rating"`  // Rating (1-5)
-	SessionID string    `gorm:"not null" json:"session_id"`
+	UserID    uint      `gorm:"not null;unique_index:idx_item_feedback_user_session" json:"user_id"` // User who gave feedback
+	ItemID    uint      `gorm:"not null;unique_index:idx_item_feedback_user_session" json:"item_id"` // Item being rated
+	Rating    int       `gorm:"not null" json:"rating"`                                              // Rating (1-5)
+	SessionID string    `gorm:"not null;unique_index:idx_item_feedback_user_session" json:"session_id"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
 
+type ReviewStatus string
+
+const (
+	ReviewPending  ReviewStatus = "Pending"
+	ReviewApproved ReviewStatus = "Approved"
+	ReviewRejected ReviewStatus = "Rejected"
+)
+
 type CafeFeedback struct {
 	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
 	UserID      uint      `gorm:"not null" json:"user_id"`      // User who gave feedback
@@ -415,40 +491,138 @@ type CafeFeedback struct {
 	Review      string    `gorm:"type:text" json:"review"`      // Optional text review
 	SessionID   string    `gorm:"not null" json:"session_id"`
 	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	// Reviews are published once approved, automatically when the classifier
+	// finds nothing, otherwise by the owner. Only guests who ordered can review.
+	ReviewStatus     ReviewStatus `gorm:"type:varchar(20);index" json:"review_status,omitempty"` // Empty without a review
+	ModerationReason string       `gorm:"type:varchar(255)" json:"moderation_reason,omitempty"`
+	ModeratedAt      *time.Time   `json:"moderated_at,omitempty"`
+	OrderID          string       `gorm:"type:varchar(100)" json:"order_id,omitempty"` // Order of the reviewer in the session
+	OwnerReply       string       `gorm:"type:text" json:"owner_reply,omitempty"`
+	RepliedAt        *time.Time   `json:"replied_at,omitempty"`
+
+	// Set by the feedback analysis job, the topics are in FeedbackTopic
+	Sentiment      string     `gorm:"type:varchar(10)" json:"sentiment,omitempty"`
+	SentimentScore float64    `gorm:"default:0" json:"sentiment_score"` // -1 to 1
+	Analyser       string     `gorm:"type:varchar(50)" json:"-"`
+	AnalysedAt     *time.Time `gorm:"index" json:"analysed_at,omitempty"`
+	AnalysisTries  int        `gorm:"default:0" json:"-"` // Failed analyses, the review is skipped after a few
+	AnalysisError  string     `gorm:"type:varchar(255)" json:"-"`
+}
+
+type FeedbackPromptStatus string
+
+const (
+	PromptScheduled FeedbackPromptStatus = "Scheduled"
+	PromptSent      FeedbackPromptStatus = "Sent"
+	PromptSkipped   FeedbackPromptStatus = "Skipped" // Opted out, no way to reach the guest or feedback already given
+	PromptFailed    FeedbackPromptStatus = "Failed"
+)
+
+// FeedbackPrompt asks a guest for feedback once after a visit, by push when
+// the app registered a token, otherwise by SMS.
+type FeedbackPrompt struct {
+	ID          uint                 `gorm:"primaryKey;autoIncrement" json:"id"`
+	SessionID   string               `gorm:"type:varchar(100);not null;unique_index:idx_feedback_prompt_session_user" json:"session_id"`
+	UserID      uint                 `gorm:"not null;unique_index:idx_feedback_prompt_session_user" json:"user_id"`
+	CafeID      uint                 `gorm:"index;not null" json:"cafe_id"`
+	Token       string               `gorm:"type:varchar(64);unique_index;not null" json:"-"` // Identifies the prompt in its links
+	Status      FeedbackPromptStatus `gorm:"type:varchar(20);index;not null" json:"status"`
+	Channel     string               `gorm:"type:varchar(10)" json:"channel,omitempty"` // fcm or sms
+	DueAt       time.Time            `gorm:"index;not null" json:"due_at"`
+	Attempts    int                  `gorm:"default:0" json:"attempts"`
+	LastError   string               `gorm:"type:text" json:"last_error,omitempty"`
+	SentAt      *time.Time           `json:"sent_at,omitempty"`
+	OpenedAt    *time.Time           `json:"opened_at,omitempty"`
+	CompletedAt *time.Time           `json:"completed_at,omitempty"` // Feedback submitted for the session
+	CreatedAt   time.Time            `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// FeedbackTopic is a topic a review talks about and how it speaks of it
+type FeedbackTopic struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	FeedbackID uint   `gorm:"not null;unique_index:idx_feedback_topic" json:"feedback_id"`
+	CafeID     uint   `gorm:"index;not null" json:"cafe_id"`
+	Topic      string `gorm:"type:varchar(20);not null;unique_index:idx_feedback_topic" json:"topic"`
+	Sentiment  string `gorm:"type:varchar(10);not null" json:"sentiment"`
 }
 
 type Cafe struct {
-	ID           uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	CafeCode     string         `gorm:"type:varchar(255)" json:"cafe_code"`
-	Name         string         `gorm:"type:varchar(100);not null" json:"name"`
-	Address      string         `gorm:"type:varchar(255)" json:"address"`
-	City         string         `gorm:"type:varchar(100)" json:"city"`
-	State        string         `gorm:"type:varchar(100)" json:"state"`
-	Country      string         `gorm:"type:varchar(100)" json:"country"`
-	ZipCode      string         `gorm:"type:varchar(20)" json:"zip_code"`
-	Phone        string         `gorm:"type:varchar(20)" json:"phone"`
-	Email        datatypes.JSON `gorm:"type:jsonb" json:"email"`
-	OpeningTime  time.Time      `gorm:"type:time" json:"opening_time"`
-	ClosingTime  time.Time      `gorm:"type:time" json:"closing_time"`
-	Rating       float64        `gorm:"default:0.0" json:"rating"`
-	ImageURL     string         `gorm:"type:varchar(255)" json:"image_url"`
-	CompletePos  bool           `gorm:"default:false" json:"complete_pos"` // Indicates if the cafe has a complete POS setup
-	TotalRatings uint           `gorm:"default:0" json:"total_ratings"`
-	CreatedAt    time.Time      `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt    time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	ID              uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeCode        string         `gorm:"type:varchar(255)" json:"cafe_code"`
+	Name            string         `gorm:"type:varchar(100);not null" json:"name"`
+	Address         string         `gorm:"type:varchar(255)" json:"address"`
+	City            string         `gorm:"type:varchar(100)" json:"city"`
+	State           string         `gorm:"type:varchar(100)" json:"state"`
+	Country         string         `gorm:"type:varchar(100)" json:"country"`
+	ZipCode         string         `gorm:"type:varchar(20)" json:"zip_code"`
+	Phone           string         `gorm:"type:varchar(20)" json:"phone"`
+	Email           datatypes.JSON `gorm:"type:jsonb" json:"email"`
+	OpeningTime     time.Time      `gorm:"type:time" json:"opening_time"`
+	ClosingTime     time.Time      `gorm:"type:time" json:"closing_time"`
+	Rating          float64        `gorm:"default:0.0" json:"rating"`
+	ImageURL        string         `gorm:"type:varchar(255)" json:"image_url"`
+	CompletePos     bool           `gorm:"default:false" json:"complete_pos"` // Indicates if the cafe has a complete POS setup
+	TotalRatings    uint           `gorm:"default:0" json:"total_ratings"`
+	RatingSum       int            `gorm:"default:0;not null" json:"-"`
+	WeightedRating  float64        `gorm:"default:0.0;not null" json:"weighted_rating"`
+	Timezone        string         `gorm:"type:varchar(64);default:'Asia/Kolkata'" json:"timezone"`   // IANA timezone all cafe times are shown in
+	Currency        string         `gorm:"type:varchar(3);default:'INR'" json:"currency"`             // ISO 4217 currency code
+	Locale          string         `gorm:"type:varchar(16);default:'en-IN'" json:"locale"`            // BCP 47 locale used for formatting
+	MorningEndsAt   string         `gorm:"type:varchar(10);default:'12:00'" json:"morning_ends_at"`   // Curated carts switch from morning to noon
+	AfternoonEndsAt string         `gorm:"type:varchar(10);default:'17:00'" json:"afternoon_ends_at"` // Curated carts switch from noon to night
+	MenuLanguage    string         `gorm:"type:varchar(16)" json:"menu_language"`                     // Language the menu is written in, the locale's language when empty
+	MenuRevision    uint           `gorm:"default:0;not null" json:"menu_revision"`                   // Bumped on every menu change, part of the menu cache key
+	CreatedAt       time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
 func (Cafe) TableName() string {
 	return "cafes"
 }
 
+// CafeOperatingHours is one opening window in a cafe's weekly schedule. A day
+// may have several windows; a window closing before it opens runs past midnight.
+type CafeOperatingHours struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeID    uint      `gorm:"not null;index" json:"cafe_id"`
+	DayOfWeek int       `gorm:"not null" json:"day_of_week"` // 0 = Sunday ... 6 = Saturday
+	OpenTime  string    `gorm:"type:varchar(10);not null" json:"open_time"`
+	CloseTime string    `gorm:"type:varchar(10);not null" json:"close_time"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// CafeHoliday overrides the weekly schedule on a given date, either closing
+// the cafe for the day or replacing its hours.
+type CafeHoliday struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeID    uint      `gorm:"not null;index" json:"cafe_id"`
+	Date      time.Time `gorm:"type:date;not null" json:"date"`
+	IsClosed  bool      `gorm:"default:true" json:"is_closed"`
+	OpenTime  string    `gorm:"type:varchar(10)" json:"open_time"`
+	CloseTime string    `gorm:"type:varchar(10)" json:"close_time"`
+	Reason    string    `gorm:"type:varchar(255)" json:"reason"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type SeatingArea struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string    `gorm:"type:varchar(100);not null" json:"name"`
+	Description string    `gorm:"type:text" json:"description"`
+	CafeID      uint      `gorm:"not null;index" json:"cafe_id"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
 type Table struct {
 	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
 	Name          string    `gorm:"type:varchar(100);not null" json:"name"`
 	Description   string    `gorm:"type:text" json:"description"`
-	CafeID        uint      `gorm:"not null" json:"cafe_id"`
+	CafeID        uint      `gorm:"not null;index" json:"cafe_id"`
 	Capacity      uint      `gorm:"not null" json:"capacity"`
 	SeatingAreaID uint      `gorm:"not null" json:"seating_area_id"`
+	QRVersion     uint      `gorm:"default:1" json:"qr_version"` // Bumped to invalidate previously printed QR codes
 	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -492,15 +666,65 @@ type CafeAdvertisementClick struct {
 	ClickedCancel   bool      `gorm:"default:false" json:"clicked_cancel"` // Indicates if the user clicked cancel on the ad
 }
 
+// FcmToken is the push token of a staff device. Despite the name it holds
+// Expo tokens too, Provider tells them apart.
 type FcmToken struct {
 	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID    uint      `gorm:"not null" json:"user_id"`
-	Token     string    `gorm:"type:varchar(255);not null" json:"token"`
-	CafeID    uint      `gorm:"not null" json:"cafe_id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"` // AdminUser the device belongs to
+	Token     string    `gorm:"type:varchar(255);not null;unique_index" json:"token"`
+	Provider  string    `gorm:"type:varchar(10);not null;default:'fcm'" json:"provider"` // fcm or expo
+	DeviceID  string    `gorm:"type:varchar(100)" json:"device_id,omitempty"`            // Set by the app, replaces older tokens of the device
+	CafeID    uint      `gorm:"not null;index" json:"cafe_id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"` // Last registered or refreshed
+}
+
+// NotificationChannel is a way a cafe wants to be notified. Push channels
+// deliver to the staff devices of the cafe, the others to Target: a phone
+// number, email address or webhook URL. Cafes without channels get Expo push.
+type NotificationChannel struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeID    uint      `gorm:"index;not null" json:"cafe_id"`
+	Channel   string    `gorm:"type:varchar(20);not null" json:"channel"`
+	Target    string    `gorm:"type:varchar(255)" json:"target"`
+	Events    string    `gorm:"type:varchar(255)" json:"events"` // Comma separated, empty for every event
+	Enabled   bool      `gorm:"default:true" json:"enabled"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
 
+// NotificationTemplate replaces the default message of an event for a cafe
+type NotificationTemplate struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeID    uint      `gorm:"not null;unique_index:idx_notification_template_event" json:"cafe_id"`
+	Event     string    `gorm:"type:varchar(50);not null;unique_index:idx_notification_template_event" json:"event"`
+	Title     string    `gorm:"type:varchar(255)" json:"title"`
+	Body      string    `gorm:"type:text" json:"body"`
+	URL       string    `gorm:"type:varchar(500)" json:"url"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliverySent    DeliveryStatus = "Sent"
+	DeliveryFailed  DeliveryStatus = "Failed"
+	DeliveryInvalid DeliveryStatus = "Invalid" // The recipient no longer exists and was removed
+)
+
+// NotificationDelivery logs every message sent to one recipient
+type NotificationDelivery struct {
+	ID        uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeID    uint           `gorm:"index;not null" json:"cafe_id"`
+	Event     string         `gorm:"type:varchar(50);not null" json:"event"`
+	Channel   string         `gorm:"type:varchar(20);not null" json:"channel"`
+	Recipient string         `gorm:"type:varchar(255)" json:"recipient"`
+	Status    DeliveryStatus `gorm:"type:varchar(20);not null" json:"status"`
+	Attempts  int            `gorm:"not null" json:"attempts"`
+	Error     string         `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt time.Time      `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
 type RewardTransaction struct {
 	ID              uint       `gorm:"primaryKey;autoIncrement" json:"id"`
 	UserID          uint       `gorm:"not null" json:"user_id"`
@@ -508,8 +732,9 @@ type RewardTransaction struct {
 	SessionID       string     `gorm:"type:varchar(100);not null" json:"session_id"`
 	TransactionType string     `gorm:"type:varchar(20);not null;check:transaction_type IN ('credited','redeemed','expired')" json:"transaction_type"`
 	Mustaches       uint       `gorm:"not null;default:0" json:"mustaches"`
-	EarnedDate      *time.Time `gorm:"type:timestamp" json:"earned_date"` // only for credits
-	SpentDate       *time.Time `gorm:"type:timestamp" json:"spent_date"`  // only for redemptions
+	EarnedDate      *time.Time `gorm:"type:timestamp" json:"earned_date"`                        // only for credits
+	SpentDate       *time.Time `gorm:"type:timestamp" json:"spent_date"`                         // only for redemptions
+	OrderID         *string    `gorm:"type:varchar(100);unique_index" json:"order_id,omitempty"` // Order a credit was earned with
 	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -536,13 +761,27 @@ type ItemFavorite struct {
 }
 
 type Category struct {
-	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name        string    `gorm:"type:varchar(100);not null" json:"name"`
-	Description string    `gorm:"type:text" json:"description"`
-	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
-	CafeID      uint      `gorm:"not null" json:"cafe_id"`
-	Counter     uint      `gorm:"default:0" json:"counter"`
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name           string     `gorm:"type:varchar(100);not null" json:"name"`
+	Description    string     `gorm:"type:text" json:"description"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	CafeID         uint       `gorm:"not null" json:"cafe_id"`
+	Counter        uint       `gorm:"default:0" json:"counter"` // Items added to carts, all time
+	PinnedPosition *int       `json:"pinned_position"`          // Set by the owner, pinned categories lead the menu in this order
+	ArchivedAt     *time.Time `json:"archived_at"`
+}
+
+// CategoryPopularity counts the items of a category added to carts per local
+// day and time of day. Rows are upserted atomically, so concurrent adds never
+// lose a count.
+type CategoryPopularity struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeID     uint      `gorm:"index;not null" json:"cafe_id"`
+	CategoryID uint      `gorm:"not null;unique_index:idx_category_popularity" json:"category_id"`
+	Day        time.Time `gorm:"type:date;not null;unique_index:idx_category_popularity" json:"day"`
+	TimeOfDay  TimeOfDay `gorm:"type:varchar(50);not null;unique_index:idx_category_popularity" json:"time_of_day"`
+	Adds       int       `gorm:"not null;default:0" json:"adds"`
 }
 
 type AdminUser struct {
@@ -558,3 +797,208 @@ type AdminUser struct {
 	AddedBy     uint      `gorm:"column:added_by" json:"added_by"`
 	Status      string    `gorm:"type:varchar(20);not null;default:'active'" json:"status"` // e.g. "active"/"inactive"
 }
+
+// Ingredient is a stock-tracked ingredient of a cafe
+type Ingredient struct {
+	ID                uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeID            uint      `gorm:"not null;index" json:"cafe_id"`
+	Name              string    `gorm:"type:varchar(100);not null" json:"name"`
+	Unit              string    `gorm:"type:varchar(20)" json:"unit"` // e.g. g, ml, pcs
+	StockQuantity     float64   `gorm:"type:decimal(12,3);default:0" json:"stock_quantity"`
+	LowStockThreshold float64   `gorm:"type:decimal(12,3);default:0" json:"low_stock_threshold"`
+	CreatedAt         time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// RecipeItem is the quantity of an ingredient used by one portion of a menu item
+type RecipeItem struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	MenuItemID   uint      `gorm:"not null;index" json:"menu_item_id"`
+	IngredientID uint      `gorm:"not null;index" json:"ingredient_id"`
+	Quantity     float64   `gorm:"type:decimal(12,3);not null" json:"quantity"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type InventoryChangeReason string
+
+const (
+	InventoryOrder   InventoryChangeReason = "Order"
+	InventoryRestock InventoryChangeReason = "Restock"
+	InventoryAdjust  InventoryChangeReason = "Adjustment"
+)
+
+// InventoryTransaction records every change to item or ingredient stock
+type InventoryTransaction struct {
+	ID           uint                  `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeID       uint                  `gorm:"not null;index" json:"cafe_id"`
+	MenuItemID   *uint                 `json:"menu_item_id"`
+	IngredientID *uint                 `json:"ingredient_id"`
+	Change       float64               `gorm:"type:decimal(12,3);not null" json:"change"`
+	Balance      float64               `gorm:"type:decimal(12,3)" json:"balance"`
+	Reason       InventoryChangeReason `gorm:"type:varchar(20);not null" json:"reason"`
+	OrderID      string                `gorm:"type:varchar(100)" json:"order_id"`
+	CreatedAt    time.Time             `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type MenuVersionStatus string
+
+const (
+	MenuVersionDraft      MenuVersionStatus = "Draft"
+	MenuVersionScheduled  MenuVersionStatus = "Scheduled"
+	MenuVersionPublished  MenuVersionStatus = "Published"
+	MenuVersionSuperseded MenuVersionStatus = "Superseded"
+)
+
+// MenuVersion is a complete menu of a cafe. Drafts are edited freely, then
+// published now or at PublishAt. Only one version per cafe is published.
+type MenuVersion struct {
+	ID               uint              `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeID           uint              `gorm:"not null;unique_index:idx_menu_version_number" json:"cafe_id"`
+	Number           uint              `gorm:"not null;unique_index:idx_menu_version_number" json:"number"`
+	Status           MenuVersionStatus `gorm:"type:varchar(20);not null" json:"status"`
+	Note             string            `gorm:"type:text" json:"note"`
+	Menu             datatypes.JSON    `gorm:"type:jsonb" json:"menu,omitempty"` // MenuDocument
+	PublishAt        *time.Time        `json:"publish_at"`
+	PublishedAt      *time.Time        `json:"published_at"`
+	PublishError     string            `gorm:"type:text" json:"publish_error"` // Set when a scheduled publish failed
+	RolledBackFromID *uint             `json:"rolled_back_from_id"`
+	CreatedAt        time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// MenuItemPrice is the name and price of a menu item for a span of time. Cart
+// items point at the snapshot that was current when they were added.
+type MenuItemPrice struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeID        uint       `gorm:"not null;index" json:"cafe_id"`
+	MenuItemID    uint       `gorm:"not null;index" json:"menu_item_id"`
+	MenuVersionID *uint      `json:"menu_version_id"` // Empty for changes made outside a published version
+	Name          string     `gorm:"type:varchar(100);not null" json:"name"`
+	Price         float64    `gorm:"type:decimal(10,2);not null" json:"price"`
+	EffectiveFrom time.Time  `gorm:"not null" json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to"` // Empty while the price is current
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type LabelKind string
+
+const (
+	LabelDietary  LabelKind = "dietary"
+	LabelTag      LabelKind = "tag"
+	LabelAllergen LabelKind = "allergen"
+)
+
+// Label is a dietary label, tag or allergen shared by the menu items of every cafe
+type Label struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Kind      LabelKind `gorm:"type:varchar(20);not null;unique_index:idx_label_kind_name" json:"kind"`
+	Name      string    `gorm:"type:varchar(100);not null;unique_index:idx_label_kind_name" json:"name"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// MenuItemLabel links a menu item to a label. It is rebuilt from the item's
+// dietary_labels, tag and allergens columns whenever the menu is saved.
+type MenuItemLabel struct {
+	MenuItemID uint `gorm:"primary_key;auto_increment:false" json:"menu_item_id"`
+	LabelID    uint `gorm:"primary_key;auto_increment:false;index:idx_menu_item_label_label" json:"label_id"`
+}
+
+// MenuItemTranslation is the content of a menu item in another language than
+// the cafe's menu language. Empty fields fall back to the item's own content.
+type MenuItemTranslation struct {
+	ID               uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	MenuItemID       uint      `gorm:"not null;unique_index:idx_menu_item_translation" json:"menu_item_id"`
+	Language         string    `gorm:"type:varchar(16);not null;unique_index:idx_menu_item_translation" json:"language"` // Lower case BCP 47 tag
+	Name             string    `gorm:"type:varchar(100)" json:"name"`
+	Description      string    `gorm:"type:text" json:"description"`
+	ShortDescription string    `gorm:"type:varchar(255)" json:"short_description"`
+	Ingredients      string    `gorm:"type:text" json:"ingredients"`
+	AudioURL         string    `gorm:"type:varchar(255)" json:"audio_url"`
+	AudioSourceHash  string    `gorm:"type:varchar(64)" json:"-"` // Hash of the narrated text, empty when the audio was set by hand
+	CreatedAt        time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type MediaKind string
+
+const (
+	MediaMenuItemImage    MediaKind = "menu_item_image"
+	MediaMenuItemVideo    MediaKind = "menu_item_video"
+	MediaCafeImage        MediaKind = "cafe_image"
+	MediaCuratedCartImage MediaKind = "curated_cart_image"
+	MediaPaymentImage     MediaKind = "payment_image"
+)
+
+type MediaStatus string
+
+const (
+	MediaPending MediaStatus = "Pending"
+	MediaReady   MediaStatus = "Ready"
+)
+
+// MediaAsset is a file uploaded for a menu item, cafe, curated cart or
+// session. It is created pending when the upload is signed and becomes ready
+// once the file is validated and stored, which also points the owner at it.
+type MediaAsset struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CafeID      uint           `gorm:"index;not null" json:"cafe_id"`
+	Kind        MediaKind      `gorm:"type:varchar(30);not null" json:"kind"`
+	OwnerID     string         `gorm:"type:varchar(100);not null" json:"owner_id"` // Menu item, cafe or curated cart id, or session id
+	Status      MediaStatus    `gorm:"type:varchar(20);not null" json:"status"`
+	ContentType string         `gorm:"type:varchar(50)" json:"content_type"`
+	Size        int            `json:"size"`
+	Width       int            `json:"width,omitempty"`
+	Height      int            `json:"height,omitempty"`
+	URL         string         `gorm:"type:varchar(255)" json:"url"`
+	OriginalURL string         `gorm:"type:varchar(255)" json:"original_url"`
+	Variants    datatypes.JSON `gorm:"type:jsonb" json:"variants,omitempty"` // map of variant name to MediaVariant
+	UploadedAt  *time.Time     `json:"uploaded_at"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// CafePopularitySettings are the thresholds the popularity job tags the items
+// of a cafe with. Cafes without a row use the defaults.
+type CafePopularitySettings struct {
+	CafeID               uint      `gorm:"primary_key;auto_increment:false" json:"cafe_id"`
+	HalfLifeDays         float64   `gorm:"not null" json:"half_life_days"`         // An order counts half as much after this many days
+	BestsellerTopPercent float64   `gorm:"not null" json:"bestseller_top_percent"` // Share of items ordered most in 30 days tagged bestseller
+	BestsellerMinOrders  int       `gorm:"not null" json:"bestseller_min_orders"`  // Orders in 30 days a bestseller needs at least
+	TrendingMinOrders    int       `gorm:"not null" json:"trending_min_orders"`    // Orders in the last 7 days a trending item needs at least
+	TrendingGrowth       float64   `gorm:"not null" json:"trending_growth"`        // Orders in the last 7 days over the 7 days before
+	BestRatedMinRating   float64   `gorm:"not null" json:"best_rated_min_rating"`  // Average rating out of 5
+	BestRatedMinRatings  int       `gorm:"not null" json:"best_rated_min_ratings"` // Ratings needed before the average counts
+	UpdatedAt            time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "Queued"
+	JobRunning JobStatus = "Running"
+	JobDone    JobStatus = "Done"
+	JobFailed  JobStatus = "Failed" // Gave up after the last attempt
+)
+
+// QueuedJob is a side effect of a request, run later by the job worker. The
+// payload is the JSON the handler of its kind expects.
+type QueuedJob struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Kind        string     `gorm:"type:varchar(50);index;not null" json:"kind"`
+	Payload     string     `gorm:"type:text;not null" json:"payload"`
+	Status      JobStatus  `gorm:"type:varchar(20);not null;index:idx_queued_job_claim" json:"status"`
+	RunAt       time.Time  `gorm:"not null;index:idx_queued_job_claim" json:"run_at"`
+	Attempts    int        `gorm:"default:0" json:"attempts"`
+	MaxAttempts int        `gorm:"not null" json:"max_attempts"`
+	LockedAt    *time.Time `json:"locked_at,omitempty"` // When a worker claimed it
+	LastError   string     `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// SchemaMigration records a one-time data migration that has been applied
+type SchemaMigration struct {
+	Name      string    `gorm:"primaryKey;type:varchar(100)" json:"name"`
+	AppliedAt time.Time `gorm:"not null" json:"applied_at"`
+}
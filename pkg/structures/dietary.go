@@ -0,0 +1,14 @@
+package structures
+
+type DietaryProfileRequest struct {
+	Allergens     []string `json:"allergens"`
+	Dietary       []string `json:"dietary"`
+	HideConflicts bool     `json:"hide_conflicts"`
+}
+
+// DietaryWarning flags an item that conflicts with the user's dietary profile
+type DietaryWarning struct {
+	ItemID    uint     `json:"item_id"`
+	Name      string   `json:"name"`
+	Conflicts []string `json:"conflicts"`
+}
@@ -0,0 +1,37 @@
+package structures
+
+type IngredientRequest struct {
+	ID                uint    `json:"id"`
+	Name              string  `json:"name"`
+	Unit              string  `json:"unit"`
+	StockQuantity     float64 `json:"stock_quantity"`
+	LowStockThreshold float64 `json:"low_stock_threshold"`
+}
+
+type RecipeIngredient struct {
+	IngredientID uint    `json:"ingredient_id"`
+	Quantity     float64 `json:"quantity"`
+}
+
+// SetRecipeRequest replaces the recipe of a menu item
+type SetRecipeRequest struct {
+	MenuItemID  uint               `json:"menu_item_id"`
+	Ingredients []RecipeIngredient `json:"ingredients"`
+}
+
+// SetItemStockRequest starts or stops item level stock tracking. A nil
+// stock_quantity stops tracking.
+type SetItemStockRequest struct {
+	MenuItemID        uint `json:"menu_item_id"`
+	StockQuantity     *int `json:"stock_quantity"`
+	LowStockThreshold int  `json:"low_stock_threshold"`
+}
+
+// RestockRequest adds stock to an ingredient or a menu item. With Set the
+// quantity replaces the current stock instead.
+type RestockRequest struct {
+	IngredientID uint    `json:"ingredient_id"`
+	MenuItemID   uint    `json:"menu_item_id"`
+	Quantity     float64 `json:"quantity"`
+	Set          bool    `json:"set"`
+}
@@ -0,0 +1,32 @@
+package structures
+
+// MediaUploadRequest asks for a signed upload. OwnerID is the menu item or
+// curated cart the file is for, it is ignored for cafe images.
+type MediaUploadRequest struct {
+	Kind        MediaKind `json:"kind"`
+	OwnerID     uint      `json:"owner_id"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+}
+
+type PaymentImageUploadRequest struct {
+	SessionID   string `json:"session_id"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+}
+
+// MediaUploadPayload is the signed content of an upload token
+type MediaUploadPayload struct {
+	AssetID   uint  `json:"asset_id"`
+	CafeID    uint  `json:"cafe_id"`
+	ExpiresAt int64 `json:"expires_at"` // Unix seconds
+}
+
+// MediaVariant is one resized version of an uploaded image, in its original
+// format and as WebP.
+type MediaVariant struct {
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	URL     string `json:"url"`
+	WebPURL string `json:"webp_url"`
+}
@@ -0,0 +1,146 @@
+package structures
+
+// Menu rows are the portable shape of menu data used by the admin API and by
+// bulk import/export. Rows are matched to existing records by id when given,
+// otherwise by name within the cafe.
+
+type MenuCategoryRow struct {
+	ID          uint   `json:"id,omitempty" csv:"id"`
+	Name        string `json:"name" csv:"name"`
+	Description string `json:"description" csv:"description"`
+	Counter     uint   `json:"counter" csv:"counter"`
+	Archived    bool   `json:"archived" csv:"archived"`
+}
+
+// CategoryPinsRequest lists the categories to pin, in menu order
+type CategoryPinsRequest struct {
+	CategoryIDs []uint `json:"category_ids"`
+}
+
+type MenuItemRow struct {
+	ID               uint    `json:"id,omitempty" csv:"id"`
+	Name             string  `json:"name" csv:"name"`
+	Category         string  `json:"category" csv:"category"`
+	Description      string  `json:"description" csv:"description"`
+	ShortDescription string  `json:"short_description" csv:"short_description"`
+	Price            float64 `json:"price" csv:"price"`
+	FoodType         string  `json:"food_type" csv:"food_type"`
+	Cuisine          string  `json:"cuisine" csv:"cuisine"`
+	DietaryLabels    string  `json:"dietary_labels" csv:"dietary_labels"` // Comma separated
+	Tags             string  `json:"tags" csv:"tags"`                     // Comma separated
+	Allergens        string  `json:"allergens" csv:"allergens"`           // Comma separated
+	SpiceLevel       string  `json:"spice_level" csv:"spice_level"`
+	CMCategory       string  `json:"cm_category" csv:"cm_category"`
+	Ingredients      string  `json:"ingredients" csv:"ingredients"`
+	ServingSize      string  `json:"serving_size" csv:"serving_size"`
+	Calories         int     `json:"calories" csv:"calories"`
+	PreparationTime  int     `json:"preparation_time" csv:"preparation_time"`
+	ImageURL         string  `json:"image_url" csv:"image_url"`
+	VideoURL         string  `json:"video_url" csv:"video_url"`
+	AvailableFrom    string  `json:"available_from" csv:"available_from"`
+	AvailableTill    string  `json:"available_till" csv:"available_till"`
+	AvailableAllDay  string  `json:"available_all_day" csv:"available_all_day"`
+	IsAvailable      *bool   `json:"is_available" csv:"is_available"` // Defaults to true for new items, unchanged when omitted
+	IsCustomizable   bool    `json:"is_customizable" csv:"is_customizable"`
+	KitchenArea      string  `json:"kitchen_area" csv:"kitchen_area"`
+	Archived         bool    `json:"archived" csv:"archived"`
+}
+
+// MenuCustomizationRow references its menu item by menu_item_id or by item name
+// MenuCustomizationRow takes its type from the group name when a group is given
+type MenuCustomizationRow struct {
+	ID             uint    `json:"id,omitempty" csv:"id"`
+	MenuItemID     uint    `json:"menu_item_id,omitempty" csv:"menu_item_id"`
+	Item           string  `json:"item" csv:"item"`
+	GroupID        uint    `json:"group_id,omitempty" csv:"group_id"`
+	Type           string  `json:"type" csv:"type"`
+	Option         string  `json:"option" csv:"option"`
+	AdditionalCost float64 `json:"additional_cost" csv:"additional_cost"`
+	Priority       int     `json:"priority" csv:"priority"`
+	IsDefault      bool    `json:"is_default" csv:"is_default"`
+	IsAvailable    *bool   `json:"is_available,omitempty" csv:"is_available"` // Unchanged when empty, true for new options
+	Archived       bool    `json:"archived" csv:"archived"`
+}
+
+// MenuCrossSellRow references both items by id or by name
+type MenuCrossSellRow struct {
+	ID              uint   `json:"id,omitempty" csv:"id"`
+	BaseItemID      uint   `json:"base_item_id,omitempty" csv:"base_item_id"`
+	BaseItem        string `json:"base_item" csv:"base_item"`
+	CrossSellItemID uint   `json:"cross_sell_item_id,omitempty" csv:"cross_sell_item_id"`
+	CrossSellItem   string `json:"cross_sell_item" csv:"cross_sell_item"`
+	Category        string `json:"category" csv:"category"`
+	Priority        int    `json:"priority" csv:"priority"`
+	Description     string `json:"description" csv:"description"`
+	Archived        bool   `json:"archived" csv:"archived"`
+}
+
+// MenuDocument is the full menu of a cafe as exported and imported in JSON
+type MenuDocument struct {
+	Categories     []MenuCategoryRow      `json:"categories"`
+	Items          []MenuItemRow          `json:"items"`
+	Customizations []MenuCustomizationRow `json:"customizations"`
+	CrossSells     []MenuCrossSellRow     `json:"cross_sells"`
+}
+
+const (
+	MenuEntityCategories     = "categories"
+	MenuEntityItems          = "items"
+	MenuEntityCustomizations = "customizations"
+	MenuEntityCrossSells     = "cross_sells"
+)
+
+// ImportMenuRequest carries either a JSON menu document or CSV content for a
+// single entity. With DryRun the changes are computed but not applied.
+type ImportMenuRequest struct {
+	Format  string        `json:"format"` // "json" (default) or "csv"
+	Entity  string        `json:"entity"` // Required for csv: categories, items, customizations or cross_sells
+	DryRun  bool          `json:"dry_run"`
+	Content string        `json:"content"`
+	Menu    *MenuDocument `json:"menu"`
+}
+
+type MenuRowError struct {
+	Entity  string `json:"entity"`
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type MenuFieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type MenuChange struct {
+	Entity  string                     `json:"entity"`
+	Action  string                     `json:"action"` // "create" or "update"
+	Key     string                     `json:"key"`
+	Changes map[string]MenuFieldChange `json:"changes,omitempty"`
+}
+
+type ImportMenuResponse struct {
+	DryRun    bool           `json:"dry_run"`
+	Applied   bool           `json:"applied"`
+	Created   int            `json:"created"`
+	Updated   int            `json:"updated"`
+	Unchanged int            `json:"unchanged"`
+	Changes   []MenuChange   `json:"changes"`
+	Errors    []MenuRowError `json:"errors"`
+}
+
+type ArchiveRequest struct {
+	ID       uint `json:"id"`
+	Archived bool `json:"archived"`
+}
+
+// ItemTranslationRequest saves the content of an item in one language
+type ItemTranslationRequest struct {
+	MenuItemID       uint   `json:"menu_item_id"`
+	Language         string `json:"language"`
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	ShortDescription string `json:"short_description"`
+	Ingredients      string `json:"ingredients"`
+	AudioURL         string `json:"audio_url"`
+}
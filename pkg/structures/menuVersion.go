@@ -0,0 +1,24 @@
+package structures
+
+// MenuDraftRequest creates or edits a draft menu version. Without a menu the
+// draft starts from the menu customers see right now.
+type MenuDraftRequest struct {
+	ID   uint          `json:"id"`
+	Note string        `json:"note"`
+	Menu *MenuDocument `json:"menu"`
+}
+
+// ScheduleMenuRequest schedules a draft for publishing. An empty PublishAt
+// takes the version back to draft.
+type ScheduleMenuRequest struct {
+	ID        uint   `json:"id"`
+	PublishAt string `json:"publish_at"` // RFC 3339
+}
+
+type MenuVersionRequest struct {
+	ID uint `json:"id"`
+}
+
+type PriceHistoryRequest struct {
+	MenuItemID uint `json:"menu_item_id"`
+}
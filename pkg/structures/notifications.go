@@ -0,0 +1,31 @@
+package structures
+
+type NotificationChannelRequest struct {
+	Channel string   `json:"channel"` // fcm, expo, sms, email or webhook
+	Target  string   `json:"target"`  // Phone, email or URL, empty for push
+	Events  []string `json:"events"`  // Empty for every event
+	Enabled *bool    `json:"enabled"` // Defaults to true
+}
+
+// SetNotificationChannelsRequest replaces every channel of the cafe
+type SetNotificationChannelsRequest struct {
+	Channels []NotificationChannelRequest `json:"channels"`
+}
+
+// NotificationTemplateRequest customises the message of an event, an empty
+// title and body restore the default.
+type NotificationTemplateRequest struct {
+	Event string `json:"event"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url"`
+}
+
+// DeviceTokenRequest registers the push token of a staff device. Refreshing
+// passes the token it replaces as old_token.
+type DeviceTokenRequest struct {
+	Token    string `json:"token"`
+	Provider string `json:"provider"`  // fcm or expo, guessed from the token when empty
+	DeviceID string `json:"device_id"` // Optional, older tokens of the device are removed
+	OldToken string `json:"old_token"`
+}
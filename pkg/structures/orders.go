@@ -44,6 +44,7 @@ type OrderResponse struct {
 	OrderedAt          time.Time        `json:"ordered_at"`
 	OrderTimeFormatted string           `json:"order_time_formatted"`
 	TotalAmount        float64          `json:"total_amount"`
+	TotalFormatted     string           `json:"total_formatted"`
 }
 
 // PlaceOrderRequest represents the request payload
@@ -73,16 +74,19 @@ type PlaceOrderResponse struct {
 // }
 
 type UserOrderSummary struct {
-	UserID   uint            `json:"user_id"`
-	UserName string          `json:"user_name"`
-	Total    float64         `json:"total"`
-	Discount float64         `json:"discount"`
-	Orders   []OrderResponse `json:"orders"`
+	UserID         uint            `json:"user_id"`
+	UserName       string          `json:"user_name"`
+	Total          float64         `json:"total"`
+	Discount       float64         `json:"discount"`
+	TotalFormatted string          `json:"total_formatted"`
+	Orders         []OrderResponse `json:"orders"`
 }
 
 type FinalResponse struct {
 	Timestamp            time.Time          `json:"timestamp"`
 	Users                []UserOrderSummary `json:"users"`
 	CumilativeOrderTotal float64            `json:"cumilative_order_total"`
+	CumilativeFormatted  string             `json:"cumilative_order_total_formatted"`
+	Currency             string             `json:"currency"`
 	Advertisement        *CafeAdvertisement `json:"advertisement,omitempty"`
 }
@@ -0,0 +1,36 @@
+package structures
+
+import "time"
+
+type ModerateReviewRequest struct {
+	ReviewID uint   `json:"review_id"`
+	Action   string `json:"action"` // approve or reject
+	Reason   string `json:"reason"`
+}
+
+// NotificationPreferencesRequest changes only the fields that are set
+type NotificationPreferencesRequest struct {
+	PushToken         *string `json:"push_token"`          // Empty to remove
+	PushTokenProvider string  `json:"push_token_provider"` // fcm or expo, found from the token when left out
+	FeedbackPrompts   *bool   `json:"feedback_prompts"`    // Ask for feedback after visits
+}
+
+// ReviewReplyRequest sets the public reply of the owner, an empty reply
+// removes it.
+type ReviewReplyRequest struct {
+	ReviewID uint   `json:"review_id"`
+	Reply    string `json:"reply"`
+}
+
+// CafeReview is a published review as shown to everyone
+type CafeReview struct {
+	ID          uint       `json:"id"`
+	Reviewer    string     `json:"reviewer"` // First name only
+	Rating      int        `json:"rating"`
+	WouldReturn int        `json:"would_return"`
+	Review      string     `json:"review"`
+	Verified    bool       `json:"verified"` // Tied to an order of the reviewer
+	OwnerReply  string     `json:"owner_reply,omitempty"`
+	RepliedAt   *time.Time `json:"replied_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
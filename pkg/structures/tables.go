@@ -0,0 +1,33 @@
+package structures
+
+type SeatingAreaRequest struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type TableRequest struct {
+	ID            uint   `json:"id"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Capacity      uint   `json:"capacity"`
+	SeatingAreaID uint   `json:"seating_area_id"`
+}
+
+// TableQRPayload is the signed content encoded in a table's QR code
+type TableQRPayload struct {
+	CafeID    uint   `json:"cafe_id"`
+	TableID   uint   `json:"table_id"`
+	TableName string `json:"table_name"`
+	Version   uint   `json:"version"`
+}
+
+type TableQRRequest struct {
+	TableID uint   `json:"table_id"`
+	Format  string `json:"format"` // "png" (default) or "svg"
+	Size    int    `json:"size"`   // PNG size in pixels
+}
+
+type ResolveTableQRRequest struct {
+	Payload string `json:"payload"`
+}
@@ -1,9 +1,15 @@
 package structures
 
-// CustomizationCategory groups customizations under a category
+// CustomizationCategory groups customizations under a category. Options
+// without a group are grouped by their type with no selection limits.
 type CustomizationCategory struct {
-	Category string              `json:"category"`
-	Items    []CustomizationItem `json:"items"`
+	Category       string              `json:"category"`
+	GroupID        uint                `json:"group_id,omitempty"`
+	IsRequired     bool                `json:"is_required"`
+	MinSelections  int                 `json:"min_selections"`
+	MaxSelections  int                 `json:"max_selections"` // 0 means no limit
+	ParentOptionID *uint               `json:"parent_option_id,omitempty"`
+	Items          []CustomizationItem `json:"items"`
 }
 
 // CustomizationItem represents an upsell option for a specific category
@@ -11,6 +17,27 @@ type CustomizationItem struct {
 	ItemName        string  `json:"item_name"`
 	AdditionalCost  float64 `json:"additional_cost"`
 	CustomizationID uint    `json:"customization_id"`
+	IsDefault       bool    `json:"is_default"`
+	IsAvailable     bool    `json:"is_available"`
+}
+
+type CustomizationGroupRequest struct {
+	ID             uint   `json:"id"`
+	MenuItemID     uint   `json:"menu_item_id"`
+	Name           string `json:"name"`
+	Position       int    `json:"position"`
+	IsRequired     bool   `json:"is_required"`
+	MinSelections  int    `json:"min_selections"`
+	MaxSelections  int    `json:"max_selections"`
+	ParentOptionID *uint  `json:"parent_option_id"`
+}
+
+// CustomizationError explains why a selection of options was rejected
+type CustomizationError struct {
+	GroupID         uint   `json:"group_id,omitempty"`
+	Group           string `json:"group,omitempty"`
+	CustomizationID uint   `json:"customization_id,omitempty"`
+	Message         string `json:"message"`
 }
 
 // CustomizationResponse represents the API response format